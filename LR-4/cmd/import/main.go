@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/catalog"
+	"smartdevices/internal/importer"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Загрузка каталога из CSV/JSON без очистки таблиц - те же правила, что у POST /api/smart-devices/import
+func main() {
+	dryRun := flag.Bool("dry-run", false, "только проверить файл, ничего не сохраняя")
+	format := flag.String("format", "", "csv или json; по умолчанию по расширению файла")
+	asJSON := flag.Bool("json", false, "вывести полный отчет в JSON")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Использование: import [-dry-run] [-format csv|json] [-json] <файл | ->")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	path := flag.Arg(0)
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		log.Fatal("Ошибка чтения файла:", err)
+	}
+
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if *format != catalog.FormatCSV && *format != catalog.FormatJSON {
+			*format = catalog.DetectFormat(data)
+		}
+	}
+	lines, err := catalog.ReadRecords(*format, data)
+	if err != nil {
+		log.Fatal("Ошибка разбора файла: ", err)
+	}
+
+	// Подключение к PostgreSQL
+	dsn := "host=localhost user=root password=root dbname=RIP port=5433 sslmode=disable"
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		log.Fatal("Ошибка подключения к БД:", err)
+	}
+
+	report, err := importer.Run(db, lines, importer.Options{DryRun: *dryRun, DevicePayload: serializers.SmartDevicePayload})
+	if err != nil {
+		log.Fatal("Ошибка импорта: ", err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		for _, line := range report.Lines {
+			switch line.Action {
+			case importer.ActionError:
+				fmt.Printf("❌ строка %d (%s): %s\n", line.Line, line.Model, strings.Join(line.Errors, "; "))
+			case importer.ActionUpdate:
+				fmt.Printf("✏️ строка %d (%s): обновление %s\n", line.Line, line.Model, strings.Join(line.Changes, ", "))
+			case importer.ActionCreate:
+				fmt.Printf("➕ строка %d (%s): новое устройство\n", line.Line, line.Model)
+			}
+		}
+		fmt.Printf("📊 Создано: %d, обновлено: %d, без изменений: %d, ошибок: %d\n",
+			report.Created, report.Updated, report.Unchanged, report.Failed)
+	}
+
+	switch {
+	case report.Failed > 0:
+		fmt.Fprintln(os.Stderr, "⚠️ Файл содержит ошибки - ничего не сохранено")
+		os.Exit(1)
+	case report.DryRun:
+		fmt.Fprintln(os.Stderr, "🔍 Проверка завершена (dry-run) - ничего не сохранено")
+	default:
+		fmt.Fprintln(os.Stderr, "✅ Импорт завершен")
+	}
+}
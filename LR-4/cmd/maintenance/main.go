@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	apiHandlers "smartdevices/internal/api/handlers"
+	"smartdevices/internal/events"
+	"smartdevices/internal/maintenance"
+	"smartdevices/internal/notifications"
+	"smartdevices/internal/session"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Разовый запуск задач обслуживания (например, из cron) вместо фонового планировщика сервера
+func main() {
+	draftTTL := flag.Duration("draft-ttl", 30*24*time.Hour, "через сколько простоя черновик удаляется")
+	warnBefore := flag.Duration("warn-before", 3*24*time.Hour, "за сколько до удаления предупредить клиента")
+	flag.Parse()
+
+	// Подключение к PostgreSQL
+	dsn := "host=localhost user=root password=root dbname=RIP port=5433 sslmode=disable"
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		log.Fatal("Ошибка подключения к БД:", err)
+	}
+
+	fmt.Println("✅ Подключение к PostgreSQL установлено")
+
+	redisClient := redis.NewClient(session.RedisOptionsFromEnv())
+	defer redisClient.Close()
+
+	// Переходы заявок те же, что у сервера: события SSE уходят подключенным клиентам через Redis
+	orders := apiHandlers.NewSmartOrderAPIHandler(db, nil, nil, events.NewBroker(redisClient))
+	cleaner := maintenance.NewDraftCleaner(db, notifications.NewDraftNotifier(db), orders, *draftTTL, *warnBefore)
+	scheduler := maintenance.NewScheduler(
+		maintenance.NewRedisLock(redisClient, "maintenance:lock", 10*time.Minute),
+		time.Hour,
+		cleaner.Job())
+	scheduler.RunOnce(context.Background())
+
+	fmt.Println("🎉 Обслуживание завершено")
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 	"time"
 
+	"smartdevices/internal/storage"
+
 	_ "github.com/lib/pq"
 )
 
@@ -28,8 +30,17 @@ func main() {
 
 	// Очищаем старые данные
 	fmt.Println("🧹 Очищаем старые данные...")
+	db.Exec("DELETE FROM notifications")
+	db.Exec("DELETE FROM notification_preferences")
+	db.Exec("DELETE FROM client_addresses")
+	db.Exec("DELETE FROM order_status_histories")
+	db.Exec("DELETE FROM order_comments")
 	db.Exec("DELETE FROM order_items")
 	db.Exec("DELETE FROM smart_orders")
+	db.Exec("DELETE FROM device_revisions")
+	db.Exec("DELETE FROM device_images")
+	db.Exec("DELETE FROM device_tags")
+	db.Exec("DELETE FROM tags")
 	db.Exec("DELETE FROM smart_devices")
 	db.Exec("DELETE FROM clients")
 	db.Exec("ALTER SEQUENCE clients_id_seq RESTART WITH 1")
@@ -60,58 +71,130 @@ func main() {
 	fmt.Printf("✓ Создан клиент client1 с ID: %d\n", clientID)
 	fmt.Printf("✓ Создан пользователь moderator1 с ID: %d\n", moderatorID)
 
-	// 2. Умные устройства
+	// 2. Категории (коэффициенты трафика, признак хаба и схема характеристик)
+	fmt.Println("🗂️ Добавляем категории...")
+	categories := []struct {
+		slug        string
+		name        string
+		sortOrder   int
+		coefficient float64
+		isHub       bool
+		attributes  string // JSON-схема характеристик
+	}{
+		{"hubs", "Хабы", 10, 1.3, true,
+			`[{"key":"max_devices","label":"Максимум устройств","type":"integer","min":1},
+			  {"key":"voice_assistant","label":"Голосовой помощник","type":"boolean"}]`},
+		{"lighting", "Освещение", 20, 1.1, false,
+			`[{"key":"socket","label":"Цоколь","type":"enum","options":["E27","E14","GU10","GU5.3"]},
+			  {"key":"lumens","label":"Световой поток","type":"integer","unit":"лм","min":0},
+			  {"key":"dimmable","label":"Регулировка яркости","type":"boolean"}]`},
+		{"sockets", "Розетки", 30, 0.9, false,
+			`[{"key":"max_power","label":"Максимальная мощность","type":"integer","unit":"Вт","min":0},
+			  {"key":"energy_metering","label":"Учет электроэнергии","type":"boolean"}]`},
+		{"sensors", "Датчики", 40, 0.7, false,
+			`[{"key":"battery","label":"Тип батарейки","type":"enum","options":["CR2032","CR2450","CR123A","AAA","AA"]},
+			  {"key":"range","label":"Дальность обнаружения","type":"number","unit":"м","min":0}]`},
+		{"switches", "Выключатели", 50, 0.8, false,
+			`[{"key":"keys","label":"Количество клавиш","type":"integer","min":1,"max":4},
+			  {"key":"battery","label":"Тип батарейки","type":"enum","options":["CR2032","CR2450","AAA"]}]`},
+	}
+	for _, c := range categories {
+		_, err := db.Exec(`
+            INSERT INTO categories (slug, name, sort_order, traffic_coefficient, is_hub, attributes, created_at, updated_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+            ON CONFLICT (slug) DO UPDATE SET attributes = EXCLUDED.attributes
+        `, c.slug, c.name, c.sortOrder, c.coefficient, c.isHub, c.attributes, time.Now())
+		if err != nil {
+			log.Printf("Ошибка добавления категории %s: %v", c.slug, err)
+		}
+	}
+
+	// 3. Умные устройства
 	fmt.Println("💡 Добавляем умные устройства...")
+	// Демо-остаток, чтобы заявки можно было сформировать сразу после миграции
+	const demoStock = 20
 	devices := []struct {
 		name        string
 		model       string
+		vendor      string
 		dataRate    float64
 		dataPerHour float64
 		imageFile   string // имя файла картинки
 		description string
 		fullDesc    string
 		protocol    string
+		category    string
+		tags        []string
+		specs       string // JSON по схеме категории
 	}{
 		{
-			"Хаб", "Яндекс Хаб", 5120, 56.25, "hub.png",
+			"Хаб", "Яндекс Хаб", "Яндекс", 5120, 56.25, "hub.png",
 			"Умный пульт Яндекс Хаб для устройств",
 			"Умный пульт Яндекс Хаб для управления всеми устройствами умного дома. Центральное устройство системы, координирующее работу всех подключенных девайсов.",
 			"Wi-Fi",
+			"hubs", []string{"алиса", "пульт"}, `{"max_devices": 100, "voice_assistant": true}`,
 		},
 		{
-			"Лампочка", "Яндекс, E27", 8, 0.5, "lamp.png",
+			"Лампочка", "Яндекс, E27", "Яндекс", 8, 0.5, "lamp.png",
 			"Умная лампочка Яндекс, E27",
 			"Умная Яндекс лампочка позволяет дистанционно управлять освещением в комнате или доме. Поддержка Wi-Fi позволяет лампе работать в Умном доме Яндекса и реагировать на команды, отданные по мобильному приложению или напрямую голосовому помощнику Алисе.",
 			"Wi-Fi",
+			"lighting", []string{"алиса", "e27"}, `{"socket": "E27", "lumens": 806, "dimmable": true}`,
 		},
 		{
-			"Розетка", "YNDX-00340", 2, 0.1, "socket.png",
+			"Розетка", "YNDX-00340", "Яндекс", 2, 0.1, "socket.png",
 			"Умная розетка Яндекс YNDX-00340",
 			"Умная розетка для дистанционного управления электроприборами. Позволяет включать и выключать устройства по расписанию или голосовой команде.",
 			"Wi-Fi",
+			"sockets", []string{"алиса"}, `{"max_power": 3680, "energy_metering": false}`,
 		},
 		{
-			"Датчик", "Aqara Motion Sensor P1", 5, 0.3, "sensor.png",
+			"Датчик", "Aqara Motion Sensor P1", "Aqara", 5, 0.3, "sensor.png",
 			"Датчик движения Aqara Motion Sensor P1",
 			"Беспроводной датчик движения для автоматизации освещения и безопасности. Реагирует на движение в помещении и отправляет уведомления.",
 			"Zigbee",
+			"sensors", []string{"движение", "безопасность"}, `{"battery": "CR2450", "range": 7}`,
 		},
 		{
-			"Выключатель", "Яндекс, 2 клавиши", 3, 0.2, "switch.png",
+			"Выключатель", "Яндекс, 2 клавиши", "Яндекс", 3, 0.2, "switch.png",
 			"Умный беспроводной выключатель Яндекс, 2 клавиши",
 			"Беспроводной выключатель для управления умным освещением. Не требует прокладки проводов, работает от батареек.",
 			"Bluetooth",
+			"switches", []string{"беспроводной"}, `{"keys": 2, "battery": "CR2032"}`,
 		},
 	}
 
 	for _, d := range devices {
-		// Генерируем MinIO URL для картинки
-		namespaceURL := fmt.Sprintf("http://localhost:9000/image/%s", d.imageFile)
-
-		_, err := db.Exec(`
-            INSERT INTO smart_devices (name, model, avg_data_rate, data_per_hour, namespace_url, description, description_all, protocol, created_at)
-            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-        `, d.name, d.model, d.dataRate, d.dataPerHour, namespaceURL, d.description, d.fullDesc, d.protocol, time.Now())
+		// Картинка отдается через API: bucket закрыт
+		namespaceURL := storage.ImageURL(d.imageFile)
+
+		var deviceID int
+		err := db.QueryRow(`
+            INSERT INTO smart_devices (name, model, vendor, avg_data_rate, data_per_hour, namespace_url, description, description_all, protocol, stock_quantity, category_id, specs, created_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, (SELECT id FROM categories WHERE slug = $11), $12, $13)
+            RETURNING id
+        `, d.name, d.model, d.vendor, d.dataRate, d.dataPerHour, namespaceURL, d.description, d.fullDesc, d.protocol, demoStock, d.category, d.specs, time.Now()).Scan(&deviceID)
+		if err == nil {
+			_, err = db.Exec(`
+                INSERT INTO device_images (device_id, object_name, url, alt_text, sort_order, is_primary, created_at)
+                VALUES ($1, $2, $3, $4, 0, true, $5)
+            `, deviceID, d.imageFile, namespaceURL, d.description, time.Now())
+		}
+		if err == nil {
+			for _, tag := range d.tags {
+				_, err = db.Exec(`
+                    WITH t AS (
+                        INSERT INTO tags (name, created_at) VALUES ($1, $2)
+                        ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+                        RETURNING id
+                    )
+                    INSERT INTO device_tags (smart_device_id, tag_id) SELECT $3, id FROM t
+                `, tag, time.Now(), deviceID)
+				if err != nil {
+					break
+				}
+			}
+		}
 
 		if err != nil {
 			log.Printf("Ошибка добавления %s: %v", d.name, err)
@@ -120,12 +203,14 @@ func main() {
 		}
 	}
 
-	// 3. Демо-заявка (используем реальный clientID)
+	// 4. Демо-заявка (используем реальный clientID)
 	fmt.Println("📋 Создаем демо-заявку...")
 	var orderID int
 	err = db.QueryRow(`
-        INSERT INTO smart_orders (status, client_id, address, created_at)
-        VALUES ('draft', $1, 'ул. Примерная, д. 1, кв. 5', $2)
+        INSERT INTO smart_orders (status, client_id, address, created_at,
+            address_region, address_city, address_street, address_house, address_apartment, address_postal_code)
+        VALUES ('draft', $1, '101000, г. Москва, ул. Примерная, д. 1, кв. 5', $2,
+            'Москва', 'Москва', 'ул. Примерная', '1', '5', '101000')
         RETURNING id
     `, clientID, time.Now()).Scan(&orderID)
 
@@ -135,7 +220,7 @@ func main() {
 		fmt.Printf("✓ Создана заявка ID: %d\n", orderID)
 	}
 
-	// 4. Устройства в заявке
+	// 5. Устройства в заявке
 	fmt.Println("🛒 Добавляем устройства в заявку...")
 	orderItems := []struct {
 		deviceID int
@@ -162,4 +247,5 @@ func main() {
 	fmt.Printf("👤 Демо-клиент: client1 (ID: %d) / pass123\n", clientID)
 	fmt.Printf("🛒 Демо-заявка создана с 2 устройствами\n")
 	fmt.Println("🖼️ Картинки загружены с MinIO URL")
+	fmt.Println("🕘 Исходные ревизии устройств создаст сервер при следующем запуске")
 }
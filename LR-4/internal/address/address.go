@@ -0,0 +1,174 @@
+package address
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"smartdevices/internal/models"
+)
+
+// FieldError - ошибка валидации одного поля адреса
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+var (
+	namePattern       = regexp.MustCompile(`^[\p{L}][\p{L}0-9 .,\-()]*$`)
+	streetPattern     = regexp.MustCompile(`^[\p{L}0-9][\p{L}0-9 .,\-/()]*$`)
+	housePattern      = regexp.MustCompile(`^\d{1,4}[\p{L}]?(\s*(/|к\.?|корп\.?|стр\.?)\s*\d{1,3}[\p{L}]?)?$`)
+	apartmentPattern  = regexp.MustCompile(`^\d{1,4}[\p{L}]?$`)
+	postalCodePattern = regexp.MustCompile(`^\d{6}$`)
+)
+
+// Normalize убирает лишние пробелы во всех текстовых полях адреса
+func Normalize(a models.StructuredAddress) models.StructuredAddress {
+	a.Region = collapseSpaces(a.Region)
+	a.City = collapseSpaces(a.City)
+	a.Street = collapseSpaces(a.Street)
+	a.House = collapseSpaces(a.House)
+	a.Apartment = collapseSpaces(a.Apartment)
+	a.PostalCode = strings.TrimSpace(a.PostalCode)
+	a.Notes = strings.TrimSpace(a.Notes)
+	return a
+}
+
+// Validate проверяет формат полей адреса и возвращает список ошибок
+func Validate(a models.StructuredAddress) []FieldError {
+	var errs []FieldError
+
+	check := func(field, value string, required bool, maxLen int, pattern *regexp.Regexp, message string) {
+		if value == "" {
+			if required {
+				errs = append(errs, FieldError{Field: field, Message: "обязательное поле"})
+			}
+			return
+		}
+		if utf8.RuneCountInString(value) > maxLen {
+			errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("не более %d символов", maxLen)})
+			return
+		}
+		if pattern != nil && !pattern.MatchString(value) {
+			errs = append(errs, FieldError{Field: field, Message: message})
+		}
+	}
+
+	check("region", a.Region, true, 100, namePattern, "допустимы буквы, цифры, пробелы и знаки .,-()")
+	check("city", a.City, true, 100, namePattern, "допустимы буквы, цифры, пробелы и знаки .,-()")
+	check("street", a.Street, true, 150, streetPattern, "допустимы буквы, цифры, пробелы и знаки .,-/()")
+	check("house", a.House, true, 20, housePattern, "ожидается номер дома, например 12, 12А, 12/1, 12 к2")
+	check("apartment", a.Apartment, false, 10, apartmentPattern, "ожидается номер квартиры, например 5 или 5А")
+	check("postal_code", a.PostalCode, true, 6, postalCodePattern, "индекс должен состоять из 6 цифр")
+	check("notes", a.Notes, false, 500, nil, "")
+
+	return errs
+}
+
+// IsEmpty сообщает, что ни одно из основных полей адреса не заполнено
+func IsEmpty(a models.StructuredAddress) bool {
+	return a.Region == "" && a.City == "" && a.Street == "" && a.House == "" && a.PostalCode == ""
+}
+
+// Format собирает однострочное представление адреса для поля SmartOrder.Address
+func Format(a models.StructuredAddress) string {
+	parts := make([]string, 0, 6)
+	if a.PostalCode != "" {
+		parts = append(parts, a.PostalCode)
+	}
+	if a.Region != "" && !strings.EqualFold(a.Region, a.City) {
+		parts = append(parts, a.Region)
+	}
+	if a.City != "" {
+		parts = append(parts, "г. "+a.City)
+	}
+	if a.Street != "" {
+		parts = append(parts, a.Street)
+	}
+	if a.House != "" {
+		parts = append(parts, "д. "+a.House)
+	}
+	if a.Apartment != "" {
+		parts = append(parts, "кв. "+a.Apartment)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Сокращения и типы улиц, которые не различают адреса: "ул. Ленина" и "Ленина" - одна улица
+var streetTypes = map[string]bool{
+	"ул": true, "улица": true, "пр": true, "пр-т": true, "просп": true, "проспект": true,
+	"пер": true, "переулок": true, "б-р": true, "бульвар": true, "ш": true, "шоссе": true,
+	"пл": true, "площадь": true, "наб": true, "набережная": true,
+}
+
+var (
+	buildingPattern  = regexp.MustCompile(`(корп|к)\.?`)
+	structurePattern = regexp.MustCompile(`стр\.?`)
+)
+
+// SameLocation сообщает, что два адреса указывают на одно помещение: совпадают индекс,
+// улица, дом и квартира без учета регистра, сокращений ("ул.", "д.", "корп.") и пунктуации.
+// Адреса без индекса, улицы или дома не совпадают ни с чем.
+func SameLocation(a, b models.StructuredAddress) bool {
+	ka, kb := locationKey(a), locationKey(b)
+	return ka != "" && ka == kb
+}
+
+// locationKey - адрес без оформления; пустая строка, если адрес неполный
+func locationKey(a models.StructuredAddress) string {
+	postalCode := strings.TrimSpace(a.PostalCode)
+	street := streetKey(a.Street)
+	house := numberKey(a.House, "д")
+	if postalCode == "" || street == "" || house == "" {
+		return ""
+	}
+	return strings.Join([]string{postalCode, street, house, numberKey(a.Apartment, "кв")}, "|")
+}
+
+func streetKey(street string) string {
+	street = strings.NewReplacer("ё", "е", ",", " ", ".", " ").Replace(strings.ToLower(street))
+	words := []string{}
+	for _, word := range strings.Fields(street) {
+		if !streetTypes[word] {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// numberKey приводит номер дома или квартиры к виду "12к2": без пробелов и префикса ("д.", "кв.")
+func numberKey(number, prefix string) string {
+	number = strings.ToLower(strings.Join(strings.Fields(number), ""))
+	number = strings.TrimPrefix(strings.TrimPrefix(number, prefix+"."), prefix)
+	number = buildingPattern.ReplaceAllString(number, "к")
+	return structurePattern.ReplaceAllString(number, "с")
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Prepare нормализует и проверяет адрес, затем дополняет его координатами.
+// Если геокодер не нашел адрес, координаты остаются пустыми.
+func Prepare(ctx context.Context, g Geocoder, a models.StructuredAddress) (models.StructuredAddress, []FieldError) {
+	a = Normalize(a)
+	if errs := Validate(a); len(errs) > 0 {
+		return a, errs
+	}
+
+	a.Latitude, a.Longitude = nil, nil
+	if g != nil {
+		if point, err := g.Geocode(ctx, a); err == nil {
+			a.Latitude = &point.Latitude
+			a.Longitude = &point.Longitude
+		} else if !errors.Is(err, ErrNotFound) {
+			log.Printf("⚠️ Geocoding failed for %q: %v", Format(a), err)
+		}
+	}
+
+	return a, nil
+}
@@ -0,0 +1,261 @@
+package address
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"smartdevices/internal/models"
+)
+
+func validAddress() models.StructuredAddress {
+	return models.StructuredAddress{
+		Region:     "Москва",
+		City:       "Москва",
+		Street:     "ул. Ленина",
+		House:      "5",
+		Apartment:  "12",
+		PostalCode: "101000",
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	got := Normalize(models.StructuredAddress{
+		Region:     "  Московская   область ",
+		City:       " Химки",
+		Street:     "ул.  Ленина\t",
+		House:      " 12  к2 ",
+		Apartment:  " 5 ",
+		PostalCode: " 141400 ",
+		Notes:      "  домофон  не работает ",
+	})
+	want := models.StructuredAddress{
+		Region:     "Московская область",
+		City:       "Химки",
+		Street:     "ул. Ленина",
+		House:      "12 к2",
+		Apartment:  "5",
+		PostalCode: "141400",
+		Notes:      "домофон  не работает",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Normalize() = %+v, want %+v", got, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*models.StructuredAddress)
+		fields []string
+	}{
+		{"valid", func(a *models.StructuredAddress) {}, nil},
+		{"apartment is optional", func(a *models.StructuredAddress) { a.Apartment = "" }, nil},
+		{"house with building", func(a *models.StructuredAddress) { a.House = "12 к2" }, nil},
+		{"house with fraction", func(a *models.StructuredAddress) { a.House = "12/1" }, nil},
+		{"house with letter", func(a *models.StructuredAddress) { a.House = "12А" }, nil},
+		{"house with structure", func(a *models.StructuredAddress) { a.House = "7 стр. 3" }, nil},
+		{"missing required fields", func(a *models.StructuredAddress) { *a = models.StructuredAddress{} },
+			[]string{"region", "city", "street", "house", "postal_code"}},
+		{"bad postal code", func(a *models.StructuredAddress) { a.PostalCode = "12345" }, []string{"postal_code"}},
+		{"letters in postal code", func(a *models.StructuredAddress) { a.PostalCode = "10100A" }, []string{"postal_code"}},
+		{"bad house", func(a *models.StructuredAddress) { a.House = "дом пять" }, []string{"house"}},
+		{"bad apartment", func(a *models.StructuredAddress) { a.Apartment = "5-6" }, []string{"apartment"}},
+		{"city starts with digit", func(a *models.StructuredAddress) { a.City = "1Москва" }, []string{"city"}},
+		{"street with markup", func(a *models.StructuredAddress) { a.Street = "<b>Ленина</b>" }, []string{"street"}},
+		{"too long street", func(a *models.StructuredAddress) { a.Street = strings.Repeat("а", 151) }, []string{"street"}},
+		{"too long notes", func(a *models.StructuredAddress) { a.Notes = strings.Repeat("н", 501) }, []string{"notes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := validAddress()
+			tt.modify(&a)
+
+			var fields []string
+			for _, err := range Validate(a) {
+				fields = append(fields, err.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("Validate() fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	if !IsEmpty(models.StructuredAddress{Apartment: "5", Notes: "код 12"}) {
+		t.Error("address with only apartment and notes should be empty")
+	}
+	if IsEmpty(models.StructuredAddress{City: "Москва"}) {
+		t.Error("address with city should not be empty")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		a    models.StructuredAddress
+		want string
+	}{
+		{"city equals region", validAddress(), "101000, г. Москва, ул. Ленина, д. 5, кв. 12"},
+		{"region differs", models.StructuredAddress{
+			Region: "Московская область", City: "Химки", Street: "ул. Мира", House: "3", PostalCode: "141400",
+		}, "141400, Московская область, г. Химки, ул. Мира, д. 3"},
+		{"empty", models.StructuredAddress{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Format(tt.a); got != tt.want {
+				t.Errorf("Format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+type stubGeocoder struct {
+	point Point
+	err   error
+	calls int
+}
+
+func (g *stubGeocoder) Geocode(ctx context.Context, a models.StructuredAddress) (Point, error) {
+	g.calls++
+	return g.point, g.err
+}
+
+func TestPrepare(t *testing.T) {
+	t.Run("geocodes valid address", func(t *testing.T) {
+		g := &stubGeocoder{point: Point{Latitude: 55.76, Longitude: 37.63}}
+		a := validAddress()
+		a.Street = "  ул.   Ленина "
+
+		got, errs := Prepare(context.Background(), g, a)
+		if len(errs) > 0 {
+			t.Fatalf("Prepare() errors = %v", errs)
+		}
+		if got.Street != "ул. Ленина" {
+			t.Errorf("Street = %q, want normalized", got.Street)
+		}
+		if got.Latitude == nil || *got.Latitude != 55.76 || got.Longitude == nil || *got.Longitude != 37.63 {
+			t.Errorf("coordinates = %v, %v", got.Latitude, got.Longitude)
+		}
+	})
+
+	t.Run("invalid address is not geocoded", func(t *testing.T) {
+		g := &stubGeocoder{}
+		a := validAddress()
+		a.PostalCode = ""
+
+		_, errs := Prepare(context.Background(), g, a)
+		if len(errs) != 1 || errs[0].Field != "postal_code" {
+			t.Errorf("Prepare() errors = %v, want postal_code", errs)
+		}
+		if g.calls != 0 {
+			t.Errorf("geocoder called %d times", g.calls)
+		}
+	})
+
+	t.Run("not found clears stale coordinates", func(t *testing.T) {
+		lat, lon := 1.0, 2.0
+		a := validAddress()
+		a.Latitude, a.Longitude = &lat, &lon
+
+		got, errs := Prepare(context.Background(), &stubGeocoder{err: ErrNotFound}, a)
+		if len(errs) > 0 {
+			t.Fatalf("Prepare() errors = %v", errs)
+		}
+		if got.Latitude != nil || got.Longitude != nil {
+			t.Errorf("coordinates = %v, %v, want nil", got.Latitude, got.Longitude)
+		}
+	})
+
+	t.Run("geocoder failure is not a validation error", func(t *testing.T) {
+		_, errs := Prepare(context.Background(), &stubGeocoder{err: errors.New("timeout")}, validAddress())
+		if len(errs) > 0 {
+			t.Errorf("Prepare() errors = %v", errs)
+		}
+	})
+}
+
+func TestTableGeocoder(t *testing.T) {
+	g := NewTableGeocoder()
+
+	tests := []struct {
+		name    string
+		a       models.StructuredAddress
+		want    Point
+		wantErr error
+	}{
+		{"postal prefix", models.StructuredAddress{PostalCode: "190000", City: "Москва"}, Point{59.9270, 30.3173}, nil},
+		{"city fallback", models.StructuredAddress{PostalCode: "000000", City: " Г. Казань "}, Point{55.7963, 49.1088}, nil},
+		{"unknown", models.StructuredAddress{PostalCode: "000000", City: "Урюпинск"}, Point{}, ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := g.Geocode(context.Background(), tt.a)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Geocode() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Geocode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameLocation(t *testing.T) {
+	base := validAddress()
+
+	tests := []struct {
+		name   string
+		modify func(*models.StructuredAddress)
+		want   bool
+	}{
+		{"identical", func(a *models.StructuredAddress) {}, true},
+		{"street without type", func(a *models.StructuredAddress) { a.Street = "Ленина" }, true},
+		{"full street type and case", func(a *models.StructuredAddress) { a.Street = "УЛИЦА ленина" }, true},
+		{"street type after name", func(a *models.StructuredAddress) { a.Street = "Ленина ул." }, true},
+		{"house with prefix", func(a *models.StructuredAddress) { a.House = "д. 5" }, true},
+		{"apartment with prefix", func(a *models.StructuredAddress) { a.Apartment = "кв.12" }, true},
+		{"other city spelling", func(a *models.StructuredAddress) { a.City = "г. Москва"; a.Region = "" }, true},
+		{"other house", func(a *models.StructuredAddress) { a.House = "7" }, false},
+		{"other apartment", func(a *models.StructuredAddress) { a.Apartment = "13" }, false},
+		{"no apartment", func(a *models.StructuredAddress) { a.Apartment = "" }, false},
+		{"other postal code", func(a *models.StructuredAddress) { a.PostalCode = "101001" }, false},
+		{"other street", func(a *models.StructuredAddress) { a.Street = "пр. Ленинградский" }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := base
+			tt.modify(&other)
+			if got := SameLocation(base, other); got != tt.want {
+				t.Errorf("SameLocation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("building spellings", func(t *testing.T) {
+		a, b := base, base
+		a.House, b.House = "12 корп. 2", "12к2"
+		if !SameLocation(a, b) {
+			t.Error("12 корп. 2 and 12к2 should match")
+		}
+		a.House, b.House = "12 стр. 3", "12с3"
+		if !SameLocation(a, b) {
+			t.Error("12 стр. 3 and 12с3 should match")
+		}
+	})
+
+	t.Run("incomplete address matches nothing", func(t *testing.T) {
+		empty := models.StructuredAddress{}
+		if SameLocation(empty, empty) {
+			t.Error("empty addresses should not match")
+		}
+	})
+}
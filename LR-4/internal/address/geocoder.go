@@ -0,0 +1,115 @@
+package address
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"smartdevices/internal/models"
+)
+
+// ErrNotFound возвращается, если геокодер не смог определить координаты
+var ErrNotFound = errors.New("address not found")
+
+// Point - географические координаты
+type Point struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Geocoder определяет координаты по структурированному адресу
+type Geocoder interface {
+	Geocode(ctx context.Context, a models.StructuredAddress) (Point, error)
+}
+
+// TableGeocoder - офлайн-геокодер на основе встроенной таблицы
+// индексов и городов. Точность - до центра почтового района или города.
+type TableGeocoder struct {
+	byPostalPrefix map[string]Point
+	byCity         map[string]Point
+}
+
+// NewTableGeocoder создает геокодер со встроенной таблицей
+func NewTableGeocoder() *TableGeocoder {
+	return &TableGeocoder{
+		byPostalPrefix: map[string]Point{
+			"101": {55.7601, 37.6386},
+			"103": {55.7642, 37.6061},
+			"105": {55.7749, 37.7002},
+			"107": {55.8060, 37.6908},
+			"109": {55.7108, 37.7450},
+			"115": {55.6560, 37.6380},
+			"117": {55.6629, 37.5532},
+			"119": {55.7201, 37.5483},
+			"121": {55.7442, 37.4903},
+			"123": {55.7826, 37.4871},
+			"125": {55.8172, 37.5201},
+			"127": {55.8465, 37.5770},
+			"129": {55.8229, 37.6508},
+			"190": {59.9270, 30.3173},
+			"191": {59.9387, 30.3380},
+			"194": {60.0010, 30.3347},
+			"196": {59.8576, 30.3244},
+			"197": {59.9652, 30.2832},
+			"199": {59.9407, 30.2542},
+			"420": {55.7963, 49.1088},
+			"603": {56.3269, 44.0059},
+			"620": {56.8389, 60.6057},
+			"630": {55.0302, 82.9204},
+		},
+		byCity: map[string]Point{
+			"москва":          {55.7558, 37.6173},
+			"санкт-петербург": {59.9343, 30.3351},
+			"казань":          {55.7963, 49.1088},
+			"нижний новгород": {56.3269, 44.0059},
+			"екатеринбург":    {56.8389, 60.6057},
+			"новосибирск":     {55.0302, 82.9204},
+			"самара":          {53.1959, 50.1002},
+			"ростов-на-дону":  {47.2357, 39.7015},
+			"краснодар":       {45.0355, 38.9753},
+			"воронеж":         {51.6720, 39.1843},
+			"пермь":           {58.0105, 56.2502},
+			"уфа":             {54.7388, 55.9721},
+			"красноярск":      {56.0153, 92.8932},
+			"челябинск":       {55.1644, 61.4368},
+			"омск":            {54.9885, 73.3242},
+			"волгоград":       {48.7080, 44.5133},
+			"тула":            {54.1931, 37.6173},
+			"ярославль":       {57.6261, 39.8845},
+			"калининград":     {54.7104, 20.4522},
+			"владивосток":     {43.1155, 131.8855},
+			"химки":           {55.8970, 37.4297},
+			"балашиха":        {55.7963, 37.9381},
+			"подольск":        {55.4242, 37.5547},
+			"королёв":         {55.9162, 37.8545},
+			"королев":         {55.9162, 37.8545},
+			"мытищи":          {55.9116, 37.7308},
+			"зеленоград":      {55.9825, 37.1814},
+			"сочи":            {43.5855, 39.7231},
+			"иркутск":         {52.2870, 104.3050},
+			"тюмень":          {57.1522, 65.5272},
+			"саратов":         {51.5331, 46.0342},
+			"томск":           {56.4846, 84.9476},
+			"рязань":          {54.6269, 39.6916},
+			"тверь":           {56.8587, 35.9176},
+			"тольятти":        {53.5303, 49.3461},
+		},
+	}
+}
+
+// Geocode ищет координаты сначала по индексу, затем по названию города
+func (g *TableGeocoder) Geocode(ctx context.Context, a models.StructuredAddress) (Point, error) {
+	if len(a.PostalCode) >= 3 {
+		if p, ok := g.byPostalPrefix[a.PostalCode[:3]]; ok {
+			return p, nil
+		}
+	}
+
+	city := strings.ToLower(strings.TrimSpace(a.City))
+	city = strings.TrimPrefix(city, "г. ")
+	if p, ok := g.byCity[city]; ok {
+		return p, nil
+	}
+
+	return Point{}, ErrNotFound
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/catalog"
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var categorySlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type CategoryAPIHandler struct {
+	db *gorm.DB
+}
+
+func NewCategoryAPIHandler(db *gorm.DB) *CategoryAPIHandler {
+	return &CategoryAPIHandler{db: db}
+}
+
+// GET /api/categories - дерево категорий. **Доступно без авторизации**
+func (h *CategoryAPIHandler) GetCategories(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var categories []models.Category
+	if err := h.db.Find(&categories).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.CategoryTree(categories))
+}
+
+// GET /api/categories/{id} - категория с подкатегориями и полной схемой характеристик
+func (h *CategoryAPIHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	category, ok := h.loadCategory(w, r)
+	if !ok {
+		return
+	}
+
+	var subtree []models.Category
+	err := h.db.Where("id IN (?)", catalog.SubtreeIDs(h.db, []string{strconv.Itoa(int(category.ID))})).
+		Find(&subtree).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Корень поддерева - сама категория, ее родитель в ответ не входит
+	for i := range subtree {
+		if subtree[i].ID == category.ID {
+			subtree[i].ParentID = nil
+		}
+	}
+	response := serializers.CategoryTree(subtree)[0]
+	response.ParentID = category.ParentID
+
+	effective, err := catalog.EffectiveSchema(h.db, &category.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response.EffectiveAttributes = effective
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// POST /api/categories - создание категории (модератор)
+func (h *CategoryAPIHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var req serializers.CategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var category models.Category
+	if status, err := h.applyCategoryRequest(&category, req); err != nil {
+		writeJSONError(w, status, err)
+		return
+	}
+
+	if err := h.db.Create(&category).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🗂️ Category %d created: %s", category.ID, category.Slug)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serializers.CategoryToJSON(category))
+}
+
+// PUT /api/categories/{id} - изменение категории, в том числе перенос в другого родителя (модератор)
+func (h *CategoryAPIHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	category, ok := h.loadCategory(w, r)
+	if !ok {
+		return
+	}
+
+	var req serializers.CategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if status, err := h.applyCategoryRequest(&category, req); err != nil {
+		writeJSONError(w, status, err)
+		return
+	}
+
+	if err := h.db.Omit("Parent").Save(&category).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.CategoryToJSON(category))
+}
+
+// DELETE /api/categories/{id} - удаление пустой категории (модератор).
+// Категорию с подкатегориями или устройствами удалить нельзя - сначала их нужно перенести.
+func (h *CategoryAPIHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	category, ok := h.loadCategory(w, r)
+	if !ok {
+		return
+	}
+
+	var children, devices int64
+	if err := h.db.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&children).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.db.Model(&models.SmartDevice{}).Where("category_id = ?", category.ID).Count(&devices).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if children > 0 || devices > 0 {
+		writeJSONError(w, http.StatusConflict,
+			fmt.Errorf("category has %d subcategories and %d devices, move them first", children, devices))
+		return
+	}
+
+	if err := h.db.Delete(&category).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🗂️ Category %d deleted: %s", category.ID, category.Slug)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadCategory читает категорию по ID из пути; при ошибке ответ уже записан
+func (h *CategoryAPIHandler) loadCategory(w http.ResponseWriter, r *http.Request) (models.Category, bool) {
+	var category models.Category
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/categories/"))
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return category, false
+	}
+	if err := h.db.First(&category, id).Error; err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return category, false
+	}
+	return category, true
+}
+
+// applyCategoryRequest проверяет запрос и переносит его в категорию.
+// Возвращает HTTP-статус ошибки: 400 - неверные поля, 409 - занятый slug или цикл в дереве.
+func (h *CategoryAPIHandler) applyCategoryRequest(category *models.Category, req serializers.CategoryRequest) (int, error) {
+	slug := strings.ToLower(strings.TrimSpace(req.Slug))
+	name := strings.TrimSpace(req.Name)
+	if !categorySlugPattern.MatchString(slug) || len(slug) > 50 {
+		return http.StatusBadRequest, errors.New("slug must be 1-50 latin letters, digits and dashes")
+	}
+	if name == "" || utf8.RuneCountInString(name) > 100 {
+		return http.StatusBadRequest, errors.New("name is required and must be at most 100 characters")
+	}
+
+	coefficient := 1.0
+	if req.TrafficCoefficient != nil {
+		coefficient = *req.TrafficCoefficient
+	}
+	if coefficient <= 0 {
+		return http.StatusBadRequest, errors.New("traffic_coefficient must be positive")
+	}
+	if req.Attributes != nil {
+		if err := catalog.ValidateSchema(req.Attributes); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+
+	var taken int64
+	if err := h.db.Model(&models.Category{}).Where("slug = ? AND id <> ?", slug, category.ID).Count(&taken).Error; err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if taken > 0 {
+		return http.StatusConflict, fmt.Errorf("slug %q is already used", slug)
+	}
+
+	if req.ParentID != nil {
+		var parent models.Category
+		if err := h.db.First(&parent, *req.ParentID).Error; err != nil {
+			return http.StatusBadRequest, errors.New("parent category not found")
+		}
+		// Новая категория еще не в дереве; существующую нельзя вложить в саму себя или в потомка
+		if category.ID != 0 {
+			cycle, err := catalog.IsInSubtree(h.db, category.ID, parent.ID)
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
+			if cycle {
+				return http.StatusConflict, errors.New("category cannot be moved into itself or its subcategory")
+			}
+		}
+	}
+
+	category.ParentID = req.ParentID
+	category.Slug = slug
+	category.Name = name
+	category.SortOrder = req.SortOrder
+	category.TrafficCoefficient = coefficient
+	category.IsHub = req.IsHub
+	// Значения характеристик устройств не пересчитываются: новая схема проверяется при их следующем изменении
+	if req.Attributes != nil {
+		category.Attributes = req.Attributes
+	}
+	return 0, nil
+}
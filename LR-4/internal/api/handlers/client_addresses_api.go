@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"smartdevices/internal/address"
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/middleware"
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type ClientAddressAPIHandler struct {
+	db             *gorm.DB
+	authMiddleware *middleware.AuthMiddleware
+	geocoder       address.Geocoder
+}
+
+func NewClientAddressAPIHandler(db *gorm.DB, geocoder address.Geocoder) *ClientAddressAPIHandler {
+	return &ClientAddressAPIHandler{
+		db:             db,
+		authMiddleware: middleware.NewAuthMiddleware(db),
+		geocoder:       geocoder,
+	}
+}
+
+// GET /api/clients/addresses - адресная книга текущего пользователя
+func (h *ClientAddressAPIHandler) GetAddresses(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var addresses []models.ClientAddress
+	result := h.db.Where("client_id = ?", currentUser.ClientID).
+		Order("is_default DESC, id").
+		Find(&addresses)
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := []serializers.ClientAddressResponse{}
+	for _, a := range addresses {
+		response = append(response, serializers.ClientAddressToJSON(a, address.Format(a.Address)))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// POST /api/clients/addresses - добавление адреса в адресную книгу
+func (h *ClientAddressAPIHandler) CreateAddress(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req serializers.ClientAddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	prepared, fieldErrors := address.Prepare(r.Context(), h.geocoder, serializers.AddressFromRequest(req.Address))
+	if len(fieldErrors) > 0 {
+		writeAddressErrors(w, fieldErrors)
+		return
+	}
+
+	entry := models.ClientAddress{
+		ClientID:  currentUser.ClientID,
+		Label:     strings.TrimSpace(req.Label),
+		Address:   prepared,
+		IsDefault: req.IsDefault,
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if entry.IsDefault {
+			if err := resetDefaultAddress(tx, currentUser.ClientID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&entry).Error
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serializers.ClientAddressToJSON(entry, address.Format(entry.Address)))
+}
+
+// PUT /api/clients/addresses/{id} - изменение адреса
+func (h *ClientAddressAPIHandler) UpdateAddress(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/clients/addresses/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid address ID", http.StatusBadRequest)
+		return
+	}
+
+	var entry models.ClientAddress
+	result := h.db.Where("id = ? AND client_id = ?", id, currentUser.ClientID).First(&entry)
+	if result.Error != nil {
+		http.Error(w, "Address not found", http.StatusNotFound)
+		return
+	}
+
+	var req serializers.ClientAddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	prepared, fieldErrors := address.Prepare(r.Context(), h.geocoder, serializers.AddressFromRequest(req.Address))
+	if len(fieldErrors) > 0 {
+		writeAddressErrors(w, fieldErrors)
+		return
+	}
+
+	entry.Label = strings.TrimSpace(req.Label)
+	entry.Address = prepared
+	entry.IsDefault = req.IsDefault
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if entry.IsDefault {
+			if err := resetDefaultAddress(tx, currentUser.ClientID); err != nil {
+				return err
+			}
+		}
+		return tx.Save(&entry).Error
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.ClientAddressToJSON(entry, address.Format(entry.Address)))
+}
+
+// DELETE /api/clients/addresses/{id} - удаление адреса
+func (h *ClientAddressAPIHandler) DeleteAddress(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/clients/addresses/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid address ID", http.StatusBadRequest)
+		return
+	}
+
+	result := h.db.Where("id = ? AND client_id = ?", id, currentUser.ClientID).Delete(&models.ClientAddress{})
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Address not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Снимает признак "по умолчанию" со всех адресов клиента
+func resetDefaultAddress(tx *gorm.DB, clientID uint) error {
+	return tx.Model(&models.ClientAddress{}).
+		Where("client_id = ? AND is_default = ?", clientID, true).
+		Update("is_default", false).Error
+}
+
+// Ответ 400 со списком ошибок валидации адреса
+func writeAddressErrors(w http.ResponseWriter, fieldErrors []address.FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  "Invalid address",
+		"fields": fieldErrors,
+	})
+}
@@ -29,34 +29,48 @@ func NewClientAPIHandler(db *gorm.DB) *ClientAPIHandler {
 func (h *ClientAPIHandler) GetClients(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
+	params, err := parsePageParams(r, clientSortFields, "id")
+	if err != nil {
+		writePageError(w, err)
+		return
+	}
+
 	var clients []models.Client
-	result := h.db.Find(&clients)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	total, err := paginate(h.db.Model(&models.Client{}), params, &clients)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	var response []serializers.ClientResponse
+	response := []serializers.ClientResponse{}
 	for _, client := range clients {
 		response = append(response, serializers.ClientToJSON(client))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(newPageResponse(response, params, len(clients), total))
+}
+
+// Поля сортировки списка клиентов: имя в API -> колонка
+var clientSortFields = map[string]string{
+	"id":          "id",
+	"username":    "username",
+	"date_joined": "date_joined",
+	"last_login":  "last_login",
 }
 
 // GET /api/clients/{id} - один клиент
 func (h *ClientAPIHandler) GetClient(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -85,7 +99,7 @@ func (h *ClientAPIHandler) GetClient(w http.ResponseWriter, r *http.Request) {
 func (h *ClientAPIHandler) CreateClient(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -124,7 +138,7 @@ func (h *ClientAPIHandler) CreateClient(w http.ResponseWriter, r *http.Request)
 func (h *ClientAPIHandler) UpdateClient(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -177,7 +191,7 @@ func (h *ClientAPIHandler) UpdateClient(w http.ResponseWriter, r *http.Request)
 func (h *ClientAPIHandler) Login(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -227,7 +241,7 @@ func (h *ClientAPIHandler) Login(w http.ResponseWriter, r *http.Request) {
 func (h *ClientAPIHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/catalog"
+	"smartdevices/internal/models"
+	"smartdevices/internal/search"
+
+	"gorm.io/gorm"
+)
+
+// Фасеты каталога; фильтр фасета не применяется при подсчете его же значений
+const (
+	facetProtocol    = "protocol"
+	facetVendor      = "vendor"
+	facetAvgDataRate = "avg_data_rate"
+	facetDataPerHour = "data_per_hour"
+)
+
+// Границы интервалов для числовых фасетов
+var (
+	avgDataRateBounds = []float64{0, 10, 100, 1000}
+	dataPerHourBounds = []float64{0, 1, 10, 100}
+)
+
+// deviceFilter - одно условие каталога; facet пустой у условий, которые сужают все фасеты
+type deviceFilter struct {
+	facet string
+	apply func(*gorm.DB) *gorm.DB
+}
+
+// deviceFilters разбирает фильтры каталога. Фильтры по значениям принимают несколько
+// значений (protocol=Wi-Fi&protocol=Zigbee или protocol=Wi-Fi,Zigbee): внутри фасета - ИЛИ,
+// между фасетами - И. Некорректные числа игнорируются, как и раньше.
+func deviceFilters(r *http.Request, searchQuery search.Query, searching bool) []deviceFilter {
+	filters := []deviceFilter{}
+	values := r.URL.Query()
+
+	if searching {
+		filters = append(filters, deviceFilter{apply: searchQuery.Filter})
+	}
+
+	if protocols := multiValue(r, "protocol"); len(protocols) > 0 {
+		filters = append(filters, deviceFilter{facet: facetProtocol, apply: func(q *gorm.DB) *gorm.DB {
+			return q.Where("protocol IN ?", protocols)
+		}})
+	}
+
+	if vendors := multiValue(r, "vendor"); len(vendors) > 0 {
+		filters = append(filters, deviceFilter{facet: facetVendor, apply: func(q *gorm.DB) *gorm.DB {
+			return q.Where("vendor IN ?", vendors)
+		}})
+	}
+
+	// model - поиск по подстроке, любое из значений
+	if modelNames := multiValue(r, "model"); len(modelNames) > 0 {
+		filters = append(filters, deviceFilter{apply: func(q *gorm.DB) *gorm.DB {
+			conditions := make([]string, len(modelNames))
+			args := make([]interface{}, len(modelNames))
+			for i, model := range modelNames {
+				conditions[i] = "model ILIKE ?"
+				args[i] = "%" + model + "%"
+			}
+			return q.Where(strings.Join(conditions, " OR "), args...)
+		}})
+	}
+
+	// category - ID или slug, вместе с подкатегориями
+	if categories := multiValue(r, "category"); len(categories) > 0 {
+		filters = append(filters, deviceFilter{apply: func(q *gorm.DB) *gorm.DB {
+			subtree := catalog.SubtreeIDs(q.Session(&gorm.Session{NewDB: true}), categories)
+			return q.Where("smart_devices.category_id IN (?)", subtree)
+		}})
+	}
+
+	// tag - устройства с любой из меток
+	if tags := multiValue(r, "tag"); len(tags) > 0 {
+		names, _ := catalog.NormalizeTags(tags)
+		filters = append(filters, deviceFilter{apply: func(q *gorm.DB) *gorm.DB {
+			return q.Where(`EXISTS (SELECT 1 FROM device_tags dt JOIN tags t ON t.id = dt.tag_id
+				WHERE dt.smart_device_id = smart_devices.id AND t.name IN ?)`, names)
+		}})
+	}
+
+	filters = append(filters, specFilters(r)...)
+
+	filters = appendRangeFilter(filters, facetAvgDataRate, "avg_data_rate",
+		values.Get("data_rate_min"), values.Get("data_rate_max"))
+	filters = appendRangeFilter(filters, facetDataPerHour, "data_per_hour",
+		values.Get("data_per_hour_min"), values.Get("data_per_hour_max"))
+
+	if values.Get("in_stock") == "true" {
+		filters = append(filters, deviceFilter{apply: func(q *gorm.DB) *gorm.DB {
+			return q.Where("stock_quantity > reserved_quantity")
+		}})
+	}
+
+	return filters
+}
+
+func appendRangeFilter(filters []deviceFilter, facet, column, minStr, maxStr string) []deviceFilter {
+	if min, err := strconv.ParseFloat(minStr, 64); err == nil {
+		filters = append(filters, deviceFilter{facet: facet, apply: func(q *gorm.DB) *gorm.DB {
+			return q.Where(column+" >= ?", min)
+		}})
+	}
+	if max, err := strconv.ParseFloat(maxStr, 64); err == nil {
+		filters = append(filters, deviceFilter{facet: facet, apply: func(q *gorm.DB) *gorm.DB {
+			return q.Where(column+" <= ?", max)
+		}})
+	}
+	return filters
+}
+
+// specFilters - фильтры по характеристикам: spec.<key>=a,b - любое из значений,
+// spec.<key>.min / spec.<key>.max - границы числовых характеристик.
+// Параметры с неизвестным форматом ключа игнорируются.
+func specFilters(r *http.Request) []deviceFilter {
+	filters := []deviceFilter{}
+	names := make([]string, 0)
+	for name := range r.URL.Query() {
+		if strings.HasPrefix(name, "spec.") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		key := strings.TrimPrefix(name, "spec.")
+		bound := ""
+		if i := strings.LastIndex(key, "."); i >= 0 {
+			key, bound = key[:i], key[i+1:]
+		}
+		if !catalog.AttributeKeyPattern.MatchString(key) {
+			continue
+		}
+
+		switch bound {
+		case "":
+			values := multiValue(r, name)
+			if len(values) == 0 {
+				continue
+			}
+			filters = append(filters, deviceFilter{apply: func(q *gorm.DB) *gorm.DB {
+				return q.Where("smart_devices.specs ->> ? IN ?", key, values)
+			}})
+		case "min", "max":
+			limit, err := strconv.ParseFloat(r.URL.Query().Get(name), 64)
+			if err != nil {
+				continue
+			}
+			operator := ">="
+			if bound == "max" {
+				operator = "<="
+			}
+			// Нечисловые значения (другой тип у одноименной характеристики) не приводятся и не проходят фильтр
+			filters = append(filters, deviceFilter{apply: func(q *gorm.DB) *gorm.DB {
+				return q.Where(`CASE WHEN jsonb_typeof(smart_devices.specs -> ?) = 'number'
+					THEN (smart_devices.specs ->> ?)::numeric END `+operator+` ?`, key, key, limit)
+			}})
+		}
+	}
+	return filters
+}
+
+// multiValue собирает значения параметра из повторов и списков через запятую
+func multiValue(r *http.Request, name string) []string {
+	result := []string{}
+	for _, raw := range r.URL.Query()[name] {
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				result = append(result, value)
+			}
+		}
+	}
+	return result
+}
+
+// catalogQuery - активные устройства со всеми фильтрами, кроме фильтров фасета except
+func (h *SmartDeviceAPIHandler) catalogQuery(filters []deviceFilter, except string) *gorm.DB {
+	query := h.db.Model(&models.SmartDevice{}).Where("is_active = ?", true)
+	for _, filter := range filters {
+		if except == "" || filter.facet != except {
+			query = filter.apply(query)
+		}
+	}
+	return query
+}
+
+// deviceFacets считает все фасеты для текущих фильтров
+func (h *SmartDeviceAPIHandler) deviceFacets(filters []deviceFilter) (serializers.DeviceFacets, error) {
+	var facets serializers.DeviceFacets
+	var err error
+
+	if facets.Protocol, err = h.valueFacet(filters, facetProtocol, "protocol"); err != nil {
+		return facets, err
+	}
+	if facets.Vendor, err = h.valueFacet(filters, facetVendor, "vendor"); err != nil {
+		return facets, err
+	}
+	if facets.AvgDataRate, err = h.rangeFacet(filters, facetAvgDataRate, "avg_data_rate", avgDataRateBounds); err != nil {
+		return facets, err
+	}
+	if facets.DataPerHour, err = h.rangeFacet(filters, facetDataPerHour, "data_per_hour", dataPerHourBounds); err != nil {
+		return facets, err
+	}
+	return facets, nil
+}
+
+// valueFacet - количество устройств по значениям колонки, частые первыми
+func (h *SmartDeviceAPIHandler) valueFacet(filters []deviceFilter, facet, column string) ([]serializers.FacetValue, error) {
+	values := []serializers.FacetValue{}
+	err := h.catalogQuery(filters, facet).
+		Select(column + " AS value, count(*) AS count").
+		Where(column + " <> ''").
+		Group(column).
+		Order("count DESC, value").
+		Scan(&values).Error
+	return values, err
+}
+
+// rangeFacet - минимум, максимум и количество устройств в интервалах bounds
+func (h *SmartDeviceAPIHandler) rangeFacet(filters []deviceFilter, facet, column string, bounds []float64) (serializers.RangeFacet, error) {
+	result := serializers.RangeFacet{Buckets: []serializers.RangeBucket{}}
+
+	var limits struct {
+		Min *float64
+		Max *float64
+	}
+	err := h.catalogQuery(filters, facet).
+		Select("min(" + column + ") AS min, max(" + column + ") AS max").
+		Scan(&limits).Error
+	if err != nil {
+		return result, err
+	}
+	result.Min, result.Max = limits.Min, limits.Max
+
+	// Номер интервала: 0 - [bounds[0], bounds[1]), последний - от bounds[len-1] и выше.
+	// Значения ниже bounds[0] попадают в первый интервал.
+	var cases strings.Builder
+	cases.WriteString("CASE")
+	for i, bound := range bounds[1:] {
+		fmt.Fprintf(&cases, " WHEN %s < %g THEN %d", column, bound, i)
+	}
+	fmt.Fprintf(&cases, " ELSE %d END", len(bounds)-1)
+
+	var rows []struct {
+		Bucket int
+		Count  int64
+	}
+	err = h.catalogQuery(filters, facet).
+		Select(cases.String() + " AS bucket, count(*) AS count").
+		Group("bucket").
+		Scan(&rows).Error
+	if err != nil {
+		return result, err
+	}
+
+	counts := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Bucket] = row.Count
+	}
+	for i, from := range bounds {
+		bucket := serializers.RangeBucket{From: from, Count: counts[i]}
+		if i+1 < len(bounds) {
+			to := bounds[i+1]
+			bucket.To = &to
+		}
+		result.Buckets = append(result.Buckets, bucket)
+	}
+	return result, nil
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/imaging"
+	"smartdevices/internal/models"
+	"smartdevices/internal/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// imageUploadTTL - сколько действует ссылка на загрузку; неподтвержденный файл удаляется после нее
+	imageUploadTTL = 15 * time.Minute
+	// imageReadTTL - срок подписанной ссылки на чтение при IMAGE_READ_MODE=presigned
+	imageReadTTL = time.Hour
+)
+
+var (
+	errUploadNotFound = errors.New("upload not found")
+	errUploadExpired  = errors.New("upload link has expired, request a new one")
+	errUploadMissing  = errors.New("file has not been uploaded yet")
+
+	errDirectUploadUnsupported = errors.New("direct uploads are not supported by the configured storage, upload via POST /images")
+)
+
+// POST /api/smart-devices/{id}/images/uploads - подписанная ссылка для загрузки файла из браузера
+// напрямую в MinIO, минуя сервер (модератор). После загрузки файл нужно подтвердить.
+func (h *SmartDeviceAPIHandler) CreateImageUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	id, _, err := parseDeviceSubpath(r.URL.Path, "images")
+	if err != nil {
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+
+	// Загрузка в обход сервера возможна только в хранилище с подписанными ссылками (MinIO)
+	presigner, ok := h.store.(storage.Presigner)
+	if !ok {
+		writeJSONError(w, http.StatusNotImplemented, errDirectUploadUnsupported)
+		return
+	}
+
+	var device models.SmartDevice
+	if err := h.db.Select("id").First(&device, id).Error; err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	var req serializers.DeviceImageUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	// Предварительная проверка по словам клиента; настоящая - по содержимому при подтверждении
+	if !imaging.AllowedType(req.ContentType) {
+		writeJSONError(w, http.StatusUnsupportedMediaType, imaging.ErrUnsupportedType)
+		return
+	}
+	if req.Size > imaging.MaxFileSize {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, imaging.ErrTooLarge)
+		return
+	}
+	if status, err := h.checkImageLimit(device.ID); err != nil {
+		writeJSONError(w, status, err)
+		return
+	}
+
+	upload := models.DeviceImageUpload{
+		DeviceID:    device.ID,
+		ObjectName:  fmt.Sprintf("%sdevice_%d_%d", storage.UploadsPrefix, device.ID, time.Now().UnixNano()),
+		CreatedByID: h.currentUserID(r),
+		ExpiresAt:   time.Now().Add(imageUploadTTL),
+	}
+	uploadURL, err := presigner.PresignPut(r.Context(), upload.ObjectName, imageUploadTTL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.db.Create(&upload).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("📤 Image upload %d issued for device %d (expires %s)", upload.ID, device.ID, upload.ExpiresAt.Format(time.RFC3339))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serializers.DeviceImageUploadResponse{
+		UploadID:   upload.ID,
+		UploadURL:  uploadURL,
+		Method:     http.MethodPut,
+		Headers:    map[string]string{"Content-Type": req.ContentType},
+		ConfirmURL: fmt.Sprintf("/api/smart-devices/%d/images/uploads/%d/confirm", device.ID, upload.ID),
+		MaxSize:    imaging.MaxFileSize,
+		ExpiresAt:  upload.ExpiresAt,
+	})
+}
+
+// POST /api/smart-devices/{id}/images/uploads/{uploadId}/confirm - проверка загруженного файла
+// и добавление его в галерею, как при обычной загрузке (модератор). Тело: alt_text, is_primary.
+// Временный файл удаляется после добавления в галерею или если он не подходит (истек срок, не изображение).
+// После сбоя сервера или при заполненной галерее загрузку можно подтвердить повторно, пока не истекла ссылка.
+func (h *SmartDeviceAPIHandler) ConfirmImageUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	id, rest, err := parseDeviceSubpath(r.URL.Path, "images")
+	if err != nil || len(rest) != 3 || rest[0] != "uploads" || rest[2] != "confirm" {
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+	uploadID, err := strconv.Atoi(rest[1])
+	if err != nil {
+		http.Error(w, "Invalid upload ID", http.StatusBadRequest)
+		return
+	}
+
+	// Тело необязательно: без него изображение добавляется без подписи
+	var req serializers.DeviceImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	altText := ""
+	if req.AltText != nil {
+		altText = strings.TrimSpace(*req.AltText)
+	}
+	if utf8.RuneCountInString(altText) > 300 {
+		writeJSONError(w, http.StatusBadRequest, errors.New("alt_text must be at most 300 characters"))
+		return
+	}
+
+	var device models.SmartDevice
+	if err := h.db.First(&device, id).Error; err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	upload, data, status, err := h.claimUpload(r.Context(), uint(uploadID), device.ID)
+	if err != nil {
+		writeJSONError(w, status, err)
+		return
+	}
+
+	image, _, status, err := h.attachImage(r.Context(), device, data, altText, req.IsPrimary, h.currentUserID(r))
+	if err != nil {
+		// Файл, не прошедший проверку изображения, повторно не подтвердить
+		if imageStatus(err) != http.StatusInternalServerError {
+			deleteImageObjects(r.Context(), h.store, upload.ObjectName)
+		} else {
+			h.releaseUpload(upload)
+		}
+		writeJSONError(w, status, err)
+		return
+	}
+	deleteImageObjects(r.Context(), h.store, upload.ObjectName)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serializers.DeviceImagesToJSON([]models.DeviceImage{image})[0])
+}
+
+// claimUpload забирает загруженный файл: запись о загрузке удаляется,
+// поэтому параллельное подтверждение той же загрузки получит 404.
+// Временный объект удаляет вызывающий после добавления в галерею; при сбое загрузку возвращает releaseUpload.
+// Если файл еще не загружен, загрузку можно подтвердить позже (пока не истекла ссылка).
+func (h *SmartDeviceAPIHandler) claimUpload(ctx context.Context, uploadID, deviceID uint) (models.DeviceImageUpload, []byte, int, error) {
+	var upload models.DeviceImageUpload
+	err := h.db.Where("id = ? AND device_id = ?", uploadID, deviceID).First(&upload).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return upload, nil, http.StatusNotFound, errUploadNotFound
+	}
+	if err != nil {
+		return upload, nil, http.StatusInternalServerError, err
+	}
+
+	expired := time.Now().After(upload.ExpiresAt)
+	info, err := h.store.Stat(ctx, upload.ObjectName)
+	switch {
+	case errors.Is(err, storage.ErrObjectNotFound) && !expired:
+		return upload, nil, http.StatusConflict, errUploadMissing
+	case err != nil && !errors.Is(err, storage.ErrObjectNotFound):
+		return upload, nil, http.StatusInternalServerError, err
+	}
+
+	result := h.db.Delete(&upload)
+	if result.Error != nil {
+		return upload, nil, http.StatusInternalServerError, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return upload, nil, http.StatusNotFound, errUploadNotFound
+	}
+
+	switch {
+	case expired:
+		deleteImageObjects(ctx, h.store, upload.ObjectName)
+		return upload, nil, http.StatusGone, errUploadExpired
+	case info.Size > imaging.MaxFileSize:
+		// Подписанный PUT не ограничивает размер - проверяем до скачивания
+		deleteImageObjects(ctx, h.store, upload.ObjectName)
+		return upload, nil, http.StatusRequestEntityTooLarge, imaging.ErrTooLarge
+	}
+
+	reader, _, err := h.store.Get(ctx, upload.ObjectName)
+	if err != nil {
+		h.releaseUpload(upload)
+		return upload, nil, http.StatusInternalServerError, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, imaging.MaxFileSize+1))
+	if err != nil {
+		h.releaseUpload(upload)
+		return upload, nil, http.StatusInternalServerError, fmt.Errorf("failed to read uploaded file: %v", err)
+	}
+	return upload, data, 0, nil
+}
+
+// releaseUpload возвращает забранную загрузку, чтобы ее можно было подтвердить повторно.
+// Если вернуть не удалось, временный файл удалит очистка потерянных загрузок.
+func (h *SmartDeviceAPIHandler) releaseUpload(upload models.DeviceImageUpload) {
+	if err := h.db.Omit(clause.Associations).Create(&upload).Error; err != nil {
+		log.Printf("⚠️ Failed to restore image upload %d: %v", upload.ID, err)
+	}
+}
+
+// GET /api/images/{name} - изображение из хранилища. **Доступно без авторизации**.
+// По умолчанию файл отдается через сервер; при IMAGE_READ_MODE=presigned и MinIO - редирект на подписанную ссылку.
+func (h *SmartDeviceAPIHandler) ServeImage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-None-Match")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Только объекты галереи: временные загрузки (uploads/...) и пути с / не отдаются
+	name := strings.TrimPrefix(r.URL.Path, "/api/images/")
+	if name == "" || strings.ContainsAny(name, "/\\") || strings.HasPrefix(name, ".") {
+		http.NotFound(w, r)
+		return
+	}
+
+	if presigner, ok := h.store.(storage.Presigner); ok && storage.PresignedReads() {
+		target, err := presigner.PresignGet(r.Context(), name, imageReadTTL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Редирект кешируется меньше срока ссылки, чтобы браузер не получил истекшую
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(imageReadTTL.Seconds())/2))
+		http.Redirect(w, r, target, http.StatusFound)
+		return
+	}
+
+	reader, info, err := h.store.Get(r.Context(), name)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer reader.Close()
+
+	// Имена объектов уникальны и файлы не перезаписываются - можно кешировать надолго
+	etag := `"` + info.ETag + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, reader); err != nil {
+		log.Printf("⚠️ Failed to stream image %s: %v", name, err)
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"smartdevices/internal/middleware"
+	"smartdevices/internal/models"
+	"smartdevices/internal/session"
+	"smartdevices/internal/storage"
+)
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestConfirmImageUploadKeepsFileUntilAttached(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&models.DeviceImageUpload{}); err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &SmartDeviceAPIHandler{db: db, authMiddleware: &middleware.AuthMiddleware{}, store: store}
+	moderator := &session.Session{ClientID: 1, Username: "moderator", IsModerator: true}
+
+	device := models.SmartDevice{Name: "Лампа", IsActive: true}
+	if err := db.Create(&device).Error; err != nil {
+		t.Fatal(err)
+	}
+	newUpload := func(name string, data []byte) models.DeviceImageUpload {
+		upload := models.DeviceImageUpload{
+			DeviceID:   device.ID,
+			ObjectName: storage.UploadsPrefix + name,
+			ExpiresAt:  time.Now().Add(imageUploadTTL),
+		}
+		if err := db.Create(&upload).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Put(context.Background(), upload.ObjectName, data, "image/png"); err != nil {
+			t.Fatal(err)
+		}
+		return upload
+	}
+	confirm := func(upload models.DeviceImageUpload) *httptest.ResponseRecorder {
+		path := fmt.Sprintf("/api/smart-devices/%d/images/uploads/%d/confirm", device.ID, upload.ID)
+		r := httptest.NewRequest("POST", path, strings.NewReader(`{}`))
+		r = r.WithContext(context.WithValue(r.Context(), "user", moderator))
+		w := httptest.NewRecorder()
+		h.ConfirmImageUpload(w, r)
+		return w
+	}
+	// state - осталась ли запись о загрузке и временный файл
+	state := func(upload models.DeviceImageUpload) (bool, bool) {
+		var count int64
+		db.Model(&models.DeviceImageUpload{}).Where("id = ?", upload.ID).Count(&count)
+		_, err := store.Stat(context.Background(), upload.ObjectName)
+		if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			t.Fatal(err)
+		}
+		return count == 1, err == nil
+	}
+
+	// Не изображение: повторять нечего - загрузка и файл удаляются
+	invalid := newUpload("invalid.png", []byte("not an image"))
+	if w := confirm(invalid); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("confirm invalid file = %d, want 415: %s", w.Code, w.Body)
+	}
+	if row, file := state(invalid); row || file {
+		t.Errorf("invalid upload: row %v, file %v, want both removed", row, file)
+	}
+
+	// Галерея заполнена: файл остается, загрузку можно подтвердить после освобождения места
+	for i := 0; i < maxDeviceImages; i++ {
+		image := models.DeviceImage{DeviceID: device.ID, ObjectName: fmt.Sprintf("existing_%d.png", i), SortOrder: i}
+		if err := db.Create(&image).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	upload := newUpload("photo.png", testPNG(t))
+	if w := confirm(upload); w.Code != http.StatusConflict {
+		t.Fatalf("confirm into full gallery = %d, want 409: %s", w.Code, w.Body)
+	}
+	if row, file := state(upload); !row || !file {
+		t.Fatalf("upload after failed attach: row %v, file %v, want both kept", row, file)
+	}
+
+	if err := db.Where("device_id = ? AND object_name = ?", device.ID, "existing_0.png").Delete(&models.DeviceImage{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w := confirm(upload); w.Code != http.StatusCreated {
+		t.Fatalf("second confirm = %d, want 201: %s", w.Code, w.Body)
+	}
+	if row, file := state(upload); row || file {
+		t.Errorf("upload after attach: row %v, file %v, want both removed", row, file)
+	}
+
+	// Подтверждение одноразовое
+	if w := confirm(upload); w.Code != http.StatusNotFound {
+		t.Errorf("third confirm = %d, want 404", w.Code)
+	}
+}
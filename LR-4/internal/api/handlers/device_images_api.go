@@ -0,0 +1,528 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/catalog"
+	"smartdevices/internal/imaging"
+	"smartdevices/internal/models"
+	"smartdevices/internal/storage"
+	"smartdevices/internal/webhooks"
+
+	"gorm.io/gorm"
+)
+
+const maxDeviceImages = 20
+
+// MaxImageFormSize - предел multipart-формы с изображением: файл и 1 MB запаса на остальные поля
+const MaxImageFormSize = imaging.MaxFileSize + 1<<20
+
+var (
+	errImageNotFound = errors.New("image not found")
+	errGalleryFull   = fmt.Errorf("device may have at most %d images", maxDeviceImages)
+)
+
+// GET /api/smart-devices/{id}/images - галерея устройства. **Доступно без авторизации**
+func (h *SmartDeviceAPIHandler) GetDeviceImages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	id, _, err := parseDeviceSubpath(r.URL.Path, "images")
+	if err != nil {
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+
+	var device models.SmartDevice
+	if err := h.db.Preload("Images").Select("id").First(&device, id).Error; err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.DeviceImagesToJSON(device.Images))
+}
+
+// POST /api/smart-devices/{id}/images - добавление изображения в галерею (модератор).
+// multipart: image, alt_text, is_primary. Первое изображение устройства становится основным.
+func (h *SmartDeviceAPIHandler) AddDeviceImage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	id, _, err := parseDeviceSubpath(r.URL.Path, "images")
+	if err != nil {
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+
+	var device models.SmartDevice
+	if err := h.db.First(&device, id).Error; err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	image, _, status, err := h.addImage(w, r, device, false)
+	if err != nil {
+		writeJSONError(w, status, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serializers.DeviceImagesToJSON([]models.DeviceImage{image})[0])
+}
+
+// PUT /api/smart-devices/{id}/images/{imageId} - подпись и выбор основного изображения (модератор)
+func (h *SmartDeviceAPIHandler) UpdateDeviceImage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	image, err := h.loadImage(r)
+	if err != nil {
+		writeImageError(w, err)
+		return
+	}
+
+	var req serializers.DeviceImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.AltText != nil {
+		altText := strings.TrimSpace(*req.AltText)
+		if utf8.RuneCountInString(altText) > 300 {
+			writeJSONError(w, http.StatusBadRequest, errors.New("alt_text must be at most 300 characters"))
+			return
+		}
+		image.AltText = altText
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&image).Update("alt_text", image.AltText).Error; err != nil {
+			return err
+		}
+		if req.IsPrimary && !image.IsPrimary {
+			return setPrimaryImage(tx, &image, h.currentUserID(r))
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.DeviceImagesToJSON([]models.DeviceImage{image})[0])
+}
+
+// DELETE /api/smart-devices/{id}/images/{imageId} - удаление изображения из галереи и хранилища (модератор).
+// Если удалено основное, основным становится следующее по порядку.
+func (h *SmartDeviceAPIHandler) DeleteGalleryImage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	image, err := h.loadImage(r)
+	if err != nil {
+		writeImageError(w, err)
+		return
+	}
+
+	if err := h.removeImage(r.Context(), image, h.currentUserID(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /api/smart-devices/{id}/images/order - новый порядок галереи (модератор).
+// В image_ids должны быть все изображения устройства, каждое один раз.
+func (h *SmartDeviceAPIHandler) ReorderDeviceImages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	id, _, err := parseDeviceSubpath(r.URL.Path, "images")
+	if err != nil {
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+
+	var device models.SmartDevice
+	if err := h.db.Preload("Images").Select("id").First(&device, id).Error; err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	var req serializers.DeviceImageOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	position := make(map[uint]int, len(req.ImageIDs))
+	for i, imageID := range req.ImageIDs {
+		if _, ok := position[imageID]; ok {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("image %d is listed twice", imageID))
+			return
+		}
+		position[imageID] = i
+	}
+	for _, image := range device.Images {
+		if _, ok := position[image.ID]; !ok {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("image_ids must list all %d images of the device", len(device.Images)))
+			return
+		}
+	}
+	if len(req.ImageIDs) != len(device.Images) {
+		writeJSONError(w, http.StatusBadRequest, errors.New("image_ids contains images of another device"))
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		for i := range device.Images {
+			image := &device.Images[i]
+			image.SortOrder = position[image.ID]
+			if err := tx.Model(image).Update("sort_order", image.SortOrder).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.DeviceImagesToJSON(device.Images))
+}
+
+// addImage читает файл из формы (поле image) и добавляет его в галерею через attachImage.
+// primary или поле is_primary делают изображение основным.
+// Возвращает изображение, размер оригинала и HTTP-статус ошибки.
+func (h *SmartDeviceAPIHandler) addImage(w http.ResponseWriter, r *http.Request, device models.SmartDevice, primary bool) (models.DeviceImage, int, int, error) {
+	var image models.DeviceImage
+
+	// Заполненную галерею отклоняем до чтения файла
+	if status, err := h.checkImageLimit(device.ID); err != nil {
+		return image, 0, status, err
+	}
+
+	// Файл больше 1 MB форма держит во временном файле, а не в памяти
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImageFormSize)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return image, 0, http.StatusRequestEntityTooLarge, imaging.ErrTooLarge
+		}
+		return image, 0, http.StatusBadRequest, fmt.Errorf("failed to parse form: %v", err)
+	}
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		return image, 0, http.StatusBadRequest, fmt.Errorf("failed to get image file: %v", err)
+	}
+	defer file.Close()
+	if header.Size > imaging.MaxFileSize {
+		return image, 0, http.StatusRequestEntityTooLarge, imaging.ErrTooLarge
+	}
+
+	fileData, err := io.ReadAll(io.LimitReader(file, imaging.MaxFileSize+1))
+	if err != nil {
+		return image, 0, http.StatusInternalServerError, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	altText := strings.TrimSpace(r.FormValue("alt_text"))
+	if utf8.RuneCountInString(altText) > 300 {
+		return image, 0, http.StatusBadRequest, errors.New("alt_text must be at most 300 characters")
+	}
+	if value, _ := strconv.ParseBool(r.FormValue("is_primary")); value {
+		primary = true
+	}
+	return h.attachImage(r.Context(), device, fileData, altText, primary, h.currentUserID(r))
+}
+
+// attachImage проверяет файл, сохраняет в хранилище оригинал без метаданных и уменьшенные копии
+// и добавляет изображение в конец галереи. Первое изображение устройства становится основным.
+// Общая часть загрузки через форму и подтверждения прямой загрузки.
+func (h *SmartDeviceAPIHandler) attachImage(ctx context.Context, device models.SmartDevice, fileData []byte, altText string,
+	primary bool, changedBy *uint) (models.DeviceImage, int, int, error) {
+	var image models.DeviceImage
+
+	// Тип определяется по содержимому; расширение и Content-Type клиента не учитываются
+	processed, err := imaging.Process(fileData)
+	if err != nil {
+		return image, 0, imageStatus(err), err
+	}
+
+	// Имена на латинице: оригинал и копии рядом, с общим префиксом
+	base := fmt.Sprintf("device_%d_%d", device.ID, time.Now().UnixNano())
+	objects := []imageObject{
+		{name: base + processed.Original.Ext(), file: processed.Original},
+		{name: base + "_medium" + processed.Medium.Ext(), file: processed.Medium},
+		{name: base + "_thumb" + processed.Thumbnail.Ext(), file: processed.Thumbnail},
+	}
+
+	if err := uploadImageObjects(ctx, h.store, objects); err != nil {
+		fmt.Printf("❌ Storage upload failed: %v\n", err)
+		return image, 0, http.StatusInternalServerError, fmt.Errorf("failed to upload image to storage: %v", err)
+	}
+
+	image = models.DeviceImage{
+		DeviceID:        device.ID,
+		ObjectName:      objects[0].name,
+		URL:             h.store.URL(objects[0].name),
+		AltText:         altText,
+		ContentType:     processed.Original.ContentType,
+		Width:           processed.Original.Width,
+		Height:          processed.Original.Height,
+		MediumObject:    objects[1].name,
+		MediumURL:       h.store.URL(objects[1].name),
+		ThumbnailObject: objects[2].name,
+		ThumbnailURL:    h.store.URL(objects[2].name),
+	}
+	status := http.StatusInternalServerError
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var stats struct {
+			Count int
+			Next  int
+		}
+		err := tx.Model(&models.DeviceImage{}).
+			Where("device_id = ?", device.ID).
+			Select("COUNT(*) AS count, COALESCE(MAX(sort_order) + 1, 0) AS next").
+			Scan(&stats).Error
+		if err != nil {
+			return err
+		}
+		// Повторная проверка: пока файл обрабатывался, галерею могли заполнить
+		if stats.Count >= maxDeviceImages {
+			status = http.StatusConflict
+			return errGalleryFull
+		}
+		image.SortOrder = stats.Next
+		if err := tx.Create(&image).Error; err != nil {
+			return err
+		}
+		if primary || stats.Count == 0 {
+			return setPrimaryImage(tx, &image, changedBy)
+		}
+		return nil
+	})
+	if err != nil {
+		// Файлы без записи в галерее никому не видны - убираем их
+		deleteImageObjects(ctx, h.store, image.ObjectName, image.MediumObject, image.ThumbnailObject)
+		return image, 0, status, err
+	}
+
+	size := len(processed.Original.Data)
+	fmt.Printf("✅ Image uploaded: %s (%s, %dx%d, %d bytes)\n", image.ObjectName, image.ContentType, image.Width, image.Height, size)
+	return image, size, 0, nil
+}
+
+// checkImageLimit - 409, если в галерее уже maxDeviceImages изображений
+func (h *SmartDeviceAPIHandler) checkImageLimit(deviceID uint) (int, error) {
+	var count int64
+	if err := h.db.Model(&models.DeviceImage{}).Where("device_id = ?", deviceID).Count(&count).Error; err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if count >= maxDeviceImages {
+		return http.StatusConflict, errGalleryFull
+	}
+	return 0, nil
+}
+
+// imageObject - файл изображения и имя объекта в bucket
+type imageObject struct {
+	name string
+	file imaging.File
+}
+
+// uploadImageObjects загружает все файлы или ни одного: при ошибке загруженные удаляются
+func uploadImageObjects(ctx context.Context, store storage.ObjectStore, objects []imageObject) error {
+	for i, object := range objects {
+		if err := store.Put(ctx, object.name, object.file.Data, object.file.ContentType); err != nil {
+			for _, uploaded := range objects[:i] {
+				deleteImageObjects(ctx, store, uploaded.name)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteImageObjects удаляет объекты из хранилища; пустые имена пропускаются, ошибки только логируются.
+// Удаление не прерывается, если клиент закрыл соединение.
+func deleteImageObjects(ctx context.Context, store storage.ObjectStore, names ...string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if err := store.Delete(ctx, name); err != nil {
+			log.Printf("⚠️ Failed to delete image %s from storage: %v", name, err)
+		}
+	}
+}
+
+// imageStatus - HTTP-статус для ошибки проверки изображения
+func imageStatus(err error) int {
+	switch {
+	case errors.Is(err, imaging.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, imaging.ErrUnsupportedType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, imaging.ErrDimensions):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, imaging.ErrInvalidImage):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// removeImage удаляет изображение из галереи, при необходимости выбирает новое основное,
+// затем удаляет файлы из хранилища. Ошибка хранилища после удаления записи только логируется.
+func (h *SmartDeviceAPIHandler) removeImage(ctx context.Context, image models.DeviceImage, changedBy *uint) error {
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&image).Error; err != nil {
+			return err
+		}
+		if !image.IsPrimary {
+			return nil
+		}
+
+		var next models.DeviceImage
+		err := tx.Where("device_id = ?", image.DeviceID).Order("sort_order, id").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return setDeviceImageURL(tx, image.DeviceID, "", changedBy)
+		}
+		if err != nil {
+			return err
+		}
+		return setPrimaryImage(tx, &next, changedBy)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Внешние ссылки, перенесенные из namespace_url, в bucket не лежат
+	if image.ObjectName != "" {
+		deleteImageObjects(ctx, h.store, image.ObjectName, image.MediumObject, image.ThumbnailObject)
+	}
+	fmt.Printf("✅ Image %d deleted from device %d\n", image.ID, image.DeviceID)
+	return nil
+}
+
+// loadImage читает изображение из пути /api/smart-devices/{id}/images/{imageId}
+func (h *SmartDeviceAPIHandler) loadImage(r *http.Request) (models.DeviceImage, error) {
+	var image models.DeviceImage
+	id, rest, err := parseDeviceSubpath(r.URL.Path, "images")
+	if err != nil || len(rest) != 1 {
+		return image, errInvalidImagePath
+	}
+	imageID, err := strconv.Atoi(rest[0])
+	if err != nil {
+		return image, errInvalidImagePath
+	}
+	err = h.db.Where("id = ? AND device_id = ?", imageID, id).First(&image).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return image, errImageNotFound
+	}
+	return image, err
+}
+
+var errInvalidImagePath = errors.New("invalid device or image ID")
+
+// writeImageError - 400/404 для неверного пути и отсутствующего изображения, иначе 500
+func writeImageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidImagePath):
+		writeJSONError(w, http.StatusBadRequest, err)
+	case errors.Is(err, errImageNotFound):
+		writeJSONError(w, http.StatusNotFound, err)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// setPrimaryImage делает изображение основным и переносит его URL в namespace_url устройства
+func setPrimaryImage(tx *gorm.DB, image *models.DeviceImage, changedBy *uint) error {
+	err := tx.Model(&models.DeviceImage{}).
+		Where("device_id = ? AND is_primary", image.DeviceID).
+		Update("is_primary", false).Error
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(image).Update("is_primary", true).Error; err != nil {
+		return err
+	}
+	return setDeviceImageURL(tx, image.DeviceID, image.URL, changedBy)
+}
+
+// setDeviceImageURL обновляет namespace_url. Только свои колонки: остаток и резерв могли измениться параллельно.
+// URL входит в представление устройства: изменение записывается ревизией и уходит webhook device.updated.
+func setDeviceImageURL(tx *gorm.DB, deviceID uint, url string, changedBy *uint) error {
+	result := tx.Model(&models.SmartDevice{}).
+		Where("id = ? AND namespace_url IS DISTINCT FROM ?", deviceID, url).
+		UpdateColumns(map[string]interface{}{
+			"namespace_url": url,
+			"version":       gorm.Expr("version + 1"),
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	var device models.SmartDevice
+	if err := tx.Preload("Category").Preload("Tags").Preload("Images").First(&device, deviceID).Error; err != nil {
+		return err
+	}
+	if err := catalog.RecordRevision(tx, device, models.RevisionUpdate, changedBy, nil); err != nil {
+		return err
+	}
+	return webhooks.Enqueue(tx, webhooks.EventDeviceUpdated, serializers.SmartDeviceToJSON(device))
+}
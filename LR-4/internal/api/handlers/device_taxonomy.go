@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/catalog"
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var errCategoryNotFound = errors.New("category not found")
+
+// deviceTaxonomy - категория и метки из запроса устройства, проверенные до транзакции
+type deviceTaxonomy struct {
+	setCategory bool
+	category    *models.Category
+	setTags     bool
+	tags        []string
+	setSpecs    bool
+	specs       map[string]interface{}
+}
+
+// parseDeviceTaxonomy проверяет category_id и tags. Ошибка - неверный запрос (400).
+func (h *SmartDeviceAPIHandler) parseDeviceTaxonomy(req serializers.SmartDeviceCreateRequest) (deviceTaxonomy, error) {
+	var taxonomy deviceTaxonomy
+
+	if req.CategoryID != nil {
+		taxonomy.setCategory = true
+		if *req.CategoryID != 0 {
+			var category models.Category
+			if err := h.db.First(&category, *req.CategoryID).Error; err != nil {
+				return taxonomy, errCategoryNotFound
+			}
+			taxonomy.category = &category
+		}
+	}
+
+	if req.Tags != nil {
+		tags, err := catalog.NormalizeTags(req.Tags)
+		if err != nil {
+			return taxonomy, err
+		}
+		taxonomy.setTags = true
+		taxonomy.tags = tags
+	}
+
+	if req.Specs != nil {
+		taxonomy.setSpecs = true
+		taxonomy.specs = req.Specs
+	}
+
+	return taxonomy, nil
+}
+
+// setCategoryOf переносит категорию в устройство перед сохранением
+func (t deviceTaxonomy) setCategoryOf(device *models.SmartDevice) {
+	if !t.setCategory {
+		return
+	}
+	device.Category = t.category
+	device.CategoryID = nil
+	if t.category != nil {
+		device.CategoryID = &t.category.ID
+	}
+}
+
+// applySpecs проверяет характеристики по схеме итоговой категории устройства.
+// При изменении без specs, но со сменой категории проверяются текущие значения.
+// Ошибки значений возвращаются как catalog.SpecErrors.
+func (h *SmartDeviceAPIHandler) applySpecs(device *models.SmartDevice, t deviceTaxonomy, isNew bool) error {
+	values := map[string]interface{}(device.Specs)
+	switch {
+	case t.setSpecs:
+		values = t.specs
+	case !isNew && !t.setCategory:
+		return nil
+	}
+
+	schema, err := catalog.EffectiveSchema(h.db, device.CategoryID)
+	if err != nil {
+		return err
+	}
+	specs, err := catalog.ValidateSpecs(schema, values)
+	if err != nil {
+		return err
+	}
+	device.Specs = specs
+	return nil
+}
+
+// writeSpecsError - 400 с ошибками по ключам для неверных характеристик, иначе 500
+func writeSpecsError(w http.ResponseWriter, err error) {
+	var problems catalog.SpecErrors
+	if !errors.As(err, &problems) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  "Specs do not match the category schema",
+		"fields": problems,
+	})
+}
+
+// saveTags заменяет метки сохраненного устройства; вызывается в транзакции сохранения
+func (t deviceTaxonomy) saveTags(tx *gorm.DB, device *models.SmartDevice) error {
+	if !t.setTags {
+		return nil
+	}
+	tags, err := catalog.ResolveTags(tx, t.tags)
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(device).Association("Tags").Replace(tags); err != nil {
+		return err
+	}
+	device.Tags = tags
+	return nil
+}
@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// writeJSONError - ошибка клиента в JSON {"error": ...}; внутренние ошибки - текстом, как везде
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	if status == http.StatusInternalServerError {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
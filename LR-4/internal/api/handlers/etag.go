@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ETag для версии записи
+func formatETag(version uint) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// Проставляет ETag текущей версии записи
+func setETag(w http.ResponseWriter, version uint) {
+	w.Header().Set("ETag", formatETag(version))
+}
+
+// checkIfMatch проверяет заголовок If-Match против текущей версии.
+// Без заголовка отвечает 428, при несовпадении - 412.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, version uint) bool {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		http.Error(w, `{"error": "If-Match header is required"}`, http.StatusPreconditionRequired)
+		return false
+	}
+
+	if header == "*" {
+		return true
+	}
+
+	current := formatETag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == current {
+			return true
+		}
+	}
+
+	setETag(w, version)
+	http.Error(w, `{"error": "Resource was modified, reload and retry"}`, http.StatusPreconditionFailed)
+	return false
+}
+
+// saveVersioned сохраняет запись, только если в БД все еще ожидаемая версия.
+// Version в value должна быть уже увеличена. Возвращает false при конфликте.
+func saveVersioned(db *gorm.DB, value interface{}, expectedVersion uint) (bool, error) {
+	result := db.Model(value).
+		Where("version = ?", expectedVersion).
+		Select("*").
+		Omit(clause.Associations, "created_at").
+		Updates(value)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
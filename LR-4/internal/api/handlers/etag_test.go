@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"smartdevices/internal/events"
+	"smartdevices/internal/middleware"
+	"smartdevices/internal/models"
+	"smartdevices/internal/session"
+)
+
+func TestCheckIfMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		ok     bool
+		code   int
+	}{
+		{"missing", "", false, http.StatusPreconditionRequired},
+		{"blank", "   ", false, http.StatusPreconditionRequired},
+		{"current", `"3"`, true, 0},
+		{"weak current", `W/"3"`, true, 0},
+		{"list with current", `"1", W/"2" , "3"`, true, 0},
+		{"any", "*", true, 0},
+		{"stale", `"2"`, false, http.StatusPreconditionFailed},
+		{"weak stale", `W/"2"`, false, http.StatusPreconditionFailed},
+		{"unquoted", "3", false, http.StatusPreconditionFailed},
+		{"other resource tag", `"3-gzip"`, false, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/", nil)
+			if tt.header != "" {
+				r.Header.Set("If-Match", tt.header)
+			}
+			w := httptest.NewRecorder()
+			ok := checkIfMatch(w, r, 3)
+			if ok != tt.ok || (!ok && w.Code != tt.code) {
+				t.Fatalf("checkIfMatch(%q) = %v, %d, want %v, %d", tt.header, ok, w.Code, tt.ok, tt.code)
+			}
+			// При 412 клиент получает актуальный ETag, чтобы перечитать запись
+			if tt.code == http.StatusPreconditionFailed && w.Header().Get("ETag") != `"3"` {
+				t.Errorf("ETag = %q, want \"3\"", w.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+// Запись сохраняется, только если версия в БД не изменилась после чтения
+func TestSaveVersioned(t *testing.T) {
+	db := newTestDB(t)
+	device := models.SmartDevice{Name: "Лампа", IsActive: true}
+	if err := db.Create(&device).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	stale := device
+	device.Name = "Лампа 2"
+	device.Version = 2
+	if saved, err := saveVersioned(db, &device, 1); err != nil || !saved {
+		t.Fatalf("saveVersioned(current) = %v, %v", saved, err)
+	}
+
+	stale.Name = "Старое имя"
+	stale.Version = 2
+	if saved, err := saveVersioned(db, &stale, 1); err != nil || saved {
+		t.Fatalf("saveVersioned(stale) = %v, %v, want false", saved, err)
+	}
+
+	var current models.SmartDevice
+	db.First(&current, device.ID)
+	if current.Name != "Лампа 2" || current.Version != 2 {
+		t.Errorf("device = %q v%d, want %q v2", current.Name, current.Version, "Лампа 2")
+	}
+}
+
+// versionedRequest - запрос к ресурсу с версией: метод, путь, тело и вызов обработчика
+type versionedRequest struct {
+	name    string
+	method  string
+	path    string
+	body    string
+	handler func(w http.ResponseWriter, r *http.Request)
+	success int
+	// version - текущая версия записи в БД
+	version func() uint
+}
+
+func TestVersionedHandlers(t *testing.T) {
+	db := newTestDB(t)
+	moderator := models.Client{Username: "moderator", Password: "x", IsModerator: true, IsActive: true}
+	if err := db.Create(&moderator).Error; err != nil {
+		t.Fatal(err)
+	}
+	user := &session.Session{ClientID: moderator.ID, Username: moderator.Username, IsModerator: true}
+
+	devices := &SmartDeviceAPIHandler{db: db, authMiddleware: &middleware.AuthMiddleware{}}
+	orders := &SmartOrderAPIHandler{db: db, authMiddleware: &middleware.AuthMiddleware{}, events: events.NewBroker(nil)}
+
+	newDevice := func() uint {
+		device := models.SmartDevice{Name: "Лампа", Model: "L1", IsActive: true}
+		if err := db.Create(&device).Error; err != nil {
+			t.Fatal(err)
+		}
+		return device.ID
+	}
+	newOrder := func() uint {
+		order := models.SmartOrder{Status: "draft", ClientID: moderator.ID}
+		if err := db.Create(&order).Error; err != nil {
+			t.Fatal(err)
+		}
+		return order.ID
+	}
+	deviceVersion := func(id uint) func() uint {
+		return func() uint {
+			var device models.SmartDevice
+			db.First(&device, id)
+			return device.Version
+		}
+	}
+	orderVersion := func(id uint) func() uint {
+		return func() uint {
+			var order models.SmartOrder
+			db.First(&order, id)
+			return order.Version
+		}
+	}
+
+	// Для каждого случая - свежая запись, чтобы версии не зависели от порядка
+	cases := []func() versionedRequest{
+		func() versionedRequest {
+			id := newDevice()
+			return versionedRequest{"PUT device", "PUT", fmt.Sprintf("/api/smart-devices/%d", id),
+				`{"name": "Лампа 2", "model": "L2"}`, devices.UpdateSmartDevice, http.StatusOK, deviceVersion(id)}
+		},
+		func() versionedRequest {
+			id := newDevice()
+			return versionedRequest{"DELETE device", "DELETE", fmt.Sprintf("/api/smart-devices/%d", id),
+				"", devices.DeleteSmartDevice, http.StatusNoContent, deviceVersion(id)}
+		},
+		func() versionedRequest {
+			id := newOrder()
+			return versionedRequest{"PUT order", "PUT", fmt.Sprintf("/api/smart-orders/%d", id),
+				`{"address": "ул. Ленина, 1"}`, orders.UpdateSmartOrder, http.StatusOK, orderVersion(id)}
+		},
+		func() versionedRequest {
+			id := newOrder()
+			return versionedRequest{"DELETE order", "DELETE", fmt.Sprintf("/api/smart-orders/%d", id),
+				"", orders.DeleteSmartOrder, http.StatusNoContent, orderVersion(id)}
+		},
+	}
+
+	send := func(req versionedRequest, ifMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(req.method, req.path, strings.NewReader(req.body))
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		r = r.WithContext(context.WithValue(r.Context(), "user", user))
+		w := httptest.NewRecorder()
+		req.handler(w, r)
+		return w
+	}
+
+	for _, newCase := range cases {
+		req := newCase()
+		t.Run(req.name, func(t *testing.T) {
+			version := req.version()
+
+			if w := send(req, ""); w.Code != http.StatusPreconditionRequired {
+				t.Errorf("without If-Match = %d, want 428", w.Code)
+			}
+			w := send(req, formatETag(version+1))
+			if w.Code != http.StatusPreconditionFailed || w.Header().Get("ETag") != formatETag(version) {
+				t.Errorf("stale If-Match = %d, ETag %q, want 412, %q", w.Code, w.Header().Get("ETag"), formatETag(version))
+			}
+			if got := req.version(); got != version {
+				t.Fatalf("version after rejected requests = %d, want %d", got, version)
+			}
+
+			w = send(req, "W/"+formatETag(version))
+			if w.Code != req.success {
+				t.Fatalf("weak current If-Match = %d, want %d: %s", w.Code, req.success, w.Body)
+			}
+			if got := req.version(); got != version+1 {
+				t.Errorf("version after success = %d, want %d", got, version+1)
+			}
+			if req.method != "PUT" {
+				return
+			}
+			if w.Header().Get("ETag") != formatETag(version+1) {
+				t.Errorf("ETag after PUT = %q, want %q", w.Header().Get("ETag"), formatETag(version+1))
+			}
+
+			// Старый ETag после изменения больше не подходит
+			if w := send(req, formatETag(version)); w.Code != http.StatusPreconditionFailed {
+				t.Errorf("old If-Match after PUT = %d, want 412", w.Code)
+			}
+		})
+	}
+}
+
+// Повторное удаление заявки - 404 без смены версии и ETag, как у GET удаленной заявки
+func TestDeleteSmartOrderAlreadyDeleted(t *testing.T) {
+	db := newTestDB(t)
+	client := models.Client{Username: "client", Password: "x"}
+	if err := db.Create(&client).Error; err != nil {
+		t.Fatal(err)
+	}
+	order := models.SmartOrder{Status: "deleted", ClientID: client.ID}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	h := &SmartOrderAPIHandler{db: db, authMiddleware: &middleware.AuthMiddleware{}, events: events.NewBroker(nil)}
+	r := httptest.NewRequest("DELETE", fmt.Sprintf("/api/smart-orders/%d", order.ID), nil)
+	r.Header.Set("If-Match", "*")
+	r = r.WithContext(context.WithValue(r.Context(), "user", &session.Session{ClientID: client.ID}))
+	w := httptest.NewRecorder()
+	h.DeleteSmartOrder(w, r)
+
+	var after models.SmartOrder
+	db.First(&after, order.ID)
+	if w.Code != http.StatusNotFound || after.Version != order.Version {
+		t.Errorf("DELETE deleted order = %d, version %d -> %d, want 404 and no change", w.Code, order.Version, after.Version)
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"smartdevices/internal/events"
+	"smartdevices/internal/middleware"
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Комментарий-пинг держит соединение открытым за прокси и выявляет отключившихся клиентов
+const eventsHeartbeat = 25 * time.Second
+
+type EventsAPIHandler struct {
+	db             *gorm.DB
+	authMiddleware *middleware.AuthMiddleware
+	broker         *events.Broker
+}
+
+func NewEventsAPIHandler(db *gorm.DB, broker *events.Broker) *EventsAPIHandler {
+	return &EventsAPIHandler{
+		db:             db,
+		authMiddleware: middleware.NewAuthMiddleware(db),
+		broker:         broker,
+	}
+}
+
+// GET /api/events - поток Server-Sent Events текущего пользователя.
+// Клиент получает смену статусов своих заявок и количество в корзине,
+// модератор - еще и новые сформированные заявки.
+func (h *EventsAPIHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Подписываемся до снимка корзины, чтобы не пропустить изменение между ними
+	stream, unsubscribe := h.broker.Subscribe(currentUser.ClientID, currentUser.IsModerator)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Переподключение браузера через 5 секунд и текущее состояние корзины
+	fmt.Fprint(w, "retry: 5000\n\n")
+	snapshot, _ := json.Marshal(draftCart(h.db, currentUser.ClientID))
+	writeSSE(w, events.Event{Type: events.TypeCartUpdated, Data: snapshot})
+	flusher.Flush()
+
+	log.Printf("📡 Events stream opened: %s (moderator: %v)", currentUser.Username, currentUser.IsModerator)
+	defer log.Printf("📡 Events stream closed: %s", currentUser.Username)
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-stream:
+			if !ok {
+				return
+			}
+			writeSSE(w, event)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// writeSSE пишет событие в формате text/event-stream; data - однострочный JSON
+func writeSSE(w http.ResponseWriter, event events.Event) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, event.Data)
+}
+
+// draftCart - черновик пользователя и общее количество устройств в нем
+func draftCart(db *gorm.DB, clientID uint) events.Cart {
+	var cart events.Cart
+
+	var order models.SmartOrder
+	if err := db.Where("status = ? AND client_id = ?", "draft", clientID).First(&order).Error; err != nil {
+		return cart
+	}
+	cart.OrderID = order.ID
+
+	db.Model(&models.OrderItem{}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Where("order_id = ?", order.ID).
+		Scan(&cart.Count)
+	return cart
+}
+
+// publishCart отправляет пользователю актуальное количество в корзине
+func publishCart(db *gorm.DB, broker *events.Broker, clientID uint) {
+	broker.PublishToUser(clientID, events.TypeCartUpdated, draftCart(db, clientID))
+}
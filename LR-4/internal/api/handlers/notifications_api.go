@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/middleware"
+	"smartdevices/internal/models"
+	"smartdevices/internal/notifications"
+
+	"gorm.io/gorm"
+)
+
+var notificationSortFields = map[string]string{
+	"id":         "id",
+	"created_at": "created_at",
+}
+
+type NotificationAPIHandler struct {
+	db             *gorm.DB
+	authMiddleware *middleware.AuthMiddleware
+}
+
+func NewNotificationAPIHandler(db *gorm.DB) *NotificationAPIHandler {
+	return &NotificationAPIHandler{
+		db:             db,
+		authMiddleware: middleware.NewAuthMiddleware(db),
+	}
+}
+
+// GET /api/notifications?unread=true&type=... - входящие текущего пользователя, новые первыми
+func (h *NotificationAPIHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	params, err := parsePageParams(r, notificationSortFields, "-created_at")
+	if err != nil {
+		writePageError(w, err)
+		return
+	}
+
+	query := h.db.Model(&models.Notification{}).Where("client_id = ?", currentUser.ClientID)
+	if r.URL.Query().Get("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+	if notificationType := r.URL.Query().Get("type"); notificationType != "" {
+		query = query.Where("type = ?", notificationType)
+	}
+
+	var items []models.Notification
+	total, err := paginate(query, params, &items)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := []serializers.NotificationResponse{}
+	for _, notification := range items {
+		response = append(response, serializers.NotificationToJSON(notification))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newPageResponse(response, params, len(items), total))
+}
+
+// GET /api/notifications/unread-count - количество непрочитанных для значка в шапке
+func (h *NotificationAPIHandler) GetUnreadCount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var count int64
+	result := h.db.Model(&models.Notification{}).
+		Where("client_id = ? AND read_at IS NULL", currentUser.ClientID).
+		Count(&count)
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"count": count})
+}
+
+// POST /api/notifications/{id}/read - отметить уведомление прочитанным
+func (h *NotificationAPIHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/notifications/")
+	idStr = strings.TrimSuffix(idStr, "/read")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+		return
+	}
+
+	var notification models.Notification
+	result := h.db.Where("id = ? AND client_id = ?", id, currentUser.ClientID).First(&notification)
+	if result.Error != nil {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+
+	// Повторная отметка не меняет время прочтения
+	if notification.ReadAt == nil {
+		now := time.Now()
+		if err := h.db.Model(&notification).Update("read_at", now).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		notification.ReadAt = &now
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.NotificationToJSON(notification))
+}
+
+// POST /api/notifications/read-all - отметить прочитанными все уведомления
+func (h *NotificationAPIHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	result := h.db.Model(&models.Notification{}).
+		Where("client_id = ? AND read_at IS NULL", currentUser.ClientID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"updated": result.RowsAffected})
+}
+
+// GET /api/notifications/preferences - включенные типы уведомлений {тип: true|false}
+func (h *NotificationAPIHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	preferences, err := notifications.Preferences(h.db, currentUser.ClientID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preferences)
+}
+
+// PUT /api/notifications/preferences - включение и отключение типов; неуказанные типы не меняются
+func (h *NotificationAPIHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var changes map[string]bool
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	for notificationType := range changes {
+		if !notifications.IsKnownType(notificationType) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("unknown notification type %q, allowed: %s",
+					notificationType, strings.Join(notifications.Types, ", ")),
+			})
+			return
+		}
+	}
+
+	preferences, err := notifications.SetPreferences(h.db, currentUser.ClientID, changes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preferences)
+}
@@ -2,25 +2,41 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/events"
 	"smartdevices/internal/middleware"
 	"smartdevices/internal/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxLineConfigKeys = 20
+
+var (
+	errInvalidSplit = errors.New("Split quantity must be positive and less than the line quantity")
+	errLinesLocked  = errors.New("order lines are locked after the order is formed")
 )
 
 type OrderItemAPIHandler struct {
 	db             *gorm.DB
 	authMiddleware *middleware.AuthMiddleware
+	events         *events.Broker
 }
 
-func NewOrderItemAPIHandler(db *gorm.DB) *OrderItemAPIHandler {
+func NewOrderItemAPIHandler(db *gorm.DB, broker *events.Broker) *OrderItemAPIHandler {
 	return &OrderItemAPIHandler{
 		db:             db,
 		authMiddleware: middleware.NewAuthMiddleware(db),
+		events:         broker,
 	}
 }
 
@@ -28,7 +44,7 @@ func NewOrderItemAPIHandler(db *gorm.DB) *OrderItemAPIHandler {
 func (h *OrderItemAPIHandler) UpdateOrderItem(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -57,36 +73,41 @@ func (h *OrderItemAPIHandler) UpdateOrderItem(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	var request struct {
-		Quantity int `json:"quantity"`
-	}
-
+	var request serializers.OrderItemUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if request.Quantity <= 0 {
-		http.Error(w, "Quantity must be positive", http.StatusBadRequest)
-		return
-	}
-
 	// Ищем устройство ИМЕННО в этой корзине
-	var orderItem models.OrderItem
-	result = h.db.Where("order_id = ? AND device_id = ?", order.ID, deviceID).First(&orderItem)
-	if result.Error != nil {
+	var lines []models.OrderItem
+	h.db.Preload("Device").Where("order_id = ? AND device_id = ?", order.ID, deviceID).Order("id").Find(&lines)
+	if len(lines) == 0 {
 		http.Error(w, "Device not found in cart", http.StatusNotFound)
 		return
 	}
+	if len(lines) > 1 {
+		http.Error(w, `{"error": "Device is split into several lines, use /api/order-items/lines/{id}"}`, http.StatusConflict)
+		return
+	}
 
-	orderItem.Quantity = request.Quantity
-	h.db.Save(&orderItem)
+	orderItem := lines[0]
+	if err := applyLineUpdate(&orderItem, request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.saveLine(&orderItem); err != nil {
+		writeLineError(w, err)
+		return
+	}
+	publishCart(h.db, h.events, currentUser.ClientID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"device_id": orderItem.DeviceID,
 		"quantity":  orderItem.Quantity,
 		"updated":   true,
+		"line":      serializers.OrderItemToJSON(orderItem),
 	})
 }
 
@@ -94,7 +115,7 @@ func (h *OrderItemAPIHandler) UpdateOrderItem(w http.ResponseWriter, r *http.Req
 func (h *OrderItemAPIHandler) DeleteOrderItem(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -135,17 +156,301 @@ func (h *OrderItemAPIHandler) DeleteOrderItem(w http.ResponseWriter, r *http.Req
 
 	log.Printf("🛠️ Found cart: ID=%d", order.ID)
 
-	// Удаляем устройство ИЗ ЭТОЙ КОРЗИНЫ
-	var orderItem models.OrderItem
-	result = h.db.Where("order_id = ? AND device_id = ?", order.ID, deviceID).First(&orderItem)
-	if result.Error != nil {
-		log.Printf("❌ Device %d not found in cart %d: %v", deviceID, order.ID, result.Error)
+	// Удаляем устройство ИЗ ЭТОЙ КОРЗИНЫ - все его строки
+	log.Printf("🛠️ Deleting device %d from cart %d", deviceID, order.ID)
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockDraftOrder(tx, order.ID); err != nil {
+			return err
+		}
+		result := tx.Where("order_id = ? AND device_id = ?", order.ID, deviceID).Delete(&models.OrderItem{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return bumpOrderVersion(tx, order.ID)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("❌ Device %d not found in cart %d", deviceID, order.ID)
 		http.Error(w, "Device not found in cart", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		writeLineError(w, err)
+		return
+	}
+	publishCart(h.db, h.events, currentUser.ClientID)
 
-	log.Printf("🛠️ Deleting device %d from cart %d", deviceID, order.ID)
-	h.db.Delete(&orderItem)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /api/order-items/lines/{lineId} - изменение строки: количество, помещение, примечание, настройки
+func (h *OrderItemAPIHandler) UpdateOrderLine(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	line, ok := h.loadDraftLine(w, r)
+	if !ok {
+		return
+	}
+
+	var request serializers.OrderItemUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := applyLineUpdate(&line, request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.saveLine(&line); err != nil {
+		writeLineError(w, err)
+		return
+	}
+	publishCart(h.db, h.events, line.Order.ClientID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.OrderItemToJSON(line))
+}
+
+// POST /api/order-items/lines/{lineId}/split - перенос части количества в новую строку
+func (h *OrderItemAPIHandler) SplitOrderLine(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	source, ok := h.loadDraftLine(w, r)
+	if !ok {
+		return
+	}
+
+	var request serializers.OrderItemSplitRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validateLineFields(request.Room, request.PlacementNotes, request.Config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	line := models.OrderItem{
+		OrderID:        source.OrderID,
+		DeviceID:       source.DeviceID,
+		Quantity:       request.Quantity,
+		Room:           strings.TrimSpace(request.Room),
+		PlacementNotes: strings.TrimSpace(request.PlacementNotes),
+		Config:         request.Config,
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockDraftOrder(tx, source.OrderID); err != nil {
+			return err
+		}
+		// Блокируем исходную строку, чтобы параллельные разбиения не ушли в минус
+		var locked models.OrderItem
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, source.ID).Error; err != nil {
+			return err
+		}
+		if request.Quantity <= 0 || request.Quantity >= locked.Quantity {
+			return errInvalidSplit
+		}
+		source.Quantity = locked.Quantity - request.Quantity
+		if err := tx.Model(&locked).Update("quantity", source.Quantity).Error; err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Create(&line).Error; err != nil {
+			return err
+		}
+		return bumpOrderVersion(tx, source.OrderID)
+	})
+	if err != nil {
+		writeLineError(w, err)
+		return
+	}
+
+	line.Device = source.Device
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serializers.OrderItemSplitResponse{
+		Source: serializers.OrderItemToJSON(source),
+		Line:   serializers.OrderItemToJSON(line),
+	})
+}
+
+// DELETE /api/order-items/lines/{lineId} - удаление одной строки
+func (h *OrderItemAPIHandler) DeleteOrderLine(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	line, ok := h.loadDraftLine(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockDraftOrder(tx, line.OrderID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.OrderItem{}, line.ID).Error; err != nil {
+			return err
+		}
+		return bumpOrderVersion(tx, line.OrderID)
+	})
+	if err != nil {
+		writeLineError(w, err)
+		return
+	}
+	publishCart(h.db, h.events, line.Order.ClientID)
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// loadDraftLine находит строку заявки текущего пользователя по /api/order-items/lines/{lineId}.
+// После формирования заявки строки заблокированы - отвечает 409.
+// Окончательная проверка статуса - в транзакции изменения (lockDraftOrder).
+func (h *OrderItemAPIHandler) loadDraftLine(w http.ResponseWriter, r *http.Request) (models.OrderItem, bool) {
+	var line models.OrderItem
+
+	// Получаем текущего пользователя
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return line, false
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/order-items/lines/")
+	idStr = strings.TrimSuffix(idStr, "/split")
+	lineID, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid line ID", http.StatusBadRequest)
+		return line, false
+	}
+
+	result := h.db.Preload("Device").Preload("Order").First(&line, lineID)
+	if result.Error != nil || line.Order.ClientID != currentUser.ClientID || line.Order.Status == "deleted" {
+		http.Error(w, "Order line not found", http.StatusNotFound)
+		return line, false
+	}
+	if line.Order.Status != "draft" {
+		writeLineError(w, errLinesLocked)
+		return line, false
+	}
+	return line, true
+}
+
+// lockDraftOrder блокирует заявку до конца транзакции и проверяет, что она еще черновик.
+// Формирование меняет ту же строку smart_orders, поэтому правка позиций и /form не пересекаются.
+func lockDraftOrder(tx *gorm.DB, orderID uint) error {
+	var order models.SmartOrder
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "status").
+		First(&order, orderID).Error
+	if err != nil {
+		return err
+	}
+	if order.Status != "draft" {
+		return errLinesLocked
+	}
+	return nil
+}
+
+// Ответ на ошибку изменения строк заявки
+func writeLineError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errLinesLocked):
+		http.Error(w, `{"error": "Order lines are locked after the order is formed"}`, http.StatusConflict)
+	case errors.Is(err, errInvalidSplit):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Order line not found", http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// applyLineUpdate применяет переданные поля к строке с проверкой
+func applyLineUpdate(line *models.OrderItem, request serializers.OrderItemUpdateRequest) error {
+	if request.Quantity != nil {
+		if *request.Quantity <= 0 {
+			return errors.New("Quantity must be positive")
+		}
+		line.Quantity = *request.Quantity
+	}
+	if request.Room != nil {
+		line.Room = strings.TrimSpace(*request.Room)
+	}
+	if request.PlacementNotes != nil {
+		line.PlacementNotes = strings.TrimSpace(*request.PlacementNotes)
+	}
+	if request.Config != nil {
+		line.Config = request.Config
+	}
+	return validateLineFields(line.Room, line.PlacementNotes, line.Config)
+}
+
+// Ограничения совпадают с размерами колонок order_items
+func validateLineFields(room, notes string, config map[string]string) error {
+	if utf8.RuneCountInString(room) > 100 {
+		return errors.New("Room must be at most 100 characters")
+	}
+	if utf8.RuneCountInString(notes) > 500 {
+		return errors.New("Placement notes must be at most 500 characters")
+	}
+	if len(config) > maxLineConfigKeys {
+		return fmt.Errorf("Config may contain at most %d keys", maxLineConfigKeys)
+	}
+	for key, value := range config {
+		if strings.TrimSpace(key) == "" || utf8.RuneCountInString(key) > 50 {
+			return errors.New("Config keys must be non-empty and at most 50 characters")
+		}
+		if utf8.RuneCountInString(value) > 200 {
+			return fmt.Errorf("Config value for %q must be at most 200 characters", key)
+		}
+	}
+	return nil
+}
+
+// saveLine сохраняет редактируемые поля строки и меняет версию заявки,
+// если заявка все еще черновик
+func (h *OrderItemAPIHandler) saveLine(line *models.OrderItem) error {
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockDraftOrder(tx, line.OrderID); err != nil {
+			return err
+		}
+		err := tx.Model(line).
+			Select("quantity", "room", "placement_notes", "config").
+			Updates(line).Error
+		if err != nil {
+			return err
+		}
+		return bumpOrderVersion(tx, line.OrderID)
+	})
+}
+
+// Состав заявки входит в ее представление, поэтому меняет и версию (ETag)
+func bumpOrderVersion(tx *gorm.DB, orderID uint) error {
+	// Update (не UpdateColumn) также обновляет updated_at - от него считается простой черновика
+	return tx.Model(&models.SmartOrder{}).
+		Where("id = ?", orderID).
+		Update("version", gorm.Expr("version + 1")).Error
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"smartdevices/internal/models"
+)
+
+// Статус проверяется в транзакции изменения: строку нельзя править после /form,
+// даже если черновик был загружен до формирования
+func TestSaveLineRequiresDraft(t *testing.T) {
+	tests := []struct {
+		status  string
+		wantErr error
+	}{
+		{"draft", nil},
+		{"formed", errLinesLocked},
+		{"completed", errLinesLocked},
+		{"deleted", errLinesLocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			db := newTestDB(t)
+			client := models.Client{Username: "client", Password: "x"}
+			device := models.SmartDevice{Name: "Лампа", Model: "L1", IsActive: true}
+			for _, value := range []interface{}{&client, &device} {
+				if err := db.Create(value).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			order := models.SmartOrder{Status: "draft", ClientID: client.ID}
+			if err := db.Create(&order).Error; err != nil {
+				t.Fatal(err)
+			}
+			line := models.OrderItem{OrderID: order.ID, DeviceID: device.ID, Quantity: 1}
+			if err := db.Omit("Order", "Device").Create(&line).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Model(&order).Update("status", tt.status).Error; err != nil {
+				t.Fatal(err)
+			}
+			var before models.SmartOrder
+			db.First(&before, order.ID)
+
+			h := &OrderItemAPIHandler{db: db}
+			line.Quantity = 5
+			err := h.saveLine(&line)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("saveLine() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var saved models.OrderItem
+			var after models.SmartOrder
+			db.First(&saved, line.ID)
+			db.First(&after, order.ID)
+			wantQuantity, wantVersion := 1, before.Version
+			if tt.wantErr == nil {
+				wantQuantity, wantVersion = 5, before.Version+1
+			}
+			if saved.Quantity != wantQuantity || after.Version != wantVersion {
+				t.Errorf("quantity = %d, version = %d, want %d, %d", saved.Quantity, after.Version, wantQuantity, wantVersion)
+			}
+		})
+	}
+}
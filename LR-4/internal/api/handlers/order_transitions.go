@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/catalog"
+	"smartdevices/internal/events"
+	"smartdevices/internal/inventory"
+	"smartdevices/internal/models"
+	"smartdevices/internal/notifications"
+	"smartdevices/internal/webhooks"
+
+	"gorm.io/gorm"
+)
+
+var (
+	errOrderNotFormed = errors.New("only formed orders can be completed or rejected")
+	errOrderConflict  = errors.New("order was modified concurrently, reload and retry")
+	errReasonRequired = errors.New("rejection reason is required")
+)
+
+// Расчет общего трафика по формуле из лабы 2.
+// Коэффициент берется из категории устройства - items должны быть загружены с Device.Category.
+func calculateOrderTraffic(items []models.OrderItem) float64 {
+	totalTraffic := 0.0
+	for _, item := range items {
+		baseTraffic := item.Device.DataPerHour * float64(item.Quantity)
+		totalTraffic += baseTraffic * catalog.TrafficCoefficient(item.Device)
+	}
+	return totalTraffic
+}
+
+// completeOrder завершает сформированную заявку и считает трафик.
+// Используется одиночным и массовым завершением.
+func (h *SmartOrderAPIHandler) completeOrder(order *models.SmartOrder, moderatorID uint) ([]models.OrderItem, error) {
+	if order.Status != "formed" {
+		return nil, errOrderNotFormed
+	}
+
+	var items []models.OrderItem
+	if err := h.db.Preload("Device.Category").Where("order_id = ?", order.ID).Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	// Установка статуса, модератора и даты завершения
+	now := time.Now()
+	updated := *order
+	updated.Status = "completed"
+	updated.CompletedAt = &now
+	updated.ModeratorID = &moderatorID
+	updated.TotalTraffic = calculateOrderTraffic(items)
+
+	if err := h.saveOrderVersion(&updated, order.Status, &moderatorID, ""); err != nil {
+		return nil, err
+	}
+	*order = updated
+	return items, nil
+}
+
+// rejectOrder отклоняет сформированную заявку с указанием причины
+func (h *SmartOrderAPIHandler) rejectOrder(order *models.SmartOrder, moderatorID uint, reason string) error {
+	if order.Status != "formed" {
+		return errOrderNotFormed
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return errReasonRequired
+	}
+
+	now := time.Now()
+	updated := *order
+	updated.Status = "rejected"
+	updated.CompletedAt = &now
+	updated.ModeratorID = &moderatorID
+	updated.RejectionReason = reason
+
+	if err := h.saveOrderVersion(&updated, order.Status, &moderatorID, reason); err != nil {
+		return err
+	}
+	*order = updated
+	return nil
+}
+
+// ExpireDraft удаляет заброшенный черновик по задаче обслуживания.
+// false - черновик уже не draft или изменен после выборки, удаление пропускается.
+func (h *SmartOrderAPIHandler) ExpireDraft(order models.SmartOrder, comment string) (bool, error) {
+	if order.Status != "draft" {
+		return false, nil
+	}
+	updated := order
+	updated.Status = "deleted"
+	err := h.saveOrderVersion(&updated, order.Status, nil, comment)
+	if errors.Is(err, errOrderConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// saveOrderVersion увеличивает версию и сохраняет заявку, если в БД не было изменений
+// и заявка все еще в статусе fromStatus.
+// Если статус отличается от fromStatus, той же транзакцией меняется склад,
+// переход записывается в историю, создаются уведомления и ставится в очередь webhook.
+// После фиксации транзакции переход рассылается подключенным пользователям.
+func (h *SmartOrderAPIHandler) saveOrderVersion(order *models.SmartOrder, fromStatus string, changedBy *uint, comment string) error {
+	expectedVersion := order.Version
+	order.Version++
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		// Условие по статусу: переход из fromStatus выполняется один раз
+		saved, err := saveVersioned(tx.Where("status = ?", fromStatus), order, expectedVersion)
+		if err != nil {
+			return err
+		}
+		if !saved {
+			return errOrderConflict
+		}
+		if order.Status == fromStatus {
+			return nil
+		}
+		if err := inventory.ApplyTransition(tx, order.ID, fromStatus, order.Status); err != nil {
+			return err
+		}
+		if err := recordStatusChange(tx, order.ID, fromStatus, order.Status, changedBy, comment); err != nil {
+			return err
+		}
+		if err := notifications.OrderTransition(tx, *order, comment); err != nil {
+			return err
+		}
+		if event, ok := webhooks.OrderEvent(order.Status); ok {
+			return enqueueOrderEvent(tx, event, *order)
+		}
+		return nil
+	})
+	if err == nil && order.Status != fromStatus {
+		h.publishOrderStatus(*order, fromStatus)
+	}
+	return err
+}
+
+// publishOrderStatus уведомляет подключенных пользователей после сохранения перехода:
+// владельца - о новом статусе (и пустой корзине, если ушел черновик), модераторов - о новой заявке
+func (h *SmartOrderAPIHandler) publishOrderStatus(order models.SmartOrder, fromStatus string) {
+	h.events.PublishToUser(order.ClientID, events.TypeOrderStatus, events.OrderStatus{
+		OrderID:    order.ID,
+		FromStatus: fromStatus,
+		Status:     order.Status,
+		Version:    order.Version,
+		ChangedAt:  time.Now(),
+	})
+
+	if fromStatus == "draft" {
+		publishCart(h.db, h.events, order.ClientID)
+	}
+
+	if order.Status == "formed" {
+		formed := events.OrderFormed{
+			OrderID:    order.ID,
+			ClientID:   order.ClientID,
+			ClientName: order.Client.Username,
+			Address:    order.Address,
+			FormedAt:   order.FormedAt,
+		}
+		if formed.ClientName == "" {
+			h.db.Model(&models.Client{}).Select("username").Where("id = ?", order.ClientID).Scan(&formed.ClientName)
+		}
+		h.events.PublishToModerators(events.TypeOrderFormed, formed)
+	}
+}
+
+// enqueueOrderEvent ставит в очередь webhook о переходе заявки вместе с ее составом
+func enqueueOrderEvent(tx *gorm.DB, event string, order models.SmartOrder) error {
+	var items []models.OrderItem
+	if err := tx.Preload("Device").Where("order_id = ?", order.ID).Order("id").Find(&items).Error; err != nil {
+		return err
+	}
+	if order.Client.ID == 0 {
+		tx.Select("id", "username").First(&order.Client, order.ClientID)
+	}
+
+	itemResponses := make([]serializers.SmartOrderItemResponse, 0, len(items))
+	for _, item := range items {
+		itemResponses = append(itemResponses, serializers.OrderItemToJSON(item))
+	}
+	return webhooks.Enqueue(tx, event, serializers.SmartOrderToJSON(order, itemResponses))
+}
+
+// recordStatusChange добавляет запись в историю статусов заявки
+func recordStatusChange(tx *gorm.DB, orderID uint, fromStatus, toStatus string, changedBy *uint, comment string) error {
+	return tx.Create(&models.OrderStatusHistory{
+		OrderID:     orderID,
+		FromStatus:  fromStatus,
+		ToStatus:    toStatus,
+		ChangedByID: changedBy,
+		Comment:     comment,
+	}).Error
+}
+
+// Ответ на ошибку перехода статуса заявки
+func writeTransitionError(w http.ResponseWriter, err error) {
+	var shortage *inventory.ShortageError
+	switch {
+	case errors.As(err, &shortage):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":     "Insufficient stock for some devices",
+			"shortages": shortage.Shortages,
+		})
+	case errors.Is(err, errOrderNotFormed):
+		http.Error(w, "Only formed orders can be completed or rejected", http.StatusBadRequest)
+	case errors.Is(err, errReasonRequired):
+		http.Error(w, "Rejection reason is required", http.StatusBadRequest)
+	case errors.Is(err, errOrderConflict):
+		http.Error(w, `{"error": "Resource was modified, reload and retry"}`, http.StatusPreconditionFailed)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"smartdevices/internal/api/serializers"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+var (
+	errInvalidLimit  = errors.New("limit must be between 1 and 100")
+	errInvalidCursor = errors.New("invalid cursor")
+)
+
+// pageParams - параметры страницы: limit, смещение и ORDER BY из белого списка
+type pageParams struct {
+	Limit  int
+	Offset int
+	Order  string
+}
+
+// parsePageParams читает limit, offset/cursor и sort.
+// sort - поле из белого списка, "-" в начале означает убывание (sort=-created_at).
+// sortFields сопоставляет имена полей API с колонками БД.
+func parsePageParams(r *http.Request, sortFields map[string]string, defaultSort string) (pageParams, error) {
+	params := pageParams{Limit: defaultPageLimit}
+	query := r.URL.Query()
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return params, errInvalidLimit
+		}
+		params.Limit = limit
+	}
+
+	// Курсор имеет приоритет над offset
+	if cursor := query.Get("cursor"); cursor != "" {
+		offset, err := decodeCursor(cursor)
+		if err != nil {
+			return params, err
+		}
+		params.Offset = offset
+	} else if offsetStr := query.Get("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return params, errors.New("offset must be a non-negative integer")
+		}
+		params.Offset = offset
+	}
+
+	sort := query.Get("sort")
+	if sort == "" {
+		sort = defaultSort
+	}
+	direction := "ASC"
+	field := sort
+	if strings.HasPrefix(sort, "-") {
+		direction = "DESC"
+		field = sort[1:]
+	}
+	column, ok := sortFields[field]
+	if !ok {
+		allowed := make([]string, 0, len(sortFields))
+		for name := range sortFields {
+			allowed = append(allowed, name)
+		}
+		return params, fmt.Errorf("unsupported sort field %q, allowed: %s", field, strings.Join(allowed, ", "))
+	}
+	// id добавляется для стабильного порядка при равных значениях
+	params.Order = column + " " + direction
+	if field != "id" {
+		params.Order += ", " + sortFields["id"] + " " + direction
+	}
+
+	return params, nil
+}
+
+// paginate считает total по фильтрованному запросу и загружает одну страницу в dest.
+// Связи подгружаются только для страницы - Count с Preload не используется.
+func paginate(query *gorm.DB, params pageParams, dest interface{}, preloads ...string) (int64, error) {
+	base := query.Session(&gorm.Session{})
+
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		return 0, err
+	}
+
+	page := base.Order(params.Order).Limit(params.Limit).Offset(params.Offset)
+	for _, preload := range preloads {
+		page = page.Preload(preload)
+	}
+	if err := page.Find(dest).Error; err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// newPageResponse собирает конверт; next_cursor пустой на последней странице
+func newPageResponse(items interface{}, params pageParams, returned int, total int64) serializers.PageResponse {
+	page := serializers.PageResponse{Items: items, Total: total}
+	if next := params.Offset + returned; returned == params.Limit && int64(next) < total {
+		cursor := encodeCursor(next)
+		page.NextCursor = &cursor
+	}
+	return page
+}
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(raw), "offset:"))
+	if err != nil || offset < 0 || !strings.HasPrefix(string(raw), "offset:") {
+		return 0, errInvalidCursor
+	}
+	return offset, nil
+}
+
+// writePageError - ошибка разбора параметров страницы
+func writePageError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, offset := range []int{0, 1, 20, 100000} {
+		got, err := decodeCursor(encodeCursor(offset))
+		if err != nil || got != offset {
+			t.Errorf("decodeCursor(encodeCursor(%d)) = %d, %v", offset, got, err)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	for _, cursor := range []string{
+		"not base64!",
+		raw("20"),
+		raw("offset:"),
+		raw("offset:-1"),
+		raw("offset:abc"),
+		raw("id:20"),
+		base64.StdEncoding.EncodeToString([]byte("offset:20")) + "==",
+	} {
+		if _, err := decodeCursor(cursor); !errors.Is(err, errInvalidCursor) {
+			t.Errorf("decodeCursor(%q) error = %v, want errInvalidCursor", cursor, err)
+		}
+	}
+}
+
+var testSortFields = map[string]string{
+	"id":         "t.id",
+	"created_at": "t.created_at",
+}
+
+func TestParsePageParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    pageParams
+		wantErr bool
+	}{
+		{"defaults", "", pageParams{Limit: 20, Order: "t.created_at DESC, t.id DESC"}, false},
+		{"limit and offset", "?limit=5&offset=10", pageParams{Limit: 5, Offset: 10, Order: "t.created_at DESC, t.id DESC"}, false},
+		{"cursor wins over offset", "?offset=3&cursor=" + encodeCursor(40), pageParams{Limit: 20, Offset: 40, Order: "t.created_at DESC, t.id DESC"}, false},
+		{"ascending sort", "?sort=created_at", pageParams{Limit: 20, Order: "t.created_at ASC, t.id ASC"}, false},
+		{"id sort has no tiebreaker", "?sort=-id", pageParams{Limit: 20, Order: "t.id DESC"}, false},
+		{"max limit", "?limit=100", pageParams{Limit: 100, Order: "t.created_at DESC, t.id DESC"}, false},
+		{"limit too large", "?limit=101", pageParams{}, true},
+		{"zero limit", "?limit=0", pageParams{}, true},
+		{"negative offset", "?offset=-1", pageParams{}, true},
+		{"bad cursor", "?cursor=xyz", pageParams{}, true},
+		{"unknown sort field", "?sort=password", pageParams{}, true},
+		{"sql in sort", "?sort=id%3BDROP%20TABLE%20t", pageParams{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/items"+tt.query, nil)
+			got, err := parsePageParams(r, testSortFields, "-created_at")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePageParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parsePageParams() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPageResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		offset   int
+		returned int
+		total    int64
+		next     int
+	}{
+		{"first of several pages", 0, 10, 25, 10},
+		{"middle page", 10, 10, 25, 20},
+		{"short last page", 20, 5, 25, -1},
+		{"full last page", 20, 10, 30, -1},
+		{"empty", 0, 0, 0, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := newPageResponse([]int{}, pageParams{Limit: 10, Offset: tt.offset}, tt.returned, tt.total)
+			if page.Total != tt.total {
+				t.Errorf("Total = %d, want %d", page.Total, tt.total)
+			}
+			if tt.next < 0 {
+				if page.NextCursor != nil {
+					t.Errorf("NextCursor = %q, want nil", *page.NextCursor)
+				}
+				return
+			}
+			if page.NextCursor == nil {
+				t.Fatal("NextCursor = nil")
+			}
+			if offset, _ := decodeCursor(*page.NextCursor); offset != tt.next {
+				t.Errorf("next offset = %d, want %d", offset, tt.next)
+			}
+		})
+	}
+}
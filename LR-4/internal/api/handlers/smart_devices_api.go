@@ -2,80 +2,127 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/catalog"
 	"smartdevices/internal/middleware"
 	"smartdevices/internal/models"
+	"smartdevices/internal/search"
 	"smartdevices/internal/storage"
+	"smartdevices/internal/webhooks"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type SmartDeviceAPIHandler struct {
 	db             *gorm.DB
 	authMiddleware *middleware.AuthMiddleware
+	store          storage.ObjectStore // файлы изображений: MinIO или локальный каталог
 }
 
-func NewSmartDeviceAPIHandler(db *gorm.DB) *SmartDeviceAPIHandler {
+func NewSmartDeviceAPIHandler(db *gorm.DB, store storage.ObjectStore) *SmartDeviceAPIHandler {
 	return &SmartDeviceAPIHandler{
 		db:             db,
 		authMiddleware: middleware.NewAuthMiddleware(db),
+		store:          store,
 	}
 }
 
-// GET /api/smart-devices - список с фильтрацией
+// GET /api/smart-devices - список с фильтрацией и фасетами
 func (h *SmartDeviceAPIHandler) GetSmartDevices(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	search := r.URL.Query().Get("search")
-	protocol := r.URL.Query().Get("protocol")
+	params, err := parsePageParams(r, deviceSortFields, "id")
+	if err != nil {
+		writePageError(w, err)
+		return
+	}
+
+	searchQuery, searching := search.Parse(r.URL.Query().Get("search"))
+	filters := deviceFilters(r, searchQuery, searching)
 
 	var devices []models.SmartDevice
-	query := h.db.Where("is_active = ?", true)
+	query := h.catalogQuery(filters, "")
 
-	if search != "" {
-		query = query.Where("name ILIKE ? OR description ILIKE ?",
-			"%"+search+"%", "%"+search+"%")
+	// Полнотекстовый поиск; без явного sort - сначала самые релевантные
+	if searching {
+		query = searchQuery.WithRank(query)
+		if r.URL.Query().Get("sort") == "" {
+			params.Order = search.RankOrder + ", id ASC"
+		}
 	}
 
-	if protocol != "" {
-		query = query.Where("protocol = ?", protocol)
+	total, err := paginate(query, params, &devices, "Category", "Tags", "Images")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	result := query.Find(&devices)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
-		return
+	var highlights map[uint]search.Highlight
+	if searching {
+		ids := make([]uint, len(devices))
+		for i, device := range devices {
+			ids[i] = device.ID
+		}
+		if highlights, err = searchQuery.Highlights(h.db, ids); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 
-	var response []serializers.SmartDeviceResponse
+	response := []serializers.SmartDeviceResponse{}
 	for _, device := range devices {
-		response = append(response, serializers.SmartDeviceToJSON(device))
+		item := serializers.SmartDeviceToJSON(device)
+		if highlight, ok := highlights[device.ID]; ok {
+			item.Highlight = &highlight
+		}
+		response = append(response, item)
+	}
+
+	facets, err := h.deviceFacets(filters)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(serializers.DeviceCatalogResponse{
+		PageResponse: newPageResponse(response, params, len(devices), total),
+		Facets:       facets,
+	})
+}
+
+// Поля сортировки каталога: имя в API -> колонка
+var deviceSortFields = map[string]string{
+	"id":            "id",
+	"name":          "name",
+	"model":         "model",
+	"avg_data_rate": "avg_data_rate",
+	"data_per_hour": "data_per_hour",
+	"created_at":    "created_at",
+	"available":     "(stock_quantity - reserved_quantity)",
 }
 
 // GET /api/smart-devices/{id} - одна запись
 func (h *SmartDeviceAPIHandler) GetSmartDevice(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -90,12 +137,13 @@ func (h *SmartDeviceAPIHandler) GetSmartDevice(w http.ResponseWriter, r *http.Re
 	}
 
 	var device models.SmartDevice
-	result := h.db.First(&device, id)
+	result := h.db.Preload("Category").Preload("Tags").Preload("Images").First(&device, id)
 	if result.Error != nil {
 		http.Error(w, "Device not found", http.StatusNotFound)
 		return
 	}
 
+	setETag(w, device.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(serializers.SmartDeviceToJSON(device))
 }
@@ -104,7 +152,8 @@ func (h *SmartDeviceAPIHandler) GetSmartDevice(w http.ResponseWriter, r *http.Re
 func (h *SmartDeviceAPIHandler) CreateSmartDevice(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -122,9 +171,25 @@ func (h *SmartDeviceAPIHandler) CreateSmartDevice(w http.ResponseWriter, r *http
 		return
 	}
 
+	stock := 0
+	if req.StockQuantity != nil {
+		stock = *req.StockQuantity
+	}
+	if stock < 0 {
+		http.Error(w, "Stock quantity must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	taxonomy, err := h.parseDeviceTaxonomy(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	device := models.SmartDevice{
 		Name:           req.Name,
 		Model:          req.Model,
+		Vendor:         strings.TrimSpace(req.Vendor),
 		AvgDataRate:    req.AvgDataRate,
 		DataPerHour:    req.DataPerHour,
 		NamespaceURL:   req.NamespaceURL,
@@ -132,14 +197,35 @@ func (h *SmartDeviceAPIHandler) CreateSmartDevice(w http.ResponseWriter, r *http
 		DescriptionAll: req.DescriptionAll,
 		Protocol:       req.Protocol,
 		IsActive:       true,
+		Version:        1,
+		StockQuantity:  stock,
 	}
 
-	result := h.db.Create(&device)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	taxonomy.setCategoryOf(&device)
+	if err := h.applySpecs(&device, taxonomy, true); err != nil {
+		writeSpecsError(w, err)
 		return
 	}
 
+	author := h.currentUserID(r)
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(&device).Error; err != nil {
+			return err
+		}
+		if err := taxonomy.saveTags(tx, &device); err != nil {
+			return err
+		}
+		if err := catalog.RecordRevision(tx, device, models.RevisionCreate, author, nil); err != nil {
+			return err
+		}
+		return webhooks.Enqueue(tx, webhooks.EventDeviceCreated, serializers.SmartDeviceToJSON(device))
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	setETag(w, device.Version)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(serializers.SmartDeviceToJSON(device))
@@ -149,7 +235,8 @@ func (h *SmartDeviceAPIHandler) CreateSmartDevice(w http.ResponseWriter, r *http
 func (h *SmartDeviceAPIHandler) UpdateSmartDevice(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -164,29 +251,72 @@ func (h *SmartDeviceAPIHandler) UpdateSmartDevice(w http.ResponseWriter, r *http
 	}
 
 	var device models.SmartDevice
-	result := h.db.First(&device, id)
+	result := h.db.Preload("Category").Preload("Tags").Preload("Images").First(&device, id)
 	if result.Error != nil {
 		http.Error(w, "Device not found", http.StatusNotFound)
 		return
 	}
 
+	// Оптимистическая блокировка: клиент должен прислать ETag прочитанной версии
+	if !checkIfMatch(w, r, device.Version) {
+		return
+	}
+
 	var req serializers.SmartDeviceCreateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	taxonomy, err := h.parseDeviceTaxonomy(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	device.Name = req.Name
 	device.Model = req.Model
+	device.Vendor = strings.TrimSpace(req.Vendor)
 	device.AvgDataRate = req.AvgDataRate
 	device.DataPerHour = req.DataPerHour
-	device.NamespaceURL = req.NamespaceURL
+	// С галереей namespace_url - URL основного изображения; меняется через /images
+	if len(device.Images) == 0 {
+		device.NamespaceURL = req.NamespaceURL
+	}
 	device.Description = req.Description
 	device.DescriptionAll = req.DescriptionAll
 	device.Protocol = req.Protocol
 
-	h.db.Save(&device)
+	// Резерв меняет версию устройства, поэтому сравнение идет с актуальным значением
+	if req.StockQuantity != nil {
+		if *req.StockQuantity < device.ReservedQuantity {
+			http.Error(w, fmt.Sprintf("Stock quantity must not be less than reserved (%d)", device.ReservedQuantity),
+				http.StatusBadRequest)
+			return
+		}
+		device.StockQuantity = *req.StockQuantity
+	}
+
+	taxonomy.setCategoryOf(&device)
+	if err := h.applySpecs(&device, taxonomy, false); err != nil {
+		writeSpecsError(w, err)
+		return
+	}
 
+	expectedVersion := device.Version
+	device.Version++
+	saved, err := h.saveDeviceVersion(&device, expectedVersion, webhooks.EventDeviceUpdated,
+		taxonomy.saveTags, recordRevision(models.RevisionUpdate, h.currentUserID(r), nil))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !saved {
+		http.Error(w, `{"error": "Resource was modified, reload and retry"}`, http.StatusPreconditionFailed)
+		return
+	}
+
+	setETag(w, device.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(serializers.SmartDeviceToJSON(device))
 }
@@ -195,7 +325,8 @@ func (h *SmartDeviceAPIHandler) UpdateSmartDevice(w http.ResponseWriter, r *http
 func (h *SmartDeviceAPIHandler) DeleteSmartDevice(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -210,15 +341,30 @@ func (h *SmartDeviceAPIHandler) DeleteSmartDevice(w http.ResponseWriter, r *http
 	}
 
 	var device models.SmartDevice
-	result := h.db.First(&device, id)
+	result := h.db.Preload("Category").Preload("Tags").Preload("Images").First(&device, id)
 	if result.Error != nil {
 		http.Error(w, "Device not found", http.StatusNotFound)
 		return
 	}
 
+	if !checkIfMatch(w, r, device.Version) {
+		return
+	}
+
 	// ТОЛЬКО деактивация устройства, без удаления изображения из MinIO
+	expectedVersion := device.Version
 	device.IsActive = false
-	h.db.Save(&device)
+	device.Version++
+	saved, err := h.saveDeviceVersion(&device, expectedVersion, webhooks.EventDeviceDeleted,
+		recordRevision(models.RevisionDeactivate, h.currentUserID(r), nil))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !saved {
+		http.Error(w, `{"error": "Resource was modified, reload and retry"}`, http.StatusPreconditionFailed)
+		return
+	}
 
 	fmt.Printf("✅ Device deactivated: %s (ID: %d)\n", device.Name, device.ID)
 
@@ -226,39 +372,19 @@ func (h *SmartDeviceAPIHandler) DeleteSmartDevice(w http.ResponseWriter, r *http
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// POST /api/smart-devices/{id}/image - добавление изображения
+// POST /api/smart-devices/{id}/image - добавление изображения.
+// Оставлено для совместимости: файл добавляется в галерею и становится основным.
 func (h *SmartDeviceAPIHandler) UploadDeviceImage(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	// Парсим multipart form
-	err := r.ParseMultipartForm(32 << 20) // 32 MB max
-	if err != nil {
-		http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	// Получаем файл из формы
-	file, handler, err := r.FormFile("image")
-	if err != nil {
-		http.Error(w, "Failed to get image file: "+err.Error(), http.StatusBadRequest)
-		return
-	}
-	defer file.Close()
-
-	// Читаем файл в память
-	fileData, err := io.ReadAll(file)
-	if err != nil {
-		http.Error(w, "Failed to read file: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
 	idStr := strings.TrimPrefix(r.URL.Path, "/api/smart-devices/")
 	idStr = strings.TrimSuffix(idStr, "/image")
 	id, err := strconv.Atoi(idStr)
@@ -274,44 +400,32 @@ func (h *SmartDeviceAPIHandler) UploadDeviceImage(w http.ResponseWriter, r *http
 		return
 	}
 
-	// Генерируем имя файла на латинице
-	fileExt := ".png"
-	if strings.Contains(handler.Filename, ".") {
-		fileExt = filepath.Ext(handler.Filename)
-	}
-	newFileName := fmt.Sprintf("device_%d_%d%s", device.ID, time.Now().Unix(), fileExt)
-
-	// Загружаем файл в MinIO
-	minioClient := storage.NewMinIOClient()
-	err = minioClient.UploadFile(newFileName, fileData)
+	image, size, status, err := h.addImage(w, r, device, true)
 	if err != nil {
-		fmt.Printf("❌ MinIO upload failed: %v\n", err)
-		http.Error(w, "Failed to upload image to storage: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), status)
 		return
 	}
 
-	// Обновляем URL в БД
-	namespaceURL := minioClient.GetImageURL(newFileName)
-	device.NamespaceURL = namespaceURL
-	h.db.Save(&device)
-
-	fmt.Printf("✅ Image uploaded: %s (%d bytes)\n", newFileName, len(fileData))
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":   true,
-		"message":   "Image uploaded successfully",
-		"image_url": namespaceURL,
-		"file_name": newFileName,
-		"file_size": len(fileData),
+		"success":       true,
+		"message":       "Image uploaded successfully",
+		"image_url":     image.URL,
+		"thumbnail_url": image.ThumbnailURL,
+		"medium_url":    image.MediumURL,
+		"file_name":     image.ObjectName,
+		"file_size":     size,
+		"image_id":      image.ID,
 	})
 }
 
-// DELETE /api/smart-devices/{id}/image - удаление изображения устройства
+// DELETE /api/smart-devices/{id}/image - удаление основного изображения устройства.
+// Основным становится следующее изображение галереи.
 func (h *SmartDeviceAPIHandler) DeleteDeviceImage(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -333,22 +447,18 @@ func (h *SmartDeviceAPIHandler) DeleteDeviceImage(w http.ResponseWriter, r *http
 		return
 	}
 
-	// Удаляем изображение из MinIO если есть
-	if device.NamespaceURL != "" && strings.Contains(device.NamespaceURL, "localhost:9000") {
-		filename := filepath.Base(device.NamespaceURL)
-		minioClient := storage.NewMinIOClient()
-		err := minioClient.DeleteFile(filename)
-		if err != nil {
-			fmt.Printf("⚠️ Failed to delete image from MinIO: %v\n", err)
-			http.Error(w, "Failed to delete image from storage", http.StatusInternalServerError)
+	var image models.DeviceImage
+	err = h.db.Where("device_id = ? AND is_primary", device.ID).First(&image).Error
+	switch {
+	case err == nil:
+		if err := h.removeImage(r.Context(), image, h.currentUserID(r)); err != nil {
+			fmt.Printf("⚠️ Failed to delete image: %v\n", err)
+			http.Error(w, "Failed to delete image", http.StatusInternalServerError)
 			return
-		} else {
-			fmt.Printf("✅ Image deleted from MinIO: %s\n", filename)
 		}
-
-		// Очищаем URL в БД
-		device.NamespaceURL = ""
-		h.db.Save(&device)
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -357,3 +467,24 @@ func (h *SmartDeviceAPIHandler) DeleteDeviceImage(w http.ResponseWriter, r *http
 		"message": "Image deleted successfully",
 	})
 }
+
+// saveDeviceVersion сохраняет устройство с проверкой версии и в той же транзакции
+// выполняет extra (например, замену меток) и ставит в очередь webhook об изменении
+func (h *SmartDeviceAPIHandler) saveDeviceVersion(device *models.SmartDevice, expectedVersion uint, event string,
+	extra ...func(tx *gorm.DB, device *models.SmartDevice) error) (bool, error) {
+	saved := false
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		saved, err = saveVersioned(tx, device, expectedVersion)
+		if err != nil || !saved {
+			return err
+		}
+		for _, step := range extra {
+			if err := step(tx, device); err != nil {
+				return err
+			}
+		}
+		return webhooks.Enqueue(tx, event, serializers.SmartDeviceToJSON(*device))
+	})
+	return saved, err
+}
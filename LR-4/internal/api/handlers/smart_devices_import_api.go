@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/catalog"
+	"smartdevices/internal/importer"
+	"smartdevices/internal/models"
+)
+
+// MaxImportSize - предел файла импорта каталога
+const MaxImportSize = 10 << 20 // 10 MB
+
+// POST /api/smart-devices/import?dry_run=true&format=csv|json - массовая загрузка каталога (модератор).
+// Устройства сопоставляются по модели. Если хоть одна строка с ошибкой, ничего не сохраняется (422);
+// dry_run только проверяет файл и возвращает тот же отчет.
+func (h *SmartDeviceAPIHandler) ImportSmartDevices(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, `{"error": "dry_run must be true or false"}`, http.StatusBadRequest)
+			return
+		}
+		dryRun = parsed
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxImportSize))
+	if err != nil {
+		http.Error(w, `{"error": "Import file must be at most 10 MB"}`, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	format := importFormat(r, data)
+	lines, err := catalog.ReadRecords(format, data)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	report, err := importer.Run(h.db, lines, importer.Options{
+		DryRun:        dryRun,
+		ChangedBy:     h.currentUserID(r),
+		DevicePayload: serializers.SmartDevicePayload,
+	})
+	switch {
+	case errors.Is(err, importer.ErrConflict):
+		writeJSONError(w, http.StatusConflict, err)
+		return
+	case errors.Is(err, importer.ErrTooManyRecords):
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("📥 Devices import (%s, dry_run=%t): %d created, %d updated, %d unchanged, %d failed",
+		format, dryRun, report.Created, report.Updated, report.Unchanged, report.Failed)
+
+	status := http.StatusOK
+	if report.Failed > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// GET /api/smart-devices/export?format=csv|json - выгрузка каталога в формате импорта (модератор).
+// Выгружаются и неактивные устройства, чтобы файл можно было загрузить обратно без потерь.
+func (h *SmartDeviceAPIHandler) ExportSmartDevices(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag, Content-Disposition")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = catalog.FormatCSV
+	}
+	if format != catalog.FormatCSV && format != catalog.FormatJSON {
+		http.Error(w, `{"error": "Format must be csv or json"}`, http.StatusBadRequest)
+		return
+	}
+
+	var devices []models.SmartDevice
+	if err := h.db.Preload("Category").Preload("Tags").Order("id").Find(&devices).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == catalog.FormatJSON {
+		contentType = "application/json"
+	}
+	filename := fmt.Sprintf("smart_devices_%s.%s", time.Now().Format("20060102_150405"), format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	writer, err := catalog.NewRecordWriter(format, w)
+	for i := 0; err == nil && i < len(devices); i++ {
+		err = writer.Write(catalog.RecordOf(devices[i]))
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+
+	// Заголовки уже отправлены - ошибку можно только залогировать
+	if err != nil {
+		log.Printf("❌ Devices export failed: %v", err)
+		return
+	}
+	log.Printf("📤 Devices exported: %d rows (%s)", len(devices), format)
+}
+
+// importFormat - формат из параметра format, затем из Content-Type, иначе по содержимому
+func importFormat(r *http.Request, data []byte) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case strings.Contains(contentType, "json"):
+		return catalog.FormatJSON
+	case strings.Contains(contentType, "csv"):
+		return catalog.FormatCSV
+	}
+	return catalog.DetectFormat(data)
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/catalog"
+	"smartdevices/internal/models"
+	"smartdevices/internal/webhooks"
+
+	"gorm.io/gorm"
+)
+
+// Поля сортировки истории устройства
+var revisionSortFields = map[string]string{
+	"id":         "revision",
+	"created_at": "created_at",
+}
+
+// GET /api/smart-devices/{id}/revisions - история изменений устройства (модератор)
+func (h *SmartDeviceAPIHandler) GetDeviceRevisions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	id, _, err := parseDeviceSubpath(r.URL.Path, "revisions")
+	if err != nil {
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+
+	var device models.SmartDevice
+	if err := h.db.Select("id").First(&device, id).Error; err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	params, err := parsePageParams(r, revisionSortFields, "-id")
+	if err != nil {
+		writePageError(w, err)
+		return
+	}
+
+	var revisions []models.DeviceRevision
+	query := h.db.Model(&models.DeviceRevision{}).Where("device_id = ?", device.ID)
+	total, err := paginate(query, params, &revisions, "ChangedBy")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := []serializers.DeviceRevisionResponse{}
+	for _, revision := range revisions {
+		response = append(response, serializers.DeviceRevisionToJSON(revision))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newPageResponse(response, params, len(revisions), total))
+}
+
+// GET /api/smart-devices/{id}/revisions/diff?from=1&to=3 - отличия между ревизиями (модератор).
+// Без to сравнивается последняя ревизия, без from - предыдущая перед to.
+func (h *SmartDeviceAPIHandler) GetDeviceRevisionDiff(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	id, _, err := parseDeviceSubpath(r.URL.Path, "revisions")
+	if err != nil {
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+
+	to, err := revisionParam(r, "to")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if to == 0 {
+		err := h.db.Model(&models.DeviceRevision{}).
+			Where("device_id = ?", id).
+			Select("COALESCE(MAX(revision), 0)").
+			Scan(&to).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	from, err := revisionParam(r, "from")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if from == 0 && to > 0 {
+		from = to - 1
+		if from == 0 {
+			writeJSONError(w, http.StatusBadRequest, errors.New("revision 1 has no previous revision, pass from"))
+			return
+		}
+	}
+
+	fromRevision, err := h.loadRevision(id, from)
+	if err != nil {
+		writeRevisionError(w, err)
+		return
+	}
+	toRevision, err := h.loadRevision(id, to)
+	if err != nil {
+		writeRevisionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.DeviceRevisionDiffResponse{
+		DeviceID: uint(id),
+		From:     fromRevision.Revision,
+		To:       toRevision.Revision,
+		Changes:  catalog.DiffSnapshots(fromRevision.Snapshot, toRevision.Snapshot),
+	})
+}
+
+// POST /api/smart-devices/{id}/revisions/{rev}/revert - возврат устройства к ревизии (модератор).
+// Восстанавливаются поля каталога, категория, метки и характеристики; остаток и изображение
+// не меняются - ими управляют заявки и загрузка изображений. Откат сохраняется новой ревизией.
+func (h *SmartDeviceAPIHandler) RevertDeviceRevision(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	id, rest, err := parseDeviceSubpath(r.URL.Path, "revisions")
+	if err != nil || len(rest) != 2 || rest[1] != "revert" {
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+	number, err := strconv.ParseUint(rest[0], 10, 32)
+	if err != nil || number == 0 {
+		http.Error(w, "Invalid revision number", http.StatusBadRequest)
+		return
+	}
+
+	var device models.SmartDevice
+	result := h.db.Preload("Category").Preload("Tags").Preload("Images").First(&device, id)
+	if result.Error != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	if !checkIfMatch(w, r, device.Version) {
+		return
+	}
+
+	revision, err := h.loadRevision(id, uint(number))
+	if err != nil {
+		writeRevisionError(w, err)
+		return
+	}
+	snapshot := revision.Snapshot
+
+	// Категория ревизии могла быть удалена - тогда сначала нужно выбрать новую обычной правкой
+	taxonomy := deviceTaxonomy{
+		setCategory: true,
+		setTags:     true,
+		tags:        snapshot.Tags,
+		setSpecs:    true,
+		specs:       snapshot.Specs,
+	}
+	if snapshot.CategoryID != nil {
+		var category models.Category
+		if err := h.db.First(&category, *snapshot.CategoryID).Error; err != nil {
+			writeJSONError(w, http.StatusConflict,
+				fmt.Errorf("category of revision %d no longer exists", revision.Revision))
+			return
+		}
+		taxonomy.category = &category
+	}
+
+	device.Name = snapshot.Name
+	device.Model = snapshot.Model
+	device.Vendor = snapshot.Vendor
+	device.AvgDataRate = snapshot.AvgDataRate
+	device.DataPerHour = snapshot.DataPerHour
+	device.Description = snapshot.Description
+	device.DescriptionAll = snapshot.DescriptionAll
+	device.Protocol = snapshot.Protocol
+	device.IsActive = snapshot.IsActive
+
+	taxonomy.setCategoryOf(&device)
+	if err := h.applySpecs(&device, taxonomy, false); err != nil {
+		writeSpecsError(w, err)
+		return
+	}
+
+	expectedVersion := device.Version
+	device.Version++
+	saved, err := h.saveDeviceVersion(&device, expectedVersion, webhooks.EventDeviceUpdated,
+		taxonomy.saveTags, recordRevision(models.RevisionRevert, h.currentUserID(r), &revision.Revision))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !saved {
+		http.Error(w, `{"error": "Resource was modified, reload and retry"}`, http.StatusPreconditionFailed)
+		return
+	}
+
+	fmt.Printf("⏪ Device %d reverted to revision %d\n", device.ID, revision.Revision)
+
+	setETag(w, device.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.SmartDeviceToJSON(device))
+}
+
+var errRevisionNotFound = errors.New("revision not found")
+
+// loadRevision читает ревизию устройства по номеру
+func (h *SmartDeviceAPIHandler) loadRevision(deviceID int, number uint) (models.DeviceRevision, error) {
+	var revision models.DeviceRevision
+	err := h.db.Where("device_id = ? AND revision = ?", deviceID, number).First(&revision).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return revision, errRevisionNotFound
+	}
+	return revision, err
+}
+
+// writeRevisionError - 404 для отсутствующей ревизии, иначе 500
+func writeRevisionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errRevisionNotFound) {
+		writeJSONError(w, http.StatusNotFound, err)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// parseDeviceSubpath разбирает /api/smart-devices/{id}/{section}[/...]:
+// возвращает ID устройства и части пути после section
+func parseDeviceSubpath(path, section string) (int, []string, error) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/api/smart-devices/"), "/"), "/")
+	if len(parts) < 2 || parts[1] != section {
+		return 0, nil, fmt.Errorf("invalid %s path", section)
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, parts[2:], nil
+}
+
+// revisionParam читает номер ревизии из query; 0 - параметр не передан
+func revisionParam(r *http.Request, name string) (uint, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	number, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || number == 0 {
+		return 0, fmt.Errorf("%s must be a positive revision number", name)
+	}
+	return uint(number), nil
+}
+
+// recordRevision - шаг транзакции сохранения устройства, записывающий ревизию.
+// Идет после saveTags, чтобы в снимок попали новые метки.
+func recordRevision(action string, changedBy *uint, revertedFrom *uint) func(tx *gorm.DB, device *models.SmartDevice) error {
+	return func(tx *gorm.DB, device *models.SmartDevice) error {
+		return catalog.RecordRevision(tx, *device, action, changedBy, revertedFrom)
+	}
+}
+
+// currentUserID - ID автора изменения; nil, если сессии нет
+func (h *SmartDeviceAPIHandler) currentUserID(r *http.Request) *uint {
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		return nil
+	}
+	id := currentUser.ClientID
+	return &id
+}
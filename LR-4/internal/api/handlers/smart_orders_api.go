@@ -7,9 +7,13 @@ import (
 	"strings"
 	"time"
 
+	"smartdevices/internal/address"
 	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/compatibility"
+	"smartdevices/internal/events"
 	"smartdevices/internal/middleware"
 	"smartdevices/internal/models"
+	"smartdevices/internal/session"
 
 	"gorm.io/gorm"
 )
@@ -17,12 +21,18 @@ import (
 type SmartOrderAPIHandler struct {
 	db             *gorm.DB
 	authMiddleware *middleware.AuthMiddleware
+	geocoder       address.Geocoder
+	compatibility  *compatibility.Engine
+	events         *events.Broker
 }
 
-func NewSmartOrderAPIHandler(db *gorm.DB) *SmartOrderAPIHandler {
+func NewSmartOrderAPIHandler(db *gorm.DB, geocoder address.Geocoder, compatibilityEngine *compatibility.Engine, broker *events.Broker) *SmartOrderAPIHandler {
 	return &SmartOrderAPIHandler{
 		db:             db,
 		authMiddleware: middleware.NewAuthMiddleware(db),
+		geocoder:       geocoder,
+		compatibility:  compatibilityEngine,
+		events:         broker,
 	}
 }
 
@@ -30,7 +40,8 @@ func NewSmartOrderAPIHandler(db *gorm.DB) *SmartOrderAPIHandler {
 func (h *SmartOrderAPIHandler) GetCart(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -44,29 +55,7 @@ func (h *SmartOrderAPIHandler) GetCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var order models.SmartOrder
-	result := h.db.Where("status = ? AND client_id = ?", "draft", currentUser.ClientID).First(&order)
-
-	var response struct {
-		OrderID uint `json:"order_id"`
-		Count   int  `json:"count"`
-	}
-
-	if result.Error != nil {
-		response.OrderID = 0
-		response.Count = 0
-	} else {
-		response.OrderID = order.ID
-		var totalQuantity struct {
-			Total int
-		}
-		h.db.Model(&models.OrderItem{}).
-			Select("SUM(quantity) as total").
-			Where("order_id = ?", order.ID).
-			Scan(&totalQuantity)
-
-		response.Count = totalQuantity.Total
-	}
+	response := draftCart(h.db, currentUser.ClientID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -76,7 +65,8 @@ func (h *SmartOrderAPIHandler) GetCart(w http.ResponseWriter, r *http.Request) {
 func (h *SmartOrderAPIHandler) GetSmartOrders(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -90,71 +80,46 @@ func (h *SmartOrderAPIHandler) GetSmartOrders(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	status := r.URL.Query().Get("status")
-	dateFromStr := r.URL.Query().Get("date_from")
-	dateToStr := r.URL.Query().Get("date_to")
-
-	var orders []models.SmartOrder
-	query := h.db.Preload("Client").Preload("Moderator")
-
-	// Если не модератор - показываем только свои заявки
-	if !currentUser.IsModerator {
-		query = query.Where("client_id = ?", currentUser.ClientID)
-	} else {
-		// Модераторы не видят черновики и удаленные
-		query = query.Where("status != ? AND status != ?", "deleted", "draft")
-	}
-
-	if status != "" {
-		query = query.Where("status = ?", status)
-	}
-
-	if dateFromStr != "" {
-		if dateFrom, err := time.Parse("2006-01-02", dateFromStr); err == nil {
-			query = query.Where("formed_at >= ?", dateFrom)
-		}
+	params, err := parsePageParams(r, orderSortFields, "-created_at")
+	if err != nil {
+		writePageError(w, err)
+		return
 	}
 
-	if dateToStr != "" {
-		if dateTo, err := time.Parse("2006-01-02", dateToStr); err == nil {
-			query = query.Where("formed_at <= ?", dateTo.AddDate(0, 0, 1))
-		}
+	var orders []models.SmartOrder
+	total, err := paginate(h.ordersQuery(currentUser, r), params, &orders, "Client", "Moderator")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	result := query.Find(&orders)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	// Позиции всех заявок страницы - одним запросом (плюс один на устройства)
+	itemsByOrder, err := h.loadOrderItems(orders)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	var response []serializers.SmartOrderResponse
+	response := []serializers.SmartOrderResponse{}
 	for _, order := range orders {
-		var items []models.OrderItem
-		h.db.Preload("Device").Where("order_id = ?", order.ID).Find(&items)
-
 		var itemResponses []serializers.SmartOrderItemResponse
-		for _, item := range items {
-			itemResponses = append(itemResponses, serializers.SmartOrderItemResponse{
-				DeviceID:     item.DeviceID,
-				DeviceName:   item.Device.Name,
-				Quantity:     item.Quantity,
-				DataPerHour:  item.Device.DataPerHour,
-				NamespaceURL: item.Device.NamespaceURL,
-			})
+		for _, item := range itemsByOrder[order.ID] {
+			itemResponses = append(itemResponses, serializers.OrderItemToJSON(item))
 		}
 
 		response = append(response, serializers.SmartOrderToJSON(order, itemResponses))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(newPageResponse(response, params, len(orders), total))
 }
 
 // GET /api/smart-orders/{id} - одна заявка
 func (h *SmartOrderAPIHandler) GetSmartOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -189,21 +154,16 @@ func (h *SmartOrderAPIHandler) GetSmartOrder(w http.ResponseWriter, r *http.Requ
 	}
 
 	var items []models.OrderItem
-	h.db.Preload("Device").Where("order_id = ?", order.ID).Find(&items)
+	h.db.Preload("Device").Where("order_id = ?", order.ID).Order("id").Find(&items)
 
 	var itemResponses []serializers.SmartOrderItemResponse
 	for _, item := range items {
-		itemResponses = append(itemResponses, serializers.SmartOrderItemResponse{
-			DeviceID:     item.DeviceID,
-			DeviceName:   item.Device.Name,
-			Quantity:     item.Quantity,
-			DataPerHour:  item.Device.DataPerHour,
-			NamespaceURL: item.Device.NamespaceURL,
-		})
+		itemResponses = append(itemResponses, serializers.OrderItemToJSON(item))
 	}
 
 	response := serializers.SmartOrderToJSON(order, itemResponses)
 
+	setETag(w, order.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
@@ -212,7 +172,8 @@ func (h *SmartOrderAPIHandler) GetSmartOrder(w http.ResponseWriter, r *http.Requ
 func (h *SmartOrderAPIHandler) UpdateSmartOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -246,6 +207,10 @@ func (h *SmartOrderAPIHandler) UpdateSmartOrder(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if !checkIfMatch(w, r, order.Version) {
+		return
+	}
+
 	var req serializers.SmartOrderUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -253,12 +218,44 @@ func (h *SmartOrderAPIHandler) UpdateSmartOrder(w http.ResponseWriter, r *http.R
 	}
 
 	// Обновляем только разрешенные поля
-	if req.Address != "" {
+	switch {
+	case req.SavedAddressID != nil:
+		// Адрес из адресной книги владельца заявки
+		var saved models.ClientAddress
+		result := h.db.Where("id = ? AND client_id = ?", *req.SavedAddressID, order.ClientID).First(&saved)
+		if result.Error != nil {
+			http.Error(w, "Saved address not found", http.StatusNotFound)
+			return
+		}
+		order.AddressDetails = saved.Address
+		order.Address = address.Format(saved.Address)
+	case req.AddressDetails != nil:
+		prepared, fieldErrors := address.Prepare(r.Context(), h.geocoder, serializers.AddressFromRequest(*req.AddressDetails))
+		if len(fieldErrors) > 0 {
+			writeAddressErrors(w, fieldErrors)
+			return
+		}
+		order.AddressDetails = prepared
+		order.Address = address.Format(prepared)
+	case req.Address != "":
+		// Текст без разбора на поля: прежний структурированный адрес больше не соответствует заявке
 		order.Address = req.Address
+		order.AddressDetails = models.StructuredAddress{}
 	}
 
-	h.db.Save(&order)
+	expectedVersion := order.Version
+	order.Version++
+	saved, err := saveVersioned(h.db, &order, expectedVersion)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !saved {
+		http.Error(w, `{"error": "Resource was modified, reload and retry"}`, http.StatusPreconditionFailed)
+		return
+	}
 
+	setETag(w, order.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(serializers.SmartOrderToJSON(order, nil))
 }
@@ -267,7 +264,8 @@ func (h *SmartOrderAPIHandler) UpdateSmartOrder(w http.ResponseWriter, r *http.R
 func (h *SmartOrderAPIHandler) FormSmartOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -302,19 +300,58 @@ func (h *SmartOrderAPIHandler) FormSmartOrder(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// Сформировать можно только черновик: повторное формирование задвоило бы резерв и уведомления
+	if order.Status != "draft" {
+		http.Error(w, `{"error": "Only draft orders can be formed"}`, http.StatusConflict)
+		return
+	}
+
+	if !checkIfMatch(w, r, order.Version) {
+		return
+	}
+
 	// Проверка обязательных полей
-	if order.Address == "" {
-		http.Error(w, "Address is required to form order", http.StatusBadRequest)
+	if address.IsEmpty(order.AddressDetails) {
+		http.Error(w, "Structured address is required to form order", http.StatusBadRequest)
+		return
+	}
+	if fieldErrors := address.Validate(order.AddressDetails); len(fieldErrors) > 0 {
+		writeAddressErrors(w, fieldErrors)
+		return
+	}
+
+	// Проверка совместимости устройств в заявке
+	cart, err := h.loadCompatibilityCart(order)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(cart.Items) == 0 {
+		http.Error(w, "Order has no devices", http.StatusBadRequest)
+		return
+	}
+	if violations := h.compatibility.Validate(cart); len(violations) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":      "Order violates device compatibility rules",
+			"violations": violations,
+		})
 		return
 	}
 
 	// Установка статуса и даты формирования
 	now := time.Now()
+	fromStatus := order.Status
 	order.Status = "formed"
 	order.FormedAt = &now
 
-	h.db.Save(&order)
+	if err := h.saveOrderVersion(&order, fromStatus, &currentUser.ClientID, ""); err != nil {
+		writeTransitionError(w, err)
+		return
+	}
 
+	setETag(w, order.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(serializers.SmartOrderToJSON(order, nil))
 }
@@ -323,7 +360,8 @@ func (h *SmartOrderAPIHandler) FormSmartOrder(w http.ResponseWriter, r *http.Req
 func (h *SmartOrderAPIHandler) CompleteSmartOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -352,73 +390,89 @@ func (h *SmartOrderAPIHandler) CompleteSmartOrder(w http.ResponseWriter, r *http
 		return
 	}
 
-	// Проверяем что заявка сформирована
-	if order.Status != "formed" {
-		http.Error(w, "Only formed orders can be completed", http.StatusBadRequest)
+	if !checkIfMatch(w, r, order.Version) {
 		return
 	}
 
-	// Расчет общего трафика по формуле из лабы 2
-	var items []models.OrderItem
-	h.db.Preload("Device").Where("order_id = ?", order.ID).Find(&items)
-
-	totalTraffic := 0.0
-	for _, item := range items {
-		baseTraffic := item.Device.DataPerHour * float64(item.Quantity)
-
-		// Формула расчета с коэффициентами для разных типов устройств
-		var coefficient float64
-		switch {
-		case strings.Contains(item.Device.Name, "Хаб"):
-			coefficient = 1.3 // Хабы требуют больше трафика
-		case strings.Contains(item.Device.Name, "Датчик"):
-			coefficient = 0.7 // Датчики экономят трафик
-		case strings.Contains(item.Device.Name, "Лампочка"):
-			coefficient = 1.1 // Лампочки немного больше
-		case strings.Contains(item.Device.Name, "Розетка"):
-			coefficient = 0.9 // Розетки мало трафика
-		case strings.Contains(item.Device.Name, "Выключатель"):
-			coefficient = 0.8 // Выключатели мало трафика
-		default:
-			coefficient = 1.0
-		}
-
-		traffic := baseTraffic * coefficient
-		totalTraffic += traffic
+	items, err := h.completeOrder(&order, currentUser.ClientID)
+	if err != nil {
+		writeTransitionError(w, err)
+		return
 	}
 
-	// Установка статуса, модератора и даты завершения
-	now := time.Now()
-	order.Status = "completed"
-	order.CompletedAt = &now
-	order.ModeratorID = &currentUser.ClientID
-	order.TotalTraffic = totalTraffic
-
-	h.db.Save(&order)
-
 	// Загружаем items для ответа
 	var itemResponses []serializers.SmartOrderItemResponse
 	for _, item := range items {
-		itemResponses = append(itemResponses, serializers.SmartOrderItemResponse{
-			DeviceID:     item.DeviceID,
-			DeviceName:   item.Device.Name,
-			Quantity:     item.Quantity,
-			DataPerHour:  item.Device.DataPerHour,
-			NamespaceURL: item.Device.NamespaceURL,
-		})
+		itemResponses = append(itemResponses, serializers.OrderItemToJSON(item))
 	}
 
 	response := serializers.SmartOrderToJSON(order, itemResponses)
 
+	setETag(w, order.Version)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// PUT /api/smart-orders/{id}/reject - отклонение заявки
+func (h *SmartOrderAPIHandler) RejectSmartOrder(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Проверяем права модератора
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil || !currentUser.IsModerator {
+		http.Error(w, `{"error": "Moderator access required"}`, http.StatusForbidden)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/smart-orders/")
+	idStr = strings.TrimSuffix(idStr, "/reject")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req serializers.SmartOrderRejectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var order models.SmartOrder
+	result := h.db.Preload("Client").First(&order, id)
+	if result.Error != nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	if !checkIfMatch(w, r, order.Version) {
+		return
+	}
+
+	if err := h.rejectOrder(&order, currentUser.ClientID, req.Reason); err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+
+	setETag(w, order.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.SmartOrderToJSON(order, nil))
+}
+
 // DELETE /api/smart-orders/{id} - удаление заявки
 func (h *SmartOrderAPIHandler) DeleteSmartOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -439,9 +493,10 @@ func (h *SmartOrderAPIHandler) DeleteSmartOrder(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	// Удаленная заявка не видна, как и в GetSmartOrder: повторное удаление не меняет версию
 	var order models.SmartOrder
 	result := h.db.First(&order, id)
-	if result.Error != nil {
+	if result.Error != nil || order.Status == "deleted" {
 		http.Error(w, "Order not found", http.StatusNotFound)
 		return
 	}
@@ -452,13 +507,170 @@ func (h *SmartOrderAPIHandler) DeleteSmartOrder(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if !checkIfMatch(w, r, order.Version) {
+		return
+	}
+
 	// Мягкое удаление - меняем статус
+	fromStatus := order.Status
 	order.Status = "deleted"
-	h.db.Save(&order)
+	if err := h.saveOrderVersion(&order, fromStatus, &currentUser.ClientID, ""); err != nil {
+		writeTransitionError(w, err)
+		return
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// ordersQuery - видимые пользователю заявки с фильтрами status, date_from, date_to.
+// Используется списком заявок и выгрузкой.
+func (h *SmartOrderAPIHandler) ordersQuery(currentUser *session.Session, r *http.Request) *gorm.DB {
+	status := r.URL.Query().Get("status")
+	dateFromStr := r.URL.Query().Get("date_from")
+	dateToStr := r.URL.Query().Get("date_to")
+	clientName := r.URL.Query().Get("client")
+	addressPart := r.URL.Query().Get("address")
+	trafficMinStr := r.URL.Query().Get("traffic_min")
+	trafficMaxStr := r.URL.Query().Get("traffic_max")
+	moderatorIDStr := r.URL.Query().Get("moderator_id")
+
+	query := h.db.Model(&models.SmartOrder{})
+
+	// Если не модератор - показываем только свои заявки
+	if !currentUser.IsModerator {
+		query = query.Where("smart_orders.client_id = ?", currentUser.ClientID)
+	} else {
+		// Модераторы не видят черновики и удаленные
+		query = query.Where("smart_orders.status != ? AND smart_orders.status != ?", "deleted", "draft")
+	}
+
+	if status != "" {
+		query = query.Where("smart_orders.status = ?", status)
+	}
+
+	if dateFromStr != "" {
+		if dateFrom, err := time.Parse("2006-01-02", dateFromStr); err == nil {
+			query = query.Where("smart_orders.formed_at >= ?", dateFrom)
+		}
+	}
+
+	if dateToStr != "" {
+		if dateTo, err := time.Parse("2006-01-02", dateToStr); err == nil {
+			query = query.Where("smart_orders.formed_at <= ?", dateTo.AddDate(0, 0, 1))
+		}
+	}
+
+	// Подзапросы вместо JOIN, чтобы выгрузка могла присоединять clients сама
+	if clientName != "" {
+		query = query.Where("smart_orders.client_id IN (SELECT id FROM clients WHERE username ILIKE ?)",
+			"%"+clientName+"%")
+	}
+
+	if addressPart != "" {
+		query = query.Where("smart_orders.address ILIKE ?", "%"+addressPart+"%")
+	}
+
+	if trafficMin, err := strconv.ParseFloat(trafficMinStr, 64); err == nil {
+		query = query.Where("smart_orders.total_traffic >= ?", trafficMin)
+	}
+
+	if trafficMax, err := strconv.ParseFloat(trafficMaxStr, 64); err == nil {
+		query = query.Where("smart_orders.total_traffic <= ?", trafficMax)
+	}
+
+	if moderatorID, err := strconv.Atoi(moderatorIDStr); err == nil {
+		query = query.Where("smart_orders.moderator_id = ?", moderatorID)
+	}
+
+	return query
+}
+
+// loadOrderItems загружает позиции сразу для набора заявок и группирует по заявке.
+// Число запросов не зависит от количества заявок на странице.
+func (h *SmartOrderAPIHandler) loadOrderItems(orders []models.SmartOrder) (map[uint][]models.OrderItem, error) {
+	itemsByOrder := make(map[uint][]models.OrderItem, len(orders))
+	if len(orders) == 0 {
+		return itemsByOrder, nil
+	}
+
+	orderIDs := make([]uint, len(orders))
+	for i, order := range orders {
+		orderIDs[i] = order.ID
+	}
+
+	var items []models.OrderItem
+	err := h.db.Preload("Device").
+		Where("order_id IN ?", orderIDs).
+		Order("order_id, id").
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		itemsByOrder[item.OrderID] = append(itemsByOrder[item.OrderID], item)
+	}
+	return itemsByOrder, nil
+}
+
+// Поля сортировки списка заявок: имя в API -> колонка
+var orderSortFields = map[string]string{
+	"id":            "smart_orders.id",
+	"status":        "smart_orders.status",
+	"created_at":    "smart_orders.created_at",
+	"formed_at":     "smart_orders.formed_at",
+	"completed_at":  "smart_orders.completed_at",
+	"total_traffic": "smart_orders.total_traffic",
+}
+
+// Собирает содержимое заявки, хабы по адресу установки и каталог для проверки совместимости
+func (h *SmartOrderAPIHandler) loadCompatibilityCart(order models.SmartOrder) (compatibility.Cart, error) {
+	var cart compatibility.Cart
+
+	var items []models.OrderItem
+	if err := h.db.Preload("Device.Category").Where("order_id = ?", order.ID).Find(&items).Error; err != nil {
+		return cart, err
+	}
+	for _, item := range items {
+		cart.Items = append(cart.Items, compatibility.CartItem{Device: item.Device, Quantity: item.Quantity})
+	}
+
+	// Хабы, установленные ранее по тому же адресу этого клиента.
+	// Адреса сравниваются по полям, а не по тексту: "ул. Ленина, д. 5" и "Ленина, 5" - один дом.
+	var completed []models.SmartOrder
+	err := h.db.Select("id", "address_postal_code", "address_street", "address_house", "address_apartment").
+		Where("client_id = ? AND status = ? AND id <> ?", order.ClientID, "completed", order.ID).
+		Find(&completed).Error
+	if err != nil {
+		return cart, err
+	}
+	var sameAddress []uint
+	for _, other := range completed {
+		if address.SameLocation(order.AddressDetails, other.AddressDetails) {
+			sameAddress = append(sameAddress, other.ID)
+		}
+	}
+
+	if len(sameAddress) > 0 {
+		var installed []models.OrderItem
+		err := h.db.Preload("Device.Category").Where("order_id IN ?", sameAddress).Find(&installed).Error
+		if err != nil {
+			return cart, err
+		}
+		for _, item := range installed {
+			if compatibility.IsHub(item.Device) {
+				cart.HubsAtAddress += item.Quantity
+			}
+		}
+	}
+
+	if err := h.db.Preload("Category").Where("is_active = ?", true).Find(&cart.Catalog).Error; err != nil {
+		return cart, err
+	}
+
+	return cart, nil
+}
+
 // Вспомогательная функция
 func uintPtr(i uint) *uint {
 	return &i
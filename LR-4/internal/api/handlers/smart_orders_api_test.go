@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"smartdevices/internal/events"
+	"smartdevices/internal/middleware"
+	"smartdevices/internal/models"
+	"smartdevices/internal/session"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testDBSeq int64
+
+// newTestDB - отдельная SQLite в памяти со схемой заявок и каталога
+func newTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	name := fmt.Sprintf("file:test%d?mode=memory&cache=shared", atomic.AddInt64(&testDBSeq, 1))
+	db, err := gorm.Open(sqlite.Open(name), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	err = db.AutoMigrate(&models.Client{}, &models.Category{}, &models.Tag{}, &models.SmartDevice{}, &models.DeviceImage{},
+		&models.SmartOrder{}, &models.OrderItem{}, &models.OrderStatusHistory{}, &models.OrderComment{},
+		&models.DeviceRevision{}, &models.WebhookSubscription{}, &models.WebhookDelivery{},
+		&models.Notification{}, &models.NotificationPreference{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// countQueries считает SELECT-запросы, выполненные через db после вызова
+func countQueries(t testing.TB, db *gorm.DB) *int64 {
+	t.Helper()
+	var count int64
+	increment := func(*gorm.DB) { atomic.AddInt64(&count, 1) }
+	if err := db.Callback().Query().After("gorm:query").Register("test:count_queries", increment); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Callback().Row().After("gorm:row").Register("test:count_rows", increment); err != nil {
+		t.Fatal(err)
+	}
+	return &count
+}
+
+// seedOrders создает сформированные заявки по две позиции в каждой
+func seedOrders(t testing.TB, db *gorm.DB, n int) {
+	t.Helper()
+	client := models.Client{Username: "client", Password: "x"}
+	moderator := models.Client{Username: "moderator", Password: "x", IsModerator: true}
+	devices := []models.SmartDevice{
+		{Name: "Лампа", Model: "L1", IsActive: true},
+		{Name: "Хаб", Model: "H1", IsActive: true},
+	}
+	for _, value := range []interface{}{&client, &moderator, &devices} {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	for i := 0; i < n; i++ {
+		order := models.SmartOrder{
+			Status:      "formed",
+			ClientID:    client.ID,
+			ModeratorID: &moderator.ID,
+			FormedAt:    &now,
+			Address:     fmt.Sprintf("ул. Ленина, д. %d", i+1),
+		}
+		if err := db.Create(&order).Error; err != nil {
+			t.Fatal(err)
+		}
+		for _, device := range devices {
+			item := models.OrderItem{OrderID: order.ID, DeviceID: device.ID, Quantity: i + 1}
+			if err := db.Omit("Order", "Device").Create(&item).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// listQueries - сколько запросов к БД делает GET /api/smart-orders для n заявок
+func listQueries(t *testing.T, n int) int64 {
+	db := newTestDB(t)
+	seedOrders(t, db, n)
+	count := countQueries(t, db)
+
+	h := &SmartOrderAPIHandler{db: db, authMiddleware: &middleware.AuthMiddleware{}}
+	r := httptest.NewRequest("GET", "/api/smart-orders?limit=100", nil)
+	r = r.WithContext(context.WithValue(r.Context(), "user", &session.Session{ClientID: 2, IsModerator: true}))
+	w := httptest.NewRecorder()
+	h.GetSmartOrders(w, r)
+
+	if w.Code != 200 {
+		t.Fatalf("GET /api/smart-orders = %d: %s", w.Code, w.Body)
+	}
+	var page struct {
+		Items []struct {
+			Items []json.RawMessage `json:"items"`
+		} `json:"items"`
+		Total int64 `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != n || page.Total != int64(n) {
+		t.Fatalf("returned %d orders (total %d), want %d", len(page.Items), page.Total, n)
+	}
+	for _, order := range page.Items {
+		if len(order.Items) != 2 {
+			t.Fatalf("order has %d items, want 2", len(order.Items))
+		}
+	}
+	return atomic.LoadInt64(count)
+}
+
+// Число запросов списка заявок не зависит от количества заявок на странице (нет N+1)
+func TestGetSmartOrdersQueryCount(t *testing.T) {
+	single := listQueries(t, 1)
+	many := listQueries(t, 25)
+	if single != many {
+		t.Errorf("queries for 1 order = %d, for 25 orders = %d, want equal", single, many)
+	}
+}
+
+func BenchmarkGetSmartOrders(b *testing.B) {
+	for _, n := range []int{1, 20, 100} {
+		b.Run(fmt.Sprintf("orders_%d", n), func(b *testing.B) {
+			db := newTestDB(b)
+			seedOrders(b, db, n)
+			count := countQueries(b, db)
+			h := &SmartOrderAPIHandler{db: db, authMiddleware: &middleware.AuthMiddleware{}}
+			user := &session.Session{ClientID: 2, IsModerator: true}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r := httptest.NewRequest("GET", "/api/smart-orders?limit=100", nil)
+				r = r.WithContext(context.WithValue(r.Context(), "user", user))
+				h.GetSmartOrders(httptest.NewRecorder(), r)
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(count))/float64(b.N), "queries/op")
+		})
+	}
+}
+
+// Повторное формирование отклоняется до проверок и изменений склада
+func TestFormSmartOrderRequiresDraft(t *testing.T) {
+	for _, status := range []string{"formed", "completed", "rejected", "deleted"} {
+		t.Run(status, func(t *testing.T) {
+			db := newTestDB(t)
+			client := models.Client{Username: "client", Password: "x"}
+			if err := db.Create(&client).Error; err != nil {
+				t.Fatal(err)
+			}
+			order := models.SmartOrder{Status: status, ClientID: client.ID}
+			if err := db.Create(&order).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			h := &SmartOrderAPIHandler{db: db, authMiddleware: &middleware.AuthMiddleware{}}
+			r := httptest.NewRequest("PUT", fmt.Sprintf("/api/smart-orders/%d/form", order.ID), nil)
+			r = r.WithContext(context.WithValue(r.Context(), "user", &session.Session{ClientID: client.ID}))
+			w := httptest.NewRecorder()
+			h.FormSmartOrder(w, r)
+
+			if w.Code != 409 {
+				t.Errorf("PUT /form for %s order = %d, want 409", status, w.Code)
+			}
+		})
+	}
+}
+
+// Переход сохраняется, только если статус в БД все еще fromStatus
+func TestSaveOrderVersionChecksFromStatus(t *testing.T) {
+	db := newTestDB(t)
+	client := models.Client{Username: "client", Password: "x"}
+	if err := db.Create(&client).Error; err != nil {
+		t.Fatal(err)
+	}
+	order := models.SmartOrder{Status: "draft", ClientID: client.ID}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Параллельный запрос уже сформировал заявку, версия в выборке совпадает
+	if err := db.Model(&models.SmartOrder{}).Where("id = ?", order.ID).UpdateColumn("status", "formed").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	h := &SmartOrderAPIHandler{db: db}
+	order.Status = "formed"
+	if err := h.saveOrderVersion(&order, "draft", &client.ID, ""); !errors.Is(err, errOrderConflict) {
+		t.Fatalf("saveOrderVersion() error = %v, want errOrderConflict", err)
+	}
+}
+
+// Автоудаление черновика пропускается, если его изменили после выборки задачей обслуживания
+func TestExpireDraft(t *testing.T) {
+	db := newTestDB(t)
+	client := models.Client{Username: "client", Password: "x"}
+	if err := db.Create(&client).Error; err != nil {
+		t.Fatal(err)
+	}
+	h := &SmartOrderAPIHandler{db: db, events: events.NewBroker(nil)}
+
+	newOrder := func(status string) models.SmartOrder {
+		order := models.SmartOrder{Status: status, ClientID: client.ID}
+		if err := db.Create(&order).Error; err != nil {
+			t.Fatal(err)
+		}
+		return order
+	}
+	stored := func(id uint) models.SmartOrder {
+		var order models.SmartOrder
+		db.First(&order, id)
+		return order
+	}
+
+	// Клиент изменил черновик: версия в БД больше, чем в выборке
+	raced := newOrder("draft")
+	if err := db.Model(&models.SmartOrder{}).Where("id = ?", raced.ID).UpdateColumn("version", 2).Error; err != nil {
+		t.Fatal(err)
+	}
+	if deleted, err := h.ExpireDraft(raced, "Автоудаление"); err != nil || deleted {
+		t.Errorf("ExpireDraft(stale) = %v, %v, want false", deleted, err)
+	}
+	if order := stored(raced.ID); order.Status != "draft" || order.Version != 2 {
+		t.Errorf("raced draft = %s v%d, want draft v2", order.Status, order.Version)
+	}
+
+	formed := newOrder("formed")
+	if deleted, err := h.ExpireDraft(formed, "Автоудаление"); err != nil || deleted {
+		t.Errorf("ExpireDraft(formed) = %v, %v, want false", deleted, err)
+	}
+
+	draft := newOrder("draft")
+	if deleted, err := h.ExpireDraft(draft, "Автоудаление"); err != nil || !deleted {
+		t.Fatalf("ExpireDraft() = %v, %v, want true", deleted, err)
+	}
+	var history models.OrderStatusHistory
+	db.Where("order_id = ?", draft.ID).First(&history)
+	if stored(draft.ID).Status != "deleted" || history.ToStatus != "deleted" || history.ChangedByID != nil || history.Comment != "Автоудаление" {
+		t.Errorf("expired draft history = %+v", history)
+	}
+}
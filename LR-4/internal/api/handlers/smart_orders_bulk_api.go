@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/models"
+)
+
+// Максимальное число заявок в одном массовом действии
+const maxBulkOrders = 100
+
+// POST /api/smart-orders/bulk - массовое завершение/отклонение заявок модератором
+func (h *SmartOrderAPIHandler) BulkSmartOrders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Проверяем права модератора
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil || !currentUser.IsModerator {
+		http.Error(w, `{"error": "Moderator access required"}`, http.StatusForbidden)
+		return
+	}
+
+	var req serializers.BulkOrderActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Action != "complete" && req.Action != "reject" {
+		http.Error(w, `{"error": "Action must be 'complete' or 'reject'"}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.OrderIDs) == 0 || len(req.OrderIDs) > maxBulkOrders {
+		http.Error(w, `{"error": "order_ids must contain from 1 to 100 IDs"}`, http.StatusBadRequest)
+		return
+	}
+
+	response := serializers.BulkOrderActionResponse{
+		Action:  req.Action,
+		Results: make([]serializers.BulkOrderActionResult, 0, len(req.OrderIDs)),
+	}
+
+	seen := make(map[uint]bool, len(req.OrderIDs))
+	for _, id := range req.OrderIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		// Каждая заявка обрабатывается отдельно: ошибка одной не прерывает остальные
+		result := serializers.BulkOrderActionResult{OrderID: id}
+
+		var order models.SmartOrder
+		if err := h.db.First(&order, id).Error; err != nil || order.Status == "deleted" {
+			result.Error = "order not found"
+		} else {
+			var err error
+			if req.Action == "complete" {
+				_, err = h.completeOrder(&order, currentUser.ClientID)
+			} else {
+				err = h.rejectOrder(&order, currentUser.ClientID, req.Reason)
+			}
+
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Success = true
+			}
+			result.Status = order.Status
+		}
+
+		if result.Success {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
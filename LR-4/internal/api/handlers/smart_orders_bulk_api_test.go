@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/events"
+	"smartdevices/internal/middleware"
+	"smartdevices/internal/models"
+	"smartdevices/internal/session"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// moderationFixture - модератор и устройство с резервом под сформированные заявки
+type moderationFixture struct {
+	db        *gorm.DB
+	h         *SmartOrderAPIHandler
+	moderator *session.Session
+	client    models.Client
+	device    models.SmartDevice
+}
+
+func newModerationFixture(t *testing.T) *moderationFixture {
+	t.Helper()
+	db := newTestDB(t)
+	client := models.Client{Username: "client", Password: "x", IsActive: true}
+	moderator := models.Client{Username: "moderator", Password: "x", IsModerator: true, IsActive: true}
+	for _, user := range []*models.Client{&client, &moderator} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	device := models.SmartDevice{Name: "Лампа", IsActive: true, StockQuantity: 10}
+	if err := db.Create(&device).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &moderationFixture{
+		db:        db,
+		h:         &SmartOrderAPIHandler{db: db, authMiddleware: &middleware.AuthMiddleware{}, events: events.NewBroker(nil)},
+		moderator: &session.Session{ClientID: moderator.ID, Username: moderator.Username, IsModerator: true},
+		client:    client,
+		device:    device,
+	}
+}
+
+// order создает заявку с одной строкой; у сформированной заявки устройство зарезервировано
+func (f *moderationFixture) order(t *testing.T, status string, quantity int) models.SmartOrder {
+	t.Helper()
+	order := models.SmartOrder{Status: status, ClientID: f.client.ID}
+	if err := f.db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	item := models.OrderItem{OrderID: order.ID, DeviceID: f.device.ID, Quantity: quantity}
+	if err := f.db.Omit(clause.Associations).Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	if status == "formed" {
+		err := f.db.Model(&models.SmartDevice{}).Where("id = ?", f.device.ID).
+			Update("reserved_quantity", gorm.Expr("reserved_quantity + ?", quantity)).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return order
+}
+
+func (f *moderationFixture) reserved(t *testing.T) int {
+	t.Helper()
+	var device models.SmartDevice
+	if err := f.db.First(&device, f.device.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return device.ReservedQuantity
+}
+
+func (f *moderationFixture) bulk(t *testing.T, body string) (*httptest.ResponseRecorder, serializers.BulkOrderActionResponse) {
+	t.Helper()
+	r := httptest.NewRequest("POST", "/api/smart-orders/bulk", strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), "user", f.moderator))
+	w := httptest.NewRecorder()
+	f.h.BulkSmartOrders(w, r)
+
+	var response serializers.BulkOrderActionResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w, response
+}
+
+func bulkIDs(count int) string {
+	ids := make([]string, count)
+	for i := range ids {
+		ids[i] = fmt.Sprint(i + 1000)
+	}
+	return "[" + strings.Join(ids, ",") + "]"
+}
+
+func TestBulkSmartOrdersValidation(t *testing.T) {
+	f := newModerationFixture(t)
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"no IDs", `{"action": "complete", "order_ids": []}`, http.StatusBadRequest},
+		{"over the cap", fmt.Sprintf(`{"action": "complete", "order_ids": %s}`, bulkIDs(maxBulkOrders+1)), http.StatusBadRequest},
+		{"at the cap", fmt.Sprintf(`{"action": "complete", "order_ids": %s}`, bulkIDs(maxBulkOrders)), http.StatusOK},
+		{"unknown action", `{"action": "delete", "order_ids": [1]}`, http.StatusBadRequest},
+		{"invalid JSON", `{"action": `, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w, _ := f.bulk(t, tt.body); w.Code != tt.want {
+				t.Errorf("POST /bulk = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	// Клиент не может выполнять массовые действия
+	r := httptest.NewRequest("POST", "/api/smart-orders/bulk", strings.NewReader(`{"action": "complete", "order_ids": [1]}`))
+	r = r.WithContext(context.WithValue(r.Context(), "user", &session.Session{ClientID: f.client.ID}))
+	w := httptest.NewRecorder()
+	f.h.BulkSmartOrders(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("client POST /bulk = %d, want 403", w.Code)
+	}
+}
+
+func TestBulkSmartOrdersResults(t *testing.T) {
+	f := newModerationFixture(t)
+	first := f.order(t, "formed", 2)
+	draft := f.order(t, "draft", 1)
+	deleted := f.order(t, "deleted", 1)
+	second := f.order(t, "formed", 3)
+
+	// Повторы ID обрабатываются один раз, в порядке первого появления
+	body := fmt.Sprintf(`{"action": "reject", "reason": "Нет монтажника", "order_ids": [%d, %d, %d, 999, %d, %d, %d]}`,
+		first.ID, draft.ID, first.ID, deleted.ID, second.ID, second.ID)
+	w, response := f.bulk(t, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /bulk = %d: %s", w.Code, w.Body)
+	}
+
+	want := []serializers.BulkOrderActionResult{
+		{OrderID: first.ID, Success: true, Status: "rejected"},
+		{OrderID: draft.ID, Status: "draft", Error: errOrderNotFormed.Error()},
+		{OrderID: 999, Error: "order not found"},
+		{OrderID: deleted.ID, Error: "order not found"},
+		{OrderID: second.ID, Success: true, Status: "rejected"},
+	}
+	if !reflect.DeepEqual(response.Results, want) || response.Succeeded != 2 || response.Failed != 3 {
+		t.Errorf("response = %+v, want results %+v, 2 succeeded, 3 failed", response, want)
+	}
+
+	// Отклонение снимает резерв обеих заявок, черновик остается черновиком
+	if reserved := f.reserved(t); reserved != 0 {
+		t.Errorf("reserved after bulk reject = %d, want 0", reserved)
+	}
+	var stored models.SmartOrder
+	f.db.First(&stored, first.ID)
+	if stored.RejectionReason != "Нет монтажника" || stored.ModeratorID == nil || *stored.ModeratorID != f.moderator.ClientID {
+		t.Errorf("rejected order = %+v", stored)
+	}
+	var storedDraft models.SmartOrder
+	f.db.First(&storedDraft, draft.ID)
+	if storedDraft.Status != "draft" || storedDraft.Version != draft.Version {
+		t.Errorf("draft after bulk reject = %s v%d", storedDraft.Status, storedDraft.Version)
+	}
+}
+
+func TestBulkRejectRequiresReason(t *testing.T) {
+	f := newModerationFixture(t)
+	order := f.order(t, "formed", 2)
+
+	w, response := f.bulk(t, fmt.Sprintf(`{"action": "reject", "reason": "  ", "order_ids": [%d]}`, order.ID))
+	want := []serializers.BulkOrderActionResult{{OrderID: order.ID, Status: "formed", Error: errReasonRequired.Error()}}
+	if w.Code != http.StatusOK || !reflect.DeepEqual(response.Results, want) {
+		t.Errorf("POST /bulk = %d %+v, want %+v", w.Code, response.Results, want)
+	}
+	if reserved := f.reserved(t); reserved != 2 {
+		t.Errorf("reserved = %d, want 2", reserved)
+	}
+}
+
+func TestRejectSmartOrder(t *testing.T) {
+	f := newModerationFixture(t)
+	order := f.order(t, "formed", 4)
+
+	reject := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", fmt.Sprintf("/api/smart-orders/%d/reject", order.ID), strings.NewReader(body))
+		r.Header.Set("If-Match", "*")
+		r = r.WithContext(context.WithValue(r.Context(), "user", f.moderator))
+		w := httptest.NewRecorder()
+		f.h.RejectSmartOrder(w, r)
+		return w
+	}
+
+	for _, body := range []string{`{}`, `{"reason": "   "}`} {
+		if w := reject(body); w.Code != http.StatusBadRequest {
+			t.Errorf("reject %s = %d, want 400", body, w.Code)
+		}
+	}
+	if reserved := f.reserved(t); reserved != 4 {
+		t.Fatalf("reserved after rejected requests = %d, want 4", reserved)
+	}
+
+	w := reject(`{"reason": "  Адрес вне зоны обслуживания "}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("reject = %d: %s", w.Code, w.Body)
+	}
+	var stored models.SmartOrder
+	f.db.First(&stored, order.ID)
+	if stored.Status != "rejected" || stored.RejectionReason != "Адрес вне зоны обслуживания" || w.Header().Get("ETag") != formatETag(stored.Version) {
+		t.Errorf("rejected order = %s %q, ETag %q", stored.Status, stored.RejectionReason, w.Header().Get("ETag"))
+	}
+	if reserved := f.reserved(t); reserved != 0 {
+		t.Errorf("reserved after reject = %d, want 0", reserved)
+	}
+
+	var history []models.OrderStatusHistory
+	f.db.Where("order_id = ?", order.ID).Find(&history)
+	if len(history) != 1 || history[0].FromStatus != "formed" || history[0].ToStatus != "rejected" || history[0].Comment != "Адрес вне зоны обслуживания" {
+		t.Errorf("history = %+v", history)
+	}
+
+	// Повторное отклонение - заявка уже не сформирована
+	if w := reject(`{"reason": "Еще раз"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("second reject = %d, want 400", w.Code)
+	}
+}
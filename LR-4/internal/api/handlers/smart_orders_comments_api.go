@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/models"
+	"smartdevices/internal/notifications"
+	"smartdevices/internal/session"
+
+	"gorm.io/gorm"
+)
+
+// Максимальная длина комментария к заявке
+const maxCommentLength = 2000
+
+// commentOrder загружает заявку из пути /api/smart-orders/{id}/comments и проверяет доступ.
+// При ошибке ответ уже отправлен и возвращается false.
+func (h *SmartOrderAPIHandler) commentOrder(w http.ResponseWriter, r *http.Request, currentUser *session.Session) (models.SmartOrder, bool) {
+	var order models.SmartOrder
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/smart-orders/")
+	idStr = strings.TrimSuffix(idStr, "/comments")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return order, false
+	}
+
+	result := h.db.First(&order, id)
+	if result.Error != nil || order.Status == "deleted" {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return order, false
+	}
+
+	// Проверяем права доступа
+	if !currentUser.IsModerator && order.ClientID != currentUser.ClientID {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return order, false
+	}
+	return order, true
+}
+
+// GET /api/smart-orders/{id}/comments - комментарии к заявке в хронологическом порядке
+func (h *SmartOrderAPIHandler) GetSmartOrderComments(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Получаем текущего пользователя
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	order, ok := h.commentOrder(w, r, currentUser)
+	if !ok {
+		return
+	}
+
+	var comments []models.OrderComment
+	result := h.db.Preload("Author").
+		Where("order_id = ?", order.ID).
+		Order("created_at, id").
+		Find(&comments)
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := []serializers.OrderCommentResponse{}
+	for _, comment := range comments {
+		response = append(response, serializers.OrderCommentToJSON(comment))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// POST /api/smart-orders/{id}/comments - комментарий клиента или модератора.
+// Другая сторона заявки получает уведомление order_comment.
+func (h *SmartOrderAPIHandler) AddSmartOrderComment(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Получаем текущего пользователя
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	order, ok := h.commentOrder(w, r, currentUser)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" || utf8.RuneCountInString(req.Body) > maxCommentLength {
+		http.Error(w, `{"error": "Comment body must contain from 1 to 2000 characters"}`, http.StatusBadRequest)
+		return
+	}
+
+	authorID := currentUser.ClientID
+	comment := models.OrderComment{
+		OrderID:  order.ID,
+		AuthorID: &authorID,
+		Body:     req.Body,
+	}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Order", "Author").Create(&comment).Error; err != nil {
+			return err
+		}
+		return notifications.OrderComment(tx, order, comment, currentUser.Username)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	comment.Author = &models.Client{ID: authorID, Username: currentUser.Username}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serializers.OrderCommentToJSON(comment))
+}
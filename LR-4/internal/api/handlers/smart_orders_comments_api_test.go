@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"smartdevices/internal/middleware"
+	"smartdevices/internal/models"
+	"smartdevices/internal/notifications"
+	"smartdevices/internal/session"
+)
+
+func TestAddSmartOrderComment(t *testing.T) {
+	db := newTestDB(t)
+	client := models.Client{Username: "client", Password: "x", IsActive: true}
+	other := models.Client{Username: "other", Password: "x", IsActive: true}
+	moderator := models.Client{Username: "moderator", Password: "x", IsModerator: true, IsActive: true}
+	for _, user := range []*models.Client{&client, &other, &moderator} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	order := models.SmartOrder{Status: "formed", ClientID: client.ID}
+	deleted := models.SmartOrder{Status: "deleted", ClientID: client.ID}
+	for _, value := range []*models.SmartOrder{&order, &deleted} {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		user    session.Session
+		orderID uint
+		body    string
+		want    int
+	}{
+		{"client", session.Session{ClientID: client.ID, Username: "client"}, order.ID, `{"body": "  Позвоните за час  "}`, 201},
+		{"moderator", session.Session{ClientID: moderator.ID, Username: "moderator", IsModerator: true}, order.ID, `{"body": "Хорошо"}`, 201},
+		{"another client", session.Session{ClientID: other.ID, Username: "other"}, order.ID, `{"body": "Привет"}`, 403},
+		{"empty body", session.Session{ClientID: client.ID}, order.ID, `{"body": "   "}`, 400},
+		{"too long", session.Session{ClientID: client.ID}, order.ID, fmt.Sprintf(`{"body": %q}`, strings.Repeat("я", 2001)), 400},
+		{"invalid JSON", session.Session{ClientID: client.ID}, order.ID, `{"body": `, 400},
+		{"deleted order", session.Session{ClientID: client.ID}, deleted.ID, `{"body": "Привет"}`, 404},
+	}
+
+	h := &SmartOrderAPIHandler{db: db, authMiddleware: &middleware.AuthMiddleware{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := tt.user
+			r := httptest.NewRequest("POST", fmt.Sprintf("/api/smart-orders/%d/comments", tt.orderID), strings.NewReader(tt.body))
+			r = r.WithContext(context.WithValue(r.Context(), "user", &user))
+			w := httptest.NewRecorder()
+			h.AddSmartOrderComment(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("POST /comments = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	// Комментарии видны обеим сторонам по порядку, каждая сторона получила уведомление о чужом
+	r := httptest.NewRequest("GET", fmt.Sprintf("/api/smart-orders/%d/comments", order.ID), nil)
+	r = r.WithContext(context.WithValue(r.Context(), "user", &session.Session{ClientID: client.ID}))
+	w := httptest.NewRecorder()
+	h.GetSmartOrderComments(w, r)
+
+	var comments []struct {
+		Author string `json:"author"`
+		Body   string `json:"body"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &comments); err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 2 || comments[0].Author != "client" || comments[0].Body != "Позвоните за час" || comments[1].Author != "moderator" {
+		t.Errorf("GET /comments = %s", w.Body)
+	}
+
+	var inbox []models.Notification
+	db.Where("type = ?", notifications.TypeOrderComment).Order("id").Find(&inbox)
+	if len(inbox) != 2 || inbox[0].ClientID != moderator.ID || inbox[1].ClientID != client.ID {
+		t.Errorf("order_comment notifications = %+v", inbox)
+	}
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"smartdevices/internal/export"
+	"smartdevices/internal/models"
+)
+
+// Строка выгрузки заявок - собирается одним запросом с агрегацией по позициям
+type orderExportRow struct {
+	ID              uint
+	Status          string
+	ClientName      string
+	ModeratorName   string
+	Address         string
+	CreatedAt       time.Time
+	FormedAt        *time.Time
+	CompletedAt     *time.Time
+	DevicesCount    int
+	TotalTraffic    float64
+	RejectionReason string
+}
+
+var orderExportColumns = []string{
+	"ID", "Статус", "Клиент", "Модератор", "Адрес", "Создана", "Сформирована",
+	"Завершена", "Устройств, шт.", "Трафик, Кб/ч", "Причина отклонения",
+}
+
+// GET /api/smart-orders/export?format=csv|xlsx - выгрузка заявок с фильтрами списка
+func (h *SmartOrderAPIHandler) ExportSmartOrders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag, Content-Disposition")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Получаем текущего пользователя
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "xlsx" {
+		http.Error(w, `{"error": "Format must be csv or xlsx"}`, http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.ordersQuery(currentUser, r).
+		Select(`smart_orders.id, smart_orders.status, clients.username AS client_name,
+			COALESCE(moderators.username, '') AS moderator_name, smart_orders.address,
+			smart_orders.created_at, smart_orders.formed_at, smart_orders.completed_at,
+			smart_orders.total_traffic, COALESCE(smart_orders.rejection_reason, '') AS rejection_reason,
+			COALESCE(SUM(order_items.quantity), 0) AS devices_count`).
+		Joins("JOIN clients ON clients.id = smart_orders.client_id").
+		Joins("LEFT JOIN clients AS moderators ON moderators.id = smart_orders.moderator_id").
+		Joins("LEFT JOIN order_items ON order_items.order_id = smart_orders.id").
+		Group("smart_orders.id, clients.username, moderators.username").
+		Order("smart_orders.id").
+		Rows()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("smart_orders_%s.%s", time.Now().Format("20060102_150405"), format)
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	writer, err := export.NewTableWriter(format, w, "Заявки")
+	if err == nil {
+		err = writer.WriteHeader(orderExportColumns)
+	}
+
+	exported := 0
+	for err == nil && rows.Next() {
+		var row orderExportRow
+		if err = h.db.ScanRows(rows, &row); err != nil {
+			break
+		}
+		err = writer.WriteRow([]interface{}{
+			row.ID, export.StatusTitle(row.Status), row.ClientName, row.ModeratorName, row.Address,
+			row.CreatedAt, row.FormedAt, row.CompletedAt, row.DevicesCount, row.TotalTraffic,
+			row.RejectionReason,
+		})
+		exported++
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+
+	// Заголовки уже отправлены - ошибку можно только залогировать
+	if err != nil {
+		log.Printf("❌ Orders export failed after %d rows: %v", exported, err)
+		return
+	}
+	log.Printf("📤 Orders exported: %d rows (%s)", exported, format)
+}
+
+// GET /api/smart-orders/{id}/document.pdf - печатный наряд на установку
+func (h *SmartOrderAPIHandler) GetSmartOrderDocument(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag, Content-Disposition")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Получаем текущего пользователя
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/smart-orders/")
+	idStr = strings.TrimSuffix(idStr, "/document.pdf")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var order models.SmartOrder
+	result := h.db.Preload("Client").Preload("Moderator").First(&order, id)
+	if result.Error != nil || order.Status == "deleted" {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	// Проверяем права доступа
+	if !currentUser.IsModerator && order.ClientID != currentUser.ClientID {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	var items []models.OrderItem
+	h.db.Preload("Device.Category").Where("order_id = ?", order.ID).Order("id").Find(&items)
+
+	document := export.WorkOrder{
+		ID:           order.ID,
+		Status:       order.Status,
+		ClientName:   order.Client.Username,
+		Address:      order.Address,
+		AddressNotes: order.AddressDetails.Notes,
+		CreatedAt:    order.CreatedAt,
+		FormedAt:     order.FormedAt,
+		CompletedAt:  order.CompletedAt,
+		TotalTraffic: order.TotalTraffic,
+	}
+	if order.ModeratorID != nil {
+		document.ModeratorName = order.Moderator.Username
+	}
+
+	computedTotal := 0.0
+	for _, item := range items {
+		traffic := calculateOrderTraffic([]models.OrderItem{item})
+		computedTotal += traffic
+		document.Lines = append(document.Lines, export.WorkOrderLine{
+			Name:           item.Device.Name,
+			Model:          item.Device.Model,
+			Room:           item.Room,
+			PlacementNotes: item.PlacementNotes,
+			Config:         item.Config,
+			Quantity:       item.Quantity,
+			DataPerHour:    item.Device.DataPerHour,
+			Traffic:        traffic,
+		})
+	}
+	// До завершения заявки трафик не сохранен - показываем расчетный
+	if order.Status != "completed" {
+		document.TotalTraffic = computedTotal
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="work_order_%d.pdf"`, order.ID))
+	if err := export.WriteWorkOrderPDF(w, document); err != nil {
+		log.Printf("❌ Work order PDF failed for order %d: %v", order.ID, err)
+		http.Error(w, "Failed to generate document", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/models"
+)
+
+// GET /api/smart-orders/{id}/history - история смены статусов заявки
+func (h *SmartOrderAPIHandler) GetSmartOrderHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, Idempotency-Key")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Получаем текущего пользователя
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/smart-orders/")
+	idStr = strings.TrimSuffix(idStr, "/history")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var order models.SmartOrder
+	result := h.db.First(&order, id)
+	if result.Error != nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	// Проверяем права доступа
+	if !currentUser.IsModerator && order.ClientID != currentUser.ClientID {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	var history []models.OrderStatusHistory
+	result = h.db.Preload("ChangedBy").
+		Where("order_id = ?", order.ID).
+		Order("created_at, id").
+		Find(&history)
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := []serializers.OrderStatusHistoryResponse{}
+	for _, entry := range history {
+		response = append(response, serializers.OrderStatusHistoryToJSON(entry))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"smartdevices/internal/middleware"
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type StatsAPIHandler struct {
+	db             *gorm.DB
+	authMiddleware *middleware.AuthMiddleware
+}
+
+func NewStatsAPIHandler(db *gorm.DB) *StatsAPIHandler {
+	return &StatsAPIHandler{
+		db:             db,
+		authMiddleware: middleware.NewAuthMiddleware(db),
+	}
+}
+
+// withDateRange применяет фильтры date_from/date_to (YYYY-MM-DD) к колонке даты
+func withDateRange(query *gorm.DB, r *http.Request, column string) *gorm.DB {
+	if dateFrom, err := time.Parse("2006-01-02", r.URL.Query().Get("date_from")); err == nil {
+		query = query.Where(column+" >= ?", dateFrom)
+	}
+	if dateTo, err := time.Parse("2006-01-02", r.URL.Query().Get("date_to")); err == nil {
+		query = query.Where(column+" < ?", dateTo.AddDate(0, 0, 1))
+	}
+	return query
+}
+
+// GET /api/stats/orders?period=day|week|month - количество заявок по статусам за период
+func (h *StatsAPIHandler) GetOrdersByStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "day"
+	}
+	if period != "day" && period != "week" && period != "month" {
+		http.Error(w, `{"error": "Period must be day, week or month"}`, http.StatusBadRequest)
+		return
+	}
+
+	// Черновики группируются по дате создания, остальные - по дате формирования
+	dateColumn := "COALESCE(smart_orders.formed_at, smart_orders.created_at)"
+
+	var rows []struct {
+		Period time.Time
+		Status string
+		Count  int64
+	}
+	query := h.db.Model(&models.SmartOrder{}).
+		Select("date_trunc(?, "+dateColumn+") AS period, smart_orders.status, COUNT(*) AS count", period).
+		Where("smart_orders.status <> ?", "deleted")
+	result := withDateRange(query, r, dateColumn).
+		Group("period, smart_orders.status").
+		Order("period").
+		Scan(&rows)
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type periodCounts struct {
+		Period string           `json:"period"`
+		Total  int64            `json:"total"`
+		Counts map[string]int64 `json:"counts"`
+	}
+	items := []periodCounts{}
+	for _, row := range rows {
+		label := row.Period.Format("2006-01-02")
+		if len(items) == 0 || items[len(items)-1].Period != label {
+			items = append(items, periodCounts{Period: label, Counts: map[string]int64{}})
+		}
+		current := &items[len(items)-1]
+		current.Counts[row.Status] = row.Count
+		current.Total += row.Count
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"period": period,
+		"items":  items,
+	})
+}
+
+// GET /api/stats/processing-time - среднее время от формирования до завершения
+func (h *StatsAPIHandler) GetProcessingTime(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var rows []struct {
+		Status     string
+		Count      int64
+		AvgSeconds float64
+		MinSeconds float64
+		MaxSeconds float64
+	}
+	query := h.db.Model(&models.SmartOrder{}).
+		Select(`smart_orders.status, COUNT(*) AS count,
+			AVG(EXTRACT(EPOCH FROM smart_orders.completed_at - smart_orders.formed_at)) AS avg_seconds,
+			MIN(EXTRACT(EPOCH FROM smart_orders.completed_at - smart_orders.formed_at)) AS min_seconds,
+			MAX(EXTRACT(EPOCH FROM smart_orders.completed_at - smart_orders.formed_at)) AS max_seconds`).
+		Where("smart_orders.status IN ? AND smart_orders.formed_at IS NOT NULL AND smart_orders.completed_at IS NOT NULL",
+			[]string{"completed", "rejected"})
+	result := withDateRange(query, r, "smart_orders.formed_at").
+		Group("smart_orders.status").
+		Scan(&rows)
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{}
+	for _, row := range rows {
+		response[row.Status] = map[string]interface{}{
+			"count":       row.Count,
+			"avg_seconds": row.AvgSeconds,
+			"avg_hours":   row.AvgSeconds / 3600,
+			"min_seconds": row.MinSeconds,
+			"max_seconds": row.MaxSeconds,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GET /api/stats/traffic - суммарный и средний трафик завершенных заявок
+func (h *StatsAPIHandler) GetTrafficStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var stats struct {
+		Orders       int64   `json:"orders"`
+		TotalTraffic float64 `json:"total_traffic"`
+		AvgTraffic   float64 `json:"avg_traffic"`
+		MaxTraffic   float64 `json:"max_traffic"`
+	}
+	query := h.db.Model(&models.SmartOrder{}).
+		Select(`COUNT(*) AS orders,
+			COALESCE(SUM(smart_orders.total_traffic), 0) AS total_traffic,
+			COALESCE(AVG(smart_orders.total_traffic), 0) AS avg_traffic,
+			COALESCE(MAX(smart_orders.total_traffic), 0) AS max_traffic`).
+		Where("smart_orders.status = ?", "completed")
+	result := withDateRange(query, r, "smart_orders.formed_at").Scan(&stats)
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// GET /api/stats/top-devices?limit=10 - самые заказываемые устройства
+func (h *StatsAPIHandler) GetTopDevices(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	limit := 10
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+
+	type topDevice struct {
+		DeviceID      uint   `json:"device_id"`
+		Name          string `json:"name"`
+		Model         string `json:"model"`
+		TotalQuantity int64  `json:"total_quantity"`
+		OrdersCount   int64  `json:"orders_count"`
+	}
+	devices := []topDevice{}
+
+	// Учитываются только заявки, отправленные клиентами (не черновики)
+	query := h.db.Model(&models.OrderItem{}).
+		Select(`order_items.device_id, smart_devices.name, smart_devices.model,
+			SUM(order_items.quantity) AS total_quantity,
+			COUNT(DISTINCT order_items.order_id) AS orders_count`).
+		Joins("JOIN smart_orders ON smart_orders.id = order_items.order_id").
+		Joins("JOIN smart_devices ON smart_devices.id = order_items.device_id").
+		Where("smart_orders.status IN ?", []string{"formed", "completed", "rejected"})
+	result := withDateRange(query, r, "smart_orders.formed_at").
+		Group("order_items.device_id, smart_devices.name, smart_devices.model").
+		Order("total_quantity DESC").
+		Limit(limit).
+		Scan(&devices)
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(devices)
+}
+
+// GET /api/stats/moderators - производительность модераторов
+func (h *StatsAPIHandler) GetModeratorThroughput(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	type moderatorStats struct {
+		ModeratorID     uint       `json:"moderator_id"`
+		Username        string     `json:"username"`
+		Processed       int64      `json:"processed"`
+		Completed       int64      `json:"completed"`
+		Rejected        int64      `json:"rejected"`
+		AvgHours        float64    `json:"avg_processing_hours"`
+		TotalTraffic    float64    `json:"total_traffic"`
+		LastProcessedAt *time.Time `json:"last_processed_at,omitempty"`
+	}
+	moderators := []moderatorStats{}
+
+	query := h.db.Model(&models.SmartOrder{}).
+		Select(`smart_orders.moderator_id, clients.username,
+			COUNT(*) AS processed,
+			COUNT(*) FILTER (WHERE smart_orders.status = 'completed') AS completed,
+			COUNT(*) FILTER (WHERE smart_orders.status = 'rejected') AS rejected,
+			COALESCE(AVG(EXTRACT(EPOCH FROM smart_orders.completed_at - smart_orders.formed_at)) / 3600, 0) AS avg_hours,
+			COALESCE(SUM(smart_orders.total_traffic), 0) AS total_traffic,
+			MAX(smart_orders.completed_at) AS last_processed_at`).
+		Joins("JOIN clients ON clients.id = smart_orders.moderator_id").
+		Where("smart_orders.status IN ?", []string{"completed", "rejected"})
+	result := withDateRange(query, r, "smart_orders.completed_at").
+		Group("smart_orders.moderator_id, clients.username").
+		Order("processed DESC").
+		Scan(&moderators)
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(moderators)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/catalog"
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type TagAPIHandler struct {
+	db *gorm.DB
+}
+
+func NewTagAPIHandler(db *gorm.DB) *TagAPIHandler {
+	return &TagAPIHandler{db: db}
+}
+
+// GET /api/tags - метки с количеством активных устройств. **Доступно без авторизации**
+func (h *TagAPIHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	response := []serializers.TagResponse{}
+	err := h.db.Model(&models.Tag{}).
+		Select(`tags.id, tags.name, count(smart_devices.id) AS device_count`).
+		Joins("LEFT JOIN device_tags ON device_tags.tag_id = tags.id").
+		Joins("LEFT JOIN smart_devices ON smart_devices.id = device_tags.smart_device_id AND smart_devices.is_active").
+		Group("tags.id, tags.name").
+		Order("tags.name").
+		Scan(&response).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// POST /api/tags - создание метки (модератор); метки также создаются при сохранении устройства
+func (h *TagAPIHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var tag models.Tag
+	if !h.applyTagRequest(w, r, &tag) {
+		return
+	}
+
+	if err := h.db.Create(&tag).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serializers.TagResponse{ID: tag.ID, Name: tag.Name})
+}
+
+// PUT /api/tags/{id} - переименование метки (модератор)
+func (h *TagAPIHandler) UpdateTag(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	tag, ok := h.loadTag(w, r)
+	if !ok {
+		return
+	}
+	if !h.applyTagRequest(w, r, &tag) {
+		return
+	}
+
+	if err := h.db.Model(&tag).Update("name", tag.Name).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var devices int64
+	h.db.Table("device_tags").Where("tag_id = ?", tag.ID).Count(&devices)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.TagResponse{ID: tag.ID, Name: tag.Name, DeviceCount: devices})
+}
+
+// DELETE /api/tags/{id} - удаление метки у всех устройств (модератор)
+func (h *TagAPIHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	tag, ok := h.loadTag(w, r)
+	if !ok {
+		return
+	}
+
+	// Связи device_tags удаляются каскадно
+	if err := h.db.Delete(&tag).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🏷️ Tag %d deleted: %s", tag.ID, tag.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadTag читает метку по ID из пути; при ошибке ответ уже записан
+func (h *TagAPIHandler) loadTag(w http.ResponseWriter, r *http.Request) (models.Tag, bool) {
+	var tag models.Tag
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/tags/"))
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return tag, false
+	}
+	if err := h.db.First(&tag, id).Error; err != nil {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return tag, false
+	}
+	return tag, true
+}
+
+// applyTagRequest читает имя метки из тела; занятое другой меткой имя - 409
+func (h *TagAPIHandler) applyTagRequest(w http.ResponseWriter, r *http.Request, tag *models.Tag) bool {
+	var req serializers.TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+
+	names, err := catalog.NormalizeTags([]string{req.Name})
+	if err == nil && len(names) == 0 {
+		err = errors.New("name is required")
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return false
+	}
+
+	var taken int64
+	if err := h.db.Model(&models.Tag{}).Where("name = ? AND id <> ?", names[0], tag.ID).Count(&taken).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if taken > 0 {
+		writeJSONError(w, http.StatusConflict, fmt.Errorf("tag %q already exists", names[0]))
+		return false
+	}
+
+	tag.Name = names[0]
+	return true
+}
@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"smartdevices/internal/api/serializers"
+	"smartdevices/internal/middleware"
+	"smartdevices/internal/models"
+	"smartdevices/internal/webhooks"
+
+	"gorm.io/gorm"
+)
+
+const minWebhookSecretLength = 16
+
+var deliverySortFields = map[string]string{
+	"id":         "id",
+	"created_at": "created_at",
+	"attempts":   "attempts",
+}
+
+type WebhookAPIHandler struct {
+	db             *gorm.DB
+	authMiddleware *middleware.AuthMiddleware
+	dispatcher     *webhooks.Dispatcher
+}
+
+func NewWebhookAPIHandler(db *gorm.DB, dispatcher *webhooks.Dispatcher) *WebhookAPIHandler {
+	return &WebhookAPIHandler{
+		db:             db,
+		authMiddleware: middleware.NewAuthMiddleware(db),
+		dispatcher:     dispatcher,
+	}
+}
+
+// GET /api/webhooks - список подписок (модератор)
+func (h *WebhookAPIHandler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var subscriptions []models.WebhookSubscription
+	if err := h.db.Order("id").Find(&subscriptions).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := []serializers.WebhookSubscriptionResponse{}
+	for _, subscription := range subscriptions {
+		response = append(response, serializers.WebhookSubscriptionToJSON(subscription))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// POST /api/webhooks - создание подписки; секрет возвращается только в этом ответе
+func (h *WebhookAPIHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	currentUser := h.authMiddleware.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req serializers.WebhookSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	subscription := models.WebhookSubscription{
+		Description: strings.TrimSpace(req.Description),
+		IsActive:    req.IsActive == nil || *req.IsActive,
+		CreatedByID: &currentUser.ClientID,
+	}
+	if err := applySubscriptionRequest(&subscription, req); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	if subscription.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		subscription.Secret = secret
+	}
+
+	if err := h.db.Create(&subscription).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🔗 Webhook subscription %d created: %s %v", subscription.ID, subscription.URL, subscription.Events)
+
+	response := serializers.WebhookSubscriptionToJSON(subscription)
+	response.Secret = subscription.Secret
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GET /api/webhooks/{id} - подписка по ID
+func (h *WebhookAPIHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	subscription, ok := h.loadSubscription(w, r, "")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.WebhookSubscriptionToJSON(subscription))
+}
+
+// PUT /api/webhooks/{id} - изменение адреса, фильтра событий, активности или секрета
+func (h *WebhookAPIHandler) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	subscription, ok := h.loadSubscription(w, r, "")
+	if !ok {
+		return
+	}
+
+	var req serializers.WebhookSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := applySubscriptionRequest(&subscription, req); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	subscription.Description = strings.TrimSpace(req.Description)
+	if req.IsActive != nil {
+		subscription.IsActive = *req.IsActive
+	}
+
+	if err := h.db.Save(&subscription).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.WebhookSubscriptionToJSON(subscription))
+}
+
+// DELETE /api/webhooks/{id} - удаление подписки вместе с журналом доставок
+func (h *WebhookAPIHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	subscription, ok := h.loadSubscription(w, r, "")
+	if !ok {
+		return
+	}
+
+	if err := h.db.Delete(&subscription).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🔗 Webhook subscription %d deleted", subscription.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/webhooks/{id}/deliveries?status=failed - журнал доставок подписки
+func (h *WebhookAPIHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	subscription, ok := h.loadSubscription(w, r, "/deliveries")
+	if !ok {
+		return
+	}
+
+	params, err := parsePageParams(r, deliverySortFields, "-id")
+	if err != nil {
+		writePageError(w, err)
+		return
+	}
+
+	query := h.db.Model(&models.WebhookDelivery{}).Where("subscription_id = ?", subscription.ID)
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if event := r.URL.Query().Get("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+
+	var deliveries []models.WebhookDelivery
+	total, err := paginate(query, params, &deliveries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := []serializers.WebhookDeliveryResponse{}
+	for _, delivery := range deliveries {
+		response = append(response, serializers.WebhookDeliveryToJSON(delivery, nil))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newPageResponse(response, params, len(deliveries), total))
+}
+
+// GET /api/webhooks/deliveries/{id} - доставка с журналом попыток
+func (h *WebhookAPIHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	delivery, ok := h.loadDelivery(w, r, "")
+	if !ok {
+		return
+	}
+
+	h.writeDelivery(w, delivery)
+}
+
+// POST /api/webhooks/deliveries/{id}/replay - ручная повторная отправка доставки
+func (h *WebhookAPIHandler) ReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	delivery, ok := h.loadDelivery(w, r, "/replay")
+	if !ok {
+		return
+	}
+
+	if delivery.Status == webhooks.StatusSucceeded && r.URL.Query().Get("force") != "true" {
+		http.Error(w, `{"error": "Delivery already succeeded, use force=true to send it again"}`, http.StatusConflict)
+		return
+	}
+
+	// Попытка выполняется синхронно - результат сразу виден в ответе
+	if err := h.dispatcher.Replay(r.Context(), &delivery); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🔁 Webhook delivery %d replayed: %s", delivery.ID, delivery.Status)
+	h.writeDelivery(w, delivery)
+}
+
+// loadSubscription читает подписку по ID из пути /api/webhooks/{id}{suffix}
+func (h *WebhookAPIHandler) loadSubscription(w http.ResponseWriter, r *http.Request, suffix string) (models.WebhookSubscription, bool) {
+	var subscription models.WebhookSubscription
+
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/webhooks/"), suffix)
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return subscription, false
+	}
+
+	if err := h.db.First(&subscription, id).Error; err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return subscription, false
+	}
+	return subscription, true
+}
+
+// loadDelivery читает доставку по ID из пути /api/webhooks/deliveries/{id}{suffix}
+func (h *WebhookAPIHandler) loadDelivery(w http.ResponseWriter, r *http.Request, suffix string) (models.WebhookDelivery, bool) {
+	var delivery models.WebhookDelivery
+
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/webhooks/deliveries/"), suffix)
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return delivery, false
+	}
+
+	if err := h.db.First(&delivery, id).Error; err != nil {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return delivery, false
+	}
+	return delivery, true
+}
+
+func (h *WebhookAPIHandler) writeDelivery(w http.ResponseWriter, delivery models.WebhookDelivery) {
+	var attempts []models.WebhookAttempt
+	if err := h.db.Where("delivery_id = ?", delivery.ID).Order("id").Find(&attempts).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(serializers.WebhookDeliveryToJSON(delivery, attempts))
+}
+
+// applySubscriptionRequest проверяет адрес, фильтр событий и секрет.
+// Пустой секрет при изменении оставляет прежний.
+func applySubscriptionRequest(subscription *models.WebhookSubscription, req serializers.WebhookSubscriptionRequest) error {
+	target, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("url must be an absolute http(s) URL")
+	}
+
+	if len(req.Events) == 0 {
+		return fmt.Errorf("at least one event is required, use \"*\" for all events")
+	}
+	events := models.StringList{}
+	seen := map[string]bool{}
+	for _, event := range req.Events {
+		event = strings.TrimSpace(event)
+		if !webhooks.IsKnownEvent(event) {
+			return fmt.Errorf("unknown event %q, allowed: %s, *", event, strings.Join(webhooks.Events, ", "))
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+
+	if req.Secret != "" && len(req.Secret) < minWebhookSecretLength {
+		return fmt.Errorf("secret must be at least %d characters", minWebhookSecretLength)
+	}
+
+	subscription.URL = target.String()
+	subscription.Events = events
+	if req.Secret != "" {
+		subscription.Secret = req.Secret
+	}
+	return nil
+}
+
+// generateWebhookSecret - случайный ключ подписи (32 байта в hex)
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Ответ 400 с ошибкой валидации подписки
+func writeWebhookError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,80 @@
+package serializers
+
+import (
+	"smartdevices/internal/models"
+	"time"
+)
+
+type AddressRequest struct {
+	Region     string `json:"region"`
+	City       string `json:"city"`
+	Street     string `json:"street"`
+	House      string `json:"house"`
+	Apartment  string `json:"apartment"`
+	PostalCode string `json:"postal_code"`
+	Notes      string `json:"notes"`
+}
+
+type AddressResponse struct {
+	Region     string   `json:"region"`
+	City       string   `json:"city"`
+	Street     string   `json:"street"`
+	House      string   `json:"house"`
+	Apartment  string   `json:"apartment,omitempty"`
+	PostalCode string   `json:"postal_code"`
+	Notes      string   `json:"notes,omitempty"`
+	Latitude   *float64 `json:"latitude,omitempty"`
+	Longitude  *float64 `json:"longitude,omitempty"`
+}
+
+type ClientAddressRequest struct {
+	Label     string         `json:"label"`
+	IsDefault bool           `json:"is_default"`
+	Address   AddressRequest `json:"address"`
+}
+
+type ClientAddressResponse struct {
+	ID        uint            `json:"id"`
+	Label     string          `json:"label"`
+	IsDefault bool            `json:"is_default"`
+	Address   AddressResponse `json:"address"`
+	Formatted string          `json:"formatted"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func AddressFromRequest(req AddressRequest) models.StructuredAddress {
+	return models.StructuredAddress{
+		Region:     req.Region,
+		City:       req.City,
+		Street:     req.Street,
+		House:      req.House,
+		Apartment:  req.Apartment,
+		PostalCode: req.PostalCode,
+		Notes:      req.Notes,
+	}
+}
+
+func AddressToJSON(a models.StructuredAddress) AddressResponse {
+	return AddressResponse{
+		Region:     a.Region,
+		City:       a.City,
+		Street:     a.Street,
+		House:      a.House,
+		Apartment:  a.Apartment,
+		PostalCode: a.PostalCode,
+		Notes:      a.Notes,
+		Latitude:   a.Latitude,
+		Longitude:  a.Longitude,
+	}
+}
+
+func ClientAddressToJSON(a models.ClientAddress, formatted string) ClientAddressResponse {
+	return ClientAddressResponse{
+		ID:        a.ID,
+		Label:     a.Label,
+		IsDefault: a.IsDefault,
+		Address:   AddressToJSON(a.Address),
+		Formatted: formatted,
+		CreatedAt: a.CreatedAt,
+	}
+}
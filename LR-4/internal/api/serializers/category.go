@@ -0,0 +1,105 @@
+package serializers
+
+import (
+	"smartdevices/internal/models"
+	"sort"
+	"time"
+)
+
+type CategoryRequest struct {
+	ParentID  *uint  `json:"parent_id"`
+	Slug      string `json:"slug"`
+	Name      string `json:"name"`
+	SortOrder int    `json:"sort_order"`
+	// TrafficCoefficient - если не передан, 1
+	TrafficCoefficient *float64 `json:"traffic_coefficient"`
+	IsHub              bool     `json:"is_hub"`
+	// Attributes - схема характеристик; при изменении null - без изменений
+	Attributes models.AttributeSchema `json:"attributes"`
+}
+
+type CategoryResponse struct {
+	ID                 uint                  `json:"id"`
+	ParentID           *uint                 `json:"parent_id"`
+	Slug               string                `json:"slug"`
+	Name               string                `json:"name"`
+	SortOrder          int                   `json:"sort_order"`
+	TrafficCoefficient float64               `json:"traffic_coefficient"`
+	IsHub              bool                  `json:"is_hub"`
+	Attributes         []models.AttributeDef `json:"attributes"`
+	// EffectiveAttributes - схема вместе с унаследованной, только в ответе по ID
+	EffectiveAttributes []models.AttributeDef `json:"effective_attributes,omitempty"`
+	CreatedAt           time.Time             `json:"created_at"`
+	UpdatedAt           time.Time             `json:"updated_at"`
+	Children            []CategoryResponse    `json:"children,omitempty"`
+}
+
+// CategoryRef - краткая категория в карточке устройства
+type CategoryRef struct {
+	ID   uint   `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+type TagRequest struct {
+	Name string `json:"name"`
+}
+
+type TagResponse struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	DeviceCount int64  `json:"device_count"`
+}
+
+func CategoryToJSON(category models.Category) CategoryResponse {
+	return CategoryResponse{
+		ID:                 category.ID,
+		ParentID:           category.ParentID,
+		Slug:               category.Slug,
+		Name:               category.Name,
+		SortOrder:          category.SortOrder,
+		TrafficCoefficient: category.TrafficCoefficient,
+		IsHub:              category.IsHub,
+		Attributes:         attributesToJSON(category.Attributes),
+		CreatedAt:          category.CreatedAt,
+		UpdatedAt:          category.UpdatedAt,
+	}
+}
+
+// CategoryTree собирает дерево из плоского списка; порядок - sort_order, затем имя
+func CategoryTree(categories []models.Category) []CategoryResponse {
+	children := make(map[uint][]models.Category)
+	roots := []models.Category{}
+	for _, category := range categories {
+		if category.ParentID == nil {
+			roots = append(roots, category)
+		} else {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	var build func(level []models.Category) []CategoryResponse
+	build = func(level []models.Category) []CategoryResponse {
+		sort.SliceStable(level, func(i, j int) bool {
+			if level[i].SortOrder != level[j].SortOrder {
+				return level[i].SortOrder < level[j].SortOrder
+			}
+			return level[i].Name < level[j].Name
+		})
+		result := []CategoryResponse{}
+		for _, category := range level {
+			node := CategoryToJSON(category)
+			node.Children = build(children[category.ID])
+			result = append(result, node)
+		}
+		return result
+	}
+	return build(roots)
+}
+
+func attributesToJSON(schema models.AttributeSchema) []models.AttributeDef {
+	if schema == nil {
+		return []models.AttributeDef{}
+	}
+	return schema
+}
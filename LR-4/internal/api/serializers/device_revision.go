@@ -0,0 +1,39 @@
+package serializers
+
+import (
+	"smartdevices/internal/catalog"
+	"smartdevices/internal/models"
+	"time"
+)
+
+type DeviceRevisionResponse struct {
+	Revision      uint                  `json:"revision"`
+	Action        string                `json:"action"`
+	RevertedFrom  *uint                 `json:"reverted_from,omitempty"`
+	DeviceVersion uint                  `json:"device_version"`
+	ChangedBy     string                `json:"changed_by,omitempty"` // пусто - системное действие
+	CreatedAt     time.Time             `json:"created_at"`
+	Snapshot      models.DeviceSnapshot `json:"snapshot"`
+}
+
+type DeviceRevisionDiffResponse struct {
+	DeviceID uint                  `json:"device_id"`
+	From     uint                  `json:"from"`
+	To       uint                  `json:"to"`
+	Changes  []catalog.FieldChange `json:"changes"`
+}
+
+func DeviceRevisionToJSON(revision models.DeviceRevision) DeviceRevisionResponse {
+	response := DeviceRevisionResponse{
+		Revision:      revision.Revision,
+		Action:        revision.Action,
+		RevertedFrom:  revision.RevertedFrom,
+		DeviceVersion: revision.DeviceVersion,
+		CreatedAt:     revision.CreatedAt,
+		Snapshot:      revision.Snapshot,
+	}
+	if revision.ChangedBy != nil {
+		response.ChangedBy = revision.ChangedBy.Username
+	}
+	return response
+}
@@ -0,0 +1,35 @@
+package serializers
+
+// DeviceCatalogResponse - страница каталога и фасеты по всей отфильтрованной выборке
+type DeviceCatalogResponse struct {
+	PageResponse
+	Facets DeviceFacets `json:"facets"`
+}
+
+// DeviceFacets - счетчики для боковой панели фильтров.
+// Каждый фасет считается без собственного фильтра, чтобы можно было выбрать еще значения.
+type DeviceFacets struct {
+	Protocol    []FacetValue `json:"protocol"`
+	Vendor      []FacetValue `json:"vendor"`
+	AvgDataRate RangeFacet   `json:"avg_data_rate"`
+	DataPerHour RangeFacet   `json:"data_per_hour"`
+}
+
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// RangeFacet - границы значений и число устройств в интервалах [from, to)
+type RangeFacet struct {
+	Min     *float64      `json:"min"`
+	Max     *float64      `json:"max"`
+	Buckets []RangeBucket `json:"buckets"`
+}
+
+// RangeBucket - интервал; to == null у последнего
+type RangeBucket struct {
+	From  float64  `json:"from"`
+	To    *float64 `json:"to"`
+	Count int64    `json:"count"`
+}
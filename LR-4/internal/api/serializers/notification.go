@@ -0,0 +1,30 @@
+package serializers
+
+import (
+	"smartdevices/internal/models"
+	"time"
+)
+
+type NotificationResponse struct {
+	ID        uint       `json:"id"`
+	Type      string     `json:"type"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	OrderID   *uint      `json:"order_id,omitempty"`
+	IsRead    bool       `json:"is_read"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func NotificationToJSON(notification models.Notification) NotificationResponse {
+	return NotificationResponse{
+		ID:        notification.ID,
+		Type:      notification.Type,
+		Title:     notification.Title,
+		Body:      notification.Body,
+		OrderID:   notification.OrderID,
+		IsRead:    notification.ReadAt != nil,
+		ReadAt:    notification.ReadAt,
+		CreatedAt: notification.CreatedAt,
+	}
+}
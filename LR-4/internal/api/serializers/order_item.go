@@ -0,0 +1,38 @@
+package serializers
+
+import "smartdevices/internal/models"
+
+// OrderItemUpdateRequest - изменение строки заявки; не переданные поля не меняются
+type OrderItemUpdateRequest struct {
+	Quantity       *int              `json:"quantity"`
+	Room           *string           `json:"room"`
+	PlacementNotes *string           `json:"placement_notes"`
+	Config         map[string]string `json:"config"`
+}
+
+// OrderItemSplitRequest - выделение части количества в новую строку
+type OrderItemSplitRequest struct {
+	Quantity       int               `json:"quantity"`
+	Room           string            `json:"room"`
+	PlacementNotes string            `json:"placement_notes"`
+	Config         map[string]string `json:"config"`
+}
+
+type OrderItemSplitResponse struct {
+	Source SmartOrderItemResponse `json:"source"`
+	Line   SmartOrderItemResponse `json:"line"`
+}
+
+func OrderItemToJSON(item models.OrderItem) SmartOrderItemResponse {
+	return SmartOrderItemResponse{
+		LineID:         item.ID,
+		DeviceID:       item.DeviceID,
+		DeviceName:     item.Device.Name,
+		Quantity:       item.Quantity,
+		DataPerHour:    item.Device.DataPerHour,
+		NamespaceURL:   item.Device.NamespaceURL,
+		Room:           item.Room,
+		PlacementNotes: item.PlacementNotes,
+		Config:         item.Config,
+	}
+}
@@ -0,0 +1,8 @@
+package serializers
+
+// PageResponse - единый конверт для постраничных списков
+type PageResponse struct {
+	Items      interface{} `json:"items"`
+	NextCursor *string     `json:"next_cursor"`
+	Total      int64       `json:"total"`
+}
@@ -1,7 +1,10 @@
 package serializers
 
 import (
+	"smartdevices/internal/inventory"
 	"smartdevices/internal/models"
+	"smartdevices/internal/search"
+	"sort"
 	"time"
 )
 
@@ -9,6 +12,7 @@ type SmartDeviceResponse struct {
 	ID             uint      `json:"id"`
 	Name           string    `json:"name"`
 	Model          string    `json:"model"`
+	Vendor         string    `json:"vendor"`
 	AvgDataRate    float64   `json:"avg_data_rate"`
 	DataPerHour    float64   `json:"data_per_hour"`
 	NamespaceURL   string    `json:"namespace_url"`
@@ -16,25 +20,53 @@ type SmartDeviceResponse struct {
 	DescriptionAll string    `json:"description_all"`
 	Protocol       string    `json:"protocol"`
 	IsActive       bool      `json:"is_active"`
+	Version        uint      `json:"version"`
 	CreatedAt      time.Time `json:"created_at"`
+
+	StockQuantity     int  `json:"stock_quantity"`
+	ReservedQuantity  int  `json:"reserved_quantity"`
+	AvailableQuantity int  `json:"available_quantity"`
+	InStock           bool `json:"in_stock"`
+
+	Category *CategoryRef           `json:"category"`
+	Tags     []string               `json:"tags"`
+	Specs    map[string]interface{} `json:"specs"`
+	// Images - галерея по порядку показа; namespace_url - URL основного изображения
+	Images []DeviceImageResponse `json:"images"`
+	// Уменьшенные копии основного изображения для списков и карточек
+	ThumbnailURL string `json:"thumbnail_url"`
+	MediumURL    string `json:"medium_url"`
+
+	// Highlight - найденные фрагменты, только при поиске
+	Highlight *search.Highlight `json:"highlight,omitempty"`
 }
 
 type SmartDeviceCreateRequest struct {
 	Name           string  `json:"name" binding:"required"`
 	Model          string  `json:"model"`
+	Vendor         string  `json:"vendor"`
 	AvgDataRate    float64 `json:"avg_data_rate"`
 	DataPerHour    float64 `json:"data_per_hour"`
 	NamespaceURL   string  `json:"namespace_url"`
 	Description    string  `json:"description"`
 	DescriptionAll string  `json:"description_all"`
 	Protocol       string  `json:"protocol"`
+	// StockQuantity - остаток на складе; при изменении не может быть меньше резерва
+	StockQuantity *int `json:"stock_quantity"`
+	// CategoryID - при изменении: не передан - без изменений, 0 - убрать категорию
+	CategoryID *uint `json:"category_id"`
+	// Tags - имена меток, недостающие создаются; при изменении null - без изменений
+	Tags []string `json:"tags"`
+	// Specs - характеристики по схеме категории; при изменении null - без изменений
+	Specs map[string]interface{} `json:"specs"`
 }
 
 func SmartDeviceToJSON(device models.SmartDevice) SmartDeviceResponse {
-	return SmartDeviceResponse{
+	response := SmartDeviceResponse{
 		ID:             device.ID,
 		Name:           device.Name,
 		Model:          device.Model,
+		Vendor:         device.Vendor,
 		AvgDataRate:    device.AvgDataRate,
 		DataPerHour:    device.DataPerHour,
 		NamespaceURL:   device.NamespaceURL,
@@ -42,6 +74,120 @@ func SmartDeviceToJSON(device models.SmartDevice) SmartDeviceResponse {
 		DescriptionAll: device.DescriptionAll,
 		Protocol:       device.Protocol,
 		IsActive:       device.IsActive,
+		Version:        device.Version,
 		CreatedAt:      device.CreatedAt,
+
+		StockQuantity:     device.StockQuantity,
+		ReservedQuantity:  device.ReservedQuantity,
+		AvailableQuantity: inventory.Available(device),
+		InStock:           inventory.Available(device) > 0,
+	}
+	if device.Category != nil {
+		response.Category = &CategoryRef{ID: device.Category.ID, Slug: device.Category.Slug, Name: device.Category.Name}
+	}
+	response.Specs = map[string]interface{}{}
+	for key, value := range device.Specs {
+		response.Specs[key] = value
+	}
+	response.Tags = []string{}
+	for _, tag := range device.Tags {
+		response.Tags = append(response.Tags, tag.Name)
+	}
+	response.Images = DeviceImagesToJSON(device.Images)
+	response.ThumbnailURL, response.MediumURL = device.NamespaceURL, device.NamespaceURL
+	for _, image := range response.Images {
+		if image.IsPrimary {
+			response.ThumbnailURL, response.MediumURL = image.ThumbnailURL, image.MediumURL
+		}
+	}
+	return response
+}
+
+// SmartDevicePayload - SmartDeviceToJSON для importer.Options.DevicePayload
+func SmartDevicePayload(device models.SmartDevice) interface{} {
+	return SmartDeviceToJSON(device)
+}
+
+type DeviceImageResponse struct {
+	ID        uint      `json:"id"`
+	URL       string    `json:"url"`
+	AltText   string    `json:"alt_text"`
+	SortOrder int       `json:"sort_order"`
+	IsPrimary bool      `json:"is_primary"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Для перенесенных изображений без копий - URL оригинала, размеры 0
+	ThumbnailURL string `json:"thumbnail_url"`
+	MediumURL    string `json:"medium_url"`
+	ContentType  string `json:"content_type,omitempty"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// DeviceImageRequest - изменение подписи или выбор основного изображения
+type DeviceImageRequest struct {
+	// AltText - null - без изменений
+	AltText *string `json:"alt_text"`
+	// IsPrimary - true делает изображение основным; снять признак можно, только выбрав другое
+	IsPrimary bool `json:"is_primary"`
+}
+
+// DeviceImageUploadRequest - запрос ссылки на прямую загрузку; тип проверяется еще раз по содержимому при подтверждении
+type DeviceImageUploadRequest struct {
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// DeviceImageUploadResponse - подписанная ссылка: файл загружается на UploadURL методом PUT
+// с заголовками Headers, затем подтверждается запросом на ConfirmURL
+type DeviceImageUploadResponse struct {
+	UploadID   uint              `json:"upload_id"`
+	UploadURL  string            `json:"upload_url"`
+	Method     string            `json:"method"`
+	Headers    map[string]string `json:"headers"`
+	ConfirmURL string            `json:"confirm_url"`
+	MaxSize    int64             `json:"max_size"`
+	ExpiresAt  time.Time         `json:"expires_at"`
+}
+
+// DeviceImageOrderRequest - новый порядок галереи: все ID изображений устройства
+type DeviceImageOrderRequest struct {
+	ImageIDs []uint `json:"image_ids"`
+}
+
+// DeviceImagesToJSON - галерея в порядке показа
+func DeviceImagesToJSON(images []models.DeviceImage) []DeviceImageResponse {
+	sorted := append([]models.DeviceImage(nil), images...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].SortOrder != sorted[j].SortOrder {
+			return sorted[i].SortOrder < sorted[j].SortOrder
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	response := []DeviceImageResponse{}
+	for _, image := range sorted {
+		response = append(response, DeviceImageResponse{
+			ID:        image.ID,
+			URL:       image.URL,
+			AltText:   image.AltText,
+			SortOrder: image.SortOrder,
+			IsPrimary: image.IsPrimary,
+			CreatedAt: image.CreatedAt,
+
+			ThumbnailURL: orDefault(image.ThumbnailURL, image.URL),
+			MediumURL:    orDefault(image.MediumURL, image.URL),
+			ContentType:  image.ContentType,
+			Width:        image.Width,
+			Height:       image.Height,
+		})
+	}
+	return response
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
 	}
+	return value
 }
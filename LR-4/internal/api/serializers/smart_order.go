@@ -6,30 +6,39 @@ import (
 )
 
 type SmartOrderResponse struct {
-	ID            uint                     `json:"id"`
-	Status        string                   `json:"status"`
-	Address       string                   `json:"address"`
-	TotalTraffic  float64                  `json:"total_traffic"`
-	ClientID      uint                     `json:"client_id"`
-	ClientName    string                   `json:"client_name"`
-	FormedAt      *time.Time               `json:"formed_at,omitempty"`
-	CompletedAt   *time.Time               `json:"completed_at,omitempty"`
-	ModeratorID   *uint                    `json:"moderator_id,omitempty"`
-	ModeratorName string                   `json:"moderator_name,omitempty"`
-	CreatedAt     time.Time                `json:"created_at"`
-	Items         []SmartOrderItemResponse `json:"items"`
+	ID              uint                     `json:"id"`
+	Status          string                   `json:"status"`
+	Address         string                   `json:"address"`
+	AddressDetails  *AddressResponse         `json:"address_details,omitempty"`
+	TotalTraffic    float64                  `json:"total_traffic"`
+	RejectionReason string                   `json:"rejection_reason,omitempty"`
+	ClientID        uint                     `json:"client_id"`
+	ClientName      string                   `json:"client_name"`
+	FormedAt        *time.Time               `json:"formed_at,omitempty"`
+	CompletedAt     *time.Time               `json:"completed_at,omitempty"`
+	ModeratorID     *uint                    `json:"moderator_id,omitempty"`
+	ModeratorName   string                   `json:"moderator_name,omitempty"`
+	Version         uint                     `json:"version"`
+	CreatedAt       time.Time                `json:"created_at"`
+	Items           []SmartOrderItemResponse `json:"items"`
 }
 
 type SmartOrderItemResponse struct {
-	DeviceID     uint    `json:"device_id"`
-	DeviceName   string  `json:"device_name"`
-	Quantity     int     `json:"quantity"`
-	DataPerHour  float64 `json:"data_per_hour"`
-	NamespaceURL string  `json:"namespace_url"`
+	LineID         uint              `json:"line_id"`
+	DeviceID       uint              `json:"device_id"`
+	DeviceName     string            `json:"device_name"`
+	Quantity       int               `json:"quantity"`
+	DataPerHour    float64           `json:"data_per_hour"`
+	NamespaceURL   string            `json:"namespace_url"`
+	Room           string            `json:"room,omitempty"`
+	PlacementNotes string            `json:"placement_notes,omitempty"`
+	Config         map[string]string `json:"config,omitempty"`
 }
 
 type SmartOrderUpdateRequest struct {
-	Address string `json:"address"`
+	Address        string          `json:"address"`
+	AddressDetails *AddressRequest `json:"address_details"`
+	SavedAddressID *uint           `json:"saved_address_id"`
 }
 
 type SmartOrderFilter struct {
@@ -40,17 +49,24 @@ type SmartOrderFilter struct {
 
 func SmartOrderToJSON(order models.SmartOrder, items []SmartOrderItemResponse) SmartOrderResponse {
 	response := SmartOrderResponse{
-		ID:           order.ID,
-		Status:       order.Status,
-		Address:      order.Address,
-		TotalTraffic: order.TotalTraffic,
-		ClientID:     order.ClientID,
-		ClientName:   order.Client.Username,
-		FormedAt:     order.FormedAt,
-		CompletedAt:  order.CompletedAt,
-		ModeratorID:  order.ModeratorID,
-		CreatedAt:    order.CreatedAt,
-		Items:        items,
+		ID:              order.ID,
+		Status:          order.Status,
+		Address:         order.Address,
+		TotalTraffic:    order.TotalTraffic,
+		RejectionReason: order.RejectionReason,
+		ClientID:        order.ClientID,
+		ClientName:      order.Client.Username,
+		FormedAt:        order.FormedAt,
+		CompletedAt:     order.CompletedAt,
+		ModeratorID:     order.ModeratorID,
+		Version:         order.Version,
+		CreatedAt:       order.CreatedAt,
+		Items:           items,
+	}
+
+	if order.AddressDetails.City != "" {
+		details := AddressToJSON(order.AddressDetails)
+		response.AddressDetails = &details
 	}
 
 	if order.ModeratorID != nil && order.Moderator.ID != 0 {
@@ -59,3 +75,71 @@ func SmartOrderToJSON(order models.SmartOrder, items []SmartOrderItemResponse) S
 
 	return response
 }
+
+type SmartOrderRejectRequest struct {
+	Reason string `json:"reason"`
+}
+
+type BulkOrderActionRequest struct {
+	OrderIDs []uint `json:"order_ids"`
+	Action   string `json:"action"`
+	Reason   string `json:"reason"`
+}
+
+type BulkOrderActionResult struct {
+	OrderID uint   `json:"order_id"`
+	Success bool   `json:"success"`
+	Status  string `json:"status,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type BulkOrderActionResponse struct {
+	Action    string                  `json:"action"`
+	Succeeded int                     `json:"succeeded"`
+	Failed    int                     `json:"failed"`
+	Results   []BulkOrderActionResult `json:"results"`
+}
+
+type OrderStatusHistoryResponse struct {
+	ID         uint      `json:"id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ChangedBy  string    `json:"changed_by,omitempty"` // пусто - системное действие
+	Comment    string    `json:"comment,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func OrderStatusHistoryToJSON(entry models.OrderStatusHistory) OrderStatusHistoryResponse {
+	response := OrderStatusHistoryResponse{
+		ID:         entry.ID,
+		FromStatus: entry.FromStatus,
+		ToStatus:   entry.ToStatus,
+		Comment:    entry.Comment,
+		CreatedAt:  entry.CreatedAt,
+	}
+	if entry.ChangedBy != nil {
+		response.ChangedBy = entry.ChangedBy.Username
+	}
+	return response
+}
+
+type OrderCommentResponse struct {
+	ID        uint      `json:"id"`
+	Author    string    `json:"author,omitempty"` // пусто - автор удален
+	AuthorID  *uint     `json:"author_id,omitempty"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func OrderCommentToJSON(comment models.OrderComment) OrderCommentResponse {
+	response := OrderCommentResponse{
+		ID:        comment.ID,
+		AuthorID:  comment.AuthorID,
+		Body:      comment.Body,
+		CreatedAt: comment.CreatedAt,
+	}
+	if comment.Author != nil {
+		response.Author = comment.Author.Username
+	}
+	return response
+}
@@ -0,0 +1,92 @@
+package serializers
+
+import (
+	"encoding/json"
+	"smartdevices/internal/models"
+	"time"
+)
+
+type WebhookSubscriptionRequest struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	IsActive    *bool    `json:"is_active"`
+	// Secret - ключ подписи; если не передан при создании, генерируется сервером
+	Secret string `json:"secret"`
+}
+
+type WebhookSubscriptionResponse struct {
+	ID          uint      `json:"id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description"`
+	IsActive    bool      `json:"is_active"`
+	Secret      string    `json:"secret,omitempty"` // только в ответе на создание
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID             uint                     `json:"id"`
+	SubscriptionID uint                     `json:"subscription_id"`
+	Event          string                   `json:"event"`
+	Payload        json.RawMessage          `json:"payload"`
+	Status         string                   `json:"status"`
+	Attempts       int                      `json:"attempts"`
+	NextAttemptAt  *time.Time               `json:"next_attempt_at,omitempty"`
+	LastError      string                   `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time               `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time                `json:"created_at"`
+	AttemptLog     []WebhookAttemptResponse `json:"attempt_log,omitempty"`
+}
+
+type WebhookAttemptResponse struct {
+	Number       int       `json:"number"`
+	StatusCode   int       `json:"status_code"`
+	ResponseBody string    `json:"response_body,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	DurationMs   int64     `json:"duration_ms"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func WebhookSubscriptionToJSON(subscription models.WebhookSubscription) WebhookSubscriptionResponse {
+	events := []string(subscription.Events)
+	if events == nil {
+		events = []string{}
+	}
+	return WebhookSubscriptionResponse{
+		ID:          subscription.ID,
+		URL:         subscription.URL,
+		Events:      events,
+		Description: subscription.Description,
+		IsActive:    subscription.IsActive,
+		CreatedAt:   subscription.CreatedAt,
+		UpdatedAt:   subscription.UpdatedAt,
+	}
+}
+
+func WebhookDeliveryToJSON(delivery models.WebhookDelivery, attempts []models.WebhookAttempt) WebhookDeliveryResponse {
+	response := WebhookDeliveryResponse{
+		ID:             delivery.ID,
+		SubscriptionID: delivery.SubscriptionID,
+		Event:          delivery.Event,
+		Payload:        json.RawMessage(delivery.Payload),
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		LastError:      delivery.LastError,
+		DeliveredAt:    delivery.DeliveredAt,
+		CreatedAt:      delivery.CreatedAt,
+	}
+	for _, attempt := range attempts {
+		response.AttemptLog = append(response.AttemptLog, WebhookAttemptResponse{
+			Number:       attempt.Number,
+			StatusCode:   attempt.StatusCode,
+			ResponseBody: attempt.ResponseBody,
+			Error:        attempt.Error,
+			DurationMs:   attempt.DurationMs,
+			CreatedAt:    attempt.CreatedAt,
+		})
+	}
+	return response
+}
@@ -0,0 +1,171 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxTagLength = 50
+
+var errTagTooLong = fmt.Errorf("tag must be at most %d characters", maxTagLength)
+
+// TrafficCoefficient - множитель трафика устройства по его категории.
+// Устройство без категории (или без подгруженной категории) считается с коэффициентом 1.
+func TrafficCoefficient(device models.SmartDevice) float64 {
+	if device.Category == nil || device.Category.TrafficCoefficient <= 0 {
+		return 1.0
+	}
+	return device.Category.TrafficCoefficient
+}
+
+// SubtreeIDs - подзапрос с ID категорий и всех их потомков.
+// refs - ID или slug категорий в любом сочетании.
+func SubtreeIDs(db *gorm.DB, refs []string) *gorm.DB {
+	return db.Raw(`WITH RECURSIVE tree AS (
+			SELECT id FROM categories WHERE id::text IN ? OR slug IN ?
+			UNION
+			SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+		) SELECT id FROM tree`, refs, refs)
+}
+
+// IsInSubtree проверяет, что candidate - сама категория rootID или ее потомок.
+// Используется, чтобы при переносе категории не получить цикл.
+func IsInSubtree(db *gorm.DB, rootID, candidate uint) (bool, error) {
+	var count int64
+	err := db.Raw(`WITH RECURSIVE tree AS (
+			SELECT id FROM categories WHERE id = ?
+			UNION
+			SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+		) SELECT count(*) FROM tree WHERE id = ?`, rootID, candidate).Scan(&count).Error
+	return count > 0, err
+}
+
+// NormalizeTags приводит метки к нижнему регистру, убирает пустые и повторы
+func NormalizeTags(names []string) ([]string, error) {
+	seen := make(map[string]bool, len(names))
+	result := []string{}
+	for _, name := range names {
+		name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+		if name == "" || seen[name] {
+			continue
+		}
+		if utf8.RuneCountInString(name) > maxTagLength {
+			return nil, errTagTooLong
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	return result, nil
+}
+
+// ResolveTags возвращает метки по именам, создавая недостающие.
+// names должны быть уже нормализованы NormalizeTags.
+func ResolveTags(tx *gorm.DB, names []string) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	if len(names) == 0 {
+		return tags, nil
+	}
+
+	missing := make([]models.Tag, len(names))
+	for i, name := range names {
+		missing[i] = models.Tag{Name: name}
+	}
+	// Параллельный запрос мог создать ту же метку - конфликт по имени не ошибка
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&missing).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("name IN ?", names).Order("name").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	if len(tags) != len(names) {
+		return nil, errors.New("failed to resolve device tags")
+	}
+	return tags, nil
+}
+
+// defaultCategory - категория начального набора и слова в названии устройств,
+// по которым в нее переносятся существующие устройства
+type defaultCategory struct {
+	category models.Category
+	keywords []string
+}
+
+// Начальные категории повторяют коэффициенты трафика, которые раньше
+// определялись по названию устройства, и задают примеры схем характеристик
+var defaultCategories = []defaultCategory{
+	{models.Category{Slug: "hubs", Name: "Хабы", SortOrder: 10, TrafficCoefficient: 1.3, IsHub: true,
+		Attributes: models.AttributeSchema{
+			{Key: "max_devices", Label: "Максимум устройств", Type: models.AttributeInteger, Min: bound(1)},
+			{Key: "voice_assistant", Label: "Голосовой помощник", Type: models.AttributeBoolean},
+		}}, []string{"хаб", "hub"}},
+	{models.Category{Slug: "lighting", Name: "Освещение", SortOrder: 20, TrafficCoefficient: 1.1,
+		Attributes: models.AttributeSchema{
+			{Key: "socket", Label: "Цоколь", Type: models.AttributeEnum, Options: []string{"E27", "E14", "GU10", "GU5.3"}},
+			{Key: "lumens", Label: "Световой поток", Type: models.AttributeInteger, Unit: "лм", Min: bound(0)},
+			{Key: "dimmable", Label: "Регулировка яркости", Type: models.AttributeBoolean},
+		}}, []string{"лампочка"}},
+	{models.Category{Slug: "sockets", Name: "Розетки", SortOrder: 30, TrafficCoefficient: 0.9,
+		Attributes: models.AttributeSchema{
+			{Key: "max_power", Label: "Максимальная мощность", Type: models.AttributeInteger, Unit: "Вт", Min: bound(0)},
+			{Key: "energy_metering", Label: "Учет электроэнергии", Type: models.AttributeBoolean},
+		}}, []string{"розетка"}},
+	{models.Category{Slug: "sensors", Name: "Датчики", SortOrder: 40, TrafficCoefficient: 0.7,
+		Attributes: models.AttributeSchema{
+			{Key: "battery", Label: "Тип батарейки", Type: models.AttributeEnum, Options: []string{"CR2032", "CR2450", "CR123A", "AAA", "AA"}},
+			{Key: "range", Label: "Дальность обнаружения", Type: models.AttributeNumber, Unit: "м", Min: bound(0)},
+		}}, []string{"датчик"}},
+	{models.Category{Slug: "switches", Name: "Выключатели", SortOrder: 50, TrafficCoefficient: 0.8,
+		Attributes: models.AttributeSchema{
+			{Key: "keys", Label: "Количество клавиш", Type: models.AttributeInteger, Min: bound(1), Max: bound(4)},
+			{Key: "battery", Label: "Тип батарейки", Type: models.AttributeEnum, Options: []string{"CR2032", "CR2450", "AAA"}},
+		}}, []string{"выключатель"}},
+}
+
+func bound(value float64) *float64 {
+	return &value
+}
+
+// SeedCategories создает начальные категории и распределяет по ним устройства без категории.
+// Выполняется один раз - пока таблица категорий пуста.
+func SeedCategories(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&models.Category{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, def := range defaultCategories {
+			category := def.category
+			if err := tx.Create(&category).Error; err != nil {
+				return err
+			}
+
+			conditions := make([]string, len(def.keywords))
+			args := make([]interface{}, len(def.keywords))
+			for i, keyword := range def.keywords {
+				conditions[i] = "name ILIKE ?"
+				args[i] = "%" + keyword + "%"
+			}
+			// Версия не меняется: это перенос данных, а не правка модератора
+			err := tx.Model(&models.SmartDevice{}).
+				Where("category_id IS NULL").
+				Where(strings.Join(conditions, " OR "), args...).
+				UpdateColumn("category_id", category.ID).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,111 @@
+package catalog
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// FieldChange - отличие одного поля между двумя ревизиями
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// Snapshot снимает состояние устройства для ревизии.
+// Метки должны быть подгружены; в снимке они отсортированы по имени.
+func Snapshot(device models.SmartDevice) models.DeviceSnapshot {
+	snapshot := models.DeviceSnapshot{
+		Name:           device.Name,
+		Model:          device.Model,
+		Vendor:         device.Vendor,
+		AvgDataRate:    device.AvgDataRate,
+		DataPerHour:    device.DataPerHour,
+		NamespaceURL:   device.NamespaceURL,
+		Description:    device.Description,
+		DescriptionAll: device.DescriptionAll,
+		Protocol:       device.Protocol,
+		IsActive:       device.IsActive,
+		StockQuantity:  device.StockQuantity,
+		CategoryID:     device.CategoryID,
+		Tags:           []string{},
+		Specs:          map[string]interface{}{},
+	}
+	for _, tag := range device.Tags {
+		snapshot.Tags = append(snapshot.Tags, tag.Name)
+	}
+	sort.Strings(snapshot.Tags)
+	for key, value := range device.Specs {
+		snapshot.Specs[key] = value
+	}
+	return snapshot
+}
+
+// RecordRevision сохраняет ревизию устройства со следующим номером.
+// Вызывается в транзакции сохранения после обновления строки устройства:
+// строка уже заблокирована, поэтому номера одного устройства не пересекаются.
+func RecordRevision(tx *gorm.DB, device models.SmartDevice, action string, changedBy *uint, revertedFrom *uint) error {
+	var last uint
+	err := tx.Model(&models.DeviceRevision{}).
+		Where("device_id = ?", device.ID).
+		Select("COALESCE(MAX(revision), 0)").
+		Scan(&last).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&models.DeviceRevision{
+		DeviceID:      device.ID,
+		Revision:      last + 1,
+		Action:        action,
+		RevertedFrom:  revertedFrom,
+		DeviceVersion: device.Version,
+		Snapshot:      Snapshot(device),
+		ChangedByID:   changedBy,
+	}).Error
+}
+
+// BackfillRevisions создает исходную ревизию устройствам без истории,
+// чтобы первую правку можно было сравнить и откатить
+func BackfillRevisions(db *gorm.DB) error {
+	var devices []models.SmartDevice
+	err := db.Preload("Tags").
+		Where("NOT EXISTS (SELECT 1 FROM device_revisions r WHERE r.device_id = smart_devices.id)").
+		Find(&devices).Error
+	if err != nil || len(devices) == 0 {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, device := range devices {
+			if err := RecordRevision(tx, device, models.RevisionBaseline, nil, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DiffSnapshots возвращает отличающиеся поля в порядке полей снимка
+func DiffSnapshots(from, to models.DeviceSnapshot) []FieldChange {
+	changes := []FieldChange{}
+	fromValue := reflect.ValueOf(from)
+	toValue := reflect.ValueOf(to)
+	snapshotType := fromValue.Type()
+
+	for i := 0; i < snapshotType.NumField(); i++ {
+		a := fromValue.Field(i).Interface()
+		b := toValue.Field(i).Interface()
+		if reflect.DeepEqual(a, b) {
+			continue
+		}
+		name := strings.Split(snapshotType.Field(i).Tag.Get("json"), ",")[0]
+		changes = append(changes, FieldChange{Field: name, From: a, To: b})
+	}
+	return changes
+}
@@ -0,0 +1,96 @@
+package catalog
+
+import (
+	"reflect"
+	"testing"
+
+	"smartdevices/internal/models"
+)
+
+func uintPtr(value uint) *uint {
+	return &value
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	base := models.DeviceSnapshot{
+		Name:         "Лампа",
+		Model:        "L1",
+		NamespaceURL: "http://minio/lamp.png",
+		IsActive:     true,
+		CategoryID:   uintPtr(1),
+		Tags:         []string{"wifi"},
+		Specs:        map[string]interface{}{"power": 9.0},
+	}
+
+	tests := []struct {
+		name   string
+		change func(*models.DeviceSnapshot)
+		want   []FieldChange
+	}{
+		{"no changes", func(*models.DeviceSnapshot) {}, []FieldChange{}},
+		{"same category in another pointer", func(s *models.DeviceSnapshot) { s.CategoryID = uintPtr(1) }, []FieldChange{}},
+		{"image url", func(s *models.DeviceSnapshot) { s.NamespaceURL = "" }, []FieldChange{
+			{Field: "namespace_url", From: "http://minio/lamp.png", To: ""},
+		}},
+		{"fields in snapshot order", func(s *models.DeviceSnapshot) {
+			s.IsActive = false
+			s.Name = "Умная лампа"
+		}, []FieldChange{
+			{Field: "name", From: "Лампа", To: "Умная лампа"},
+			{Field: "is_active", From: true, To: false},
+		}},
+		{"category removed", func(s *models.DeviceSnapshot) { s.CategoryID = nil }, []FieldChange{
+			{Field: "category_id", From: uintPtr(1), To: (*uint)(nil)},
+		}},
+		{"tags and specs", func(s *models.DeviceSnapshot) {
+			s.Tags = []string{"wifi", "zigbee"}
+			s.Specs = map[string]interface{}{"power": 12.0}
+		}, []FieldChange{
+			{Field: "tags", From: []string{"wifi"}, To: []string{"wifi", "zigbee"}},
+			{Field: "specs", From: map[string]interface{}{"power": 9.0}, To: map[string]interface{}{"power": 12.0}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			to := base
+			to.Tags = append([]string(nil), base.Tags...)
+			to.Specs = map[string]interface{}{"power": 9.0}
+			tt.change(&to)
+
+			got := DiffSnapshots(base, to)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffSnapshots() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	device := models.SmartDevice{
+		Name:         "Хаб",
+		NamespaceURL: "http://minio/hub.png",
+		IsActive:     true,
+		Tags:         []models.Tag{{Name: "zigbee"}, {Name: "hub"}},
+		Specs:        models.Specs{"ports": 2.0},
+	}
+
+	snapshot := Snapshot(device)
+	if !reflect.DeepEqual(snapshot.Tags, []string{"hub", "zigbee"}) {
+		t.Errorf("Tags = %v, want sorted", snapshot.Tags)
+	}
+	if snapshot.NamespaceURL != device.NamespaceURL || snapshot.Specs["ports"] != 2.0 {
+		t.Errorf("Snapshot() = %+v", snapshot)
+	}
+
+	// Снимок не разделяет характеристики с устройством
+	device.Specs["ports"] = 4.0
+	if snapshot.Specs["ports"] != 2.0 {
+		t.Error("snapshot specs changed with the device")
+	}
+
+	empty := Snapshot(models.SmartDevice{})
+	if empty.Tags == nil || empty.Specs == nil {
+		t.Error("empty snapshot must have non-nil tags and specs")
+	}
+}
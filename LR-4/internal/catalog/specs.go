@@ -0,0 +1,201 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const maxAttributes = 30
+
+// AttributeKeyPattern - ключ характеристики: латиница в нижнем регистре, цифры и "_"
+var AttributeKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// SpecErrors - ошибки значений характеристик по ключам
+type SpecErrors map[string]string
+
+func (e SpecErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + ": " + e[key]
+	}
+	return "invalid specs: " + strings.Join(parts, "; ")
+}
+
+// ValidateSchema проверяет схему характеристик категории перед сохранением
+func ValidateSchema(schema models.AttributeSchema) error {
+	if len(schema) > maxAttributes {
+		return fmt.Errorf("category may have at most %d attributes", maxAttributes)
+	}
+	seen := make(map[string]bool, len(schema))
+	for i, def := range schema {
+		if !AttributeKeyPattern.MatchString(def.Key) {
+			return fmt.Errorf("attributes[%d]: key must match %s", i, AttributeKeyPattern)
+		}
+		if seen[def.Key] {
+			return fmt.Errorf("attributes[%d]: duplicate key %q", i, def.Key)
+		}
+		seen[def.Key] = true
+		if strings.TrimSpace(def.Label) == "" {
+			return fmt.Errorf("attribute %q: label is required", def.Key)
+		}
+
+		switch def.Type {
+		case models.AttributeString, models.AttributeBoolean:
+		case models.AttributeEnum:
+			if len(def.Options) == 0 {
+				return fmt.Errorf("attribute %q: enum needs options", def.Key)
+			}
+		case models.AttributeNumber, models.AttributeInteger:
+			if def.Min != nil && def.Max != nil && *def.Min > *def.Max {
+				return fmt.Errorf("attribute %q: min is greater than max", def.Key)
+			}
+		default:
+			return fmt.Errorf("attribute %q: unknown type %q, allowed: string, number, integer, boolean, enum", def.Key, def.Type)
+		}
+		if def.Type != models.AttributeEnum && len(def.Options) > 0 {
+			return fmt.Errorf("attribute %q: options are allowed only for enum", def.Key)
+		}
+	}
+	return nil
+}
+
+// EffectiveSchema - схема категории вместе с унаследованной от предков.
+// Сначала идут характеристики корня; одноименная характеристика потомка заменяет родительскую.
+// Для устройства без категории схема пустая.
+func EffectiveSchema(db *gorm.DB, categoryID *uint) (models.AttributeSchema, error) {
+	schema := models.AttributeSchema{}
+	if categoryID == nil {
+		return schema, nil
+	}
+
+	var chain []models.Category
+	err := db.Raw(`WITH RECURSIVE chain AS (
+			SELECT c.*, 0 AS depth FROM categories c WHERE c.id = ?
+			UNION ALL
+			SELECT p.*, chain.depth + 1 FROM categories p JOIN chain ON p.id = chain.parent_id
+		) SELECT * FROM chain ORDER BY depth DESC`, *categoryID).Scan(&chain).Error
+	if err != nil {
+		return nil, err
+	}
+
+	position := map[string]int{}
+	for _, category := range chain {
+		for _, def := range category.Attributes {
+			if i, ok := position[def.Key]; ok {
+				schema[i] = def
+				continue
+			}
+			position[def.Key] = len(schema)
+			schema = append(schema, def)
+		}
+	}
+	return schema, nil
+}
+
+// ValidateSpecs проверяет значения по схеме и возвращает нормализованную копию:
+// строки без пробелов по краям, пустые строки и null считаются отсутствующими.
+// Ошибки значений возвращаются как SpecErrors.
+func ValidateSpecs(schema models.AttributeSchema, values map[string]interface{}) (models.Specs, error) {
+	specs := models.Specs{}
+	problems := SpecErrors{}
+
+	defs := make(map[string]models.AttributeDef, len(schema))
+	for _, def := range schema {
+		defs[def.Key] = def
+	}
+	for key := range values {
+		if _, ok := defs[key]; !ok {
+			problems[key] = "unknown attribute for this category"
+		}
+	}
+
+	for _, def := range schema {
+		raw := values[def.Key]
+		if text, ok := raw.(string); ok {
+			raw = strings.TrimSpace(text)
+			if raw == "" {
+				raw = nil
+			}
+		}
+		if raw == nil {
+			if def.Required {
+				problems[def.Key] = "is required"
+			}
+			continue
+		}
+
+		value, err := checkValue(def, raw)
+		if err != nil {
+			problems[def.Key] = err.Error()
+			continue
+		}
+		specs[def.Key] = value
+	}
+
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return specs, nil
+}
+
+func checkValue(def models.AttributeDef, raw interface{}) (interface{}, error) {
+	switch def.Type {
+	case models.AttributeString:
+		text, ok := raw.(string)
+		if !ok {
+			return nil, errors.New("must be a string")
+		}
+		if len([]rune(text)) > 200 {
+			return nil, errors.New("must be at most 200 characters")
+		}
+		return text, nil
+
+	case models.AttributeBoolean:
+		flag, ok := raw.(bool)
+		if !ok {
+			return nil, errors.New("must be true or false")
+		}
+		return flag, nil
+
+	case models.AttributeEnum:
+		text, ok := raw.(string)
+		if ok {
+			for _, option := range def.Options {
+				if option == text {
+					return text, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("must be one of: %s", strings.Join(def.Options, ", "))
+
+	case models.AttributeNumber, models.AttributeInteger:
+		number, ok := raw.(float64)
+		if !ok || math.IsNaN(number) || math.IsInf(number, 0) {
+			return nil, errors.New("must be a number")
+		}
+		if def.Type == models.AttributeInteger && number != math.Trunc(number) {
+			return nil, errors.New("must be an integer")
+		}
+		if def.Min != nil && number < *def.Min {
+			return nil, fmt.Errorf("must be at least %g", *def.Min)
+		}
+		if def.Max != nil && number > *def.Max {
+			return nil, fmt.Errorf("must be at most %g", *def.Max)
+		}
+		return number, nil
+	}
+	return nil, fmt.Errorf("unsupported attribute type %q", def.Type)
+}
@@ -0,0 +1,172 @@
+package catalog
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"smartdevices/internal/models"
+)
+
+var testSchema = models.AttributeSchema{
+	{Key: "color", Label: "Цвет", Type: models.AttributeString},
+	{Key: "power", Label: "Мощность", Type: models.AttributeNumber, Unit: "Вт", Required: true, Min: bound(0), Max: bound(100)},
+	{Key: "keys", Label: "Клавиши", Type: models.AttributeInteger, Min: bound(1), Max: bound(4)},
+	{Key: "dimmable", Label: "Диммер", Type: models.AttributeBoolean},
+	{Key: "socket", Label: "Цоколь", Type: models.AttributeEnum, Options: []string{"E14", "E27"}},
+}
+
+func TestValidateSpecs(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]interface{}
+		want   models.Specs
+		errors SpecErrors
+	}{
+		{
+			name:   "all types",
+			values: map[string]interface{}{"color": "  белый ", "power": 9.5, "keys": 2.0, "dimmable": true, "socket": "E27"},
+			want:   models.Specs{"color": "белый", "power": 9.5, "keys": 2.0, "dimmable": true, "socket": "E27"},
+		},
+		{
+			name:   "empty and null are absent",
+			values: map[string]interface{}{"color": "   ", "power": 0.0, "socket": nil},
+			want:   models.Specs{"power": 0.0},
+		},
+		{
+			name:   "bounds are inclusive",
+			values: map[string]interface{}{"power": 100.0, "keys": 1.0},
+			want:   models.Specs{"power": 100.0, "keys": 1.0},
+		},
+		{
+			name:   "required missing",
+			values: map[string]interface{}{"power": "  "},
+			errors: SpecErrors{"power": "is required"},
+		},
+		{
+			name:   "unknown attribute",
+			values: map[string]interface{}{"power": 1.0, "voltage": 220.0},
+			errors: SpecErrors{"voltage": "unknown attribute for this category"},
+		},
+		{
+			name: "wrong types",
+			values: map[string]interface{}{
+				"color": 5.0, "power": "10", "keys": true, "dimmable": "yes", "socket": 27.0,
+			},
+			errors: SpecErrors{
+				"color":    "must be a string",
+				"power":    "must be a number",
+				"keys":     "must be a number",
+				"dimmable": "must be true or false",
+				"socket":   "must be one of: E14, E27",
+			},
+		},
+		{
+			name:   "out of range",
+			values: map[string]interface{}{"power": -1.0, "keys": 5.0},
+			errors: SpecErrors{"power": "must be at least 0", "keys": "must be at most 4"},
+		},
+		{
+			name:   "integer with fraction",
+			values: map[string]interface{}{"power": 1.0, "keys": 1.5},
+			errors: SpecErrors{"keys": "must be an integer"},
+		},
+		{
+			name:   "not finite",
+			values: map[string]interface{}{"power": math.NaN(), "keys": math.Inf(1)},
+			errors: SpecErrors{"power": "must be a number", "keys": "must be a number"},
+		},
+		{
+			name:   "enum is case sensitive",
+			values: map[string]interface{}{"power": 1.0, "socket": "e27"},
+			errors: SpecErrors{"socket": "must be one of: E14, E27"},
+		},
+		{
+			name:   "long string",
+			values: map[string]interface{}{"power": 1.0, "color": strings.Repeat("я", 201)},
+			errors: SpecErrors{"color": "must be at most 200 characters"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateSpecs(testSchema, tt.values)
+			if tt.errors != nil {
+				var problems SpecErrors
+				if !errors.As(err, &problems) {
+					t.Fatalf("ValidateSpecs() error = %v, want SpecErrors", err)
+				}
+				if !reflect.DeepEqual(problems, tt.errors) {
+					t.Errorf("ValidateSpecs() errors = %v, want %v", problems, tt.errors)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateSpecs() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateSpecs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSpecsEmptySchema(t *testing.T) {
+	got, err := ValidateSpecs(models.AttributeSchema{}, nil)
+	if err != nil || len(got) != 0 {
+		t.Errorf("ValidateSpecs(empty) = %v, %v", got, err)
+	}
+}
+
+func TestSpecErrorsMessage(t *testing.T) {
+	err := SpecErrors{"power": "is required", "color": "must be a string"}
+	want := "invalid specs: color: must be a string; power: is required"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	tooMany := make(models.AttributeSchema, maxAttributes+1)
+	for i := range tooMany {
+		tooMany[i] = models.AttributeDef{Key: "a" + strings.Repeat("b", i), Label: "A", Type: models.AttributeString}
+	}
+
+	tests := []struct {
+		name    string
+		schema  models.AttributeSchema
+		wantErr string
+	}{
+		{"valid", testSchema, ""},
+		{"empty", models.AttributeSchema{}, ""},
+		{"too many", tooMany, "at most 30 attributes"},
+		{"bad key", models.AttributeSchema{{Key: "Power", Label: "P", Type: models.AttributeNumber}}, "key must match"},
+		{"key starts with digit", models.AttributeSchema{{Key: "1st", Label: "P", Type: models.AttributeNumber}}, "key must match"},
+		{"duplicate key", models.AttributeSchema{
+			{Key: "power", Label: "P", Type: models.AttributeNumber},
+			{Key: "power", Label: "P2", Type: models.AttributeNumber},
+		}, "duplicate key"},
+		{"no label", models.AttributeSchema{{Key: "power", Label: " ", Type: models.AttributeNumber}}, "label is required"},
+		{"unknown type", models.AttributeSchema{{Key: "power", Label: "P", Type: "float"}}, "unknown type"},
+		{"enum without options", models.AttributeSchema{{Key: "socket", Label: "S", Type: models.AttributeEnum}}, "enum needs options"},
+		{"options on string", models.AttributeSchema{{Key: "color", Label: "C", Type: models.AttributeString, Options: []string{"red"}}}, "only for enum"},
+		{"min above max", models.AttributeSchema{{Key: "keys", Label: "K", Type: models.AttributeInteger, Min: bound(4), Max: bound(1)}}, "min is greater than max"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSchema(tt.schema)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateSchema() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateSchema() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
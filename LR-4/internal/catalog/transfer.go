@@ -0,0 +1,338 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"smartdevices/internal/export"
+	"smartdevices/internal/models"
+)
+
+// Форматы обмена каталогом
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// DeviceRecord - устройство в файле импорта и выгрузки. Ключ - модель.
+// Остаток, активность, категория, метки и характеристики при обновлении не меняются, если не заданы (nil);
+// категория задается slug, "" - без категории.
+type DeviceRecord struct {
+	Model          string                 `json:"model"`
+	Name           string                 `json:"name"`
+	Vendor         string                 `json:"vendor"`
+	AvgDataRate    float64                `json:"avg_data_rate"`
+	DataPerHour    float64                `json:"data_per_hour"`
+	NamespaceURL   string                 `json:"namespace_url"`
+	Description    string                 `json:"description"`
+	DescriptionAll string                 `json:"description_all"`
+	Protocol       string                 `json:"protocol"`
+	StockQuantity  *int                   `json:"stock_quantity"`
+	IsActive       *bool                  `json:"is_active"`
+	Category       *string                `json:"category"`
+	Tags           []string               `json:"tags"`
+	Specs          map[string]interface{} `json:"specs"`
+}
+
+// RecordLine - запись файла с номером строки, на которой она начинается.
+// Err - запись не удалось разобрать; остальные строки при этом читаются дальше.
+type RecordLine struct {
+	Line   int
+	Record DeviceRecord
+	Err    error
+}
+
+// DeviceColumns - колонки CSV; теги через запятую, характеристики - JSON-объект
+var DeviceColumns = []string{
+	"model", "name", "vendor", "avg_data_rate", "data_per_hour", "namespace_url", "description",
+	"description_all", "protocol", "stock_quantity", "is_active", "category", "tags", "specs",
+}
+
+// RecordOf готовит устройство к выгрузке. Category и Tags должны быть подгружены.
+func RecordOf(device models.SmartDevice) DeviceRecord {
+	stock := device.StockQuantity
+	active := device.IsActive
+	category := ""
+	if device.Category != nil {
+		category = device.Category.Slug
+	}
+	snapshot := Snapshot(device)
+	return DeviceRecord{
+		Model:          device.Model,
+		Name:           device.Name,
+		Vendor:         device.Vendor,
+		AvgDataRate:    device.AvgDataRate,
+		DataPerHour:    device.DataPerHour,
+		NamespaceURL:   device.NamespaceURL,
+		Description:    device.Description,
+		DescriptionAll: device.DescriptionAll,
+		Protocol:       device.Protocol,
+		StockQuantity:  &stock,
+		IsActive:       &active,
+		Category:       &category,
+		Tags:           snapshot.Tags,
+		Specs:          snapshot.Specs,
+	}
+}
+
+// ReadRecords разбирает файл импорта целиком: CSV с заголовком или JSON-массив
+func ReadRecords(format string, data []byte) ([]RecordLine, error) {
+	data = bytes.TrimPrefix(data, []byte("\uFEFF"))
+	switch format {
+	case FormatCSV:
+		return readCSV(data)
+	case FormatJSON:
+		return readJSON(data)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q, allowed: csv, json", format)
+	}
+}
+
+// DetectFormat угадывает формат по содержимому: JSON начинается с "["
+func DetectFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\uFEFF")))
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		return FormatJSON
+	}
+	return FormatCSV
+}
+
+func readJSON(data []byte) ([]RecordLine, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return nil, errors.New("JSON import must be an array of devices")
+	}
+
+	lines := []RecordLine{}
+	for decoder.More() {
+		// Номер строки - по первому непробельному символу элемента
+		offset := int(decoder.InputOffset())
+		for offset < len(data) && strings.ContainsRune(" \t\r\n,", rune(data[offset])) {
+			offset++
+		}
+		line := RecordLine{Line: bytes.Count(data[:offset], []byte("\n")) + 1}
+
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line.Line, err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&line.Record); err != nil {
+			line.Err = err
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+func readCSV(data []byte) ([]RecordLine, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	// Выгрузка пишет ";" (для Excel), но принимаем и обычный CSV через запятую
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("CSV header: %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	known := map[string]bool{}
+	for _, name := range DeviceColumns {
+		known[name] = true
+	}
+	for name := range columns {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown CSV column %q, allowed: %s", name, strings.Join(DeviceColumns, ", "))
+		}
+	}
+	if _, ok := columns["model"]; !ok {
+		return nil, errors.New("CSV must have a model column")
+	}
+
+	lines := []RecordLine{}
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return nil, fmt.Errorf("line %d: %v", parseErr.StartLine, parseErr.Err)
+			}
+			return nil, err
+		}
+		lineNumber, _ := reader.FieldPos(0)
+		line := RecordLine{Line: lineNumber}
+		line.Record, line.Err = csvRecord(columns, fields)
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// csvRecord собирает запись из ячеек; пустая ячейка - поле не меняется.
+// Апостроф перед формулой, добавленный выгрузкой, снимается.
+func csvRecord(columns map[string]int, fields []string) (DeviceRecord, error) {
+	var record DeviceRecord
+	cell := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(fields) {
+			return export.UnescapeFormula(strings.TrimSpace(fields[i]))
+		}
+		return ""
+	}
+
+	record.Model = cell("model")
+	record.Name = cell("name")
+	record.Vendor = cell("vendor")
+	record.NamespaceURL = cell("namespace_url")
+	record.Description = cell("description")
+	record.DescriptionAll = cell("description_all")
+	record.Protocol = cell("protocol")
+
+	numbers := []struct {
+		name   string
+		target *float64
+	}{
+		{"avg_data_rate", &record.AvgDataRate},
+		{"data_per_hour", &record.DataPerHour},
+	}
+	for _, number := range numbers {
+		if value := cell(number.name); value != "" {
+			parsed, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+			if err != nil {
+				return record, fmt.Errorf("%s must be a number", number.name)
+			}
+			*number.target = parsed
+		}
+	}
+	if value := cell("stock_quantity"); value != "" {
+		stock, err := strconv.Atoi(value)
+		if err != nil {
+			return record, errors.New("stock_quantity must be an integer")
+		}
+		record.StockQuantity = &stock
+	}
+	if value := cell("is_active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			return record, errors.New("is_active must be true or false")
+		}
+		record.IsActive = &active
+	}
+	if value := cell("category"); value != "" {
+		record.Category = &value
+	}
+	if value := cell("tags"); value != "" {
+		record.Tags = strings.Split(value, ",")
+	}
+	if value := cell("specs"); value != "" {
+		if err := json.Unmarshal([]byte(value), &record.Specs); err != nil {
+			return record, errors.New("specs must be a JSON object")
+		}
+	}
+	return record, nil
+}
+
+// RecordWriter построчно пишет выгрузку каталога в формате импорта
+type RecordWriter interface {
+	Write(record DeviceRecord) error
+	Close() error
+}
+
+// NewRecordWriter - CSV (с BOM и ";", как выгрузка заявок) или JSON-массив
+func NewRecordWriter(format string, w io.Writer) (RecordWriter, error) {
+	switch format {
+	case FormatCSV:
+		io.WriteString(w, "\uFEFF")
+		writer := csv.NewWriter(w)
+		writer.Comma = ';'
+		if err := writer.Write(DeviceColumns); err != nil {
+			return nil, err
+		}
+		return &csvRecordWriter{w: writer}, nil
+	case FormatJSON:
+		return &jsonRecordWriter{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %q, allowed: csv, json", format)
+	}
+}
+
+type csvRecordWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvRecordWriter) Write(record DeviceRecord) error {
+	specs, err := json.Marshal(record.Specs)
+	if err != nil {
+		return err
+	}
+	category := ""
+	if record.Category != nil {
+		category = *record.Category
+	}
+	stock, active := "", ""
+	if record.StockQuantity != nil {
+		stock = strconv.Itoa(*record.StockQuantity)
+	}
+	if record.IsActive != nil {
+		active = strconv.FormatBool(*record.IsActive)
+	}
+	// Текстовые поля заполняют пользователи - экранируем формулы, как в выгрузке заявок
+	text := export.EscapeFormula
+	return c.w.Write([]string{
+		text(record.Model), text(record.Name), text(record.Vendor),
+		strconv.FormatFloat(record.AvgDataRate, 'f', -1, 64),
+		strconv.FormatFloat(record.DataPerHour, 'f', -1, 64),
+		text(record.NamespaceURL), text(record.Description), text(record.DescriptionAll), text(record.Protocol),
+		stock, active, text(category), text(strings.Join(record.Tags, ",")), string(specs),
+	})
+}
+
+func (c *csvRecordWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonRecordWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonRecordWriter) Write(record DeviceRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	prefix := ",\n  "
+	if j.count == 0 {
+		prefix = "[\n  "
+	}
+	j.count++
+	if _, err := io.WriteString(j.w, prefix); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonRecordWriter) Close() error {
+	closing := "\n]\n"
+	if j.count == 0 {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(j.w, closing)
+	return err
+}
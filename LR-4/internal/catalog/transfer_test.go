@@ -0,0 +1,228 @@
+package catalog
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func intPtr(value int) *int          { return &value }
+func boolPtr(value bool) *bool       { return &value }
+func stringPtr(value string) *string { return &value }
+
+func TestReadRecordsCSV(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		want  []RecordLine
+		error string
+	}{
+		{
+			name: "semicolon with BOM",
+			data: "\uFEFFmodel;name;avg_data_rate;stock_quantity;is_active;category;tags;specs\n" +
+				"L1;Лампа;1,5;10;true;lamps;wifi,rgb;\"{\"\"power\"\":9}\"\n",
+			want: []RecordLine{{Line: 2, Record: DeviceRecord{
+				Model: "L1", Name: "Лампа", AvgDataRate: 1.5,
+				StockQuantity: intPtr(10), IsActive: boolPtr(true), Category: stringPtr("lamps"),
+				Tags: []string{"wifi", "rgb"}, Specs: map[string]interface{}{"power": 9.0},
+			}}},
+		},
+		{
+			name: "comma separated, empty cells are not set",
+			data: "Model, Name ,stock_quantity,category\nH1,Хаб,,\n",
+			want: []RecordLine{{Line: 2, Record: DeviceRecord{Model: "H1", Name: "Хаб"}}},
+		},
+		{
+			name: "escaped formulas are restored",
+			data: "model;name;description\nL1;'=Лампа;''-1\n",
+			want: []RecordLine{{Line: 2, Record: DeviceRecord{Model: "L1", Name: "=Лампа", Description: "'-1"}}},
+		},
+		{
+			name: "bad cells do not stop reading",
+			data: "model;stock_quantity;is_active;specs;data_per_hour\n" +
+				"A;x;;;\n" +
+				"B;;maybe;;\n" +
+				"C;;;[1];\n" +
+				"D;;;;fast\n" +
+				"E;;;;\n",
+			want: []RecordLine{
+				{Line: 2, Record: DeviceRecord{Model: "A"}, Err: errText("stock_quantity must be an integer")},
+				{Line: 3, Record: DeviceRecord{Model: "B"}, Err: errText("is_active must be true or false")},
+				{Line: 4, Record: DeviceRecord{Model: "C"}, Err: errText("specs must be a JSON object")},
+				{Line: 5, Record: DeviceRecord{Model: "D"}, Err: errText("data_per_hour must be a number")},
+				{Line: 6, Record: DeviceRecord{Model: "E"}},
+			},
+		},
+		{
+			name: "multiline cell keeps line numbers",
+			data: "model;description\nA;\"две\nстроки\"\nB;\n",
+			want: []RecordLine{
+				{Line: 2, Record: DeviceRecord{Model: "A", Description: "две\nстроки"}},
+				{Line: 4, Record: DeviceRecord{Model: "B"}},
+			},
+		},
+		{name: "header only", data: "model;name\n", want: []RecordLine{}},
+		{name: "empty file", data: "", error: "CSV header"},
+		{name: "unknown column", data: "model;price\nA;1\n", error: `unknown CSV column "price"`},
+		{name: "no model column", data: "name;vendor\nЛампа;X\n", error: "must have a model column"},
+		{name: "broken quotes", data: "model;name\nA;\"unterminated\n", error: "line 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadRecords(FormatCSV, []byte(tt.data))
+			checkRecords(t, got, err, tt.want, tt.error)
+		})
+	}
+}
+
+func TestReadRecordsJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		want  []RecordLine
+		error string
+	}{
+		{
+			name: "array",
+			data: "[\n  {\"model\": \"L1\", \"stock_quantity\": 3, \"tags\": [\"wifi\"]},\n\n  {\"model\": \"H1\", \"is_active\": false}\n]",
+			want: []RecordLine{
+				{Line: 2, Record: DeviceRecord{Model: "L1", StockQuantity: intPtr(3), Tags: []string{"wifi"}}},
+				{Line: 4, Record: DeviceRecord{Model: "H1", IsActive: boolPtr(false)}},
+			},
+		},
+		{
+			name: "bad element does not stop reading",
+			data: "[{\"model\": \"A\", \"price\": 1},\n{\"model\": \"B\", \"stock_quantity\": \"many\"},\n{\"model\": \"C\"}]",
+			want: []RecordLine{
+				{Line: 1, Record: DeviceRecord{Model: "A"}, Err: errText(`json: unknown field "price"`)},
+				{Line: 2, Record: DeviceRecord{Model: "B"}, Err: errText("cannot unmarshal")},
+				{Line: 3, Record: DeviceRecord{Model: "C"}},
+			},
+		},
+		{name: "formulas are not unescaped", data: `[{"model": "'=A"}]`, want: []RecordLine{{Line: 1, Record: DeviceRecord{Model: "'=A"}}}},
+		{name: "empty array", data: "[]", want: []RecordLine{}},
+		{name: "object instead of array", data: `{"model": "A"}`, error: "must be an array"},
+		{name: "broken JSON", data: "[\n{\"model\": }]", error: "line 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadRecords(FormatJSON, []byte(tt.data))
+			checkRecords(t, got, err, tt.want, tt.error)
+		})
+	}
+}
+
+func TestReadRecordsUnknownFormat(t *testing.T) {
+	if _, err := ReadRecords("xml", []byte("<devices/>")); err == nil {
+		t.Error("ReadRecords(xml) error = nil")
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := map[string]string{
+		"[]":                  FormatJSON,
+		"\uFEFF  \n[{}]":      FormatJSON,
+		"model;name\n":        FormatCSV,
+		"\uFEFFmodel,name\n":  FormatCSV,
+		"":                    FormatCSV,
+		`{"model": "object"}`: FormatCSV,
+	}
+	for data, want := range tests {
+		if got := DetectFormat([]byte(data)); got != want {
+			t.Errorf("DetectFormat(%q) = %s, want %s", data, got, want)
+		}
+	}
+}
+
+// Выгрузка читается импортом без потерь, в том числе значения, похожие на формулы
+func TestRecordWriterRoundTrip(t *testing.T) {
+	records := []DeviceRecord{
+		{
+			Model: "L1", Name: "=HYPERLINK(\"http://evil\")", Vendor: "+Vendor", AvgDataRate: 1.25, DataPerHour: 0.5,
+			NamespaceURL: "http://minio/l1.png", Description: "Лампа; с \"кавычками\"\nи переносом",
+			DescriptionAll: "'=уже с апострофом", Protocol: "@zigbee",
+			StockQuantity: intPtr(7), IsActive: boolPtr(true), Category: stringPtr("lamps"),
+			Tags: []string{"-rgb", "wifi"}, Specs: map[string]interface{}{"power": 9.0},
+		},
+		{Model: "H1", StockQuantity: intPtr(0), IsActive: boolPtr(false), Category: stringPtr(""), Tags: []string{}, Specs: map[string]interface{}{}},
+	}
+
+	for _, format := range []string{FormatCSV, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewRecordWriter(format, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, record := range records {
+				if err := writer.Write(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if format == FormatCSV && strings.Contains(buf.String(), ";=HYPERLINK") {
+				t.Error("CSV cell starts with a formula")
+			}
+			if got := DetectFormat(buf.Bytes()); got != format {
+				t.Errorf("DetectFormat() = %s, want %s", got, format)
+			}
+
+			lines, err := ReadRecords(format, buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(lines) != len(records) {
+				t.Fatalf("read %d records, want %d", len(lines), len(records))
+			}
+			for i, line := range lines {
+				want := records[i]
+				if format == FormatCSV && i == 1 {
+					// В CSV пустая ячейка означает "не менять": пустые категория и метки не читаются
+					want.Category, want.Tags = nil, nil
+				}
+				if line.Err != nil || !reflect.DeepEqual(line.Record, want) {
+					t.Errorf("record %d = %+v (%v), want %+v", i, line.Record, line.Err, want)
+				}
+			}
+		})
+	}
+}
+
+// errText - ожидаемая ошибка записи: сравнивается по вхождению текста
+type errText string
+
+func (e errText) Error() string { return string(e) }
+
+func checkRecords(t *testing.T, got []RecordLine, err error, want []RecordLine, wantErr string) {
+	t.Helper()
+	if wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Fatalf("ReadRecords() error = %v, want %q", err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("ReadRecords() error = %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ReadRecords() = %d records, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].Line != want[i].Line {
+			t.Errorf("record %d: line = %d, want %d", i, got[i].Line, want[i].Line)
+		}
+		if (got[i].Err == nil) != (want[i].Err == nil) ||
+			got[i].Err != nil && !strings.Contains(got[i].Err.Error(), want[i].Err.Error()) {
+			t.Errorf("record %d: error = %v, want %v", i, got[i].Err, want[i].Err)
+		}
+		if want[i].Err == nil && !reflect.DeepEqual(got[i].Record, want[i].Record) {
+			t.Errorf("record %d = %+v, want %+v", i, got[i].Record, want[i].Record)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package compatibility
+
+// Engine последовательно применяет правила к заявке
+type Engine struct {
+	rules []Rule
+}
+
+// NewEngine создает движок с заданным набором правил
+func NewEngine(rules ...Rule) *Engine {
+	return &Engine{rules: rules}
+}
+
+// Validate возвращает все нарушения; пустой список - заявка совместима
+func (e *Engine) Validate(cart Cart) []Violation {
+	violations := []Violation{}
+	for _, rule := range e.rules {
+		violations = append(violations, rule.Check(cart)...)
+	}
+	return violations
+}
@@ -0,0 +1,152 @@
+package compatibility
+
+import (
+	"fmt"
+	"strings"
+
+	"smartdevices/internal/models"
+)
+
+// CartItem - позиция заявки, проверяемая правилами
+type CartItem struct {
+	Device   models.SmartDevice
+	Quantity int
+}
+
+// Cart - содержимое заявки и окружение на адресе установки
+type Cart struct {
+	Items []CartItem
+	// HubsAtAddress - хабы, уже установленные по адресу заявки (из завершенных заявок)
+	HubsAtAddress int
+	// Catalog - активные устройства каталога, из которых подбираются рекомендации
+	Catalog []models.SmartDevice
+}
+
+// Suggestion - устройство, которое рекомендуется добавить в заявку
+type Suggestion struct {
+	DeviceID uint   `json:"device_id"`
+	Name     string `json:"name"`
+	Model    string `json:"model"`
+	Quantity int    `json:"quantity"`
+}
+
+// Violation - нарушение одного правила совместимости
+type Violation struct {
+	Rule        string       `json:"rule"`
+	Message     string       `json:"message"`
+	DeviceIDs   []uint       `json:"device_ids,omitempty"`
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+}
+
+// Rule - правило совместимости устройств в заявке
+type Rule interface {
+	Name() string
+	Check(cart Cart) []Violation
+}
+
+// IsHub определяет, является ли устройство хабом, по флагу его категории.
+// Устройство должно быть загружено с Category.
+func IsHub(device models.SmartDevice) bool {
+	return device.Category != nil && device.Category.IsHub
+}
+
+// hubsInCart считает хабы в самой заявке
+func hubsInCart(cart Cart) int {
+	hubs := 0
+	for _, item := range cart.Items {
+		if IsHub(item.Device) {
+			hubs += item.Quantity
+		}
+	}
+	return hubs
+}
+
+// devicesOfProtocol возвращает количество и ID устройств протокола (без хабов)
+func devicesOfProtocol(cart Cart, protocol string) (int, []uint) {
+	count := 0
+	var ids []uint
+	for _, item := range cart.Items {
+		if IsHub(item.Device) || !strings.EqualFold(item.Device.Protocol, protocol) {
+			continue
+		}
+		count += item.Quantity
+		ids = append(ids, item.Device.ID)
+	}
+	return count, ids
+}
+
+// suggestHubs предлагает хабы из каталога в нужном количестве
+func suggestHubs(cart Cart, quantity int) []Suggestion {
+	var suggestions []Suggestion
+	for _, device := range cart.Catalog {
+		if device.IsActive && IsHub(device) {
+			suggestions = append(suggestions, Suggestion{
+				DeviceID: device.ID,
+				Name:     device.Name,
+				Model:    device.Model,
+				Quantity: quantity,
+			})
+		}
+	}
+	return suggestions
+}
+
+// RequiresHubRule - устройства протокола работают только через хаб
+type RequiresHubRule struct {
+	Protocol string
+}
+
+func (r RequiresHubRule) Name() string {
+	return "requires_hub:" + strings.ToLower(r.Protocol)
+}
+
+func (r RequiresHubRule) Check(cart Cart) []Violation {
+	count, ids := devicesOfProtocol(cart, r.Protocol)
+	if count == 0 || hubsInCart(cart)+cart.HubsAtAddress > 0 {
+		return nil
+	}
+
+	return []Violation{{
+		Rule:        r.Name(),
+		Message:     fmt.Sprintf("Устройствам %s нужен хаб в заявке или по адресу установки", r.Protocol),
+		DeviceIDs:   ids,
+		Suggestions: suggestHubs(cart, 1),
+	}}
+}
+
+// MaxDevicesPerHubRule - ограничение числа устройств протокола на один хаб
+type MaxDevicesPerHubRule struct {
+	Protocol string
+	Max      int
+}
+
+func (r MaxDevicesPerHubRule) Name() string {
+	return "max_per_hub:" + strings.ToLower(r.Protocol)
+}
+
+func (r MaxDevicesPerHubRule) Check(cart Cart) []Violation {
+	hubs := hubsInCart(cart) + cart.HubsAtAddress
+	count, ids := devicesOfProtocol(cart, r.Protocol)
+	// Отсутствие хаба - зона ответственности RequiresHubRule
+	if hubs == 0 || r.Max <= 0 || count <= hubs*r.Max {
+		return nil
+	}
+
+	needed := (count+r.Max-1)/r.Max - hubs
+	return []Violation{{
+		Rule:        r.Name(),
+		Message:     fmt.Sprintf("Не более %d устройств %s на один хаб: в заявке %d, хабов %d", r.Max, r.Protocol, count, hubs),
+		DeviceIDs:   ids,
+		Suggestions: suggestHubs(cart, needed),
+	}}
+}
+
+// DefaultRules - правила совместимости каталога по умолчанию
+func DefaultRules() []Rule {
+	return []Rule{
+		RequiresHubRule{Protocol: "Zigbee"},
+		RequiresHubRule{Protocol: "Bluetooth"},
+		MaxDevicesPerHubRule{Protocol: "Zigbee", Max: 32},
+		MaxDevicesPerHubRule{Protocol: "Bluetooth", Max: 10},
+	}
+}
@@ -0,0 +1,119 @@
+package compatibility
+
+import (
+	"reflect"
+	"testing"
+
+	"smartdevices/internal/models"
+)
+
+var hubCategory = &models.Category{Name: "Хабы", IsHub: true}
+
+func device(id uint, protocol string, hub bool) models.SmartDevice {
+	d := models.SmartDevice{ID: id, Name: protocol, Protocol: protocol, IsActive: true}
+	if hub {
+		d.Category = hubCategory
+	}
+	return d
+}
+
+func TestRequiresHubRule(t *testing.T) {
+	rule := RequiresHubRule{Protocol: "Zigbee"}
+	hub := device(1, "WiFi", true)
+	sensor := device(2, "zigbee", false)
+
+	tests := []struct {
+		name      string
+		cart      Cart
+		violation bool
+	}{
+		{"no protocol devices", Cart{Items: []CartItem{{Device: device(3, "WiFi", false), Quantity: 2}}}, false},
+		{"hub in cart", Cart{Items: []CartItem{{Device: sensor, Quantity: 2}, {Device: hub, Quantity: 1}}}, false},
+		{"hub at address", Cart{Items: []CartItem{{Device: sensor, Quantity: 2}}, HubsAtAddress: 1}, false},
+		{"no hub", Cart{Items: []CartItem{{Device: sensor, Quantity: 2}}, Catalog: []models.SmartDevice{hub}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := rule.Check(tt.cart)
+			if (len(violations) > 0) != tt.violation {
+				t.Fatalf("Check() = %+v, want violation %v", violations, tt.violation)
+			}
+			if !tt.violation {
+				return
+			}
+			v := violations[0]
+			if v.Rule != "requires_hub:zigbee" {
+				t.Errorf("Rule = %q", v.Rule)
+			}
+			if !reflect.DeepEqual(v.DeviceIDs, []uint{2}) {
+				t.Errorf("DeviceIDs = %v, want [2]", v.DeviceIDs)
+			}
+			if len(v.Suggestions) != 1 || v.Suggestions[0].DeviceID != 1 || v.Suggestions[0].Quantity != 1 {
+				t.Errorf("Suggestions = %+v, want hub 1 x1", v.Suggestions)
+			}
+		})
+	}
+}
+
+func TestMaxDevicesPerHubRule(t *testing.T) {
+	rule := MaxDevicesPerHubRule{Protocol: "Zigbee", Max: 3}
+	hub := device(1, "Zigbee", true)
+	sensor := device(2, "Zigbee", false)
+	inactiveHub := device(4, "Zigbee", true)
+	inactiveHub.IsActive = false
+
+	tests := []struct {
+		name    string
+		cart    Cart
+		suggest int
+	}{
+		{"no hub is not this rule", Cart{Items: []CartItem{{Device: sensor, Quantity: 10}}}, 0},
+		{"within limit", Cart{Items: []CartItem{{Device: sensor, Quantity: 3}, {Device: hub, Quantity: 1}}}, 0},
+		{"hubs at address count", Cart{Items: []CartItem{{Device: sensor, Quantity: 6}, {Device: hub, Quantity: 1}}, HubsAtAddress: 1}, 0},
+		{"one hub short", Cart{Items: []CartItem{{Device: sensor, Quantity: 4}, {Device: hub, Quantity: 1}}}, 1},
+		{"several hubs short", Cart{Items: []CartItem{{Device: sensor, Quantity: 10}}, HubsAtAddress: 1}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cart.Catalog = []models.SmartDevice{hub, sensor, inactiveHub}
+			violations := rule.Check(tt.cart)
+			if tt.suggest == 0 {
+				if len(violations) > 0 {
+					t.Fatalf("Check() = %+v, want none", violations)
+				}
+				return
+			}
+			if len(violations) != 1 {
+				t.Fatalf("Check() = %+v, want one violation", violations)
+			}
+			// Неактивный хаб не предлагается
+			want := []Suggestion{{DeviceID: 1, Name: "Zigbee", Quantity: tt.suggest}}
+			if !reflect.DeepEqual(violations[0].Suggestions, want) {
+				t.Errorf("Suggestions = %+v, want %+v", violations[0].Suggestions, want)
+			}
+		})
+	}
+}
+
+func TestEngineValidate(t *testing.T) {
+	engine := NewEngine(DefaultRules()...)
+
+	if violations := engine.Validate(Cart{}); violations == nil || len(violations) != 0 {
+		t.Errorf("Validate(empty) = %#v, want empty non-nil slice", violations)
+	}
+
+	cart := Cart{Items: []CartItem{
+		{Device: device(1, "Zigbee", false), Quantity: 1},
+		{Device: device(2, "Bluetooth", false), Quantity: 1},
+	}}
+	var rules []string
+	for _, v := range engine.Validate(cart) {
+		rules = append(rules, v.Rule)
+	}
+	want := []string{"requires_hub:zigbee", "requires_hub:bluetooth"}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("Validate() rules = %v, want %v", rules, want)
+	}
+}
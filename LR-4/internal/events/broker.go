@@ -0,0 +1,166 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Типы событий потока /api/events
+const (
+	TypeOrderStatus = "order.status" // клиенту: смена статуса его заявки
+	TypeOrderFormed = "order.formed" // модераторам: новая сформированная заявка
+	TypeCartUpdated = "cart.updated" // клиенту: изменилось количество устройств в корзине
+)
+
+const (
+	channelPrefix     = "events:"
+	moderatorsChannel = channelPrefix + "moderators"
+	subscriberBuffer  = 16
+)
+
+func userChannel(clientID uint) string {
+	return fmt.Sprintf("%suser:%d", channelPrefix, clientID)
+}
+
+// Event - событие для подписчика
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Broker рассылает события через Redis pub/sub.
+// Каждый экземпляр сервера держит одну подписку на events:* и раздает сообщения
+// своим SSE-подключениям, поэтому событие доходит до пользователя на любом экземпляре.
+type Broker struct {
+	client *redis.Client
+
+	mu          sync.RWMutex
+	subscribers map[string]map[chan Event]struct{}
+}
+
+// NewBroker создает брокер на общем клиенте Redis.
+// Без клиента (nil) события раздаются только подключениям этого экземпляра.
+func NewBroker(client *redis.Client) *Broker {
+	return &Broker{
+		client:      client,
+		subscribers: make(map[string]map[chan Event]struct{}),
+	}
+}
+
+// Start слушает Redis до отмены ctx. go-redis сам переподключается при обрыве.
+func (b *Broker) Start(ctx context.Context) {
+	if b.client == nil {
+		return
+	}
+	pubsub := b.client.PSubscribe(ctx, channelPrefix+"*")
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				log.Printf("⚠️ Events: bad message on %s: %v", msg.Channel, err)
+				continue
+			}
+			b.dispatch(msg.Channel, event)
+		}
+	}
+}
+
+// Subscribe подключает получателя к событиям пользователя, а модератора - еще и к общему каналу.
+// Возвращенную функцию нужно вызвать при закрытии соединения.
+func (b *Broker) Subscribe(clientID uint, isModerator bool) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	channels := []string{userChannel(clientID)}
+	if isModerator {
+		channels = append(channels, moderatorsChannel)
+	}
+
+	b.mu.Lock()
+	for _, name := range channels {
+		if b.subscribers[name] == nil {
+			b.subscribers[name] = make(map[chan Event]struct{})
+		}
+		b.subscribers[name][ch] = struct{}{}
+	}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for _, name := range channels {
+			delete(b.subscribers[name], ch)
+			if len(b.subscribers[name]) == 0 {
+				delete(b.subscribers, name)
+			}
+		}
+		close(ch)
+	}
+	return ch, unsubscribe
+}
+
+// dispatch раздает событие локальным подписчикам канала.
+// Медленный получатель пропускает событие, чтобы не задерживать остальных.
+func (b *Broker) dispatch(channel string, event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subscribers[channel] {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("⚠️ Events: subscriber on %s is too slow, %s dropped",
+				strings.TrimPrefix(channel, channelPrefix), event.Type)
+		}
+	}
+}
+
+// PublishToUser отправляет событие всем подключениям пользователя
+func (b *Broker) PublishToUser(clientID uint, eventType string, data interface{}) {
+	b.publish(userChannel(clientID), eventType, data)
+}
+
+// PublishToModerators отправляет событие всем подключенным модераторам
+func (b *Broker) PublishToModerators(eventType string, data interface{}) {
+	b.publish(moderatorsChannel, eventType, data)
+}
+
+// publish не возвращает ошибку: события - подсказка для интерфейса,
+// их потеря не должна ломать запрос, который уже сохранен в БД
+func (b *Broker) publish(channel, eventType string, data interface{}) {
+	event := Event{Type: eventType}
+	payload, err := json.Marshal(data)
+	if err == nil {
+		event.Data = payload
+		payload, err = json.Marshal(event)
+	}
+	if err != nil {
+		log.Printf("⚠️ Events: encode %s failed: %v", eventType, err)
+		return
+	}
+
+	if b.client == nil {
+		b.dispatch(channel, event)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := b.client.Publish(ctx, channel, payload).Err(); err != nil {
+		log.Printf("⚠️ Events: publish %s to %s failed: %v", eventType, channel, err)
+	}
+}
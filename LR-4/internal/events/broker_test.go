@@ -0,0 +1,124 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// received забирает из канала все события, которые уже в нем лежат
+func received(ch <-chan Event) []string {
+	var types []string
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return types
+			}
+			types = append(types, event.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func TestBrokerRouting(t *testing.T) {
+	b := NewBroker(nil)
+	client, unsubscribeClient := b.Subscribe(1, false)
+	defer unsubscribeClient()
+	other, unsubscribeOther := b.Subscribe(2, false)
+	defer unsubscribeOther()
+	moderator, unsubscribeModerator := b.Subscribe(3, true)
+	defer unsubscribeModerator()
+
+	b.PublishToUser(1, TypeOrderStatus, OrderStatus{OrderID: 10, Status: "formed"})
+	b.PublishToModerators(TypeOrderFormed, OrderFormed{OrderID: 10, ClientID: 1})
+	b.PublishToUser(3, TypeCartUpdated, Cart{OrderID: 11, Count: 2})
+
+	tests := []struct {
+		name string
+		ch   <-chan Event
+		want []string
+	}{
+		{"owner gets only own events", client, []string{TypeOrderStatus}},
+		{"another client gets nothing", other, nil},
+		{"moderator gets own and moderator events", moderator, []string{TypeOrderFormed, TypeCartUpdated}},
+	}
+	for _, tt := range tests {
+		got := received(tt.ch)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestBrokerEventData(t *testing.T) {
+	b := NewBroker(nil)
+	ch, unsubscribe := b.Subscribe(1, false)
+	defer unsubscribe()
+
+	b.PublishToUser(1, TypeCartUpdated, Cart{OrderID: 5, Count: 3})
+	event := <-ch
+
+	var cart Cart
+	if err := json.Unmarshal(event.Data, &cart); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != TypeCartUpdated || cart != (Cart{OrderID: 5, Count: 3}) {
+		t.Errorf("event = %s %s", event.Type, event.Data)
+	}
+}
+
+func TestBrokerUnsubscribe(t *testing.T) {
+	b := NewBroker(nil)
+	ch, unsubscribe := b.Subscribe(1, true)
+	kept, unsubscribeKept := b.Subscribe(1, false)
+	defer unsubscribeKept()
+
+	unsubscribe()
+	if _, ok := <-ch; ok {
+		t.Error("channel is open after unsubscribe")
+	}
+	// Канал модераторов без подписчиков удаляется, канал пользователя остается у второго подключения
+	if _, ok := b.subscribers[moderatorsChannel]; ok {
+		t.Error("moderators channel kept without subscribers")
+	}
+	if len(b.subscribers[userChannel(1)]) != 1 {
+		t.Errorf("user channel has %d subscribers, want 1", len(b.subscribers[userChannel(1)]))
+	}
+
+	// Публикация после отписки не паникует и доходит до оставшегося подключения
+	b.PublishToUser(1, TypeCartUpdated, Cart{})
+	b.PublishToModerators(TypeOrderFormed, OrderFormed{})
+	if got := received(kept); len(got) != 1 || got[0] != TypeCartUpdated {
+		t.Errorf("remaining subscriber got %v", got)
+	}
+}
+
+// Переполненный получатель теряет события, но не задерживает остальных
+func TestBrokerSlowSubscriber(t *testing.T) {
+	b := NewBroker(nil)
+	slow, unsubscribeSlow := b.Subscribe(3, true)
+	defer unsubscribeSlow()
+	fast, unsubscribeFast := b.Subscribe(4, true)
+	defer unsubscribeFast()
+
+	total := subscriberBuffer + 5
+	for i := 0; i < total; i++ {
+		b.PublishToModerators(TypeOrderFormed, OrderFormed{OrderID: uint(i)})
+		received(fast)
+	}
+
+	if got := len(received(slow)); got != subscriberBuffer {
+		t.Errorf("slow subscriber got %d events, want %d", got, subscriberBuffer)
+	}
+	b.PublishToModerators(TypeOrderFormed, OrderFormed{})
+	if got := received(fast); len(got) != 1 {
+		t.Errorf("fast subscriber got %v, want one event", got)
+	}
+}
@@ -0,0 +1,27 @@
+package events
+
+import "time"
+
+// OrderStatus - данные события order.status
+type OrderStatus struct {
+	OrderID    uint      `json:"order_id"`
+	FromStatus string    `json:"from_status"`
+	Status     string    `json:"status"`
+	Version    uint      `json:"version"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// OrderFormed - данные события order.formed для модераторов
+type OrderFormed struct {
+	OrderID    uint       `json:"order_id"`
+	ClientID   uint       `json:"client_id"`
+	ClientName string     `json:"client_name"`
+	Address    string     `json:"address"`
+	FormedAt   *time.Time `json:"formed_at,omitempty"`
+}
+
+// Cart - данные события cart.updated; order_id = 0, если черновика нет
+type Cart struct {
+	OrderID uint `json:"order_id"`
+	Count   int  `json:"count"`
+}
@@ -0,0 +1,255 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// Размер страницы A4 в пунктах
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Document - минимальный генератор PDF с встроенным шрифтом Go (есть кириллица).
+// Поддерживает только текст и линии - этого достаточно для печатных бланков.
+type Document struct {
+	font       *sfnt.Font
+	buf        sfnt.Buffer
+	unitsPerEm float64
+	used       map[sfnt.GlyphIndex]rune
+	widths     map[sfnt.GlyphIndex]int
+	pages      []*bytes.Buffer
+	current    *bytes.Buffer
+}
+
+func NewDocument() (*Document, error) {
+	f, err := sfnt.Parse(goregular.TTF)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font: %v", err)
+	}
+
+	d := &Document{
+		font:       f,
+		unitsPerEm: float64(f.UnitsPerEm()),
+		used:       make(map[sfnt.GlyphIndex]rune),
+		widths:     make(map[sfnt.GlyphIndex]int),
+	}
+	d.AddPage()
+	return d, nil
+}
+
+// AddPage начинает новую страницу
+func (d *Document) AddPage() {
+	d.current = &bytes.Buffer{}
+	d.pages = append(d.pages, d.current)
+}
+
+// glyph возвращает индекс глифа и его ширину в тысячных долях кегля
+func (d *Document) glyph(r rune) (sfnt.GlyphIndex, int) {
+	gid, err := d.font.GlyphIndex(&d.buf, r)
+	if err != nil {
+		gid = 0
+	}
+	if w, ok := d.widths[gid]; ok {
+		return gid, w
+	}
+
+	ppem := fixed.Int26_6(d.font.UnitsPerEm()) << 6
+	advance, err := d.font.GlyphAdvance(&d.buf, gid, ppem, font.HintingNone)
+	width := 0
+	if err == nil {
+		width = int(float64(advance) / 64 * 1000 / d.unitsPerEm)
+	}
+	d.widths[gid] = width
+	return gid, width
+}
+
+// TextWidth - ширина строки в пунктах при заданном кегле
+func (d *Document) TextWidth(s string, size float64) float64 {
+	total := 0
+	for _, r := range s {
+		_, w := d.glyph(r)
+		total += w
+	}
+	return float64(total) * size / 1000
+}
+
+// Text выводит строку; (x, y) - левый край базовой линии, начало координат внизу слева
+func (d *Document) Text(x, y, size float64, s string) {
+	var hex strings.Builder
+	for _, r := range s {
+		gid, _ := d.glyph(r)
+		if _, ok := d.used[gid]; !ok {
+			d.used[gid] = r
+		}
+		fmt.Fprintf(&hex, "%04X", uint16(gid))
+	}
+	fmt.Fprintf(d.current, "BT /F1 %.1f Tf %.2f %.2f Td <%s> Tj ET\n", size, x, y, hex.String())
+}
+
+// Line рисует отрезок толщиной 0.5 пт
+func (d *Document) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.current, "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+// Wrap разбивает текст по словам так, чтобы строки помещались в ширину
+func (d *Document) Wrap(s string, size, width float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && d.TextWidth(candidate, size) > width {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		line = candidate
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// WriteTo собирает PDF: каталог, страницы, шрифт Type0/CIDFontType2 и таблицу xref
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var out bytes.Buffer
+	var offsets []int
+
+	newObject := func(body string) int {
+		offsets = append(offsets, out.Len())
+		id := len(offsets)
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", id, body)
+		return id
+	}
+	newStream := func(dict string, data []byte) int {
+		offsets = append(offsets, out.Len())
+		id := len(offsets)
+		fmt.Fprintf(&out, "%d 0 obj\n<< %s /Length %d >>\nstream\n", id, dict, len(data))
+		out.Write(data)
+		out.WriteString("\nendstream\nendobj\n")
+		return id
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Номера объектов фиксированы: 1 - каталог, 2 - дерево страниц, 3 - шрифт
+	fontFile := compress(goregular.TTF)
+	metrics, _ := d.font.Metrics(&d.buf, fixed.Int26_6(d.font.UnitsPerEm())<<6, font.HintingNone)
+	scale := func(v fixed.Int26_6) int { return int(float64(v) / 64 * 1000 / d.unitsPerEm) }
+
+	newObject("<< /Type /Catalog /Pages 2 0 R >>")
+	offsets = append(offsets, 0) // 2 - заполняется после страниц
+	offsets = append(offsets, 0) // 3 - шрифт Type0
+
+	fontFileID := newStream(fmt.Sprintf("/Filter /FlateDecode /Length1 %d", len(goregular.TTF)), fontFile)
+	descriptorID := newObject(fmt.Sprintf(
+		"<< /Type /FontDescriptor /FontName /GoRegular /Flags 32 /FontBBox [-200 %d 1200 %d] "+
+			"/ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		-scale(metrics.Descent), scale(metrics.Ascent), scale(metrics.Ascent), -scale(metrics.Descent),
+		scale(metrics.CapHeight), fontFileID))
+	cidFontID := newObject(fmt.Sprintf(
+		"<< /Type /Font /Subtype /CIDFontType2 /BaseFont /GoRegular "+
+			"/CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> "+
+			"/FontDescriptor %d 0 R /CIDToGIDMap /Identity /DW 600 /W [%s] >>",
+		descriptorID, d.widthsArray()))
+	toUnicodeID := newStream("/Filter /FlateDecode", compress([]byte(d.toUnicodeCMap())))
+
+	offsets[2] = out.Len()
+	fmt.Fprintf(&out, "3 0 obj\n<< /Type /Font /Subtype /Type0 /BaseFont /GoRegular /Encoding /Identity-H "+
+		"/DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>\nendobj\n", cidFontID, toUnicodeID)
+
+	var kids []string
+	for _, page := range d.pages {
+		contentID := newStream("/Filter /FlateDecode", compress(page.Bytes()))
+		pageID := newObject(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+				"/Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			PageWidth, PageHeight, contentID))
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageID))
+	}
+
+	offsets[1] = out.Len()
+	fmt.Fprintf(&out, "2 0 obj\n<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n",
+		strings.Join(kids, " "), len(kids))
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.WriteTo(w)
+}
+
+// widthsArray - массив /W с ширинами использованных глифов
+func (d *Document) widthsArray() string {
+	gids := d.usedGlyphs()
+	var b strings.Builder
+	for _, gid := range gids {
+		fmt.Fprintf(&b, "%d [%d] ", gid, d.widths[gid])
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// toUnicodeCMap позволяет копировать и искать текст в PDF
+func (d *Document) toUnicodeCMap() string {
+	gids := d.usedGlyphs()
+
+	var b strings.Builder
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+
+	for start := 0; start < len(gids); start += 100 {
+		end := start + 100
+		if end > len(gids) {
+			end = len(gids)
+		}
+		fmt.Fprintf(&b, "%d beginbfchar\n", end-start)
+		for _, gid := range gids[start:end] {
+			var unicode strings.Builder
+			for _, u := range utf16.Encode([]rune{d.used[gid]}) {
+				fmt.Fprintf(&unicode, "%04X", u)
+			}
+			fmt.Fprintf(&b, "<%04X> <%s>\n", uint16(gid), unicode.String())
+		}
+		b.WriteString("endbfchar\n")
+	}
+
+	b.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return b.String()
+}
+
+func (d *Document) usedGlyphs() []sfnt.GlyphIndex {
+	gids := make([]sfnt.GlyphIndex, 0, len(d.used))
+	for gid := range d.used {
+		gids = append(gids, gid)
+	}
+	sort.Slice(gids, func(i, j int) bool { return gids[i] < gids[j] })
+	return gids
+}
+
+func compress(data []byte) []byte {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	zw.Write(data)
+	zw.Close()
+	return b.Bytes()
+}
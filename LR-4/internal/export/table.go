@@ -0,0 +1,134 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TableWriter построчно пишет табличный отчет без накопления в памяти
+type TableWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// NewTableWriter выбирает писатель по формату: csv или xlsx
+func NewTableWriter(format string, w io.Writer, sheetName string) (TableWriter, error) {
+	switch format {
+	case "csv":
+		return NewCSVWriter(w), nil
+	case "xlsx":
+		return NewXLSXWriter(w, sheetName)
+	default:
+		return nil, fmt.Errorf("unsupported export format: %q", format)
+	}
+}
+
+// ContentType возвращает MIME-тип для формата выгрузки
+func ContentType(format string) string {
+	switch format {
+	case "csv":
+		return "text/csv; charset=utf-8"
+	case "xlsx":
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// formatValue приводит значение ячейки к строке
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	case time.Time:
+		return v.Format("2006-01-02 15:04")
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.Format("2006-01-02 15:04")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// EscapeFormula защищает от CSV-инъекций: Excel выполняет ячейку, начинающуюся
+// с =, +, -, @, табуляции или перевода строки, как формулу. Апостроф делает ее текстом.
+// Значение, которое уже выглядит экранированным, получает еще один апостроф - см. UnescapeFormula.
+func EscapeFormula(value string) string {
+	if looksLikeFormula(value) {
+		return "'" + value
+	}
+	return value
+}
+
+// UnescapeFormula возвращает значение, записанное EscapeFormula, - для импорта своей же выгрузки
+func UnescapeFormula(value string) string {
+	if value != "" && value[0] == '\'' && looksLikeFormula(value[1:]) {
+		return value[1:]
+	}
+	return value
+}
+
+func looksLikeFormula(value string) bool {
+	if value == "" {
+		return false
+	}
+	if value[0] == '\'' {
+		return looksLikeFormula(value[1:])
+	}
+	return strings.ContainsRune("=+-@\t\r", rune(value[0]))
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// NewCSVWriter - CSV с BOM, чтобы Excel правильно открывал кириллицу
+func NewCSVWriter(w io.Writer) TableWriter {
+	io.WriteString(w, "\uFEFF")
+	writer := csv.NewWriter(w)
+	writer.Comma = ';'
+	return &csvWriter{w: writer}
+}
+
+func (c *csvWriter) WriteHeader(columns []string) error {
+	return c.w.Write(columns)
+}
+
+func (c *csvWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = formatValue(value)
+		// Текст приходит от пользователей (адрес, имя, причина отказа) - числа и даты не экранируются
+		if _, ok := value.(string); ok {
+			record[i] = EscapeFormula(record[i])
+		}
+	}
+	if err := c.w.Write(record); err != nil {
+		return err
+	}
+	// Отдаем данные клиенту по мере формирования
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
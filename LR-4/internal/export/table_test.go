@@ -0,0 +1,62 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestEscapeFormula(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"ул. Ленина, д. 5", "ул. Ленина, д. 5"},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+7 999 000-00-00", "'+7 999 000-00-00"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=1", "a=1"},
+		{"'уже текст", "'уже текст"},
+		{"'=1", "''=1"},
+		{"''@x", "'''@x"},
+		{"'", "'"},
+	}
+
+	for _, tt := range tests {
+		if got := EscapeFormula(tt.value); got != tt.want {
+			t.Errorf("EscapeFormula(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+		if got := UnescapeFormula(tt.want); got != tt.value {
+			t.Errorf("UnescapeFormula(%q) = %q, want %q", tt.want, got, tt.value)
+		}
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf)
+	if err := w.WriteHeader([]string{"ID", "Адрес", "Трафик", "Создана"}); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	if err := w.WriteRow([]interface{}{uint(1), "=cmd|' /C calc'!A0", -1.5, created}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow([]interface{}{uint(2), "г. Москва; ул. Мира", 0.0, (*time.Time)(nil)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "\uFEFFID;Адрес;Трафик;Создана\n" +
+		"1;'=cmd|' /C calc'!A0;-1.50;2024-03-01 09:30\n" +
+		"2;\"г. Москва; ул. Мира\";0.00;\n"
+	if got := buf.String(); got != want {
+		t.Errorf("CSV =\n%q\nwant\n%q", got, want)
+	}
+}
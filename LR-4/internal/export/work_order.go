@@ -0,0 +1,200 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WorkOrderLine - строка наряда: устройство, место установки и рассчитанный трафик
+type WorkOrderLine struct {
+	Name           string
+	Model          string
+	Room           string
+	PlacementNotes string
+	Config         map[string]string
+	Quantity       int
+	DataPerHour    float64
+	Traffic        float64
+}
+
+// WorkOrder - данные для печатного наряда на установку
+type WorkOrder struct {
+	ID            uint
+	Status        string
+	ClientName    string
+	Address       string
+	AddressNotes  string
+	CreatedAt     time.Time
+	FormedAt      *time.Time
+	CompletedAt   *time.Time
+	ModeratorName string
+	Lines         []WorkOrderLine
+	TotalTraffic  float64
+}
+
+var statusTitles = map[string]string{
+	"draft":     "Черновик",
+	"formed":    "Сформирована",
+	"completed": "Завершена",
+	"rejected":  "Отклонена",
+	"deleted":   "Удалена",
+}
+
+// StatusTitle - название статуса заявки для документов и отчетов
+func StatusTitle(status string) string {
+	if title, ok := statusTitles[status]; ok {
+		return title
+	}
+	return status
+}
+
+// lineDetails собирает примечание по размещению и настройки строки в одну строку текста
+func lineDetails(line WorkOrderLine) string {
+	var parts []string
+	if line.PlacementNotes != "" {
+		parts = append(parts, line.PlacementNotes)
+	}
+	keys := make([]string, 0, len(line.Config))
+	for key := range line.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts = append(parts, key+": "+line.Config[key])
+	}
+	return strings.Join(parts, "; ")
+}
+
+const (
+	marginLeft   = 50.0
+	marginRight  = 50.0
+	marginTop    = 60.0
+	marginBottom = 60.0
+)
+
+// Колонки таблицы устройств: заголовок, ширина, выравнивание по правому краю
+var workOrderColumns = []struct {
+	title string
+	width float64
+	right bool
+}{
+	{"№", 25, false},
+	{"Устройство", 120, false},
+	{"Модель", 95, false},
+	{"Помещение", 85, false},
+	{"Кол-во", 45, true},
+	{"Кб/ч за ед.", 60, true},
+	{"Трафик, Кб/ч", 65, true},
+}
+
+// WriteWorkOrderPDF формирует печатный наряд на установку
+func WriteWorkOrderPDF(w io.Writer, order WorkOrder) error {
+	doc, err := NewDocument()
+	if err != nil {
+		return err
+	}
+
+	y := PageHeight - marginTop
+	contentWidth := PageWidth - marginLeft - marginRight
+
+	// Переход на новую страницу, если не хватает места
+	ensureSpace := func(height float64) {
+		if y-height < marginBottom {
+			doc.AddPage()
+			y = PageHeight - marginTop
+		}
+	}
+
+	doc.Text(marginLeft, y, 18, fmt.Sprintf("Наряд на установку № %d", order.ID))
+	y -= 28
+
+	field := func(label, value string) {
+		if value == "" {
+			return
+		}
+		lines := doc.Wrap(value, 11, contentWidth-130)
+		ensureSpace(float64(len(lines)) * 15)
+		doc.Text(marginLeft, y, 11, label)
+		for _, line := range lines {
+			doc.Text(marginLeft+130, y, 11, line)
+			y -= 15
+		}
+	}
+
+	field("Статус:", StatusTitle(order.Status))
+	field("Клиент:", order.ClientName)
+	field("Адрес установки:", order.Address)
+	field("Примечание:", order.AddressNotes)
+	field("Создана:", formatValue(order.CreatedAt))
+	field("Сформирована:", formatValue(order.FormedAt))
+	field("Завершена:", formatValue(order.CompletedAt))
+	field("Модератор:", order.ModeratorName)
+	y -= 10
+
+	// Таблица устройств; details - примечание и настройки мелким шрифтом под строкой
+	drawRow := func(values []string, size float64, details string) {
+		detailLines := doc.Wrap(details, 8, contentWidth-30)
+		ensureSpace(18 + float64(len(detailLines))*11)
+		x := marginLeft
+		for i, col := range workOrderColumns {
+			text := values[i]
+			for text != "" && doc.TextWidth(text, size) > col.width-6 {
+				runes := []rune(text)
+				text = string(runes[:len(runes)-1])
+			}
+			if col.right {
+				doc.Text(x+col.width-3-doc.TextWidth(text, size), y, size, text)
+			} else {
+				doc.Text(x+3, y, size, text)
+			}
+			x += col.width
+		}
+		for _, text := range detailLines {
+			y -= 11
+			doc.Text(marginLeft+28, y, 8, text)
+		}
+		doc.Line(marginLeft, y-5, PageWidth-marginRight, y-5)
+		y -= 18
+	}
+
+	header := make([]string, len(workOrderColumns))
+	for i, col := range workOrderColumns {
+		header[i] = col.title
+	}
+	ensureSpace(40)
+	doc.Line(marginLeft, y+13, PageWidth-marginRight, y+13)
+	drawRow(header, 10, "")
+
+	totalQuantity := 0
+	for i, line := range order.Lines {
+		totalQuantity += line.Quantity
+		drawRow([]string{
+			strconv.Itoa(i + 1),
+			line.Name,
+			line.Model,
+			line.Room,
+			strconv.Itoa(line.Quantity),
+			formatValue(line.DataPerHour),
+			formatValue(line.Traffic),
+		}, 10, lineDetails(line))
+	}
+
+	y -= 6
+	ensureSpace(40)
+	doc.Text(marginLeft, y, 11, fmt.Sprintf("Всего устройств: %d", totalQuantity))
+	y -= 16
+	doc.Text(marginLeft, y, 11, fmt.Sprintf("Общий трафик: %s Кб/ч", formatValue(order.TotalTraffic)))
+	y -= 50
+
+	// Подписи
+	ensureSpace(40)
+	doc.Text(marginLeft, y, 11, "Монтажник: ____________________")
+	doc.Text(marginLeft+contentWidth/2, y, 11, "Клиент: ____________________")
+
+	_, err = doc.WriteTo(w)
+	return err
+}
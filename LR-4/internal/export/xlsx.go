@@ -0,0 +1,143 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+)
+
+// xlsxWriter пишет минимальную книгу Office Open XML с одним листом.
+// Строки листа записываются в zip-поток сразу, без буферизации всего файла.
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet io.Writer
+	row   int
+}
+
+func NewXLSXWriter(w io.Writer, sheetName string) (TableWriter, error) {
+	z := zip.NewWriter(w)
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, escapeXML(sheetName))},
+	}
+	for _, f := range files {
+		fw, err := z.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return nil, err
+	}
+
+	return &xlsxWriter{zip: z, sheet: sheet}, nil
+}
+
+func (x *xlsxWriter) WriteHeader(columns []string) error {
+	values := make([]interface{}, len(columns))
+	for i, c := range columns {
+		values[i] = c
+	}
+	return x.WriteRow(values)
+}
+
+func (x *xlsxWriter) WriteRow(values []interface{}) error {
+	x.row++
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, x.row)
+	for i, value := range values {
+		ref := fmt.Sprintf("%s%d", columnName(i), x.row)
+		switch v := value.(type) {
+		case int, int64, uint, float64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, numberValue(v))
+		case nil:
+			// пустая ячейка
+		case *time.Time:
+			if v != nil {
+				fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, escapeXML(formatValue(v)))
+			}
+		default:
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, escapeXML(formatValue(v)))
+		}
+	}
+	b.WriteString(`</row>`)
+
+	_, err := io.WriteString(x.sheet, b.String())
+	return err
+}
+
+func (x *xlsxWriter) Close() error {
+	if _, err := io.WriteString(x.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return x.zip.Close()
+}
+
+// numberValue - число без округления до двух знаков, как ожидает Excel
+func numberValue(value interface{}) string {
+	if f, ok := value.(float64); ok {
+		return fmt.Sprintf("%g", f)
+	}
+	return formatValue(value)
+}
+
+// columnName переводит индекс колонки в буквенное имя: 0 -> A, 26 -> AA
+func columnName(i int) string {
+	name := ""
+	for i >= 0 {
+		name = string(rune('A'+i%26)) + name
+		i = i/26 - 1
+	}
+	return name
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
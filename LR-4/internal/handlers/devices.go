@@ -1,26 +1,46 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
+	"smartdevices/internal/catalog"
+	"smartdevices/internal/events"
+	"smartdevices/internal/inventory"
 	"smartdevices/internal/models"
+	"smartdevices/internal/search"
 
 	"gorm.io/gorm"
 )
 
 var (
 	db                    *gorm.DB
+	broker                *events.Broker
 	tmplSmartDevices      = template.Must(template.ParseFiles("templates/layout.html", "templates/smart_devices.html"))
 	tmplSmartDeviceDetail = template.Must(template.ParseFiles("templates/layout.html", "templates/smart_device_detail.html"))
 	tmplSmartCart         = template.Must(template.ParseFiles("templates/layout.html", "templates/smart_cart.html"))
 	tmpl404               = template.Must(template.ParseFiles("templates/404.html"))
 )
 
-func Init(database *gorm.DB) {
+func Init(database *gorm.DB, eventBroker *events.Broker) {
 	db = database
+	broker = eventBroker
+}
+
+// Количество устройств в черновике для события cart.updated
+func publishSmartCart(clientID uint, orderID uint) {
+	cart := events.Cart{OrderID: orderID}
+	db.Model(&models.OrderItem{}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Where("order_id = ?", orderID).
+		Scan(&cart.Count)
+	broker.PublishToUser(clientID, events.TypeCartUpdated, cart)
 }
 
 // Вспомогательная функция для получения количества товаров
@@ -78,7 +98,7 @@ func RequestByIDHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db.Preload("Device").Where("order_id = ?", order.ID).Find(&items)
+	db.Preload("Device").Where("order_id = ?", order.ID).Order("id").Find(&items)
 
 	order.TotalTraffic = calculateTotalTraffic(order.ID)
 
@@ -95,28 +115,55 @@ func RequestByIDHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// GET /smart-devices - поиск устройств через GORM
+// Фрагменты поиска для шаблона; текст уже экранирован в search.Highlights
+type deviceHighlight struct {
+	Name        template.HTML
+	Description template.HTML
+}
+
+// GET /smart-devices - полнотекстовый поиск устройств, самые релевантные первыми
 func SmartDevicesHandler(w http.ResponseWriter, r *http.Request) {
-	search := r.URL.Query().Get("search")
+	searchText := r.URL.Query().Get("search")
 
 	var devices []models.SmartDevice
-	query := db.Where("is_active = ?", true)
+	query := db.Model(&models.SmartDevice{}).Where("is_active = ?", true)
 
-	if search != "" {
-		query = query.Where("name ILIKE ?", "%"+search+"%")
+	searchQuery, searching := search.Parse(searchText)
+	if searching {
+		query = searchQuery.Apply(query).Order(search.RankOrder)
 	}
 
-	result := query.Find(&devices)
+	result := query.Order("id").Find(&devices)
 	if result.Error != nil {
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	highlights := map[uint]*deviceHighlight{}
+	if searching {
+		ids := make([]uint, len(devices))
+		for i, device := range devices {
+			ids[i] = device.ID
+		}
+		found, err := searchQuery.Highlights(db, ids)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for id, highlight := range found {
+			highlights[id] = &deviceHighlight{
+				Name:        template.HTML(highlight.Name),
+				Description: template.HTML(highlight.Description),
+			}
+		}
+	}
+
 	err := tmplSmartDevices.ExecuteTemplate(w, "layout.html", map[string]interface{}{
-		"Devices":   devices,
-		"Search":    search,
-		"ShowCart":  true,
-		"CartCount": getSmartCartCount(1),
+		"Devices":    devices,
+		"Highlights": highlights,
+		"Search":     searchText,
+		"ShowCart":   true,
+		"CartCount":  getSmartCartCount(1),
 	})
 
 	if err != nil {
@@ -134,16 +181,25 @@ func SmartDeviceDetailHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var device models.SmartDevice
-	result := db.First(&device, id)
+	result := db.Preload("Category").
+		Preload("Images", func(tx *gorm.DB) *gorm.DB { return tx.Order("sort_order, id") }).
+		First(&device, id)
 	if result.Error != nil {
 		http.NotFound(w, r)
 		return
 	}
 
+	specs, err := deviceSpecRows(device)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	log.Printf("📱 Device Detail - ID: %d, Name: %s, NamespaceURL: %s", device.ID, device.Name, device.NamespaceURL)
 
 	err = tmplSmartDeviceDetail.ExecuteTemplate(w, "layout.html", map[string]interface{}{
 		"Device":    device,
+		"Specs":     specs,
 		"ShowCart":  false,
 		"CartCount": getSmartCartCount(1),
 	})
@@ -154,6 +210,43 @@ func SmartDeviceDetailHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Строка характеристики на странице устройства
+type specRow struct {
+	Label string
+	Value string
+}
+
+// deviceSpecRows - заполненные характеристики в порядке схемы категории
+func deviceSpecRows(device models.SmartDevice) ([]specRow, error) {
+	schema, err := catalog.EffectiveSchema(db, device.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []specRow{}
+	for _, def := range schema {
+		value, ok := device.Specs[def.Key]
+		if !ok {
+			continue
+		}
+		text := fmt.Sprint(value)
+		switch v := value.(type) {
+		case bool:
+			text = "Нет"
+			if v {
+				text = "Да"
+			}
+		case float64:
+			text = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		if def.Unit != "" {
+			text += " " + def.Unit
+		}
+		rows = append(rows, specRow{Label: def.Label, Value: text})
+	}
+	return rows, nil
+}
+
 // GET /smart-cart - просмотр корзины
 func SmartCartHandler(w http.ResponseWriter, r *http.Request) {
 	var order models.SmartOrder
@@ -166,7 +259,7 @@ func SmartCartHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db.Preload("Device").Where("order_id = ?", order.ID).Find(&items)
+	db.Preload("Device").Where("order_id = ?", order.ID).Order("id").Find(&items)
 
 	order.TotalTraffic = calculateTotalTraffic(order.ID)
 
@@ -219,11 +312,12 @@ func AddToSmartCartHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var existingOrderItem models.OrderItem
-	findResult := db.Where("order_id = ? AND device_id = ?", order.ID, dID).First(&existingOrderItem)
+	// Если устройство разбито по помещениям - увеличиваем первую строку
+	findResult := db.Where("order_id = ? AND device_id = ?", order.ID, dID).Order("id").First(&existingOrderItem)
 
 	if findResult.Error == nil {
 		existingOrderItem.Quantity++
-		db.Save(&existingOrderItem)
+		db.Model(&existingOrderItem).Update("quantity", existingOrderItem.Quantity)
 		log.Printf("➕ Увеличено количество устройства %d в корзине %d: %d шт.", dID, order.ID, existingOrderItem.Quantity)
 	} else {
 		orderItem := models.OrderItem{
@@ -235,8 +329,14 @@ func AddToSmartCartHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("🆕 Добавлено устройство %d в корзину %d", dID, order.ID)
 	}
 
+	// Состав заявки изменился - увеличиваем версию для ETag и отметку изменения
+	db.Model(&models.SmartOrder{}).
+		Where("id = ?", order.ID).
+		Update("version", gorm.Expr("version + 1"))
+
 	totalTraffic := calculateTotalTraffic(order.ID)
 	log.Printf("📊 Общий трафик корзины %d: %.2f Кб/ч", order.ID, totalTraffic)
+	publishSmartCart(order.ClientID, order.ID)
 
 	http.Redirect(w, r, "/smart-cart", http.StatusSeeOther)
 }
@@ -254,19 +354,55 @@ func DeleteSmartCartHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sqlDB, err := db.DB()
+	id, err := strconv.Atoi(orderID)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
 		return
 	}
 
-	_, err = sqlDB.Exec("UPDATE smart_orders SET status = 'deleted' WHERE id = $1", orderID)
+	// Смена статуса, снятие резерва и запись в историю - одной транзакцией.
+	// Склад меняется тем же переходом, что и в API заявок.
+	var fromStatus string
+	var clientID uint
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Raw("SELECT status, client_id FROM smart_orders WHERE id = ? FOR UPDATE", id).
+			Row().Scan(&fromStatus, &clientID)
+		if err != nil || fromStatus == "deleted" {
+			return err
+		}
+		err = tx.Exec("UPDATE smart_orders SET status = 'deleted', version = version + 1, updated_at = NOW() WHERE id = ?", id).Error
+		if err != nil {
+			return err
+		}
+		if err := inventory.ApplyTransition(tx, uint(id), fromStatus, "deleted"); err != nil {
+			return err
+		}
+		return tx.Exec(`
+            INSERT INTO order_status_histories (order_id, from_status, to_status, comment, created_at)
+            VALUES (?, ?, 'deleted', 'Удалено из HTML-корзины', NOW())
+        `, id, fromStatus).Error
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		Show404Page(w, "Заявка не найдена")
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error deleting order: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("🗑️ Deleted cart: id=%s", orderID)
+	log.Printf("🗑️ Deleted cart: id=%d", id)
+	if fromStatus != "deleted" {
+		broker.PublishToUser(clientID, events.TypeOrderStatus, events.OrderStatus{
+			OrderID:    uint(id),
+			FromStatus: fromStatus,
+			Status:     "deleted",
+			ChangedAt:  time.Now(),
+		})
+		if fromStatus == "draft" {
+			broker.PublishToUser(clientID, events.TypeCartUpdated, events.Cart{})
+		}
+	}
 	http.Redirect(w, r, "/smart-devices", http.StatusSeeOther)
 }
 
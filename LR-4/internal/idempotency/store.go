@@ -0,0 +1,94 @@
+package idempotency
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/net/context"
+)
+
+// ErrInProgress - запрос с этим ключом еще выполняется
+var ErrInProgress = errors.New("request with this idempotency key is in progress")
+
+// Срок резерва ключа на время выполнения первого запроса. Если процесс упал до Complete/Release,
+// ключ освобождается через lease, а не держит клиента в 409 на все окно ttl.
+const lease = 2 * time.Minute
+
+// Record - сохраненный результат первого выполнения запроса
+type Record struct {
+	Fingerprint string      `json:"fingerprint"`
+	Completed   bool        `json:"completed"`
+	StatusCode  int         `json:"status_code,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+type Store struct {
+	client *redis.Client
+	ctx    context.Context
+	ttl    time.Duration
+}
+
+// NewStore создает хранилище ключей идемпотентности на общем клиенте Redis.
+// ttl - окно, в течение которого повтор запроса получает сохраненный ответ.
+func NewStore(client *redis.Client, ttl time.Duration) *Store {
+	return &Store{
+		client: client,
+		ctx:    context.Background(),
+		ttl:    ttl,
+	}
+}
+
+func redisKey(clientID uint, key string) string {
+	return fmt.Sprintf("idempotency:%d:%s", clientID, key)
+}
+
+// Begin резервирует ключ. Если ключ уже использован, возвращает сохраненную запись.
+// Пока первый запрос выполняется, повторы получают ErrInProgress.
+func (s *Store) Begin(clientID uint, key, fingerprint string) (*Record, error) {
+	placeholder, err := json.Marshal(Record{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.client.SetNX(s.ctx, redisKey(clientID, key), placeholder, min(lease, s.ttl)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return nil, nil
+	}
+
+	data, err := s.client.Get(s.ctx, redisKey(clientID, key)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var record Record
+	if err := json.Unmarshal([]byte(data), &record); err != nil {
+		return nil, err
+	}
+	if record.Fingerprint == fingerprint && !record.Completed {
+		return &record, ErrInProgress
+	}
+	return &record, nil
+}
+
+// Complete сохраняет ответ первого выполнения на полное окно ttl
+func (s *Store) Complete(clientID uint, key string, record Record) error {
+	record.Completed = true
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(s.ctx, redisKey(clientID, key), data, s.ttl).Err()
+}
+
+// Release освобождает ключ, чтобы запрос можно было повторить (например, после 5xx)
+func (s *Store) Release(clientID uint, key string) error {
+	return s.client.Del(s.ctx, redisKey(clientID, key)).Err()
+}
@@ -0,0 +1,177 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Ограничения на загружаемые изображения
+const (
+	MaxFileSize  = 10 << 20 // 10 MB
+	MinDimension = 50
+	MaxDimension = 6000
+	MaxPixels    = 24_000_000 // ~100 MB в памяти после декодирования
+)
+
+// Размеры уменьшенных копий (вписываются в квадрат, пропорции сохраняются)
+const (
+	ThumbnailSize = 200
+	MediumSize    = 800
+)
+
+// Разрешенные типы: определяются по сигнатуре файла, а не по расширению
+var allowedTypes = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpeg",
+	"image/webp": "webp",
+}
+
+var extensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+}
+
+var (
+	ErrTooLarge        = fmt.Errorf("image must be at most %d MB", MaxFileSize>>20)
+	ErrUnsupportedType = errors.New("unsupported image type, allowed: PNG, JPEG, WebP")
+	ErrInvalidImage    = errors.New("file is not a valid image")
+	ErrDimensions      = fmt.Errorf("image must be from %dx%d to %dx%d pixels and at most %d megapixels",
+		MinDimension, MinDimension, MaxDimension, MaxDimension, MaxPixels/1_000_000)
+)
+
+// AllowedType - можно ли загрузить файл с таким типом
+func AllowedType(contentType string) bool {
+	_, ok := allowedTypes[contentType]
+	return ok
+}
+
+// File - готовый к сохранению файл
+type File struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Ext - расширение файла по типу содержимого
+func (f File) Ext() string {
+	return extensions[f.ContentType]
+}
+
+// Result - оригинал без метаданных и уменьшенные копии
+type Result struct {
+	Original  File
+	Medium    File
+	Thumbnail File
+}
+
+// Process проверяет изображение, удаляет EXIF и прочие метаданные и готовит уменьшенные копии.
+// Оригинал сохраняется без перекодирования; если EXIF требовал поворота, он поворачивается и перекодируется.
+func Process(data []byte) (*Result, error) {
+	if len(data) > MaxFileSize {
+		return nil, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	format, ok := allowedTypes[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w (got %s)", ErrUnsupportedType, contentType)
+	}
+
+	// Размеры проверяются по заголовку, до декодирования всего файла
+	config, decodedFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decodedFormat != format {
+		return nil, ErrInvalidImage
+	}
+	if config.Width < MinDimension || config.Height < MinDimension ||
+		config.Width > MaxDimension || config.Height > MaxDimension ||
+		config.Width*config.Height > MaxPixels {
+		return nil, fmt.Errorf("%w, got %dx%d", ErrDimensions, config.Width, config.Height)
+	}
+
+	cleaned, exif, err := stripMetadata(format, data)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(cleaned))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	result := &Result{}
+	if orientation := exifOrientation(exif); orientation > 1 {
+		img = orient(img, orientation)
+		if result.Original, err = encode(img); err != nil {
+			return nil, err
+		}
+	} else {
+		bounds := img.Bounds()
+		result.Original = File{Data: cleaned, ContentType: contentType, Width: bounds.Dx(), Height: bounds.Dy()}
+	}
+
+	// Миниатюра строится из средней копии - так быстрее, чем из большого оригинала
+	medium := resize(img, MediumSize)
+	if result.Medium, err = encode(medium); err != nil {
+		return nil, err
+	}
+	if result.Thumbnail, err = encode(resize(medium, ThumbnailSize)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// resize вписывает изображение в квадрат size x size; меньшие изображения не увеличиваются
+func resize(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/width)
+		} else {
+			width, height = max(1, width*size/height), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if width == bounds.Dx() && height == bounds.Dy() {
+		draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+	} else {
+		xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, xdraw.Src, nil)
+	}
+	return dst
+}
+
+// encode - JPEG для непрозрачных изображений, PNG для изображений с прозрачностью
+func encode(img image.Image) (File, error) {
+	var buf bytes.Buffer
+	contentType := "image/jpeg"
+	var err error
+	if isOpaque(img) {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	} else {
+		contentType = "image/png"
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return File{}, fmt.Errorf("failed to encode image: %v", err)
+	}
+	bounds := img.Bounds()
+	return File{Data: buf.Bytes(), ContentType: contentType, Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
@@ -0,0 +1,372 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testImage - градиент с разным цветом по углам; opaque=false - полупрозрачный
+func testImage(width, height int, opaque bool) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	alpha := uint8(255)
+	if !opaque {
+		alpha = 128
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: 100, A: alpha})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngChunk - чанк PNG с правильной CRC: декодер ее проверяет
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// pngHeader - PNG только с заголовком IHDR: размеры проверяются до декодирования пикселей
+func pngHeader(width, height int) []byte {
+	ihdr := binary.BigEndian.AppendUint32(nil, uint32(width))
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(height))
+	ihdr = append(ihdr, 8, 2, 0, 0, 0) // 8 бит, RGB
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = append(data, pngChunk("IHDR", ihdr)...)
+	return append(data, pngChunk("IEND", nil)...)
+}
+
+// insertBeforeIEND добавляет чанки перед последним чанком IEND
+func insertBeforeIEND(data []byte, chunks ...[]byte) []byte {
+	end := len(data) - 12
+	out := append([]byte(nil), data[:end]...)
+	for _, chunk := range chunks {
+		out = append(out, chunk...)
+	}
+	return append(out, data[end:]...)
+}
+
+// jpegSegment - сегмент JPEG с маркером и длиной
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// insertAfterSOI добавляет сегменты сразу после начала файла JPEG
+func insertAfterSOI(data []byte, segments ...[]byte) []byte {
+	out := append([]byte(nil), data[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, data[2:]...)
+}
+
+// exifTIFF - блок EXIF (TIFF) с единственным тегом Orientation
+func exifTIFF(order binary.AppendByteOrder, orientation uint16) []byte {
+	var tiff []byte
+	if order == binary.LittleEndian {
+		tiff = []byte("II*\x00")
+	} else {
+		tiff = []byte("MM\x00*")
+	}
+	tiff = order.AppendUint32(tiff, 8)
+	tiff = order.AppendUint16(tiff, 1)
+	tiff = order.AppendUint16(tiff, 0x0112)
+	tiff = order.AppendUint16(tiff, 3) // SHORT
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint16(tiff, orientation)
+	tiff = order.AppendUint16(tiff, 0)
+	return order.AppendUint32(tiff, 0)
+}
+
+func TestProcessRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"too large", make([]byte, MaxFileSize+1), ErrTooLarge},
+		{"text", []byte("just some text, not an image"), ErrUnsupportedType},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"), ErrUnsupportedType},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), ErrUnsupportedType},
+		{"html disguised by extension", []byte("<html><body>image.png</body></html>"), ErrUnsupportedType},
+		{"png signature with garbage", []byte("\x89PNG\r\n\x1a\ngarbage garbage"), ErrInvalidImage},
+		{"jpeg signature with garbage", []byte("\xFF\xD8\xFF\xE0garbage"), ErrInvalidImage},
+		{"too small", pngHeader(MinDimension-1, 100), ErrDimensions},
+		{"too narrow", pngHeader(100, MinDimension-1), ErrDimensions},
+		{"too wide", pngHeader(MaxDimension+1, 100), ErrDimensions},
+		{"too many pixels", pngHeader(5000, 5000), ErrDimensions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Process(tt.data)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Process() = %v, %v, want %v", result, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessSizes(t *testing.T) {
+	tests := []struct {
+		name              string
+		width, height     int
+		opaque            bool
+		medium, thumbnail [2]int
+		copyType          string
+	}{
+		{"small is not enlarged", 100, 50, true, [2]int{100, 50}, [2]int{100, 50}, "image/jpeg"},
+		{"landscape", 1000, 500, true, [2]int{800, 400}, [2]int{200, 100}, "image/jpeg"},
+		{"portrait", 300, 1200, true, [2]int{200, 800}, [2]int{50, 200}, "image/jpeg"},
+		{"transparent keeps alpha", 400, 400, false, [2]int{400, 400}, [2]int{200, 200}, "image/png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encodePNG(t, testImage(tt.width, tt.height, tt.opaque))
+			result, err := Process(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Без метаданных оригинал сохраняется как есть
+			if !bytes.Equal(result.Original.Data, data) || result.Original.ContentType != "image/png" || result.Original.Ext() != ".png" {
+				t.Errorf("original was re-encoded: %s, %d bytes", result.Original.ContentType, len(result.Original.Data))
+			}
+			for _, copy := range []struct {
+				name string
+				file File
+				size [2]int
+			}{{"medium", result.Medium, tt.medium}, {"thumbnail", result.Thumbnail, tt.thumbnail}} {
+				if copy.file.Width != copy.size[0] || copy.file.Height != copy.size[1] || copy.file.ContentType != tt.copyType {
+					t.Errorf("%s = %dx%d %s, want %dx%d %s", copy.name, copy.file.Width, copy.file.Height,
+						copy.file.ContentType, copy.size[0], copy.size[1], tt.copyType)
+				}
+				config, format, err := image.DecodeConfig(bytes.NewReader(copy.file.Data))
+				if err != nil || "image/"+format != copy.file.ContentType || config.Width != copy.size[0] {
+					t.Errorf("%s does not decode as %s: %v", copy.name, copy.file.ContentType, err)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessStripsPNGMetadata(t *testing.T) {
+	data := insertBeforeIEND(encodePNG(t, testImage(60, 60, true)),
+		pngChunk("tEXt", []byte("Author\x00secret author")),
+		pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta>secret</x:xmpmeta>")),
+		pngChunk("tIME", []byte{0x07, 0xE8, 1, 1, 0, 0, 0}),
+		pngChunk("eXIf", exifTIFF(binary.BigEndian, 1)))
+
+	result, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, marker := range []string{"tEXt", "iTXt", "tIME", "eXIf", "secret"} {
+		if bytes.Contains(result.Original.Data, []byte(marker)) {
+			t.Errorf("original still contains %q", marker)
+		}
+	}
+	if _, err := png.Decode(bytes.NewReader(result.Original.Data)); err != nil {
+		t.Errorf("cleaned PNG does not decode: %v", err)
+	}
+}
+
+func TestProcessJPEGExif(t *testing.T) {
+	source := encodeJPEG(t, testImage(120, 60, true))
+	comment := jpegSegment(0xFE, []byte("secret comment"))
+	iptc := jpegSegment(0xED, []byte("Photoshop 3.0\x00secret iptc"))
+	exif := func(orientation uint16) []byte {
+		return jpegSegment(0xE1, append([]byte("Exif\x00\x00"), exifTIFF(binary.LittleEndian, orientation)...))
+	}
+
+	tests := []struct {
+		name          string
+		data          []byte
+		width, height int
+		reencoded     bool
+	}{
+		{"no metadata", source, 120, 60, false},
+		{"comment and iptc", insertAfterSOI(source, comment, iptc), 120, 60, false},
+		{"orientation 1", insertAfterSOI(source, exif(1)), 120, 60, false},
+		{"rotated 180", insertAfterSOI(source, exif(3)), 120, 60, true},
+		{"rotated 90 clockwise", insertAfterSOI(source, exif(6), comment), 60, 120, true},
+		{"rotated 90 counterclockwise", insertAfterSOI(source, exif(8)), 60, 120, true},
+		{"invalid orientation", insertAfterSOI(source, exif(9)), 120, 60, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Process(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			original := result.Original
+			if original.Width != tt.width || original.Height != tt.height {
+				t.Errorf("original = %dx%d, want %dx%d", original.Width, original.Height, tt.width, tt.height)
+			}
+			if result.Medium.Width != tt.width || result.Medium.Height != tt.height {
+				t.Errorf("medium = %dx%d, want %dx%d", result.Medium.Width, result.Medium.Height, tt.width, tt.height)
+			}
+			if !tt.reencoded && !bytes.Equal(original.Data, source) {
+				t.Error("original differs from the source without metadata")
+			}
+			for _, marker := range []string{"Exif", "secret"} {
+				if bytes.Contains(original.Data, []byte(marker)) {
+					t.Errorf("original still contains %q", marker)
+				}
+			}
+			config, err := jpeg.DecodeConfig(bytes.NewReader(original.Data))
+			if err != nil || config.Width != tt.width {
+				t.Errorf("original does not decode as %dx%d JPEG: %v", tt.width, tt.height, err)
+			}
+		})
+	}
+}
+
+func TestProcessBrokenJPEGSegment(t *testing.T) {
+	source := encodeJPEG(t, testImage(60, 60, true))
+	// Длина сегмента больше файла
+	broken := insertAfterSOI(source, []byte{0xFF, 0xE1, 0xFF, 0xFF})
+	if _, err := Process(broken); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("Process() error = %v, want ErrInvalidImage", err)
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	tests := []struct {
+		name string
+		tiff []byte
+		want int
+	}{
+		{"little endian", exifTIFF(binary.LittleEndian, 6), 6},
+		{"big endian", exifTIFF(binary.BigEndian, 8), 8},
+		{"out of range", exifTIFF(binary.LittleEndian, 0), 1},
+		{"empty", nil, 1},
+		{"not tiff", []byte("JUNKJUNKJUNK"), 1},
+		{"truncated entry", exifTIFF(binary.LittleEndian, 6)[:16], 1},
+		{"offset outside", append([]byte("II*\x00"), 0xFF, 0xFF, 0, 0), 1},
+	}
+
+	for _, tt := range tests {
+		if got := exifOrientation(tt.tiff); got != tt.want {
+			t.Errorf("%s: exifOrientation() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// 3x2: красный угол (0,0) должен оказаться там, где его показал бы просмотрщик
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	red := color.RGBA{R: 255, A: 255}
+	src.Set(0, 0, red)
+
+	tests := []struct {
+		orientation   int
+		width, height int
+		x, y          int
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 1, 0},
+		{7, 2, 3, 1, 2},
+		{8, 2, 3, 0, 2},
+	}
+
+	for _, tt := range tests {
+		dst := orient(src, tt.orientation)
+		bounds := dst.Bounds()
+		if bounds.Dx() != tt.width || bounds.Dy() != tt.height {
+			t.Errorf("orientation %d: size = %dx%d, want %dx%d", tt.orientation, bounds.Dx(), bounds.Dy(), tt.width, tt.height)
+			continue
+		}
+		if got := color.RGBAModel.Convert(dst.At(tt.x, tt.y)); got != red {
+			t.Errorf("orientation %d: pixel (%d,%d) = %v, want red", tt.orientation, tt.x, tt.y, got)
+		}
+	}
+}
+
+func TestStripWebP(t *testing.T) {
+	chunk := func(chunkType string, data []byte) []byte {
+		out := append([]byte(chunkType), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+		out = append(out, data...)
+		if len(data)%2 == 1 {
+			out = append(out, 0)
+		}
+		return out
+	}
+	tiff := exifTIFF(binary.LittleEndian, 3)
+	body := []byte("WEBP")
+	body = append(body, chunk("VP8X", []byte{0x08 | 0x04 | 0x10, 0, 0, 0, 49, 0, 0, 49, 0, 0})...)
+	body = append(body, chunk("VP8L", []byte("odd"))...)
+	body = append(body, chunk("EXIF", append([]byte("Exif\x00\x00"), tiff...))...)
+	body = append(body, chunk("XMP ", []byte("<x:xmpmeta>secret</x:xmpmeta>"))...)
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	data = append(data, body...)
+
+	out, exif, err := stripWebP(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(exif, tiff) {
+		t.Errorf("exif = %x, want %x", exif, tiff)
+	}
+	if bytes.Contains(out, []byte("EXIF")) || bytes.Contains(out, []byte("secret")) {
+		t.Error("metadata chunks are not removed")
+	}
+	if flags := out[20]; flags != 0x10 {
+		t.Errorf("VP8X flags = %#x, want only alpha (0x10)", flags)
+	}
+	if size := binary.LittleEndian.Uint32(out[4:]); int(size) != len(out)-8 {
+		t.Errorf("RIFF size = %d, want %d", size, len(out)-8)
+	}
+	if !bytes.Contains(out, chunk("VP8L", []byte("odd"))) {
+		t.Error("image data chunk is lost")
+	}
+
+	if _, _, err := stripWebP(data[:len(data)-3]); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("truncated WebP: error = %v, want ErrInvalidImage", err)
+	}
+}
+
+func TestAllowedType(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"image/png": true, "image/jpeg": true, "image/webp": true,
+		"image/gif": false, "image/svg+xml": false, "": false,
+	} {
+		if got := AllowedType(contentType); got != want {
+			t.Errorf("AllowedType(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// stripMetadata удаляет из файла EXIF, XMP, IPTC и текстовые комментарии без перекодирования.
+// Возвращает очищенный файл и EXIF-блок (TIFF), если он был, - из него берется ориентация.
+func stripMetadata(format string, data []byte) ([]byte, []byte, error) {
+	switch format {
+	case "jpeg":
+		return stripJPEG(data)
+	case "png":
+		return stripPNG(data)
+	case "webp":
+		return stripWebP(data)
+	}
+	return nil, nil, ErrUnsupportedType
+}
+
+// stripJPEG выбрасывает сегменты APP1 (EXIF, XMP), APP13 (IPTC) и COM до начала данных (SOS).
+// JFIF и ICC-профиль остаются - без профиля искажаются цвета.
+func stripJPEG(data []byte) ([]byte, []byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, nil, ErrInvalidImage
+	}
+	out := append(make([]byte, 0, len(data)), data[:2]...)
+	var exif []byte
+
+	for i := 2; i < len(data); {
+		if data[i] != 0xFF {
+			return nil, nil, ErrInvalidImage
+		}
+		// Перед маркером может быть произвольное количество 0xFF
+		for i < len(data) && data[i] == 0xFF {
+			i++
+		}
+		if i >= len(data) {
+			return nil, nil, ErrInvalidImage
+		}
+		start, marker := i-1, data[i]
+		i++
+
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out = append(out, 0xFF, marker)
+			continue
+		}
+		if marker == 0xD9 || marker == 0xDA {
+			// Конец файла или начало сжатых данных - дальше метаданных нет
+			return append(out, data[start:]...), exif, nil
+		}
+		if i+2 > len(data) {
+			return nil, nil, ErrInvalidImage
+		}
+		end := i + int(binary.BigEndian.Uint16(data[i:]))
+		if end > len(data) || end < i+2 {
+			return nil, nil, ErrInvalidImage
+		}
+		payload := data[i+2 : end]
+		i = end
+
+		switch marker {
+		case 0xE1:
+			if tiff, ok := bytes.CutPrefix(payload, []byte("Exif\x00\x00")); ok && exif == nil {
+				exif = tiff
+			}
+		case 0xED, 0xFE:
+		default:
+			out = append(out, 0xFF, marker)
+			out = append(out, data[start+2:end]...)
+		}
+	}
+	return nil, nil, ErrInvalidImage
+}
+
+// PNG-чанки с метаданными: EXIF, текст (в т.ч. XMP в iTXt) и время изменения
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+func stripPNG(data []byte) ([]byte, []byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, nil, ErrInvalidImage
+	}
+	out := append(make([]byte, 0, len(data)), signature...)
+	var exif []byte
+
+	for i := len(signature); i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		chunkType := string(data[i+4 : i+8])
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, nil, ErrInvalidImage
+		}
+		switch {
+		case chunkType == "eXIf":
+			exif = data[i+8 : i+8+length]
+		case pngMetadataChunks[chunkType]:
+		default:
+			out = append(out, data[i:end]...)
+		}
+		if chunkType == "IEND" {
+			return out, exif, nil
+		}
+		i = end
+	}
+	return nil, nil, ErrInvalidImage
+}
+
+// stripWebP удаляет чанки EXIF и XMP и снимает соответствующие флаги в заголовке VP8X
+func stripWebP(data []byte) ([]byte, []byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, nil, ErrInvalidImage
+	}
+	out := append(make([]byte, 0, len(data)), data[:12]...)
+	var exif []byte
+
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, nil, ErrInvalidImage
+		}
+		chunkType := string(data[i : i+4])
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + length + length%2 // чанки выравниваются по двум байтам
+		if length < 0 || end > len(data) {
+			return nil, nil, ErrInvalidImage
+		}
+		switch chunkType {
+		case "EXIF":
+			// Некоторые редакторы пишут EXIF с JPEG-префиксом
+			exif, _ = bytes.CutPrefix(data[i+8:i+8+length], []byte("Exif\x00\x00"))
+		case "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if length > 0 {
+				chunk[8] &^= 0x08 | 0x04 // флаги EXIF и XMP
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, exif, nil
+}
+
+// exifOrientation читает тег Orientation (0x0112) из IFD0. 1 - поворот не нужен.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if value := int(order.Uint16(tiff[entry+8:])); value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient поворачивает и отражает изображение так, как его показал бы просмотрщик с учетом EXIF
+func orient(src image.Image, orientation int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = width-1-x, y
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dx, dy = x, height-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			default:
+				dx, dy = x, y
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], rgba.Pix[rgba.PixOffset(x, y):][:4])
+		}
+	}
+	return dst
+}
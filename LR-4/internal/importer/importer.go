@@ -0,0 +1,402 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"smartdevices/internal/catalog"
+	"smartdevices/internal/models"
+	"smartdevices/internal/webhooks"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Итог обработки строки файла
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+	ActionError     = "error"
+)
+
+// MaxRecords - ограничение на количество устройств в одном файле
+const MaxRecords = 5000
+
+var (
+	// ErrConflict - устройство изменили параллельно с импортом; импорт откатывается целиком
+	ErrConflict       = errors.New("device was modified during import, retry")
+	ErrTooManyRecords = fmt.Errorf("import file may have at most %d devices", MaxRecords)
+)
+
+type Options struct {
+	DryRun    bool
+	ChangedBy *uint // автор ревизий; nil - системный импорт (CLI)
+	// DevicePayload - данные webhook-события об устройстве, то же представление, что отдает API
+	DevicePayload func(device models.SmartDevice) interface{}
+}
+
+// LineResult - результат по одной записи файла
+type LineResult struct {
+	Line     int      `json:"line"`
+	Model    string   `json:"model"`
+	Action   string   `json:"action"`
+	DeviceID uint     `json:"device_id,omitempty"`
+	Changes  []string `json:"changes,omitempty"` // измененные поля при обновлении
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// Report - отчет импорта. Applied = false: ничего не записано (dry-run или есть ошибки).
+type Report struct {
+	DryRun    bool         `json:"dry_run"`
+	Applied   bool         `json:"applied"`
+	Total     int          `json:"total"`
+	Created   int          `json:"created"`
+	Updated   int          `json:"updated"`
+	Unchanged int          `json:"unchanged"`
+	Failed    int          `json:"failed"`
+	Lines     []LineResult `json:"lines"`
+}
+
+// plan - проверенная запись, готовая к сохранению
+type plan struct {
+	result          *LineResult
+	device          models.SmartDevice
+	expectedVersion uint
+	setTags         bool
+	tags            []string
+	deactivated     bool
+	changes         []string
+}
+
+// Run проверяет все записи и, если ошибок нет и это не dry-run, сохраняет их одной транзакцией.
+// Устройства сопоставляются по модели: найдено - обновление, нет - создание.
+// Ошибки строк попадают в отчет; error - сбой БД, ErrConflict или ErrTooManyRecords.
+func Run(db *gorm.DB, lines []catalog.RecordLine, options Options) (Report, error) {
+	report := Report{DryRun: options.DryRun, Total: len(lines), Lines: make([]LineResult, len(lines))}
+	if len(lines) > MaxRecords {
+		return report, ErrTooManyRecords
+	}
+
+	v, err := newValidator(db, lines)
+	if err != nil {
+		return report, err
+	}
+
+	plans := []*plan{}
+	for i, line := range lines {
+		result := &report.Lines[i]
+		result.Line = line.Line
+		result.Model = strings.TrimSpace(line.Record.Model)
+
+		p, problems, err := v.check(line)
+		if err != nil {
+			return report, err
+		}
+		if len(problems) > 0 {
+			result.Action = ActionError
+			result.Errors = problems
+			report.Failed++
+			continue
+		}
+
+		p.result = result
+		result.DeviceID = p.device.ID
+		result.Changes = p.changes
+		switch {
+		case p.device.ID == 0:
+			result.Action = ActionCreate
+			report.Created++
+		case len(result.Changes) == 0:
+			result.Action = ActionUnchanged
+			report.Unchanged++
+			continue
+		default:
+			result.Action = ActionUpdate
+			report.Updated++
+		}
+		plans = append(plans, p)
+	}
+
+	if options.DryRun || report.Failed > 0 {
+		return report, nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, p := range plans {
+			if err := apply(tx, p, options); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	report.Applied = true
+	return report, nil
+}
+
+// apply сохраняет одну запись: устройство, метки, ревизию и webhook
+func apply(tx *gorm.DB, p *plan, options Options) error {
+	device := &p.device
+	action, event := models.RevisionUpdate, webhooks.EventDeviceUpdated
+
+	if device.ID == 0 {
+		action, event = models.RevisionCreate, webhooks.EventDeviceCreated
+		if err := tx.Omit(clause.Associations).Create(device).Error; err != nil {
+			return err
+		}
+		p.result.DeviceID = device.ID
+	} else {
+		if p.deactivated {
+			action, event = models.RevisionDeactivate, webhooks.EventDeviceDeleted
+		}
+		device.Version++
+		result := tx.Model(device).
+			Where("version = ?", p.expectedVersion).
+			Select("*").
+			Omit(clause.Associations, "created_at").
+			Updates(device)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return fmt.Errorf("%w (line %d, model %q)", ErrConflict, p.result.Line, device.Model)
+		}
+	}
+
+	if p.setTags {
+		tags, err := catalog.ResolveTags(tx, p.tags)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(device).Association("Tags").Replace(tags); err != nil {
+			return err
+		}
+		device.Tags = tags
+	}
+
+	if err := catalog.RecordRevision(tx, *device, action, options.ChangedBy, nil); err != nil {
+		return err
+	}
+	return webhooks.Enqueue(tx, event, options.DevicePayload(*device))
+}
+
+// validator проверяет записи против текущего каталога
+type validator struct {
+	db         *gorm.DB
+	categories map[string]models.Category      // по slug
+	existing   map[string][]models.SmartDevice // по модели
+	schemas    map[uint]models.AttributeSchema // по категории
+	seen       map[string]int                  // модель -> строка первого упоминания
+}
+
+func newValidator(db *gorm.DB, lines []catalog.RecordLine) (*validator, error) {
+	v := &validator{
+		db:         db,
+		categories: map[string]models.Category{},
+		existing:   map[string][]models.SmartDevice{},
+		schemas:    map[uint]models.AttributeSchema{},
+		seen:       map[string]int{},
+	}
+
+	var categories []models.Category
+	if err := db.Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	for _, category := range categories {
+		v.categories[category.Slug] = category
+	}
+
+	modelNames := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if name := strings.TrimSpace(line.Record.Model); name != "" {
+			modelNames = append(modelNames, name)
+		}
+	}
+	if len(modelNames) == 0 {
+		return v, nil
+	}
+	var devices []models.SmartDevice
+	if err := db.Preload("Category").Preload("Tags").Preload("Images").Where("model IN ?", modelNames).Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		v.existing[device.Model] = append(v.existing[device.Model], device)
+	}
+	return v, nil
+}
+
+// check проверяет запись и собирает итоговое состояние устройства.
+// problems - ошибки строки для отчета, err - сбой БД.
+func (v *validator) check(line catalog.RecordLine) (*plan, []string, error) {
+	if line.Err != nil {
+		return nil, []string{line.Err.Error()}, nil
+	}
+	record := line.Record
+	problems := []string{}
+
+	model := strings.TrimSpace(record.Model)
+	if model == "" {
+		return nil, []string{"model is required"}, nil
+	}
+	if first, ok := v.seen[model]; ok {
+		return nil, []string{fmt.Sprintf("model is already used on line %d", first)}, nil
+	}
+	v.seen[model] = line.Line
+
+	p := &plan{}
+	var before models.DeviceSnapshot
+	switch matches := v.existing[model]; len(matches) {
+	case 0:
+		p.device = models.SmartDevice{Model: model, IsActive: true, Version: 1}
+	case 1:
+		p.device = matches[0]
+		p.expectedVersion = p.device.Version
+		before = catalog.Snapshot(p.device)
+	default:
+		return nil, []string{fmt.Sprintf("%d devices have this model, rename them first", len(matches))}, nil
+	}
+	device := &p.device
+	isNew := device.ID == 0
+
+	device.Name = strings.TrimSpace(record.Name)
+	device.Vendor = strings.TrimSpace(record.Vendor)
+	device.AvgDataRate = record.AvgDataRate
+	device.DataPerHour = record.DataPerHour
+	// У устройства с галереей namespace_url - URL основного изображения, им управляет галерея
+	if len(device.Images) == 0 {
+		device.NamespaceURL = strings.TrimSpace(record.NamespaceURL)
+	}
+	device.Description = record.Description
+	device.DescriptionAll = record.DescriptionAll
+	device.Protocol = strings.TrimSpace(record.Protocol)
+
+	limits := []struct {
+		field string
+		value string
+		max   int
+	}{
+		{"model", model, 100},
+		{"name", device.Name, 200},
+		{"vendor", device.Vendor, 100},
+		{"protocol", device.Protocol, 50},
+		{"namespace_url", device.NamespaceURL, 500},
+	}
+	for _, limit := range limits {
+		if utf8.RuneCountInString(limit.value) > limit.max {
+			problems = append(problems, fmt.Sprintf("%s must be at most %d characters", limit.field, limit.max))
+		}
+	}
+	if device.Name == "" {
+		problems = append(problems, "name is required")
+	}
+	for field, value := range map[string]float64{"avg_data_rate": device.AvgDataRate, "data_per_hour": device.DataPerHour} {
+		if value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+			problems = append(problems, field+" must be a non-negative number")
+		}
+	}
+
+	if record.StockQuantity != nil {
+		switch {
+		case *record.StockQuantity < 0:
+			problems = append(problems, "stock_quantity must not be negative")
+		case *record.StockQuantity < device.ReservedQuantity:
+			problems = append(problems, fmt.Sprintf("stock_quantity must not be less than reserved (%d)", device.ReservedQuantity))
+		default:
+			device.StockQuantity = *record.StockQuantity
+		}
+	}
+	if record.IsActive != nil {
+		p.deactivated = device.IsActive && !*record.IsActive && !isNew
+		device.IsActive = *record.IsActive
+	}
+
+	categoryChanged := false
+	if record.Category != nil {
+		slug := strings.ToLower(strings.TrimSpace(*record.Category))
+		if slug == "" {
+			categoryChanged = device.CategoryID != nil
+			device.CategoryID, device.Category = nil, nil
+		} else if category, ok := v.categories[slug]; ok {
+			categoryChanged = device.CategoryID == nil || *device.CategoryID != category.ID
+			device.CategoryID, device.Category = &category.ID, &category
+		} else {
+			problems = append(problems, fmt.Sprintf("unknown category %q", slug))
+		}
+	}
+
+	if record.Tags != nil {
+		tags, err := catalog.NormalizeTags(record.Tags)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		p.setTags, p.tags = true, tags
+	}
+
+	// Характеристики проверяются по схеме итоговой категории, как в API
+	if record.Specs != nil || isNew || categoryChanged {
+		values := map[string]interface{}(device.Specs)
+		if record.Specs != nil {
+			values = record.Specs
+		}
+		specs, err := v.validateSpecs(device.CategoryID, values)
+		var specErrors catalog.SpecErrors
+		switch {
+		case errors.As(err, &specErrors):
+			keys := make([]string, 0, len(specErrors))
+			for key := range specErrors {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				problems = append(problems, "specs."+key+": "+specErrors[key])
+			}
+		case err != nil:
+			return nil, nil, err
+		default:
+			device.Specs = specs
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, problems, nil
+	}
+
+	if !isNew {
+		after := *device
+		if p.setTags {
+			after.Tags = make([]models.Tag, len(p.tags))
+			for i, name := range p.tags {
+				after.Tags[i] = models.Tag{Name: name}
+			}
+		}
+		for _, change := range catalog.DiffSnapshots(before, catalog.Snapshot(after)) {
+			p.changes = append(p.changes, change.Field)
+		}
+	}
+	return p, nil, nil
+}
+
+// validateSpecs проверяет значения по схеме категории; схемы кешируются на время импорта
+func (v *validator) validateSpecs(categoryID *uint, values map[string]interface{}) (models.Specs, error) {
+	key := uint(0)
+	if categoryID != nil {
+		key = *categoryID
+	}
+	schema, ok := v.schemas[key]
+	if !ok {
+		var err error
+		if schema, err = catalog.EffectiveSchema(v.db, categoryID); err != nil {
+			return nil, err
+		}
+		v.schemas[key] = schema
+	}
+	return catalog.ValidateSpecs(schema, values)
+}
@@ -0,0 +1,174 @@
+package inventory
+
+import (
+	"fmt"
+	"strings"
+
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Shortage - нехватка устройства на складе при формировании заявки
+type Shortage struct {
+	DeviceID  uint   `json:"device_id"`
+	Name      string `json:"name"`
+	Requested int    `json:"requested"`
+	Available int    `json:"available"`
+}
+
+// ShortageError - заявку нельзя сформировать: не хватает устройств
+type ShortageError struct {
+	Shortages []Shortage
+}
+
+func (e *ShortageError) Error() string {
+	names := make([]string, len(e.Shortages))
+	for i, s := range e.Shortages {
+		names[i] = fmt.Sprintf("%s (нужно %d, доступно %d)", s.Name, s.Requested, s.Available)
+	}
+	return "insufficient stock: " + strings.Join(names, ", ")
+}
+
+// Available - сколько единиц можно зарезервировать
+func Available(device models.SmartDevice) int {
+	if available := device.StockQuantity - device.ReservedQuantity; available > 0 {
+		return available
+	}
+	return 0
+}
+
+// orderQuantities - количество по устройствам заявки (строки одного устройства суммируются)
+func orderQuantities(tx *gorm.DB, orderID uint) (map[uint]int, []uint, error) {
+	var rows []struct {
+		DeviceID uint
+		Quantity int
+	}
+	err := tx.Model(&models.OrderItem{}).
+		Select("device_id, SUM(quantity) AS quantity").
+		Where("order_id = ?", orderID).
+		Group("device_id").
+		Order("device_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	quantities := make(map[uint]int, len(rows))
+	deviceIDs := make([]uint, len(rows))
+	for i, row := range rows {
+		quantities[row.DeviceID] = row.Quantity
+		deviceIDs[i] = row.DeviceID
+	}
+	return quantities, deviceIDs, nil
+}
+
+// lockDevices блокирует строки устройств до конца транзакции.
+// Порядок по id исключает взаимоблокировки при параллельном формировании заявок.
+func lockDevices(tx *gorm.DB, deviceIDs []uint) ([]models.SmartDevice, error) {
+	var devices []models.SmartDevice
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", deviceIDs).
+		Order("id").
+		Find(&devices).Error
+	return devices, err
+}
+
+// Reserve резервирует устройства заявки. Вызывается в транзакции формирования;
+// при нехватке возвращает *ShortageError со всеми недостающими позициями.
+func Reserve(tx *gorm.DB, orderID uint) error {
+	quantities, deviceIDs, err := orderQuantities(tx, orderID)
+	if err != nil || len(deviceIDs) == 0 {
+		return err
+	}
+
+	devices, err := lockDevices(tx, deviceIDs)
+	if err != nil {
+		return err
+	}
+
+	var shortages []Shortage
+	for _, device := range devices {
+		if requested := quantities[device.ID]; requested > Available(device) {
+			shortages = append(shortages, Shortage{
+				DeviceID:  device.ID,
+				Name:      device.Name,
+				Requested: requested,
+				Available: Available(device),
+			})
+		}
+	}
+	if len(shortages) > 0 {
+		return &ShortageError{Shortages: shortages}
+	}
+
+	return adjust(tx, devices, quantities, func(device *models.SmartDevice, quantity int) {
+		device.ReservedQuantity += quantity
+	})
+}
+
+// Consume списывает резерв завершенной заявки со склада
+func Consume(tx *gorm.DB, orderID uint) error {
+	quantities, deviceIDs, err := orderQuantities(tx, orderID)
+	if err != nil || len(deviceIDs) == 0 {
+		return err
+	}
+	devices, err := lockDevices(tx, deviceIDs)
+	if err != nil {
+		return err
+	}
+	return adjust(tx, devices, quantities, func(device *models.SmartDevice, quantity int) {
+		device.ReservedQuantity = max(device.ReservedQuantity-quantity, 0)
+		device.StockQuantity = max(device.StockQuantity-quantity, 0)
+	})
+}
+
+// Release снимает резерв отклоненной или удаленной заявки
+func Release(tx *gorm.DB, orderID uint) error {
+	quantities, deviceIDs, err := orderQuantities(tx, orderID)
+	if err != nil || len(deviceIDs) == 0 {
+		return err
+	}
+	devices, err := lockDevices(tx, deviceIDs)
+	if err != nil {
+		return err
+	}
+	return adjust(tx, devices, quantities, func(device *models.SmartDevice, quantity int) {
+		device.ReservedQuantity = max(device.ReservedQuantity-quantity, 0)
+	})
+}
+
+// adjust пересчитывает резерв и остаток заблокированных устройств и увеличивает версию:
+// доступное количество входит в представление устройства (ETag).
+// Новые значения считаются по строкам, прочитанным под блокировкой, поэтому SQL не зависит от СУБД.
+func adjust(tx *gorm.DB, devices []models.SmartDevice, quantities map[uint]int, change func(device *models.SmartDevice, quantity int)) error {
+	for i := range devices {
+		device := &devices[i]
+		change(device, quantities[device.ID])
+		err := tx.Model(&models.SmartDevice{}).Where("id = ?", device.ID).UpdateColumns(map[string]interface{}{
+			"reserved_quantity": device.ReservedQuantity,
+			"stock_quantity":    device.StockQuantity,
+			"version":           gorm.Expr("version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyTransition меняет склад при смене статуса заявки:
+// formed из draft - резерв, completed - списание, rejected/deleted из formed - снятие резерва.
+// Повторное формирование уже сформированной заявки склад не меняет.
+func ApplyTransition(tx *gorm.DB, orderID uint, fromStatus, toStatus string) error {
+	switch {
+	case fromStatus == "draft" && toStatus == "formed":
+		return Reserve(tx, orderID)
+	case fromStatus == "formed" && toStatus == "completed":
+		return Consume(tx, orderID)
+	case fromStatus == "formed" && (toStatus == "rejected" || toStatus == "deleted"):
+		return Release(tx, orderID)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"smartdevices/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+var testDBSeq int64
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	name := fmt.Sprintf("file:inventory%d?mode=memory&cache=shared", atomic.AddInt64(&testDBSeq, 1))
+	db, err := gorm.Open(sqlite.Open(name), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.Client{}, &models.SmartDevice{}, &models.SmartOrder{}, &models.OrderItem{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// stock - остаток, резерв и версия устройства
+type stock struct {
+	Stock, Reserved int
+	Version         uint
+}
+
+// seedOrder создает черновик со строками lines: индекс устройства в devices -> количества его строк
+func seedOrder(t *testing.T, db *gorm.DB, devices []*models.SmartDevice, lines map[int][]int) models.SmartOrder {
+	t.Helper()
+	client := models.Client{Username: fmt.Sprintf("client%d", atomic.AddInt64(&testDBSeq, 1)), Password: "x"}
+	if err := db.Create(&client).Error; err != nil {
+		t.Fatal(err)
+	}
+	order := models.SmartOrder{Status: "draft", ClientID: client.ID}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	for index, quantities := range lines {
+		for _, quantity := range quantities {
+			item := models.OrderItem{OrderID: order.ID, DeviceID: devices[index].ID, Quantity: quantity}
+			if err := db.Omit(clause.Associations).Create(&item).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return order
+}
+
+func seedDevices(t *testing.T, db *gorm.DB, stocks ...stock) []*models.SmartDevice {
+	t.Helper()
+	devices := make([]*models.SmartDevice, len(stocks))
+	for i, s := range stocks {
+		devices[i] = &models.SmartDevice{Name: fmt.Sprintf("Устройство %d", i+1), IsActive: true,
+			StockQuantity: s.Stock, ReservedQuantity: s.Reserved}
+		if err := db.Create(devices[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return devices
+}
+
+func stocks(t *testing.T, db *gorm.DB, devices []*models.SmartDevice) []stock {
+	t.Helper()
+	result := make([]stock, len(devices))
+	for i, device := range devices {
+		var current models.SmartDevice
+		if err := db.First(&current, device.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		result[i] = stock{current.StockQuantity, current.ReservedQuantity, current.Version}
+	}
+	return result
+}
+
+func TestApplyTransition(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		before   []stock
+		want     []stock
+	}{
+		// Первое устройство - в двух строках (2 + 1), второе - в одной (4)
+		{"reserve on formed", "draft", "formed", []stock{{10, 2, 1}, {4, 0, 1}}, []stock{{10, 5, 2}, {4, 4, 2}}},
+		{"consume on completed", "formed", "completed", []stock{{10, 5, 1}, {4, 4, 1}}, []stock{{7, 2, 2}, {0, 0, 2}}},
+		{"release on rejected", "formed", "rejected", []stock{{10, 5, 1}, {4, 4, 1}}, []stock{{10, 2, 2}, {4, 0, 2}}},
+		{"release on deleted", "formed", "deleted", []stock{{10, 5, 1}, {4, 4, 1}}, []stock{{10, 2, 2}, {4, 0, 2}}},
+		// Резерв не уходит ниже нуля, даже если его вручную уменьшили
+		{"release below zero", "formed", "rejected", []stock{{10, 1, 1}, {4, 0, 1}}, []stock{{10, 0, 2}, {4, 0, 2}}},
+		{"formed again", "formed", "formed", []stock{{10, 5, 1}, {4, 4, 1}}, []stock{{10, 5, 1}, {4, 4, 1}}},
+		{"draft deleted", "draft", "deleted", []stock{{10, 2, 1}, {4, 0, 1}}, []stock{{10, 2, 1}, {4, 0, 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			devices := seedDevices(t, db, tt.before...)
+			order := seedOrder(t, db, devices, map[int][]int{0: {2, 1}, 1: {4}})
+
+			if err := ApplyTransition(db, order.ID, tt.from, tt.to); err != nil {
+				t.Fatal(err)
+			}
+			if got := stocks(t, db, devices); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stock = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReserveShortage(t *testing.T) {
+	db := newTestDB(t)
+	// Второго устройства хватает, первого и третьего - нет
+	devices := seedDevices(t, db, stock{Stock: 3, Reserved: 2}, stock{Stock: 5}, stock{Stock: 1})
+	order := seedOrder(t, db, devices, map[int][]int{0: {1, 1}, 1: {5}, 2: {2}})
+
+	err := Reserve(db, order.ID)
+	var shortage *ShortageError
+	if !errors.As(err, &shortage) {
+		t.Fatalf("Reserve() error = %v, want *ShortageError", err)
+	}
+	want := []Shortage{
+		{DeviceID: devices[0].ID, Name: "Устройство 1", Requested: 2, Available: 1},
+		{DeviceID: devices[2].ID, Name: "Устройство 3", Requested: 2, Available: 1},
+	}
+	if !reflect.DeepEqual(shortage.Shortages, want) {
+		t.Errorf("shortages = %+v, want %+v", shortage.Shortages, want)
+	}
+	if msg := "insufficient stock: Устройство 1 (нужно 2, доступно 1), Устройство 3 (нужно 2, доступно 1)"; err.Error() != msg {
+		t.Errorf("Error() = %q", err.Error())
+	}
+
+	// При нехватке ничего не резервируется и версии не меняются
+	if got := stocks(t, db, devices); !reflect.DeepEqual(got, []stock{{3, 2, 1}, {5, 0, 1}, {1, 0, 1}}) {
+		t.Errorf("stock after shortage = %+v", got)
+	}
+}
+
+func TestEmptyOrder(t *testing.T) {
+	db := newTestDB(t)
+	order := seedOrder(t, db, nil, nil)
+	for _, apply := range []func(*gorm.DB, uint) error{Reserve, Consume, Release} {
+		if err := apply(db, order.ID); err != nil {
+			t.Errorf("empty order: %v", err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Последняя активность черновика: изменение заявки или ее позиций
+const draftActivity = "COALESCE(smart_orders.updated_at, smart_orders.created_at)"
+
+// Notifier предупреждает клиента о скором удалении черновика (notifications.DraftNotifier)
+type Notifier interface {
+	DraftExpiring(order models.SmartOrder, deleteAt time.Time) error
+}
+
+// DraftExpirer удаляет черновик общим для API путем перехода статуса:
+// история, склад, уведомления и события SSE. false - черновик изменился после выборки.
+type DraftExpirer interface {
+	ExpireDraft(order models.SmartOrder, comment string) (bool, error)
+}
+
+// DraftCleaner переводит заброшенные черновики в deleted.
+// Сначала клиент получает предупреждение, удаление - не раньше чем через warnBefore после него.
+type DraftCleaner struct {
+	db         *gorm.DB
+	notifier   Notifier
+	expirer    DraftExpirer
+	ttl        time.Duration
+	warnBefore time.Duration
+}
+
+// NewDraftCleaner: ttl - сколько черновик может простаивать,
+// warnBefore - за сколько до удаления предупредить клиента
+func NewDraftCleaner(db *gorm.DB, notifier Notifier, expirer DraftExpirer, ttl, warnBefore time.Duration) *DraftCleaner {
+	if warnBefore >= ttl {
+		warnBefore = ttl / 2
+	}
+	return &DraftCleaner{
+		db:         db,
+		notifier:   notifier,
+		expirer:    expirer,
+		ttl:        ttl,
+		warnBefore: warnBefore,
+	}
+}
+
+// Job - задача для планировщика
+func (c *DraftCleaner) Job() Job {
+	return Job{Name: "draft-cleanup", Run: c.Run}
+}
+
+// Run предупреждает о черновиках, которые скоро истекут, и удаляет истекшие
+func (c *DraftCleaner) Run(ctx context.Context) error {
+	now := time.Now()
+
+	warned, err := c.warn(ctx, now)
+	if err != nil {
+		return fmt.Errorf("warn drafts: %w", err)
+	}
+
+	deleted, err := c.deleteExpired(ctx, now)
+	if err != nil {
+		return fmt.Errorf("delete drafts: %w", err)
+	}
+
+	if warned > 0 || deleted > 0 {
+		log.Printf("🧹 Drafts: warned %d, deleted %d", warned, deleted)
+	}
+	return nil
+}
+
+// warn отмечает черновики, простаивающие дольше ttl - warnBefore.
+// После изменения черновика предупреждение считается устаревшим и отправляется заново.
+func (c *DraftCleaner) warn(ctx context.Context, now time.Time) (int, error) {
+	var drafts []models.SmartOrder
+	err := c.db.WithContext(ctx).Preload("Client").
+		Where("smart_orders.status = ?", "draft").
+		Where(draftActivity+" < ?", now.Add(-(c.ttl - c.warnBefore))).
+		Where("smart_orders.draft_warned_at IS NULL OR smart_orders.draft_warned_at < " + draftActivity).
+		Find(&drafts).Error
+	if err != nil {
+		return 0, err
+	}
+
+	warned := 0
+	for _, draft := range drafts {
+		lastActivity := draft.UpdatedAt
+		if lastActivity.IsZero() {
+			lastActivity = draft.CreatedAt
+		}
+		deleteAt := lastActivity.Add(c.ttl)
+		if minDeleteAt := now.Add(c.warnBefore); deleteAt.Before(minDeleteAt) {
+			deleteAt = minDeleteAt
+		}
+
+		if err := c.notifier.DraftExpiring(draft, deleteAt); err != nil {
+			log.Printf("⚠️ Draft %d: warning failed: %v", draft.ID, err)
+			continue
+		}
+
+		// UpdateColumn не трогает updated_at - предупреждение не продлевает черновик
+		if err := c.db.WithContext(ctx).Model(&models.SmartOrder{}).
+			Where("id = ?", draft.ID).
+			UpdateColumn("draft_warned_at", now).Error; err != nil {
+			return warned, err
+		}
+		warned++
+	}
+	return warned, nil
+}
+
+// deleteExpired удаляет черновики, простаивающие дольше ttl,
+// если клиента предупредили после последнего изменения и не позже чем за warnBefore
+func (c *DraftCleaner) deleteExpired(ctx context.Context, now time.Time) (int, error) {
+	var drafts []models.SmartOrder
+	err := c.db.WithContext(ctx).
+		Where("smart_orders.status = ?", "draft").
+		Where(draftActivity+" < ?", now.Add(-c.ttl)).
+		Where("smart_orders.draft_warned_at >= "+draftActivity).
+		Where("smart_orders.draft_warned_at <= ?", now.Add(-c.warnBefore)).
+		Find(&drafts).Error
+	if err != nil {
+		return 0, err
+	}
+
+	comment := fmt.Sprintf("Автоудаление: черновик не изменялся %d дн.", int(c.ttl.Hours()/24))
+	deleted := 0
+	for _, draft := range drafts {
+		// Переход проверяет версию: клиент мог изменить черновик после выборки
+		changed, err := c.expirer.ExpireDraft(draft, comment)
+		if err != nil {
+			return deleted, err
+		}
+		if changed {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,204 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"smartdevices/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testDBSeq int64
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	name := fmt.Sprintf("file:maintenance%d?mode=memory&cache=shared", atomic.AddInt64(&testDBSeq, 1))
+	db, err := gorm.Open(sqlite.Open(name), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.Client{}, &models.SmartOrder{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// recordingNotifier запоминает, о каких черновиках и с какой датой удаления предупредили
+type recordingNotifier struct {
+	deleteAt map[uint]time.Time
+}
+
+func (n *recordingNotifier) DraftExpiring(order models.SmartOrder, deleteAt time.Time) error {
+	n.deleteAt[order.ID] = deleteAt
+	return nil
+}
+
+// statusExpirer удаляет черновик без истории и склада; changed=false имитирует гонку версий
+type statusExpirer struct {
+	db      *gorm.DB
+	changed bool
+	calls   []uint
+}
+
+func (e *statusExpirer) ExpireDraft(order models.SmartOrder, comment string) (bool, error) {
+	e.calls = append(e.calls, order.ID)
+	if !e.changed {
+		return false, nil
+	}
+	return true, e.db.Model(&models.SmartOrder{}).Where("id = ?", order.ID).UpdateColumn("status", "deleted").Error
+}
+
+const (
+	testDraftTTL  = 30 * 24 * time.Hour
+	testWarnAhead = 3 * 24 * time.Hour
+)
+
+func newTestCleaner(t *testing.T) (*DraftCleaner, *recordingNotifier, *statusExpirer, *gorm.DB) {
+	t.Helper()
+	db := newTestDB(t)
+	notifier := &recordingNotifier{deleteAt: map[uint]time.Time{}}
+	expirer := &statusExpirer{db: db, changed: true}
+	return NewDraftCleaner(db, notifier, expirer, testDraftTTL, testWarnAhead), notifier, expirer, db
+}
+
+// seedDraft создает заявку, последний раз измененную в updatedAt
+func seedDraft(t *testing.T, db *gorm.DB, status string, updatedAt time.Time) models.SmartOrder {
+	t.Helper()
+	client := models.Client{Username: fmt.Sprintf("client%d", atomic.AddInt64(&testDBSeq, 1)), Password: "x"}
+	if err := db.Create(&client).Error; err != nil {
+		t.Fatal(err)
+	}
+	order := models.SmartOrder{Status: status, ClientID: client.ID, CreatedAt: updatedAt, UpdatedAt: updatedAt}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+func orderStatus(t *testing.T, db *gorm.DB, id uint) string {
+	t.Helper()
+	var order models.SmartOrder
+	if err := db.First(&order, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return order.Status
+}
+
+func TestDraftCleanerWarnsThenDeletes(t *testing.T) {
+	cleaner, notifier, expirer, db := newTestCleaner(t)
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Простаивает дольше ttl, но еще не предупрежден
+	expired := seedDraft(t, db, "draft", now.Add(-testDraftTTL-time.Hour))
+	// Истечет через день: предупреждение сейчас, удаление - по сроку
+	expiring := seedDraft(t, db, "draft", now.Add(-testDraftTTL+24*time.Hour))
+	// Еще рано предупреждать
+	fresh := seedDraft(t, db, "draft", now.Add(-testDraftTTL+testWarnAhead+time.Hour))
+	// Старые заявки в других статусах не трогаем
+	formed := seedDraft(t, db, "formed", now.Add(-2*testDraftTTL))
+
+	if warned, err := cleaner.warn(ctx, now); err != nil || warned != 2 {
+		t.Fatalf("warn() = %d, %v, want 2", warned, err)
+	}
+	// Срок удаления - не раньше чем через warnBefore после предупреждения
+	want := map[uint]time.Time{
+		expired.ID:  now.Add(testWarnAhead),
+		expiring.ID: now.Add(testWarnAhead),
+	}
+	if !reflect.DeepEqual(notifier.deleteAt, want) {
+		t.Errorf("warnings = %v, want %v", notifier.deleteAt, want)
+	}
+
+	// Повторный запуск не предупреждает второй раз и не удаляет раньше warnBefore
+	if warned, err := cleaner.warn(ctx, now.Add(time.Hour)); err != nil || warned != 0 {
+		t.Errorf("second warn() = %d, %v, want 0", warned, err)
+	}
+	if deleted, err := cleaner.deleteExpired(ctx, now.Add(testWarnAhead-time.Minute)); err != nil || deleted != 0 {
+		t.Fatalf("deleteExpired() before warnBefore = %d, %v, want 0", deleted, err)
+	}
+
+	if deleted, err := cleaner.deleteExpired(ctx, now.Add(testWarnAhead+time.Minute)); err != nil || deleted != 2 {
+		t.Fatalf("deleteExpired() = %d, %v, want 2", deleted, err)
+	}
+	if !reflect.DeepEqual(expirer.calls, []uint{expired.ID, expiring.ID}) {
+		t.Errorf("expired drafts = %v, want %v", expirer.calls, []uint{expired.ID, expiring.ID})
+	}
+	for id, status := range map[uint]string{expired.ID: "deleted", expiring.ID: "deleted", fresh.ID: "draft", formed.ID: "formed"} {
+		if got := orderStatus(t, db, id); got != status {
+			t.Errorf("order %d status = %s, want %s", id, got, status)
+		}
+	}
+}
+
+func TestDraftCleanerSkipsTouchedDrafts(t *testing.T) {
+	cleaner, notifier, expirer, db := newTestCleaner(t)
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	draft := seedDraft(t, db, "draft", now.Add(-testDraftTTL-time.Hour))
+	if warned, err := cleaner.warn(ctx, now); err != nil || warned != 1 {
+		t.Fatalf("warn() = %d, %v, want 1", warned, err)
+	}
+
+	// Клиент изменил черновик после предупреждения - по старому предупреждению его не удаляем,
+	// даже когда после изменения снова прошел ttl
+	touchedAt := now.Add(time.Hour)
+	if err := db.Model(&models.SmartOrder{}).Where("id = ?", draft.ID).UpdateColumn("updated_at", touchedAt).Error; err != nil {
+		t.Fatal(err)
+	}
+	later := touchedAt.Add(testDraftTTL + time.Hour)
+	if deleted, err := cleaner.deleteExpired(ctx, later); err != nil || deleted != 0 || len(expirer.calls) != 0 {
+		t.Fatalf("deleteExpired() after touch = %d, %v, calls %v", deleted, err, expirer.calls)
+	}
+
+	// Клиент получает новое предупреждение с новым сроком, удаление - не раньше чем через warnBefore после него
+	if warned, err := cleaner.warn(ctx, later); err != nil || warned != 1 {
+		t.Fatalf("warn() after touch = %d, %v, want 1", warned, err)
+	}
+	if got, want := notifier.deleteAt[draft.ID], later.Add(testWarnAhead); !got.Equal(want) {
+		t.Errorf("new deleteAt = %v, want %v", got, want)
+	}
+	if deleted, err := cleaner.deleteExpired(ctx, later.Add(testWarnAhead+time.Minute)); err != nil || deleted != 1 {
+		t.Errorf("deleteExpired() after new warning = %d, %v, want 1", deleted, err)
+	}
+}
+
+func TestDraftCleanerVersionRace(t *testing.T) {
+	cleaner, _, expirer, db := newTestCleaner(t)
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	draft := seedDraft(t, db, "draft", now.Add(-testDraftTTL-time.Hour))
+	if _, err := cleaner.warn(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// Черновик изменили между выборкой и переходом - удаление пропускается без ошибки
+	expirer.changed = false
+	if deleted, err := cleaner.deleteExpired(ctx, now.Add(testWarnAhead+time.Minute)); err != nil || deleted != 0 {
+		t.Errorf("deleteExpired() on race = %d, %v, want 0", deleted, err)
+	}
+	if len(expirer.calls) != 1 || orderStatus(t, db, draft.ID) != "draft" {
+		t.Errorf("calls = %v, status = %s", expirer.calls, orderStatus(t, db, draft.ID))
+	}
+}
+
+func TestNewDraftCleanerWarnBefore(t *testing.T) {
+	cleaner := NewDraftCleaner(nil, nil, nil, 10*24*time.Hour, 10*24*time.Hour)
+	if cleaner.warnBefore != 5*24*time.Hour {
+		t.Errorf("warnBefore = %v, want half of ttl", cleaner.warnBefore)
+	}
+}
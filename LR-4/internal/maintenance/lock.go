@@ -0,0 +1,62 @@
+package maintenance
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Снимаем блокировку, только если она все еще наша
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisLock - распределенная блокировка: задачу выполняет только один экземпляр сервера
+type RedisLock struct {
+	client *redis.Client
+	key    string
+	ttl    time.Duration
+}
+
+// NewRedisLock создает блокировку с ключом key на общем клиенте Redis.
+// ttl ограничивает время удержания, если экземпляр упал, не сняв блокировку.
+func NewRedisLock(client *redis.Client, key string, ttl time.Duration) *RedisLock {
+	return &RedisLock{
+		client: client,
+		key:    key,
+		ttl:    ttl,
+	}
+}
+
+// TryLock захватывает блокировку без ожидания.
+// Возвращает false, если она занята другим экземпляром.
+func (l *RedisLock) TryLock(ctx context.Context) (release func(), ok bool, err error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, false, err
+	}
+
+	ok, err = l.client.SetNX(ctx, l.key, token, l.ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	release = func() {
+		releaseScript.Run(context.Background(), l.client, []string{l.key}, token)
+	}
+	return release, true, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,64 @@
+package maintenance
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Job - периодическая задача обслуживания
+type Job struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Scheduler запускает задачи по таймеру под распределенной блокировкой
+type Scheduler struct {
+	lock     *RedisLock
+	interval time.Duration
+	jobs     []Job
+}
+
+func NewScheduler(lock *RedisLock, interval time.Duration, jobs ...Job) *Scheduler {
+	return &Scheduler{
+		lock:     lock,
+		interval: interval,
+		jobs:     jobs,
+	}
+}
+
+// Start выполняет задачи сразу и затем каждые interval, пока не отменен ctx
+func (s *Scheduler) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.RunOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce выполняет все задачи, если блокировку удалось захватить
+func (s *Scheduler) RunOnce(ctx context.Context) {
+	release, ok, err := s.lock.TryLock(ctx)
+	if err != nil {
+		log.Printf("⚠️ Maintenance: lock failed: %v", err)
+		return
+	}
+	if !ok {
+		log.Printf("⏭️ Maintenance: another instance is running jobs")
+		return
+	}
+	defer release()
+
+	for _, job := range s.jobs {
+		if err := job.Run(ctx); err != nil {
+			log.Printf("❌ Maintenance job %s failed: %v", job.Name, err)
+		}
+	}
+}
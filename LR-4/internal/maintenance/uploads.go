@@ -0,0 +1,110 @@
+package maintenance
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"smartdevices/internal/models"
+	"smartdevices/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// uploadCleanupBatch - сколько просроченных загрузок удаляется за один запуск
+	uploadCleanupBatch = 500
+	// orphanUploadAge - временный файл без записи о загрузке (например, после сбоя) удаляется через сутки
+	orphanUploadAge = 24 * time.Hour
+)
+
+// UploadCleaner удаляет неподтвержденные прямые загрузки изображений и их временные файлы
+type UploadCleaner struct {
+	db    *gorm.DB
+	store storage.ObjectStore
+}
+
+func NewUploadCleaner(db *gorm.DB, store storage.ObjectStore) *UploadCleaner {
+	return &UploadCleaner{db: db, store: store}
+}
+
+// Job - задача для планировщика
+func (c *UploadCleaner) Job() Job {
+	return Job{Name: "image-upload-cleanup", Run: c.Run}
+}
+
+// Run удаляет загрузки с истекшей ссылкой, затем потерянные временные файлы.
+// Запись удаляется только после файла, чтобы при недоступном хранилище повторить попытку в следующий раз.
+func (c *UploadCleaner) Run(ctx context.Context) error {
+	var uploads []models.DeviceImageUpload
+	err := c.db.WithContext(ctx).
+		Where("expires_at < ?", time.Now()).
+		Order("id").
+		Limit(uploadCleanupBatch).
+		Find(&uploads).Error
+	if err != nil {
+		return err
+	}
+
+	removed := 0
+	for _, upload := range uploads {
+		if err := c.store.Delete(ctx, upload.ObjectName); err != nil {
+			log.Printf("⚠️ Failed to delete expired upload %s: %v", upload.ObjectName, err)
+			continue
+		}
+		if err := c.db.WithContext(ctx).Delete(&upload).Error; err != nil {
+			return err
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("🧹 Expired image uploads removed: %d", removed)
+	}
+	return c.removeOrphans(ctx)
+}
+
+// removeOrphans удаляет старые временные файлы, о которых нет записи в БД
+func (c *UploadCleaner) removeOrphans(ctx context.Context) error {
+	objects, err := c.store.List(ctx, storage.UploadsPrefix)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, object := range objects {
+		if time.Since(object.LastModified) > orphanUploadAge {
+			names = append(names, object.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	var known []string
+	err = c.db.WithContext(ctx).Model(&models.DeviceImageUpload{}).
+		Where("object_name IN ?", names).
+		Pluck("object_name", &known).Error
+	if err != nil {
+		return err
+	}
+	skip := map[string]bool{}
+	for _, name := range known {
+		skip[name] = true
+	}
+
+	removed := 0
+	for _, name := range names {
+		if skip[name] {
+			continue
+		}
+		if err := c.store.Delete(ctx, name); err != nil {
+			log.Printf("⚠️ Failed to delete orphaned upload %s: %v", name, err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("🧹 Orphaned upload files removed: %d", removed)
+	}
+	return nil
+}
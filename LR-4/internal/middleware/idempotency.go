@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"smartdevices/internal/idempotency"
+)
+
+const idempotencyHeader = "Idempotency-Key"
+
+// DefaultMaxBodySize - предел тела для JSON-запросов. Маршруты с файлами задают свой предел через WrapLimit.
+const DefaultMaxBodySize = 1 << 20 // 1 MB
+
+// Заголовки ответа, которые воспроизводятся при повторе.
+// CORS-заголовки выставляет обработчик, а при повторе он не вызывается - без них браузер не отдаст ответ фронтенду.
+var replayedHeaders = []string{
+	"Content-Type", "ETag", "Location",
+	"Access-Control-Allow-Origin", "Access-Control-Allow-Methods",
+	"Access-Control-Allow-Headers", "Access-Control-Expose-Headers",
+}
+
+// IdempotencyStore - хранилище ключей идемпотентности, реализация - idempotency.Store (Redis)
+type IdempotencyStore interface {
+	Begin(clientID uint, key, fingerprint string) (*idempotency.Record, error)
+	Complete(clientID uint, key string, record idempotency.Record) error
+	Release(clientID uint, key string) error
+}
+
+type IdempotencyMiddleware struct {
+	auth  *AuthMiddleware
+	store IdempotencyStore
+}
+
+func NewIdempotencyMiddleware(auth *AuthMiddleware, store IdempotencyStore) *IdempotencyMiddleware {
+	return &IdempotencyMiddleware{
+		auth:  auth,
+		store: store,
+	}
+}
+
+// responseRecorder пишет ответ клиенту и одновременно копирует его для сохранения
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Wrap обрабатывает заголовок Idempotency-Key для POST/PUT с телом до DefaultMaxBodySize.
+// Должен вызываться внутри RequireAuth, т.к. ключи разделены по пользователям.
+func (m *IdempotencyMiddleware) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	return m.WrapLimit(DefaultMaxBodySize)(next)
+}
+
+// WrapLimit - Wrap с пределом тела maxBodySize. Тело читается в память целиком ради отпечатка,
+// поэтому предел должен совпадать с пределом самого маршрута (импорт, загрузка изображений).
+func (m *IdempotencyMiddleware) WrapLimit(maxBodySize int64) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return m.wrap(next, maxBodySize)
+	}
+}
+
+func (m *IdempotencyMiddleware) wrap(next http.HandlerFunc, maxBodySize int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPut) {
+			next(w, r)
+			return
+		}
+		if len(key) > 255 {
+			http.Error(w, `{"error": "Idempotency-Key is too long"}`, http.StatusBadRequest)
+			return
+		}
+
+		user := m.auth.GetCurrentUser(r)
+		if user == nil {
+			http.Error(w, `{"error": "Authentication required"}`, http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, `{"error": "Request body is too large"}`, http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := requestFingerprint(r.Method, r.URL.RequestURI(), body)
+
+		record, err := m.store.Begin(user.ClientID, key, fingerprint)
+		switch {
+		case errors.Is(err, idempotency.ErrInProgress):
+			http.Error(w, `{"error": "A request with this Idempotency-Key is still in progress"}`, http.StatusConflict)
+			return
+		case err != nil:
+			// Redis недоступен - выполняем запрос без защиты от повторов
+			log.Printf("⚠️ Idempotency store unavailable: %v", err)
+			next(w, r)
+			return
+		case record != nil && record.Fingerprint != fingerprint:
+			http.Error(w, `{"error": "Idempotency-Key was already used with a different request"}`, http.StatusUnprocessableEntity)
+			return
+		case record != nil:
+			for _, name := range replayedHeaders {
+				if value := record.Header.Get(name); value != "" {
+					w.Header().Set(name, value)
+				}
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.StatusCode)
+			w.Write(record.Body)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		// Ошибки сервера не запоминаем - клиент может повторить запрос
+		if rec.status >= http.StatusInternalServerError {
+			if err := m.store.Release(user.ClientID, key); err != nil {
+				log.Printf("⚠️ Failed to release idempotency key: %v", err)
+			}
+			return
+		}
+
+		header := http.Header{}
+		for _, name := range replayedHeaders {
+			if value := rec.Header().Get(name); value != "" {
+				header.Set(name, value)
+			}
+		}
+		err = m.store.Complete(user.ClientID, key, idempotency.Record{
+			Fingerprint: fingerprint,
+			StatusCode:  rec.status,
+			Header:      header,
+			Body:        rec.body.Bytes(),
+		})
+		if err != nil {
+			log.Printf("⚠️ Failed to store idempotent response: %v", err)
+		}
+	}
+}
+
+// requestFingerprint - отпечаток запроса: метод, путь с параметрами и тело
+func requestFingerprint(method, requestURI string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + requestURI + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
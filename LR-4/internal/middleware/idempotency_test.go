@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"smartdevices/internal/idempotency"
+	"smartdevices/internal/session"
+)
+
+func TestRequestFingerprint(t *testing.T) {
+	base := requestFingerprint("POST", "/api/smart-devices", []byte(`{"name":"Lamp"}`))
+
+	tests := []struct {
+		name   string
+		method string
+		uri    string
+		body   string
+		same   bool
+	}{
+		{"same request", "POST", "/api/smart-devices", `{"name":"Lamp"}`, true},
+		{"other body", "POST", "/api/smart-devices", `{"name":"Hub"}`, false},
+		{"other method", "PUT", "/api/smart-devices", `{"name":"Lamp"}`, false},
+		{"other path", "POST", "/api/smart-devices/1", `{"name":"Lamp"}`, false},
+		{"other query", "POST", "/api/smart-devices?dry_run=true", `{"name":"Lamp"}`, false},
+		// Разделитель не дает перенести часть пути в тело
+		{"path and body boundary", "POST", "/api/smart-devices\n{", `"name":"Lamp"}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := requestFingerprint(tt.method, tt.uri, []byte(tt.body))
+			if (got == base) != tt.same {
+				t.Errorf("fingerprint equal = %v, want %v", got == base, tt.same)
+			}
+		})
+	}
+}
+
+// memoryStore повторяет поведение idempotency.Store в памяти
+type memoryStore struct {
+	records  map[string]idempotency.Record
+	err      error
+	released []string
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: map[string]idempotency.Record{}}
+}
+
+func (s *memoryStore) Begin(clientID uint, key, fingerprint string) (*idempotency.Record, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	record, ok := s.records[key]
+	if !ok {
+		s.records[key] = idempotency.Record{Fingerprint: fingerprint}
+		return nil, nil
+	}
+	if record.Fingerprint == fingerprint && !record.Completed {
+		return &record, idempotency.ErrInProgress
+	}
+	return &record, nil
+}
+
+func (s *memoryStore) Complete(clientID uint, key string, record idempotency.Record) error {
+	record.Completed = true
+	s.records[key] = record
+	return nil
+}
+
+func (s *memoryStore) Release(clientID uint, key string) error {
+	delete(s.records, key)
+	s.released = append(s.released, key)
+	return nil
+}
+
+// countingHandler отвечает заданным статусом и считает вызовы
+type countingHandler struct {
+	status int
+	calls  int
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls++
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Not-Replayed", "1")
+	w.WriteHeader(h.status)
+	w.Write([]byte(`{"echo":` + string(body) + `}`))
+}
+
+func idempotentRequest(method, key, body string, user *session.Session) *http.Request {
+	r := httptest.NewRequest(method, "/api/smart-devices", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+	if user != nil {
+		r = r.WithContext(context.WithValue(r.Context(), "user", user))
+	}
+	return r
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	user := &session.Session{ClientID: 7}
+
+	t.Run("replays first response", func(t *testing.T) {
+		store := newMemoryStore()
+		next := &countingHandler{status: http.StatusCreated}
+		wrapped := NewIdempotencyMiddleware(&AuthMiddleware{}, store).Wrap(next.ServeHTTP)
+
+		first := httptest.NewRecorder()
+		wrapped(first, idempotentRequest("POST", "k1", `{"n":1}`, user))
+		second := httptest.NewRecorder()
+		wrapped(second, idempotentRequest("POST", "k1", `{"n":1}`, user))
+
+		if next.calls != 1 {
+			t.Fatalf("handler called %d times, want 1", next.calls)
+		}
+		if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+			t.Errorf("replay = %d %q, want %d %q", second.Code, second.Body, first.Code, first.Body)
+		}
+		if second.Header().Get("Idempotent-Replayed") != "true" {
+			t.Error("replay is not marked with Idempotent-Replayed")
+		}
+		if second.Header().Get("Access-Control-Allow-Origin") != "*" {
+			t.Error("replay lost CORS headers")
+		}
+		if second.Header().Get("X-Not-Replayed") != "" {
+			t.Error("replay copied a header outside the allow-list")
+		}
+	})
+
+	tests := []struct {
+		name      string
+		method    string
+		key       string
+		user      *session.Session
+		prepare   func(*memoryStore)
+		status    int
+		wantCalls int
+	}{
+		{"no key passes through", "POST", "", user, nil, http.StatusCreated, 1},
+		{"GET is not tracked", "GET", "k", user, func(s *memoryStore) { s.err = errors.New("must not be called") }, http.StatusCreated, 1},
+		{"too long key", "POST", strings.Repeat("k", 256), user, nil, http.StatusBadRequest, 0},
+		{"unauthenticated", "POST", "k", nil, nil, http.StatusUnauthorized, 0},
+		{"in progress", "POST", "k", user, func(s *memoryStore) {
+			s.records["k"] = idempotency.Record{Fingerprint: requestFingerprint("POST", "/api/smart-devices", []byte(`{}`))}
+		}, http.StatusConflict, 0},
+		{"key reused with other body", "POST", "k", user, func(s *memoryStore) {
+			s.records["k"] = idempotency.Record{Fingerprint: "other", Completed: true}
+		}, http.StatusUnprocessableEntity, 0},
+		{"store unavailable", "PUT", "k", user, func(s *memoryStore) { s.err = errors.New("redis down") }, http.StatusCreated, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore()
+			if tt.prepare != nil {
+				tt.prepare(store)
+			}
+			next := &countingHandler{status: http.StatusCreated}
+			wrapped := NewIdempotencyMiddleware(&AuthMiddleware{}, store).Wrap(next.ServeHTTP)
+
+			w := httptest.NewRecorder()
+			wrapped(w, idempotentRequest(tt.method, tt.key, `{}`, tt.user))
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if next.calls != tt.wantCalls {
+				t.Errorf("handler called %d times, want %d", next.calls, tt.wantCalls)
+			}
+		})
+	}
+
+	t.Run("server error releases key", func(t *testing.T) {
+		store := newMemoryStore()
+		next := &countingHandler{status: http.StatusInternalServerError}
+		wrapped := NewIdempotencyMiddleware(&AuthMiddleware{}, store).Wrap(next.ServeHTTP)
+
+		wrapped(httptest.NewRecorder(), idempotentRequest("POST", "k", `{}`, user))
+		next.status = http.StatusCreated
+		w := httptest.NewRecorder()
+		wrapped(w, idempotentRequest("POST", "k", `{}`, user))
+
+		if next.calls != 2 || w.Code != http.StatusCreated {
+			t.Errorf("retry after 5xx: calls = %d, status = %d", next.calls, w.Code)
+		}
+		if len(store.released) != 1 {
+			t.Errorf("released = %v, want one key", store.released)
+		}
+	})
+
+	t.Run("client error is stored", func(t *testing.T) {
+		store := newMemoryStore()
+		next := &countingHandler{status: http.StatusBadRequest}
+		wrapped := NewIdempotencyMiddleware(&AuthMiddleware{}, store).Wrap(next.ServeHTTP)
+
+		wrapped(httptest.NewRecorder(), idempotentRequest("POST", "k", `{}`, user))
+		w := httptest.NewRecorder()
+		wrapped(w, idempotentRequest("POST", "k", `{}`, user))
+
+		if next.calls != 1 || w.Code != http.StatusBadRequest {
+			t.Errorf("replay of 4xx: calls = %d, status = %d", next.calls, w.Code)
+		}
+	})
+
+	t.Run("body over the route limit", func(t *testing.T) {
+		store := newMemoryStore()
+		next := &countingHandler{status: http.StatusCreated}
+		wrap := NewIdempotencyMiddleware(&AuthMiddleware{}, store).WrapLimit(8)
+
+		w := httptest.NewRecorder()
+		wrap(next.ServeHTTP)(w, idempotentRequest("POST", "k", `{"n":12345}`, user))
+		if w.Code != http.StatusRequestEntityTooLarge || next.calls != 0 || len(store.records) != 0 {
+			t.Errorf("oversized body: status = %d, calls = %d, records = %d", w.Code, next.calls, len(store.records))
+		}
+
+		w = httptest.NewRecorder()
+		wrap(next.ServeHTTP)(w, idempotentRequest("POST", "k", `{"n":1}`, user))
+		if w.Code != http.StatusCreated || next.calls != 1 || w.Body.String() != `{"echo":{"n":1}}` {
+			t.Errorf("body within limit: status = %d, calls = %d, body = %q", w.Code, next.calls, w.Body)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// valueJSON - значение колонки JSONB: JSON-текст value
+func valueJSON(value interface{}) (driver.Value, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// scanJSON читает колонку JSONB в dst (указатель на тип колонки).
+// NULL обнуляет dst: nil для списков и словарей, пустую структуру для остальных типов.
+func scanJSON(dst interface{}, src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		target := reflect.ValueOf(dst).Elem()
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported %T value: %T", dst, src)
+	}
+	return json.Unmarshal(data, dst)
+}
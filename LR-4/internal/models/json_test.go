@@ -0,0 +1,68 @@
+package models
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+func TestJSONColumnValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value driver.Valuer
+		want  driver.Value
+	}{
+		{"nil schema", AttributeSchema(nil), "[]"},
+		{"schema", AttributeSchema{{Key: "power", Label: "Мощность", Type: AttributeNumber}},
+			`[{"key":"power","label":"Мощность","type":"number"}]`},
+		{"nil specs", Specs(nil), "{}"},
+		{"specs", Specs{"power": 9.0}, `{"power":9}`},
+		{"nil line config", LineConfig(nil), nil},
+		{"line config", LineConfig{"socket": "E27"}, `{"socket":"E27"}`},
+		{"nil string list", StringList(nil), "[]"},
+		{"string list", StringList{"order.formed"}, `["order.formed"]`},
+		{"snapshot", DeviceSnapshot{Name: "Лампа"}, `{"name":"Лампа","model":"","vendor":"","avg_data_rate":0,` +
+			`"data_per_hour":0,"namespace_url":"","description":"","description_all":"","protocol":"",` +
+			`"is_active":false,"stock_quantity":0,"category_id":null,"tags":null,"specs":null}`},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.value.Value()
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Value() = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestJSONColumnScan(t *testing.T) {
+	// PostgreSQL отдает JSONB как []byte, SQLite - как string
+	for _, src := range []interface{}{[]byte(`{"power": 9}`), `{"power": 9}`} {
+		var specs Specs
+		if err := specs.Scan(src); err != nil || !reflect.DeepEqual(specs, Specs{"power": 9.0}) {
+			t.Errorf("Specs.Scan(%T) = %v, %v", src, specs, err)
+		}
+	}
+
+	list := StringList{"stale"}
+	if err := list.Scan(`["a","b"]`); err != nil || !reflect.DeepEqual(list, StringList{"a", "b"}) {
+		t.Errorf("StringList.Scan() = %v, %v", list, err)
+	}
+
+	// NULL обнуляет значение
+	config := LineConfig{"socket": "E27"}
+	if err := config.Scan(nil); err != nil || config != nil {
+		t.Errorf("LineConfig.Scan(nil) = %v, %v", config, err)
+	}
+	snapshot := DeviceSnapshot{Name: "Лампа"}
+	if err := snapshot.Scan(nil); err != nil || !reflect.DeepEqual(snapshot, DeviceSnapshot{}) {
+		t.Errorf("DeviceSnapshot.Scan(nil) = %+v, %v", snapshot, err)
+	}
+
+	var schema AttributeSchema
+	if err := schema.Scan(42); err == nil || err.Error() != "unsupported *models.AttributeSchema value: int" {
+		t.Errorf("AttributeSchema.Scan(42) error = %v", err)
+	}
+	if err := schema.Scan(`{"key": "power"}`); err == nil {
+		t.Error("AttributeSchema.Scan(object) error = nil")
+	}
+}
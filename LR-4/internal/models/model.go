@@ -1,6 +1,7 @@
 package models
 
 import (
+	"database/sql/driver"
 	"time"
 )
 
@@ -20,6 +21,7 @@ type SmartDevice struct {
 	ID             uint      `gorm:"primaryKey" json:"id"`
 	Name           string    `gorm:"size:200;not null" json:"name"`
 	Model          string    `gorm:"size:100" json:"model"`
+	Vendor         string    `gorm:"size:100;index" json:"vendor"`
 	AvgDataRate    float64   `json:"avg_data_rate"`
 	DataPerHour    float64   `json:"data_per_hour"`
 	NamespaceURL   string    `gorm:"size:500;null" json:"namespace_url"`
@@ -27,7 +29,131 @@ type SmartDevice struct {
 	DescriptionAll string    `gorm:"type:text" json:"description_all"`
 	Protocol       string    `gorm:"size:50" json:"protocol"`
 	IsActive       bool      `gorm:"default:true" json:"is_active"`
+	Version        uint      `gorm:"not null;default:1" json:"version"`
 	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	// Склад: ReservedQuantity - единицы в сформированных, но не завершенных заявках
+	StockQuantity    int `gorm:"not null;default:0;check:stock_quantity >= 0" json:"stock_quantity"`
+	ReservedQuantity int `gorm:"not null;default:0;check:reserved_quantity >= 0" json:"reserved_quantity"`
+
+	CategoryID *uint     `gorm:"index" json:"category_id"`
+	Category   *Category `gorm:"foreignKey:CategoryID;constraint:OnDelete:RESTRICT" json:"category,omitempty"`
+	Tags       []Tag     `gorm:"many2many:device_tags;constraint:OnDelete:CASCADE" json:"tags,omitempty"`
+	// Images - галерея; NamespaceURL всегда совпадает с URL основного изображения
+	Images []DeviceImage `gorm:"foreignKey:DeviceID;constraint:OnDelete:CASCADE" json:"images,omitempty"`
+
+	// Specs - характеристики по схеме категории (цоколь, люмены, тип батарейки...)
+	Specs Specs `gorm:"type:jsonb;not null;default:'{}'" json:"specs"`
+}
+
+// Category (table: categories) - дерево категорий устройств: хабы, освещение, розетки...
+type Category struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ParentID  *uint     `gorm:"index" json:"parent_id"`
+	Parent    *Category `gorm:"foreignKey:ParentID;constraint:OnDelete:RESTRICT" json:"-"`
+	Slug      string    `gorm:"size:50;uniqueIndex;not null" json:"slug"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	SortOrder int       `gorm:"not null;default:0" json:"sort_order"`
+	// TrafficCoefficient - множитель трафика устройств категории при завершении заявки
+	TrafficCoefficient float64 `gorm:"not null;default:1;check:traffic_coefficient > 0" json:"traffic_coefficient"`
+	// IsHub - устройства категории считаются хабами в правилах совместимости
+	IsHub bool `gorm:"not null;default:false" json:"is_hub"`
+	// Attributes - схема характеристик устройств категории; подкатегории наследуют схему предков
+	Attributes AttributeSchema `gorm:"type:jsonb;not null;default:'[]'" json:"attributes"`
+	CreatedAt  time.Time       `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Типы характеристик в схеме категории
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeInteger = "integer"
+	AttributeBoolean = "boolean"
+	AttributeEnum    = "enum"
+)
+
+// AttributeDef - одна характеристика в схеме категории
+type AttributeDef struct {
+	Key      string   `json:"key"`
+	Label    string   `json:"label"`
+	Type     string   `json:"type"`
+	Unit     string   `json:"unit,omitempty"`
+	Required bool     `json:"required,omitempty"`
+	Options  []string `json:"options,omitempty"` // допустимые значения enum
+	Min      *float64 `json:"min,omitempty"`     // границы number и integer
+	Max      *float64 `json:"max,omitempty"`
+}
+
+// AttributeSchema - схема характеристик категории, хранится в JSONB
+type AttributeSchema []AttributeDef
+
+func (a AttributeSchema) Value() (driver.Value, error) {
+	if a == nil {
+		return "[]", nil
+	}
+	return valueJSON([]AttributeDef(a))
+}
+
+func (a *AttributeSchema) Scan(value interface{}) error {
+	return scanJSON(a, value)
+}
+
+// Specs - значения характеристик устройства {key: значение}, хранятся в JSONB
+type Specs map[string]interface{}
+
+func (s Specs) Value() (driver.Value, error) {
+	if s == nil {
+		return "{}", nil
+	}
+	return valueJSON(map[string]interface{}(s))
+}
+
+func (s *Specs) Scan(value interface{}) error {
+	return scanJSON(s, value)
+}
+
+// Tag (table: tags) - свободные метки устройств; имя хранится в нижнем регистре
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:50;uniqueIndex;not null" json:"name"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// DeviceImage (table: device_images) - изображения устройства в MinIO.
+// У устройства не больше одного основного изображения (частичный уникальный индекс).
+type DeviceImage struct {
+	ID       uint `gorm:"primaryKey" json:"id"`
+	DeviceID uint `gorm:"not null;index;uniqueIndex:idx_device_images_primary,where:is_primary" json:"device_id"`
+	// ObjectName - имя объекта в bucket; пусто для внешних ссылок, перенесенных из namespace_url
+	ObjectName string    `gorm:"size:255" json:"object_name"`
+	URL        string    `gorm:"size:500;not null" json:"url"`
+	AltText    string    `gorm:"size:300" json:"alt_text"`
+	SortOrder  int       `gorm:"not null;default:0" json:"sort_order"`
+	IsPrimary  bool      `gorm:"not null;default:false" json:"is_primary"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	// Проверенный тип и размеры оригинала; пусто/0 у перенесенных изображений
+	ContentType string `gorm:"size:50" json:"content_type"`
+	Width       int    `gorm:"not null;default:0" json:"width"`
+	Height      int    `gorm:"not null;default:0" json:"height"`
+	// Уменьшенные копии лежат в bucket рядом с оригиналом
+	ThumbnailObject string `gorm:"size:255" json:"thumbnail_object"`
+	ThumbnailURL    string `gorm:"size:500" json:"thumbnail_url"`
+	MediumObject    string `gorm:"size:255" json:"medium_object"`
+	MediumURL       string `gorm:"size:500" json:"medium_url"`
+}
+
+// DeviceImageUpload (table: device_image_uploads) - выданная ссылка на прямую загрузку в MinIO.
+// Файл лежит во временном объекте, пока загрузку не подтвердят; неподтвержденные удаляются после ExpiresAt.
+type DeviceImageUpload struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	DeviceID    uint         `gorm:"not null;index" json:"device_id"`
+	Device      *SmartDevice `gorm:"foreignKey:DeviceID;constraint:OnDelete:CASCADE" json:"-"`
+	ObjectName  string       `gorm:"size:255;not null;uniqueIndex" json:"object_name"`
+	CreatedByID *uint        `json:"created_by_id"`
+	CreatedBy   *Client      `gorm:"foreignKey:CreatedByID;constraint:OnDelete:SET NULL" json:"-"`
+	ExpiresAt   time.Time    `gorm:"not null;index" json:"expires_at"`
+	CreatedAt   time.Time    `gorm:"autoCreateTime" json:"created_at"`
 }
 
 // SmartOrder (table: smart_orders) - заявки на установку
@@ -43,17 +169,231 @@ type SmartOrder struct {
 	ModeratorID *uint      `json:"moderator_id,omitempty"`
 	Moderator   Client     `gorm:"foreignKey:ModeratorID;constraint:OnDelete:RESTRICT" json:"moderator,omitempty"`
 
-	Address      string  `gorm:"size:500" json:"address"`
-	TotalTraffic float64 `json:"total_traffic"`
+	Address        string            `gorm:"size:500" json:"address"`
+	AddressDetails StructuredAddress `gorm:"embedded;embeddedPrefix:address_" json:"address_details"`
+	TotalTraffic   float64           `json:"total_traffic"`
+	// RejectionReason - причина отклонения заявки модератором
+	RejectionReason string `gorm:"size:500" json:"rejection_reason,omitempty"`
+	Version         uint   `gorm:"not null;default:1" json:"version"`
+
+	// UpdatedAt - последнее изменение заявки или ее позиций
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	// DraftWarnedAt - когда клиента предупредили об автоудалении черновика
+	DraftWarnedAt *time.Time `json:"draft_warned_at,omitempty"`
 }
 
-// OrderItem (table: order_items) - устройства в заявке
+// OrderItem (table: order_items) - строки заявки: устройство, количество и место установки.
+// Одно устройство можно разбить на несколько строк с разными помещениями.
 type OrderItem struct {
-	OrderID   uint      `gorm:"primaryKey" json:"order_id"`
-	DeviceID  uint      `gorm:"primaryKey" json:"device_id"`
-	Quantity  int       `gorm:"default:1;not null" json:"quantity"`
+	ID       uint `gorm:"primaryKey" json:"id"`
+	OrderID  uint `gorm:"not null;index" json:"order_id"`
+	DeviceID uint `gorm:"not null;index" json:"device_id"`
+	Quantity int  `gorm:"default:1;not null" json:"quantity"`
+
+	// Room - помещение или место установки, например "Кухня"
+	Room           string     `gorm:"size:100" json:"room"`
+	PlacementNotes string     `gorm:"size:500" json:"placement_notes"`
+	Config         LineConfig `gorm:"type:jsonb" json:"config"`
+
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 
 	Order  SmartOrder  `gorm:"foreignKey:OrderID;constraint:OnDelete:RESTRICT" json:"order"`
 	Device SmartDevice `gorm:"foreignKey:DeviceID;constraint:OnDelete:RESTRICT" json:"device"`
 }
+
+// LineConfig - настройки единицы устройства в строке заявки (например, тип цоколя лампы).
+// Хранится в JSONB.
+type LineConfig map[string]string
+
+func (c LineConfig) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	return valueJSON(map[string]string(c))
+}
+
+func (c *LineConfig) Scan(value interface{}) error {
+	return scanJSON(c, value)
+}
+
+// OrderStatusHistory (table: order_status_histories) - история смены статусов заявок
+type OrderStatusHistory struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	OrderID     uint       `gorm:"not null;index" json:"order_id"`
+	Order       SmartOrder `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"-"`
+	FromStatus  string     `gorm:"type:varchar(20)" json:"from_status"`
+	ToStatus    string     `gorm:"type:varchar(20);not null" json:"to_status"`
+	ChangedByID *uint      `json:"changed_by_id,omitempty"` // nil - системное действие
+	ChangedBy   *Client    `gorm:"foreignKey:ChangedByID;constraint:OnDelete:SET NULL" json:"changed_by,omitempty"`
+	Comment     string     `gorm:"size:500" json:"comment,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// OrderComment (table: order_comments) - переписка клиента и модератора по заявке
+type OrderComment struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	OrderID   uint       `gorm:"not null;index" json:"order_id"`
+	Order     SmartOrder `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"-"`
+	AuthorID  *uint      `json:"author_id,omitempty"`
+	Author    *Client    `gorm:"foreignKey:AuthorID;constraint:OnDelete:SET NULL" json:"author,omitempty"`
+	Body      string     `gorm:"size:2000;not null" json:"body"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Действия, после которых сохраняется ревизия устройства
+const (
+	RevisionCreate     = "create"
+	RevisionUpdate     = "update"
+	RevisionDeactivate = "deactivate"
+	RevisionRevert     = "revert"
+	RevisionBaseline   = "baseline" // исходное состояние устройств, созданных до появления истории
+)
+
+// DeviceRevision (table: device_revisions) - полная копия устройства после каждого изменения каталога
+type DeviceRevision struct {
+	ID       uint        `gorm:"primaryKey" json:"id"`
+	DeviceID uint        `gorm:"not null;uniqueIndex:idx_device_revision" json:"device_id"`
+	Device   SmartDevice `gorm:"foreignKey:DeviceID;constraint:OnDelete:CASCADE" json:"-"`
+	// Revision - номер ревизии внутри устройства: 1, 2, 3...
+	Revision uint   `gorm:"not null;uniqueIndex:idx_device_revision" json:"revision"`
+	Action   string `gorm:"type:varchar(20);not null" json:"action"`
+	// RevertedFrom - номер ревизии, к которой вернулись (только для revert)
+	RevertedFrom  *uint          `json:"reverted_from,omitempty"`
+	DeviceVersion uint           `gorm:"not null" json:"device_version"`
+	Snapshot      DeviceSnapshot `gorm:"type:jsonb;not null" json:"snapshot"`
+	ChangedByID   *uint          `json:"changed_by_id,omitempty"` // nil - системное действие
+	ChangedBy     *Client        `gorm:"foreignKey:ChangedByID;constraint:OnDelete:SET NULL" json:"changed_by,omitempty"`
+	CreatedAt     time.Time      `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// DeviceSnapshot - состояние устройства в ревизии, хранится в JSONB.
+// Резерв не входит: он меняется заявками, а не правками каталога.
+type DeviceSnapshot struct {
+	Name           string                 `json:"name"`
+	Model          string                 `json:"model"`
+	Vendor         string                 `json:"vendor"`
+	AvgDataRate    float64                `json:"avg_data_rate"`
+	DataPerHour    float64                `json:"data_per_hour"`
+	NamespaceURL   string                 `json:"namespace_url"`
+	Description    string                 `json:"description"`
+	DescriptionAll string                 `json:"description_all"`
+	Protocol       string                 `json:"protocol"`
+	IsActive       bool                   `json:"is_active"`
+	StockQuantity  int                    `json:"stock_quantity"`
+	CategoryID     *uint                  `json:"category_id"`
+	Tags           []string               `json:"tags"`
+	Specs          map[string]interface{} `json:"specs"`
+}
+
+func (s DeviceSnapshot) Value() (driver.Value, error) {
+	return valueJSON(s)
+}
+
+func (s *DeviceSnapshot) Scan(value interface{}) error {
+	return scanJSON(s, value)
+}
+
+// StructuredAddress - структурированный адрес установки (встраивается в заявки и адресную книгу)
+type StructuredAddress struct {
+	Region     string   `gorm:"size:100" json:"region"`
+	City       string   `gorm:"size:100" json:"city"`
+	Street     string   `gorm:"size:150" json:"street"`
+	House      string   `gorm:"size:20" json:"house"`
+	Apartment  string   `gorm:"size:10" json:"apartment"`
+	PostalCode string   `gorm:"size:6" json:"postal_code"`
+	Notes      string   `gorm:"size:500" json:"notes"`
+	Latitude   *float64 `json:"latitude,omitempty"`
+	Longitude  *float64 `json:"longitude,omitempty"`
+}
+
+// ClientAddress (table: client_addresses) - адресная книга клиента
+type ClientAddress struct {
+	ID        uint              `gorm:"primaryKey" json:"id"`
+	ClientID  uint              `gorm:"not null;index" json:"client_id"`
+	Client    Client            `gorm:"foreignKey:ClientID;constraint:OnDelete:CASCADE" json:"-"`
+	Label     string            `gorm:"size:100" json:"label"`
+	Address   StructuredAddress `gorm:"embedded" json:"address"`
+	IsDefault bool              `gorm:"default:false" json:"is_default"`
+	CreatedAt time.Time         `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// StringList - список строк, хранится в JSONB
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	return valueJSON([]string(l))
+}
+
+func (l *StringList) Scan(value interface{}) error {
+	return scanJSON(l, value)
+}
+
+// WebhookSubscription (table: webhook_subscriptions) - подписка внешней системы на события
+type WebhookSubscription struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	URL         string     `gorm:"size:500;not null" json:"url"`
+	Secret      string     `gorm:"size:128;not null" json:"-"`
+	Events      StringList `gorm:"type:jsonb;not null" json:"events"` // "*" - все события
+	Description string     `gorm:"size:255" json:"description"`
+	IsActive    bool       `gorm:"default:true" json:"is_active"`
+	CreatedByID *uint      `json:"created_by_id,omitempty"`
+	CreatedBy   *Client    `gorm:"foreignKey:CreatedByID;constraint:OnDelete:SET NULL" json:"-"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// WebhookDelivery (table: webhook_deliveries) - доставка события одной подписке.
+// Статусы: pending, succeeded, failed.
+type WebhookDelivery struct {
+	ID             uint                `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint                `gorm:"not null;index" json:"subscription_id"`
+	Subscription   WebhookSubscription `gorm:"foreignKey:SubscriptionID;constraint:OnDelete:CASCADE" json:"-"`
+	Event          string              `gorm:"type:varchar(50);not null" json:"event"`
+	Payload        string              `gorm:"type:jsonb;not null" json:"payload"`
+	Status         string              `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	Attempts       int                 `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  *time.Time          `gorm:"index" json:"next_attempt_at,omitempty"`
+	LastError      string              `gorm:"size:500" json:"last_error,omitempty"`
+	DeliveredAt    *time.Time          `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time           `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time           `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// WebhookAttempt (table: webhook_attempts) - журнал попыток доставки
+type WebhookAttempt struct {
+	ID           uint            `gorm:"primaryKey" json:"id"`
+	DeliveryID   uint            `gorm:"not null;index" json:"delivery_id"`
+	Delivery     WebhookDelivery `gorm:"foreignKey:DeliveryID;constraint:OnDelete:CASCADE" json:"-"`
+	Number       int             `gorm:"not null" json:"number"`
+	StatusCode   int             `json:"status_code"` // 0 - ответ не получен
+	ResponseBody string          `gorm:"size:1000" json:"response_body,omitempty"`
+	Error        string          `gorm:"size:500" json:"error,omitempty"`
+	DurationMs   int64           `json:"duration_ms"`
+	CreatedAt    time.Time       `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Notification (table: notifications) - уведомление во входящих пользователя
+type Notification struct {
+	ID        uint        `gorm:"primaryKey" json:"id"`
+	ClientID  uint        `gorm:"not null;index" json:"client_id"`
+	Client    Client      `gorm:"foreignKey:ClientID;constraint:OnDelete:CASCADE" json:"-"`
+	Type      string      `gorm:"type:varchar(30);not null" json:"type"`
+	Title     string      `gorm:"size:200;not null" json:"title"`
+	Body      string      `gorm:"size:1000" json:"body"`
+	OrderID   *uint       `gorm:"index" json:"order_id,omitempty"`
+	Order     *SmartOrder `gorm:"foreignKey:OrderID;constraint:OnDelete:SET NULL" json:"-"`
+	ReadAt    *time.Time  `json:"read_at,omitempty"`
+	CreatedAt time.Time   `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// NotificationPreference (table: notification_preferences) - отключенные пользователем типы уведомлений.
+// Нет записи - включены все типы.
+type NotificationPreference struct {
+	ClientID  uint       `gorm:"primaryKey;autoIncrement:false" json:"client_id"`
+	Client    Client     `gorm:"foreignKey:ClientID;constraint:OnDelete:CASCADE" json:"-"`
+	Disabled  StringList `gorm:"type:jsonb;not null" json:"disabled"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,217 @@
+package notifications
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Типы уведомлений; каждый пользователь может отключить любой из них
+const (
+	TypeOrderFormed    = "order_formed"    // модераторам: клиент сформировал заявку
+	TypeOrderCompleted = "order_completed" // клиенту: заявка выполнена
+	TypeOrderRejected  = "order_rejected"  // клиенту: заявка отклонена, с причиной
+	TypeDraftExpiring  = "draft_expiring"  // клиенту: черновик скоро будет удален
+	TypeOrderComment   = "order_comment"   // другой стороне заявки: новый комментарий
+)
+
+// Длина текста комментария в теле уведомления
+const commentPreviewLength = 300
+
+// Types - все типы в порядке показа в настройках
+var Types = []string{
+	TypeOrderFormed,
+	TypeOrderCompleted,
+	TypeOrderRejected,
+	TypeDraftExpiring,
+	TypeOrderComment,
+}
+
+// IsKnownType проверяет тип из запроса настроек
+func IsKnownType(notificationType string) bool {
+	for _, known := range Types {
+		if known == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderTransition создает уведомления о переходе заявки в той же транзакции.
+// comment - комментарий к переходу (причина отклонения).
+func OrderTransition(tx *gorm.DB, order models.SmartOrder, comment string) error {
+	orderID := order.ID
+	switch order.Status {
+	case "formed":
+		return notify(tx, moderators(tx), models.Notification{
+			Type:    TypeOrderFormed,
+			Title:   fmt.Sprintf("Новая заявка №%d", order.ID),
+			Body:    "Адрес установки: " + order.Address,
+			OrderID: &orderID,
+		})
+	case "completed":
+		return notify(tx, client(tx, order.ClientID), models.Notification{
+			Type:    TypeOrderCompleted,
+			Title:   fmt.Sprintf("Заявка №%d выполнена", order.ID),
+			Body:    fmt.Sprintf("Общий трафик устройств: %.2f Кб/ч", order.TotalTraffic),
+			OrderID: &orderID,
+		})
+	case "rejected":
+		return notify(tx, client(tx, order.ClientID), models.Notification{
+			Type:    TypeOrderRejected,
+			Title:   fmt.Sprintf("Заявка №%d отклонена", order.ID),
+			Body:    "Причина: " + comment,
+			OrderID: &orderID,
+		})
+	}
+	return nil
+}
+
+// OrderComment создает уведомления о комментарии к заявке в той же транзакции.
+// Комментарий клиента получает модератор заявки (если назначен - только он, иначе все),
+// комментарий модератора - клиент. Автор уведомление не получает.
+func OrderComment(tx *gorm.DB, order models.SmartOrder, comment models.OrderComment, authorName string) error {
+	recipients := client(tx, order.ClientID)
+	if comment.AuthorID != nil && *comment.AuthorID == order.ClientID {
+		recipients = moderators(tx)
+		if order.ModeratorID != nil {
+			recipients = recipients.Where("id = ?", *order.ModeratorID)
+		}
+	}
+	if comment.AuthorID != nil {
+		recipients = recipients.Where("id <> ?", *comment.AuthorID)
+	}
+
+	orderID := order.ID
+	return notify(tx, recipients, models.Notification{
+		Type:    TypeOrderComment,
+		Title:   fmt.Sprintf("Комментарий к заявке №%d", order.ID),
+		Body:    authorName + ": " + preview(comment.Body, commentPreviewLength),
+		OrderID: &orderID,
+	})
+}
+
+// preview обрезает текст до limit символов
+func preview(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// moderators - активные модераторы
+func moderators(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&models.Client{}).Where("is_moderator = ? AND is_active = ?", true, true)
+}
+
+// client - один пользователь
+func client(tx *gorm.DB, clientID uint) *gorm.DB {
+	return tx.Model(&models.Client{}).Where("id = ?", clientID)
+}
+
+// notify создает уведомление для получателей из запроса, у которых тип не отключен
+func notify(tx *gorm.DB, recipients *gorm.DB, template models.Notification) error {
+	var clientIDs []uint
+	if err := recipients.Order("id").Pluck("id", &clientIDs).Error; err != nil {
+		return fmt.Errorf("find notification recipients: %w", err)
+	}
+	if len(clientIDs) == 0 {
+		return nil
+	}
+
+	var preferences []models.NotificationPreference
+	if err := tx.Where("client_id IN ?", clientIDs).Find(&preferences).Error; err != nil {
+		return fmt.Errorf("load notification preferences: %w", err)
+	}
+	disabled := make(map[uint]bool, len(preferences))
+	for _, preference := range preferences {
+		disabled[preference.ClientID] = !preferenceMap(preference.Disabled)[template.Type]
+	}
+
+	var notifications []models.Notification
+	for _, clientID := range clientIDs {
+		if disabled[clientID] {
+			continue
+		}
+		notification := template
+		notification.ClientID = clientID
+		notifications = append(notifications, notification)
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+	return tx.Create(&notifications).Error
+}
+
+// Preferences - включен ли каждый тип уведомлений у пользователя
+func Preferences(db *gorm.DB, clientID uint) (map[string]bool, error) {
+	var preference models.NotificationPreference
+	result := db.Where("client_id = ?", clientID).Limit(1).Find(&preference)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return preferenceMap(preference.Disabled), nil
+}
+
+// SetPreferences применяет изменения {тип: включен}; типы, которых нет в changes, не меняются
+func SetPreferences(db *gorm.DB, clientID uint, changes map[string]bool) (map[string]bool, error) {
+	var enabled map[string]bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if enabled, err = Preferences(tx.Clauses(clause.Locking{Strength: "UPDATE"}), clientID); err != nil {
+			return err
+		}
+		for notificationType, on := range changes {
+			enabled[notificationType] = on
+		}
+
+		disabled := models.StringList{}
+		for _, notificationType := range Types {
+			if !enabled[notificationType] {
+				disabled = append(disabled, notificationType)
+			}
+		}
+		return tx.Save(&models.NotificationPreference{ClientID: clientID, Disabled: disabled}).Error
+	})
+	return enabled, err
+}
+
+func preferenceMap(disabled models.StringList) map[string]bool {
+	enabled := make(map[string]bool, len(Types))
+	for _, notificationType := range Types {
+		enabled[notificationType] = true
+	}
+	for _, notificationType := range disabled {
+		if _, ok := enabled[notificationType]; ok {
+			enabled[notificationType] = false
+		}
+	}
+	return enabled
+}
+
+// DraftNotifier - предупреждение об удалении черновика во входящие клиента (maintenance.Notifier)
+type DraftNotifier struct {
+	db *gorm.DB
+}
+
+func NewDraftNotifier(db *gorm.DB) *DraftNotifier {
+	return &DraftNotifier{db: db}
+}
+
+func (n *DraftNotifier) DraftExpiring(order models.SmartOrder, deleteAt time.Time) error {
+	orderID := order.ID
+	log.Printf("⏰ Черновик %d клиента %s будет удален %s, если его не изменить",
+		order.ID, order.Client.Username, deleteAt.Format("2006-01-02 15:04"))
+	return notify(n.db, client(n.db, order.ClientID), models.Notification{
+		Type:    TypeDraftExpiring,
+		Title:   fmt.Sprintf("Черновик №%d скоро будет удален", order.ID),
+		Body:    fmt.Sprintf("Черновик не изменялся долгое время и будет удален %s. Измените его, чтобы сохранить.", deleteAt.Format("02.01.2006")),
+		OrderID: &orderID,
+	})
+}
@@ -0,0 +1,283 @@
+package notifications
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"smartdevices/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testDBSeq int64
+
+// testUsers - клиент, второй клиент, два активных модератора и отключенный модератор
+type testUsers struct {
+	client, other, moderator, second, inactive models.Client
+}
+
+func newTestDB(t *testing.T) (*gorm.DB, testUsers) {
+	t.Helper()
+	name := fmt.Sprintf("file:notifications%d?mode=memory&cache=shared", atomic.AddInt64(&testDBSeq, 1))
+	db, err := gorm.Open(sqlite.Open(name), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	err = db.AutoMigrate(&models.Client{}, &models.SmartOrder{}, &models.OrderComment{},
+		&models.Notification{}, &models.NotificationPreference{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := testUsers{
+		client:    models.Client{Username: "client", Password: "x", IsActive: true},
+		other:     models.Client{Username: "other", Password: "x", IsActive: true},
+		moderator: models.Client{Username: "moderator", Password: "x", IsModerator: true, IsActive: true},
+		second:    models.Client{Username: "second", Password: "x", IsModerator: true, IsActive: true},
+		inactive:  models.Client{Username: "inactive", Password: "x", IsModerator: true, IsActive: true},
+	}
+	for _, user := range []*models.Client{&users.client, &users.other, &users.moderator, &users.second, &users.inactive} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Model(&users.inactive).Update("is_active", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, users
+}
+
+// inbox - получатели уведомлений типа notificationType по возрастанию id
+func inbox(t *testing.T, db *gorm.DB, notificationType string) ([]uint, []models.Notification) {
+	t.Helper()
+	var notifications []models.Notification
+	if err := db.Where("type = ?", notificationType).Order("client_id").Find(&notifications).Error; err != nil {
+		t.Fatal(err)
+	}
+	recipients := []uint{}
+	for _, notification := range notifications {
+		recipients = append(recipients, notification.ClientID)
+	}
+	return recipients, notifications
+}
+
+func TestOrderTransitionRecipients(t *testing.T) {
+	tests := []struct {
+		status     string
+		wantType   string
+		recipients func(testUsers) []uint
+		wantBody   string
+	}{
+		{"formed", TypeOrderFormed, func(u testUsers) []uint { return []uint{u.moderator.ID, u.second.ID} }, "Адрес установки: ул. Ленина, 1"},
+		{"completed", TypeOrderCompleted, func(u testUsers) []uint { return []uint{u.client.ID} }, "Общий трафик устройств: 12.50 Кб/ч"},
+		{"rejected", TypeOrderRejected, func(u testUsers) []uint { return []uint{u.client.ID} }, "Причина: Неверный адрес"},
+		{"deleted", "", nil, ""},
+		{"draft", "", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			db, users := newTestDB(t)
+			order := models.SmartOrder{Status: tt.status, ClientID: users.client.ID, Address: "ул. Ленина, 1", TotalTraffic: 12.5}
+			if err := db.Create(&order).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			if err := OrderTransition(db, order, "Неверный адрес"); err != nil {
+				t.Fatal(err)
+			}
+
+			var count int64
+			db.Model(&models.Notification{}).Count(&count)
+			if tt.wantType == "" {
+				if count != 0 {
+					t.Errorf("%s created %d notifications, want none", tt.status, count)
+				}
+				return
+			}
+
+			recipients, notifications := inbox(t, db, tt.wantType)
+			if want := tt.recipients(users); !reflect.DeepEqual(recipients, want) || int64(len(want)) != count {
+				t.Fatalf("recipients = %v (%d total), want %v", recipients, count, want)
+			}
+			for _, notification := range notifications {
+				if notification.Body != tt.wantBody || notification.OrderID == nil || *notification.OrderID != order.ID ||
+					!strings.Contains(notification.Title, fmt.Sprint(order.ID)) {
+					t.Errorf("notification = %+v", notification)
+				}
+			}
+		})
+	}
+}
+
+// Пользователь, отключивший тип, не получает уведомления этого типа, остальные типы приходят
+func TestDisabledTypesAreSkipped(t *testing.T) {
+	db, users := newTestDB(t)
+	if _, err := SetPreferences(db, users.moderator.ID, map[string]bool{TypeOrderFormed: false}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SetPreferences(db, users.client.ID, map[string]bool{TypeOrderRejected: false, TypeOrderComment: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	formed := models.SmartOrder{Status: "formed", ClientID: users.client.ID}
+	if err := db.Create(&formed).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := OrderTransition(db, formed, ""); err != nil {
+		t.Fatal(err)
+	}
+	if recipients, _ := inbox(t, db, TypeOrderFormed); !reflect.DeepEqual(recipients, []uint{users.second.ID}) {
+		t.Errorf("order_formed recipients = %v, want only %d", recipients, users.second.ID)
+	}
+
+	formed.Status = "rejected"
+	if err := OrderTransition(db, formed, "Нет в наличии"); err != nil {
+		t.Fatal(err)
+	}
+	formed.Status = "completed"
+	if err := OrderTransition(db, formed, ""); err != nil {
+		t.Fatal(err)
+	}
+	if recipients, _ := inbox(t, db, TypeOrderRejected); len(recipients) != 0 {
+		t.Errorf("order_rejected recipients = %v, want none", recipients)
+	}
+	if recipients, _ := inbox(t, db, TypeOrderCompleted); !reflect.DeepEqual(recipients, []uint{users.client.ID}) {
+		t.Errorf("order_completed recipients = %v, want client", recipients)
+	}
+
+	// Все типы снова включены - уведомление приходит
+	if _, err := SetPreferences(db, users.client.ID, map[string]bool{TypeOrderRejected: true}); err != nil {
+		t.Fatal(err)
+	}
+	formed.Status = "rejected"
+	if err := OrderTransition(db, formed, "Нет в наличии"); err != nil {
+		t.Fatal(err)
+	}
+	if recipients, _ := inbox(t, db, TypeOrderRejected); !reflect.DeepEqual(recipients, []uint{users.client.ID}) {
+		t.Errorf("order_rejected recipients after enabling = %v, want client", recipients)
+	}
+}
+
+func TestPreferences(t *testing.T) {
+	db, users := newTestDB(t)
+
+	enabled, err := Preferences(db, users.client.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, notificationType := range Types {
+		if !enabled[notificationType] {
+			t.Errorf("%s is disabled by default", notificationType)
+		}
+	}
+
+	enabled, err = SetPreferences(db, users.client.ID, map[string]bool{TypeDraftExpiring: false, TypeOrderComment: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enabled[TypeDraftExpiring] || enabled[TypeOrderComment] || !enabled[TypeOrderCompleted] {
+		t.Errorf("SetPreferences() = %v", enabled)
+	}
+
+	// Изменения накапливаются: неуказанные типы не меняются
+	if _, err := SetPreferences(db, users.client.ID, map[string]bool{TypeOrderComment: true}); err != nil {
+		t.Fatal(err)
+	}
+	var preference models.NotificationPreference
+	db.First(&preference, "client_id = ?", users.client.ID)
+	if !reflect.DeepEqual(preference.Disabled, models.StringList{TypeDraftExpiring}) {
+		t.Errorf("stored disabled = %v, want [%s]", preference.Disabled, TypeDraftExpiring)
+	}
+}
+
+func TestOrderCommentRecipients(t *testing.T) {
+	tests := []struct {
+		name       string
+		author     func(testUsers) models.Client
+		assigned   bool
+		recipients func(testUsers) []uint
+	}{
+		{"client to all moderators", func(u testUsers) models.Client { return u.client }, false,
+			func(u testUsers) []uint { return []uint{u.moderator.ID, u.second.ID} }},
+		{"client to assigned moderator", func(u testUsers) models.Client { return u.client }, true,
+			func(u testUsers) []uint { return []uint{u.moderator.ID} }},
+		{"moderator to client", func(u testUsers) models.Client { return u.second }, true,
+			func(u testUsers) []uint { return []uint{u.client.ID} }},
+		{"assigned moderator to client", func(u testUsers) models.Client { return u.moderator }, true,
+			func(u testUsers) []uint { return []uint{u.client.ID} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, users := newTestDB(t)
+			order := models.SmartOrder{Status: "formed", ClientID: users.client.ID}
+			if tt.assigned {
+				order.ModeratorID = &users.moderator.ID
+			}
+			if err := db.Create(&order).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			author := tt.author(users)
+			comment := models.OrderComment{OrderID: order.ID, AuthorID: &author.ID, Body: "Позвоните за час"}
+			if err := OrderComment(db, order, comment, author.Username); err != nil {
+				t.Fatal(err)
+			}
+
+			recipients, notifications := inbox(t, db, TypeOrderComment)
+			if want := tt.recipients(users); !reflect.DeepEqual(recipients, want) {
+				t.Fatalf("recipients = %v, want %v", recipients, want)
+			}
+			if body := notifications[0].Body; body != author.Username+": Позвоните за час" {
+				t.Errorf("body = %q", body)
+			}
+		})
+	}
+}
+
+func TestOrderCommentPreview(t *testing.T) {
+	db, users := newTestDB(t)
+	order := models.SmartOrder{Status: "formed", ClientID: users.client.ID}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	comment := models.OrderComment{OrderID: order.ID, AuthorID: &users.moderator.ID, Body: strings.Repeat("я", 2000)}
+	if err := OrderComment(db, order, comment, "moderator"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, notifications := inbox(t, db, TypeOrderComment)
+	body := []rune(notifications[0].Body)
+	if len(body) != len("moderator: ")+commentPreviewLength || body[len(body)-1] != '…' {
+		t.Errorf("body has %d characters: %q...", len(body), string(body[:20]))
+	}
+}
+
+func TestDraftNotifier(t *testing.T) {
+	db, users := newTestDB(t)
+	order := models.SmartOrder{Status: "draft", ClientID: users.client.ID}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	deleteAt := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+	if err := NewDraftNotifier(db).DraftExpiring(order, deleteAt); err != nil {
+		t.Fatal(err)
+	}
+	recipients, notifications := inbox(t, db, TypeDraftExpiring)
+	if !reflect.DeepEqual(recipients, []uint{users.client.ID}) || !strings.Contains(notifications[0].Body, "08.03.2026") {
+		t.Errorf("draft_expiring = %+v", notifications)
+	}
+}
@@ -0,0 +1,121 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Полнотекстовый поиск по каталогу (конфигурация russian): словоформы
+// "лампочки"/"лампочка" совпадают, последнее слово ищется по префиксу,
+// чтобы поиск работал по мере ввода.
+
+const (
+	// VectorSQL - выражение сгенерированной колонки smart_devices.search_vector.
+	// Имя и модель важнее описаний при ранжировании.
+	VectorSQL = `setweight(to_tsvector('russian', coalesce(name, '')), 'A') ||
+		setweight(to_tsvector('russian', coalesce(model, '')), 'A') ||
+		setweight(to_tsvector('russian', coalesce(description, '')), 'B') ||
+		setweight(to_tsvector('russian', coalesce(description_all, '')), 'C')`
+
+	// RankOrder - сортировка по релевантности; требует Apply
+	RankOrder = "search_rank DESC"
+
+	maxTerms = 10
+
+	// Маркеры ts_headline; заменяются на <mark> после экранирования текста
+	markStart = "⟦"
+	markStop  = "⟧"
+)
+
+// Query - разобранная поисковая строка
+type Query struct {
+	tsquery string
+}
+
+// Parse превращает ввод пользователя в tsquery: слова через &, каждое с префиксным поиском.
+// Спецсимволы tsquery отбрасываются. false - в строке нет слов.
+func Parse(text string) (Query, bool) {
+	terms := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(terms) == 0 {
+		return Query{}, false
+	}
+	if len(terms) > maxTerms {
+		terms = terms[:maxTerms]
+	}
+	for i, term := range terms {
+		terms[i] = term + ":*"
+	}
+	return Query{tsquery: strings.Join(terms, " & ")}, true
+}
+
+// Apply оставляет подходящие устройства и добавляет колонку search_rank для RankOrder.
+// query должен быть построен от models.SmartDevice.
+func (q Query) Apply(query *gorm.DB) *gorm.DB {
+	return q.WithRank(q.Filter(query))
+}
+
+// WithRank добавляет колонку search_rank к запросу, уже отфильтрованному Filter
+func (q Query) WithRank(query *gorm.DB) *gorm.DB {
+	return query.
+		Select("smart_devices.*, ts_rank_cd(smart_devices.search_vector, to_tsquery('russian', ?)) AS search_rank", q.tsquery)
+}
+
+// Filter только оставляет подходящие устройства - для агрегатов, где ранг не нужен
+func (q Query) Filter(query *gorm.DB) *gorm.DB {
+	return query.Where("smart_devices.search_vector @@ to_tsquery('russian', ?)", q.tsquery)
+}
+
+// Highlight - найденные фрагменты; HTML-безопасный текст, совпадения в <mark>
+type Highlight struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Highlights строит фрагменты для уже выбранной страницы устройств.
+// Отдельный запрос: ts_headline дорогой, считать его для всей выборки незачем.
+func (q Query) Highlights(db *gorm.DB, ids []uint) (map[uint]Highlight, error) {
+	highlights := make(map[uint]Highlight, len(ids))
+	if len(ids) == 0 {
+		return highlights, nil
+	}
+
+	nameOptions := "HighlightAll=true, StartSel=" + markStart + ", StopSel=" + markStop
+	textOptions := "MaxFragments=2, MaxWords=25, MinWords=8, FragmentDelimiter=\" … \", StartSel=" +
+		markStart + ", StopSel=" + markStop
+
+	var rows []struct {
+		ID          uint
+		Name        string
+		Description string
+	}
+	err := db.Table("smart_devices").
+		Select(`id,
+			ts_headline('russian', name, to_tsquery('russian', ?), ?) AS name,
+			ts_headline('russian', coalesce(nullif(description_all, ''), description), to_tsquery('russian', ?), ?) AS description`,
+			q.tsquery, nameOptions, q.tsquery, textOptions).
+		Where("id IN ?", ids).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		highlights[row.ID] = Highlight{
+			Name:        markup(row.Name),
+			Description: markup(row.Description),
+		}
+	}
+	return highlights, nil
+}
+
+// markup экранирует текст и заменяет маркеры совпадений на <mark>
+func markup(text string) string {
+	escaped := html.EscapeString(text)
+	escaped = strings.ReplaceAll(escaped, markStart, "<mark>")
+	return strings.ReplaceAll(escaped, markStop, "</mark>")
+}
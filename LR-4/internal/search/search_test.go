@@ -0,0 +1,62 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+		ok   bool
+	}{
+		{"single word", "Лампа", "лампа:*", true},
+		{"several words", "умная лампа E27", "умная:* & лампа:* & e27:*", true},
+		{"extra spaces", "  хаб   zigbee  ", "хаб:* & zigbee:*", true},
+		{"tsquery operators dropped", "лампа & !датчик | (реле) <-> 'x':*", "лампа:* & датчик:* & реле:* & x:*", true},
+		{"sql quotes dropped", "'; DROP TABLE smart_devices; --", "drop:* & table:* & smart:* & devices:*", true},
+		{"punctuation splits words", "wi-fi,розетка", "wi:* & fi:* & розетка:*", true},
+		{"empty", "", "", false},
+		{"only symbols", " &|!():*'- ", "", false},
+		{"term limit", "a b c d e f g h i j k l", "a:* & b:* & c:* & d:* & e:* & f:* & g:* & h:* & i:* & j:*", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Parse(tt.text)
+			if ok != tt.ok || got.tsquery != tt.want {
+				t.Errorf("Parse(%q) = %q, %v, want %q, %v", tt.text, got.tsquery, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseTermLimit(t *testing.T) {
+	got, _ := Parse(strings.Repeat("слово ", 3*maxTerms))
+	if terms := strings.Count(got.tsquery, ":*"); terms != maxTerms {
+		t.Errorf("Parse() kept %d terms, want %d", terms, maxTerms)
+	}
+}
+
+func TestMarkup(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Умная лампа", "Умная лампа"},
+		{"Умная ⟦лампа⟧", "Умная <mark>лампа</mark>"},
+		{"⟦Лампа⟧ … ⟦лампы⟧", "<mark>Лампа</mark> … <mark>лампы</mark>"},
+		// Разметка из описания экранируется, маркеры - нет
+		{"<script>alert(1)</script> ⟦хаб⟧", "&lt;script&gt;alert(1)&lt;/script&gt; <mark>хаб</mark>"},
+		{`"кавычки" & 'апострофы'`, "&#34;кавычки&#34; &amp; &#39;апострофы&#39;"},
+		{"<mark>не наша</mark>", "&lt;mark&gt;не наша&lt;/mark&gt;"},
+	}
+
+	for _, tt := range tests {
+		if got := markup(tt.text); got != tt.want {
+			t.Errorf("markup(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package session
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -20,12 +22,28 @@ type Manager struct {
 	ctx    context.Context
 }
 
-func NewSessionManager() *Manager {
-	client := redis.NewClient(&redis.Options{
+// RedisOptionsFromEnv читает REDIS_ADDR, REDIS_PASSWORD и REDIS_DB.
+// Значения по умолчанию - Redis из docker-compose.
+func RedisOptionsFromEnv() *redis.Options {
+	options := &redis.Options{
 		Addr:     "localhost:6379",
 		Password: "password",
 		DB:       0,
-	})
+	}
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		options.Addr = addr
+	}
+	if password, ok := os.LookupEnv("REDIS_PASSWORD"); ok {
+		options.Password = password
+	}
+	if db, err := strconv.Atoi(os.Getenv("REDIS_DB")); err == nil {
+		options.DB = db
+	}
+	return options
+}
+
+func NewSessionManager() *Manager {
+	client := redis.NewClient(RedisOptionsFromEnv())
 
 	ctx := context.Background()
 
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore - файлы в каталоге на диске сервера (разработка, одна машина).
+// Файлы отдает само приложение через /api/images/{name}; подписанных ссылок нет.
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore создает каталог хранилища, если его нет
+func NewLocalStore(dir string) (*LocalStore, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory %s: %v", root, err)
+	}
+	log.Printf("✅ Local store initialized - %s", root)
+	return &LocalStore{root: root}, nil
+}
+
+func (l *LocalStore) Put(ctx context.Context, name string, data []byte, contentType string) error {
+	target, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("failed to upload file: %v", err)
+	}
+
+	// Через временный файл: читатель не увидит недописанный объект
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to upload file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to upload file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("failed to upload file: %v", err)
+	}
+
+	log.Printf("✅ File saved to local store: %s (%d bytes)", name, len(data))
+	return nil
+}
+
+func (l *LocalStore) Get(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error) {
+	target, err := l.path(name)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	file, err := os.Open(target)
+	if err != nil {
+		return nil, ObjectInfo{}, fileError(err)
+	}
+	info, err := l.info(name, file)
+	if err != nil {
+		file.Close()
+		return nil, ObjectInfo{}, err
+	}
+	return file, info, nil
+}
+
+func (l *LocalStore) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	target, err := l.path(name)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	file, err := os.Open(target)
+	if err != nil {
+		return ObjectInfo{}, fileError(err)
+	}
+	defer file.Close()
+	return l.info(name, file)
+}
+
+func (l *LocalStore) Delete(ctx context.Context, name string) error {
+	target, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %v", err)
+	}
+
+	log.Printf("✅ File deleted from local store: %s", name)
+	return nil
+}
+
+func (l *LocalStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	err := filepath.WalkDir(l.root, func(current string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(l.root, current)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		info, err := l.Stat(ctx, name)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, info)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %v", err)
+	}
+	return objects, nil
+}
+
+func (l *LocalStore) URL(name string) string {
+	return ImageURL(name)
+}
+
+// path - путь к файлу объекта; имена с .. и абсолютные пути отклоняются, как и "." - сам каталог хранилища
+func (l *LocalStore) path(name string) (string, error) {
+	if name == "" || name == "." || strings.Contains(name, "\\") || path.IsAbs(name) || path.Clean(name) != name || strings.HasPrefix(name, "../") || name == ".." {
+		return "", ErrInvalidName
+	}
+	return filepath.Join(l.root, filepath.FromSlash(name)), nil
+}
+
+// info - метаданные файла. Тип - по расширению, для временных загрузок без расширения - по содержимому.
+func (l *LocalStore) info(name string, file *os.File) (ObjectInfo, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if stat.IsDir() {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		head := make([]byte, 512)
+		n, err := file.ReadAt(head, 0)
+		if err != nil && err != io.EOF {
+			return ObjectInfo{}, err
+		}
+		contentType = http.DetectContentType(head[:n])
+	}
+
+	return ObjectInfo{
+		Name:         name,
+		Size:         stat.Size(),
+		ContentType:  contentType,
+		ETag:         fmt.Sprintf("%x-%x", stat.ModTime().UnixNano(), stat.Size()),
+		LastModified: stat.ModTime(),
+	}, nil
+}
+
+func fileError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrObjectNotFound
+	}
+	return err
+}
+
+var _ ObjectStore = (*LocalStore)(nil)
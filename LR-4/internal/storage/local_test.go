@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStorePath(t *testing.T) {
+	root := t.TempDir()
+	store := &LocalStore{root: root}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"device_1.png", filepath.Join(root, "device_1.png")},
+		{"uploads/tmp_1", filepath.Join(root, "uploads", "tmp_1")},
+		{"a..b.png", filepath.Join(root, "a..b.png")},
+		{"..png", filepath.Join(root, "..png")},
+	}
+	for _, tt := range tests {
+		got, err := store.path(tt.name)
+		if err != nil || got != tt.want {
+			t.Errorf("path(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	for _, name := range []string{
+		"",
+		".",
+		"..",
+		"../secret",
+		"../../etc/passwd",
+		"uploads/../../secret",
+		"uploads/../device_1.png",
+		"./device_1.png",
+		"uploads//tmp_1",
+		"uploads/",
+		"/etc/passwd",
+		"..\\secret",
+		"uploads\\..\\..\\secret",
+	} {
+		if got, err := store.path(name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("path(%q) = %q, %v, want ErrInvalidName", name, got, err)
+		}
+	}
+}
+
+// Объекты с недопустимыми именами не создаются и не читаются за пределами каталога
+func TestLocalStoreStaysInRoot(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "images")
+	store, err := NewLocalStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(parent, "secret")
+	if err := os.WriteFile(secret, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "../escaped", []byte("x"), "text/plain"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Put(../escaped) error = %v, want ErrInvalidName", err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "escaped")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Put wrote a file outside the store")
+	}
+	if _, _, err := store.Get(ctx, "../secret"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Get(../secret) error = %v, want ErrInvalidName", err)
+	}
+	if err := store.Delete(ctx, "../secret"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Delete(../secret) error = %v, want ErrInvalidName", err)
+	}
+	if _, err := os.Stat(secret); err != nil {
+		t.Errorf("file outside the store is gone: %v", err)
+	}
+
+	if err := store.Put(ctx, "uploads/device_1.png", []byte("\x89PNG\r\n\x1a\n"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	reader, info, err := store.Get(ctx, "uploads/device_1.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "\x89PNG\r\n\x1a\n" || info.ContentType != "image/png" || info.Name != "uploads/device_1.png" {
+		t.Errorf("Get() = %q, %+v", data, info)
+	}
+	if _, err := store.Stat(ctx, "uploads"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Stat(directory) error = %v, want ErrObjectNotFound", err)
+	}
+
+	objects, err := store.List(ctx, "uploads/")
+	if err != nil || len(objects) != 1 || objects[0].Name != "uploads/device_1.png" {
+		t.Errorf("List(uploads/) = %+v, %v", objects, err)
+	}
+}
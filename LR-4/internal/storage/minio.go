@@ -4,80 +4,166 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"net/url"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
-type MinIOClient struct {
+// MinIOStore - закрытый bucket MinIO. Изображения отдаются через /api/images/{name}
+// (прокси или редирект на подписанную ссылку), браузер загружает файлы по подписанным PUT-ссылкам.
+type MinIOStore struct {
 	client *minio.Client
+	// public подписывает ссылки для браузера: подпись включает хост, поэтому
+	// нужен клиент с внешним адресом MinIO, а не с адресом внутри docker-сети
+	public *minio.Client
 	bucket string
 }
 
-func NewMinIOClient() *MinIOClient {
-	// Создаем клиент MinIO
-	minioClient, err := minio.New("minio:9000", &minio.Options{
-		Creds:  credentials.NewStaticV4("myaccesskey123", "mysecretkey123456", ""),
-		Secure: false,
+// NewMinIOStore подключается к MinIO и создает bucket, если его нет
+func NewMinIOStore(ctx context.Context, config Config) (*MinIOStore, error) {
+	creds := credentials.NewStaticV4(config.MinIOAccessKey, config.MinIOSecretKey, "")
+	client, err := minio.New(config.MinIOEndpoint, &minio.Options{
+		Creds:  creds,
+		Secure: config.MinIOUseSSL,
+		Region: config.MinIORegion,
 	})
 	if err != nil {
-		log.Printf("⚠️ Failed to create MinIO client: %v", err)
-		return &MinIOClient{}
+		return nil, fmt.Errorf("failed to create MinIO client: %v", err)
 	}
 
-	// Проверяем подключение и существование bucket
-	exists, err := minioClient.BucketExists(context.Background(), "image")
+	// Регион задан явно - подписание ссылок не обращается к серверу
+	public, err := minio.New(config.MinIOPublicEndpoint, &minio.Options{
+		Creds:  creds,
+		Secure: config.MinIOUseSSL,
+		Region: config.MinIORegion,
+	})
 	if err != nil {
-		log.Printf("⚠️ MinIO connection failed: %v", err)
-	} else if exists {
-		log.Printf("✅ MinIO client initialized - bucket 'image' exists")
-	} else {
-		log.Printf("❌ MinIO bucket 'image' not found - please create manually")
+		return nil, fmt.Errorf("failed to create MinIO public client: %v", err)
 	}
 
-	return &MinIOClient{
-		client: minioClient,
-		bucket: "image",
+	// Проверяем подключение и существование bucket; новый bucket закрыт по умолчанию
+	exists, err := client.BucketExists(ctx, config.MinIOBucket)
+	if err != nil {
+		return nil, fmt.Errorf("MinIO connection failed: %v", err)
 	}
-}
-
-func (m *MinIOClient) UploadFile(filename string, fileData []byte) error {
-	if m.client == nil {
-		return fmt.Errorf("MinIO client not initialized")
+	if exists {
+		log.Printf("✅ MinIO store initialized - bucket '%s' exists", config.MinIOBucket)
+	} else {
+		err := client.MakeBucket(ctx, config.MinIOBucket, minio.MakeBucketOptions{Region: config.MinIORegion})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create MinIO bucket %q: %v", config.MinIOBucket, err)
+		}
+		log.Printf("✅ MinIO store initialized - bucket '%s' created", config.MinIOBucket)
 	}
 
-	// Просто загружаем файл (bucket должен быть создан заранее)
-	_, err := m.client.PutObject(context.Background(), m.bucket, filename,
-		bytes.NewReader(fileData), int64(len(fileData)),
+	return &MinIOStore{
+		client: client,
+		public: public,
+		bucket: config.MinIOBucket,
+	}, nil
+}
+
+func (m *MinIOStore) Put(ctx context.Context, name string, data []byte, contentType string) error {
+	_, err := m.client.PutObject(ctx, m.bucket, name,
+		bytes.NewReader(data), int64(len(data)),
 		minio.PutObjectOptions{
-			ContentType: "image/png",
+			ContentType: contentType,
 		})
-
 	if err != nil {
 		return fmt.Errorf("failed to upload file: %v", err)
 	}
 
-	log.Printf("✅ File uploaded to MinIO: %s (%d bytes)", filename, len(fileData))
+	log.Printf("✅ File uploaded to MinIO: %s (%d bytes)", name, len(data))
 	return nil
 }
 
-func (m *MinIOClient) DeleteFile(filename string) error {
-	if m.client == nil {
-		return fmt.Errorf("MinIO client not initialized")
+func (m *MinIOStore) Get(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error) {
+	object, err := m.client.GetObject(ctx, m.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, ObjectInfo{}, objectError(err)
+	}
+	// GetObject ленивый: ошибка "нет объекта" приходит только при первом обращении
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, ObjectInfo{}, objectError(err)
 	}
+	return object, objectInfo(info), nil
+}
 
-	err := m.client.RemoveObject(context.Background(), m.bucket, filename,
-		minio.RemoveObjectOptions{})
+func (m *MinIOStore) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	info, err := m.client.StatObject(ctx, m.bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, objectError(err)
+	}
+	return objectInfo(info), nil
+}
 
+func (m *MinIOStore) Delete(ctx context.Context, name string) error {
+	err := m.client.RemoveObject(ctx, m.bucket, name, minio.RemoveObjectOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to delete file: %v", err)
 	}
 
-	log.Printf("✅ File deleted from MinIO: %s", filename)
+	log.Printf("✅ File deleted from MinIO: %s", name)
 	return nil
 }
 
-func (m *MinIOClient) GetImageURL(filename string) string {
-	return fmt.Sprintf("http://localhost:9000/%s/%s", m.bucket, filename)
+func (m *MinIOStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	for info := range m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, fmt.Errorf("failed to list files: %v", info.Err)
+		}
+		objects = append(objects, objectInfo(info))
+	}
+	return objects, nil
 }
+
+func (m *MinIOStore) URL(name string) string {
+	return ImageURL(name)
+}
+
+// PresignPut - ссылка, по которой браузер загружает файл напрямую в MinIO методом PUT
+func (m *MinIOStore) PresignPut(ctx context.Context, name string, expires time.Duration) (string, error) {
+	u, err := m.public.PresignedPutObject(ctx, m.bucket, name, expires)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign upload: %v", err)
+	}
+	return u.String(), nil
+}
+
+// PresignGet - временная ссылка на чтение объекта из закрытого bucket
+func (m *MinIOStore) PresignGet(ctx context.Context, name string, expires time.Duration) (string, error) {
+	u, err := m.public.PresignedGetObject(ctx, m.bucket, name, expires, url.Values{})
+	if err != nil {
+		return "", fmt.Errorf("failed to presign download: %v", err)
+	}
+	return u.String(), nil
+}
+
+func objectInfo(info minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Name:         info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+	}
+}
+
+func objectError(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrObjectNotFound
+	}
+	return err
+}
+
+var (
+	_ ObjectStore = (*MinIOStore)(nil)
+	_ Presigner   = (*MinIOStore)(nil)
+)
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Хранилища файлов
+const (
+	BackendMinIO = "minio"
+	BackendLocal = "local"
+)
+
+const defaultImages = "/api/images/"
+
+// UploadsPrefix - временные объекты прямых загрузок до подтверждения; через /api/images/ не отдаются
+const UploadsPrefix = "uploads/"
+
+var (
+	ErrObjectNotFound = errors.New("object not found")
+	ErrInvalidName    = errors.New("invalid object name")
+)
+
+// ObjectInfo - метаданные объекта в хранилище
+type ObjectInfo struct {
+	Name         string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// ObjectStore - хранилище файлов изображений. Имена объектов - пути через "/".
+// Delete отсутствующего объекта не считается ошибкой.
+type ObjectStore interface {
+	Put(ctx context.Context, name string, data []byte, contentType string) error
+	// Get открывает объект на чтение; вызывающий закрывает reader
+	Get(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error)
+	Stat(ctx context.Context, name string) (ObjectInfo, error)
+	Delete(ctx context.Context, name string) error
+	// List - объекты, имена которых начинаются с prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// URL - постоянный адрес объекта для клиентов
+	URL(name string) string
+}
+
+// Presigner - хранилище умеет выдавать подписанные ссылки для обращения к нему в обход сервера
+type Presigner interface {
+	PresignPut(ctx context.Context, name string, expires time.Duration) (string, error)
+	PresignGet(ctx context.Context, name string, expires time.Duration) (string, error)
+}
+
+// Config - настройки хранилища, см. ConfigFromEnv
+type Config struct {
+	Backend string
+
+	MinIOEndpoint       string
+	MinIOPublicEndpoint string // адрес MinIO для браузера: на него выдаются подписанные ссылки
+	MinIOAccessKey      string
+	MinIOSecretKey      string
+	MinIOBucket         string
+	MinIORegion         string
+	MinIOUseSSL         bool
+
+	LocalDir string
+}
+
+// ConfigFromEnv читает STORAGE_BACKEND (minio|local), MINIO_* и LOCAL_STORAGE_DIR.
+// Значения по умолчанию - MinIO из docker-compose.
+func ConfigFromEnv() Config {
+	return Config{
+		Backend: envOr("STORAGE_BACKEND", BackendMinIO),
+
+		MinIOEndpoint:       envOr("MINIO_ENDPOINT", "minio:9000"),
+		MinIOPublicEndpoint: envOr("MINIO_PUBLIC_ENDPOINT", "localhost:9000"),
+		MinIOAccessKey:      envOr("MINIO_ACCESS_KEY", "myaccesskey123"),
+		MinIOSecretKey:      envOr("MINIO_SECRET_KEY", "mysecretkey123456"),
+		MinIOBucket:         envOr("MINIO_BUCKET", "image"),
+		MinIORegion:         envOr("MINIO_REGION", "us-east-1"),
+		MinIOUseSSL:         os.Getenv("MINIO_USE_SSL") == "true",
+
+		LocalDir: envOr("LOCAL_STORAGE_DIR", "uploads"),
+	}
+}
+
+// New создает хранилище по настройкам и готовит его: bucket MinIO или каталог создаются, если их нет
+func New(ctx context.Context, config Config) (ObjectStore, error) {
+	// Конструкторы возвращают конкретные типы: nil-указатель в интерфейсе не был бы равен nil
+	switch config.Backend {
+	case BackendMinIO:
+		store, err := NewMinIOStore(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case BackendLocal:
+		store, err := NewLocalStore(config.LocalDir)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q, allowed: %s, %s", config.Backend, BackendMinIO, BackendLocal)
+	}
+}
+
+// ImageURL - постоянный адрес изображения в API. Ссылки хранилища не сохраняются:
+// подписанные истекают, а прямые работают только с публичным bucket.
+func ImageURL(name string) string {
+	return ImageURLPrefix() + name
+}
+
+// ImageURLPrefix - IMAGE_BASE_URL (например, адрес CDN) или /api/images/
+func ImageURLPrefix() string {
+	return envOr("IMAGE_BASE_URL", defaultImages)
+}
+
+// PresignedReads - IMAGE_READ_MODE=presigned: /api/images/ отвечает редиректом на подписанную
+// ссылку хранилища вместо того, чтобы отдавать файл через сервер
+func PresignedReads() bool {
+	return os.Getenv("IMAGE_READ_MODE") == "presigned"
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
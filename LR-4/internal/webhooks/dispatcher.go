@@ -0,0 +1,279 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Статусы доставки
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Заголовки запроса к подписчику
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	maxResponseBody = 1000
+	maxErrorLength  = 500
+	batchSize       = 50
+	requestTimeout  = 10 * time.Second
+	// claimLease - на сколько откладываются взятые доставки: хватает на отправку всей пачки
+	claimLease = batchSize*requestTimeout + time.Minute
+)
+
+// Sign - подпись HMAC-SHA256 от "timestamp.body" в формате "sha256=<hex>".
+// Метка времени входит в подпись, чтобы подписчик мог отбрасывать старые повторы.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher отправляет ожидающие доставки и повторяет неудачные
+// с экспоненциальной задержкой: baseDelay, 2*baseDelay, 4*baseDelay... но не больше maxDelay.
+type Dispatcher struct {
+	db          *gorm.DB
+	client      *http.Client
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+func NewDispatcher(db *gorm.DB, maxAttempts int, baseDelay, maxDelay time.Duration) *Dispatcher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &Dispatcher{
+		db:          db,
+		client:      &http.Client{Timeout: requestTimeout},
+		maxAttempts: maxAttempts,
+		baseDelay:   baseDelay,
+		maxDelay:    maxDelay,
+	}
+}
+
+// Backoff - задержка перед следующей попыткой после attempt неудачных
+func (d *Dispatcher) Backoff(attempt int) time.Duration {
+	delay := d.baseDelay
+	for i := 1; i < attempt && delay < d.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.maxDelay {
+		delay = d.maxDelay
+	}
+	return delay
+}
+
+// DeliverDue отправляет доставки, время попытки которых наступило.
+// Доставки сначала забираются одним запросом, поэтому параллельные экземпляры
+// не отправляют одну доставку одновременно.
+func (d *Dispatcher) DeliverDue(ctx context.Context) error {
+	deliveries, err := d.claimDue(ctx)
+	if err != nil {
+		return fmt.Errorf("claim due deliveries: %w", err)
+	}
+
+	succeeded, failed := 0, 0
+	for i := range deliveries {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := d.Deliver(ctx, &deliveries[i]); err != nil {
+			return err
+		}
+		switch deliveries[i].Status {
+		case StatusSucceeded:
+			succeeded++
+		case StatusFailed:
+			failed++
+		}
+	}
+
+	if len(deliveries) > 0 {
+		log.Printf("📨 Webhooks: %d due, %d delivered, %d failed permanently", len(deliveries), succeeded, failed)
+	}
+	return nil
+}
+
+// claimDue забирает до batchSize доставок, время которых наступило, и откладывает их на claimLease.
+// Другой экземпляр пропускает заблокированные и отложенные строки; Deliver затем ставит
+// настоящее время следующей попытки. Если экземпляр упал, доставка повторится после аренды.
+func (d *Dispatcher) claimDue(ctx context.Context) ([]models.WebhookDelivery, error) {
+	now := time.Now()
+	var deliveries []models.WebhookDelivery
+	err := d.db.WithContext(ctx).Raw(`UPDATE webhook_deliveries SET next_attempt_at = ?
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at, id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED)
+		RETURNING *`, now.Add(claimLease), StatusPending, now, batchSize).
+		Scan(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+	return deliveries, nil
+}
+
+// Replay повторно отправляет доставку (обычно failed) с новым счетчиком попыток.
+// Следующая попытка откладывается, чтобы планировщик не взял доставку параллельно.
+func (d *Dispatcher) Replay(ctx context.Context, delivery *models.WebhookDelivery) error {
+	hold := time.Now().Add(d.Backoff(1))
+	err := d.db.WithContext(ctx).Model(delivery).Updates(map[string]interface{}{
+		"status":          StatusPending,
+		"attempts":        0,
+		"next_attempt_at": hold,
+		"last_error":      "",
+	}).Error
+	if err != nil {
+		return err
+	}
+	delivery.Status = StatusPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &hold
+	delivery.LastError = ""
+	return d.Deliver(ctx, delivery)
+}
+
+// Deliver выполняет одну попытку доставки, пишет ее в журнал и планирует следующую.
+// Ошибка возвращается только при сбое БД - неудачная отправка учитывается в статусе доставки.
+func (d *Dispatcher) Deliver(ctx context.Context, delivery *models.WebhookDelivery) error {
+	var subscription models.WebhookSubscription
+	if err := d.db.WithContext(ctx).First(&subscription, delivery.SubscriptionID).Error; err != nil {
+		return fmt.Errorf("load subscription %d: %w", delivery.SubscriptionID, err)
+	}
+
+	now := time.Now()
+	attempt := models.WebhookAttempt{
+		DeliveryID: delivery.ID,
+		Number:     delivery.Attempts + 1,
+	}
+	if subscription.IsActive {
+		d.send(ctx, subscription, delivery, &attempt)
+	} else {
+		attempt.Error = "subscription is disabled"
+	}
+
+	updates := map[string]interface{}{
+		"attempts":   attempt.Number,
+		"last_error": attempt.Error,
+	}
+	switch {
+	case attempt.Error == "":
+		updates["status"] = StatusSucceeded
+		updates["delivered_at"] = now
+		updates["next_attempt_at"] = nil
+	case attempt.Number >= d.maxAttempts || !subscription.IsActive:
+		updates["status"] = StatusFailed
+		updates["next_attempt_at"] = nil
+	default:
+		updates["status"] = StatusPending
+		updates["next_attempt_at"] = now.Add(d.Backoff(attempt.Number))
+	}
+
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+		return tx.Model(delivery).Updates(updates).Error
+	})
+	if err != nil {
+		return fmt.Errorf("record delivery %d attempt: %w", delivery.ID, err)
+	}
+	delivery.Attempts = attempt.Number
+	delivery.LastError = attempt.Error
+	delivery.Status = updates["status"].(string)
+	delivery.NextAttemptAt = nil
+	if next, ok := updates["next_attempt_at"].(time.Time); ok {
+		delivery.NextAttemptAt = &next
+	}
+	if delivery.Status == StatusSucceeded {
+		delivery.DeliveredAt = &now
+	}
+
+	if attempt.Error != "" {
+		log.Printf("⚠️ Webhook delivery %d (%s) attempt %d failed: %s",
+			delivery.ID, delivery.Event, attempt.Number, attempt.Error)
+	}
+	return nil
+}
+
+// send отправляет подписанный запрос и заполняет результат попытки
+func (d *Dispatcher) send(ctx context.Context, subscription models.WebhookSubscription,
+	delivery *models.WebhookDelivery, attempt *models.WebhookAttempt) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	started := time.Now()
+	defer func() {
+		attempt.DurationMs = time.Since(started).Milliseconds()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = truncate(err.Error(), maxErrorLength)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "smartdevices-webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(subscription.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = truncate(err.Error(), maxErrorLength)
+		return
+	}
+	defer resp.Body.Close()
+
+	responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	attempt.StatusCode = resp.StatusCode
+	// Ответ хранится как текст: убираем NUL и невалидный UTF-8, которые не примет PostgreSQL
+	text := strings.ToValidUTF8(strings.ReplaceAll(string(responseBody), "\x00", ""), "")
+	attempt.ResponseBody = truncate(text, maxResponseBody)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+// truncate обрезает строку до limit байт, не разрывая символы UTF-8
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	s = s[:limit]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,168 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"smartdevices/internal/models"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		want      string
+	}{
+		{"payload", "secret", 1700000000, `{"event":"order.formed"}`,
+			"sha256=58c980de4d6cdb50e9143f9871050614b1a908cc700de7d772320b18ae663f86"},
+		{"empty", "", 0, "",
+			"sha256=b849d5a581847b281957065739df36df2463d1977ea8d6e1e4e6cf33fadc68c3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("Sign() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// Подпись зависит от каждой части
+	base := Sign("secret", 1700000000, []byte("body"))
+	for name, other := range map[string]string{
+		"secret":    Sign("other", 1700000000, []byte("body")),
+		"timestamp": Sign("secret", 1700000001, []byte("body")),
+		"body":      Sign("secret", 1700000000, []byte("body2")),
+	} {
+		if other == base {
+			t.Errorf("signature does not depend on %s", name)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(nil, 8, 30*time.Second, 5*time.Minute)
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{5, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := d.Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffBaseAboveMax(t *testing.T) {
+	d := NewDispatcher(nil, 8, time.Hour, time.Minute)
+	if got := d.Backoff(1); got != time.Minute {
+		t.Errorf("Backoff(1) = %s, want %s", got, time.Minute)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s     string
+		limit int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"truncated", 5, "trunc"},
+		// "ж" занимает 2 байта - половину символа не оставляем
+		{"жжж", 3, "ж"},
+		{"жжж", 4, "жж"},
+	}
+
+	for _, tt := range tests {
+		got := truncate(tt.s, tt.limit)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestOrderEvent(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+		ok     bool
+	}{
+		{"formed", EventOrderFormed, true},
+		{"completed", EventOrderCompleted, true},
+		{"rejected", EventOrderRejected, true},
+		{"draft", "", false},
+		{"deleted", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := OrderEvent(tt.status)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("OrderEvent(%q) = %q, %v, want %q, %v", tt.status, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestIsKnownEvent(t *testing.T) {
+	for _, event := range append([]string{AllEvents}, Events...) {
+		if !IsKnownEvent(event) {
+			t.Errorf("IsKnownEvent(%q) = false", event)
+		}
+	}
+	for _, event := range []string{"", "order", "order.*", "device.moved"} {
+		if IsKnownEvent(event) {
+			t.Errorf("IsKnownEvent(%q) = true", event)
+		}
+	}
+}
+
+// Подписчик проверяет подпись по заголовкам запроса
+func TestSendSignsRequest(t *testing.T) {
+	var verified bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		verified = err == nil &&
+			r.Header.Get(HeaderEvent) == EventOrderFormed &&
+			r.Header.Get(HeaderDelivery) == "42" &&
+			r.Header.Get(HeaderSignature) == Sign("secret", timestamp, body)
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("nope\x00" + strings.Repeat("x", 2*maxResponseBody)))
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(nil, 3, time.Second, time.Minute)
+	subscription := models.WebhookSubscription{URL: server.URL, Secret: "secret"}
+	delivery := &models.WebhookDelivery{ID: 42, Event: EventOrderFormed, Payload: `{"event":"order.formed"}`}
+	var attempt models.WebhookAttempt
+	d.send(context.Background(), subscription, delivery, &attempt)
+
+	if !verified {
+		t.Error("subscriber could not verify the signature")
+	}
+	if attempt.StatusCode != http.StatusTeapot || attempt.Error != "unexpected status 418" {
+		t.Errorf("attempt = %d %q", attempt.StatusCode, attempt.Error)
+	}
+	if strings.Contains(attempt.ResponseBody, "\x00") || len(attempt.ResponseBody) > maxResponseBody {
+		t.Errorf("response body is not sanitized: %d bytes", len(attempt.ResponseBody))
+	}
+}
@@ -0,0 +1,114 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"smartdevices/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// События, на которые можно подписаться
+const (
+	EventOrderFormed    = "order.formed"
+	EventOrderCompleted = "order.completed"
+	EventOrderRejected  = "order.rejected"
+	EventDeviceCreated  = "device.created"
+	EventDeviceUpdated  = "device.updated"
+	EventDeviceDeleted  = "device.deleted"
+
+	// AllEvents - подписка на все события
+	AllEvents = "*"
+)
+
+// Events - список поддерживаемых событий
+var Events = []string{
+	EventOrderFormed,
+	EventOrderCompleted,
+	EventOrderRejected,
+	EventDeviceCreated,
+	EventDeviceUpdated,
+	EventDeviceDeleted,
+}
+
+// OrderEvent - событие для статуса заявки; false, если на статус нет события
+func OrderEvent(status string) (string, bool) {
+	switch status {
+	case "formed":
+		return EventOrderFormed, true
+	case "completed":
+		return EventOrderCompleted, true
+	case "rejected":
+		return EventOrderRejected, true
+	}
+	return "", false
+}
+
+// IsKnownEvent проверяет имя события из фильтра подписки
+func IsKnownEvent(event string) bool {
+	if event == AllEvents {
+		return true
+	}
+	for _, known := range Events {
+		if known == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribed проверяет, входит ли событие в фильтр подписки
+func Subscribed(filter []string, event string) bool {
+	for _, name := range filter {
+		if name == event || name == AllEvents {
+			return true
+		}
+	}
+	return false
+}
+
+// Envelope - тело запроса, которое получает подписчик
+type Envelope struct {
+	Event      string      `json:"event"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// Enqueue создает доставки события для всех активных подписок.
+// Вызывается в транзакции изменения: событие уходит только если изменение сохранено.
+func Enqueue(tx *gorm.DB, event string, data interface{}) error {
+	// Подписок немного, фильтр по событиям проверяется здесь, а не в запросе
+	var active []models.WebhookSubscription
+	if err := tx.Where("is_active = ?", true).Find(&active).Error; err != nil {
+		return fmt.Errorf("find webhook subscriptions: %w", err)
+	}
+	var subscriptions []models.WebhookSubscription
+	for _, subscription := range active {
+		if Subscribed(subscription.Events, event) {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(Envelope{Event: event, OccurredAt: time.Now(), Data: data})
+	if err != nil {
+		return fmt.Errorf("encode webhook payload: %w", err)
+	}
+
+	now := time.Now()
+	deliveries := make([]models.WebhookDelivery, len(subscriptions))
+	for i, subscription := range subscriptions {
+		deliveries[i] = models.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			Event:          event,
+			Payload:        string(payload),
+			Status:         StatusPending,
+			NextAttemptAt:  &now,
+		}
+	}
+	return tx.Create(&deliveries).Error
+}
@@ -0,0 +1,92 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"testing"
+
+	"smartdevices/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestSubscribed(t *testing.T) {
+	tests := []struct {
+		filter []string
+		event  string
+		want   bool
+	}{
+		{[]string{EventOrderFormed}, EventOrderFormed, true},
+		{[]string{EventDeviceCreated, EventOrderRejected}, EventOrderRejected, true},
+		{[]string{AllEvents}, EventDeviceDeleted, true},
+		{[]string{EventOrderFormed}, EventOrderCompleted, false},
+		{[]string{}, EventOrderFormed, false},
+		{nil, EventOrderFormed, false},
+	}
+
+	for _, tt := range tests {
+		if got := Subscribed(tt.filter, tt.event); got != tt.want {
+			t.Errorf("Subscribed(%v, %q) = %v, want %v", tt.filter, tt.event, got, tt.want)
+		}
+	}
+}
+
+// Доставки создаются только активным подпискам с подходящим фильтром
+func TestEnqueue(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.WebhookSubscription{}, &models.WebhookDelivery{}); err != nil {
+		t.Fatal(err)
+	}
+
+	subscriptions := []models.WebhookSubscription{
+		{URL: "http://crm/orders", Secret: "s", Events: models.StringList{EventOrderFormed}, IsActive: true},
+		{URL: "http://crm/all", Secret: "s", Events: models.StringList{AllEvents}, IsActive: true},
+		{URL: "http://crm/devices", Secret: "s", Events: models.StringList{EventDeviceCreated}, IsActive: true},
+		{URL: "http://crm/disabled", Secret: "s", Events: models.StringList{EventOrderFormed}, IsActive: true},
+	}
+	if err := db.Create(&subscriptions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&subscriptions[3]).Update("is_active", false).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Enqueue(db, EventOrderFormed, map[string]int{"id": 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := db.Order("subscription_id").Find(&deliveries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 || deliveries[0].SubscriptionID != subscriptions[0].ID || deliveries[1].SubscriptionID != subscriptions[1].ID {
+		t.Fatalf("deliveries = %+v, want subscriptions %d and %d", deliveries, subscriptions[0].ID, subscriptions[1].ID)
+	}
+	for _, delivery := range deliveries {
+		var envelope struct {
+			Event string         `json:"event"`
+			Data  map[string]int `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(delivery.Payload), &envelope); err != nil {
+			t.Fatal(err)
+		}
+		if delivery.Status != StatusPending || delivery.NextAttemptAt == nil ||
+			envelope.Event != EventOrderFormed || envelope.Data["id"] != 7 {
+			t.Errorf("delivery = %+v, payload %s", delivery, delivery.Payload)
+		}
+	}
+
+	// order.rejected получает только подписка на все события
+	if err := Enqueue(db, EventOrderRejected, nil); err != nil {
+		t.Fatal(err)
+	}
+	var rejected []models.WebhookDelivery
+	db.Where("event = ?", EventOrderRejected).Find(&rejected)
+	if len(rejected) != 1 || rejected[0].SubscriptionID != subscriptions[1].ID {
+		t.Errorf("order.rejected deliveries = %+v, want one for subscription %d", rejected, subscriptions[1].ID)
+	}
+}
@@ -1,14 +1,31 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strings"
+	"time"
 
+	"smartdevices/internal/address"
 	apiHandlers "smartdevices/internal/api/handlers"
+	"smartdevices/internal/catalog"
+	"smartdevices/internal/compatibility"
+	"smartdevices/internal/events"
 	"smartdevices/internal/handlers"
+	"smartdevices/internal/idempotency"
+	"smartdevices/internal/maintenance"
 	"smartdevices/internal/middleware"
+	"smartdevices/internal/models"
+	"smartdevices/internal/notifications"
+	"smartdevices/internal/search"
+	"smartdevices/internal/session"
+	"smartdevices/internal/storage"
+	"smartdevices/internal/webhooks"
 
+	"github.com/redis/go-redis/v9"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -21,17 +38,134 @@ func main() {
 		log.Fatal("Ошибка подключения к БД:", err)
 	}
 
+	// Составной ключ order_items заменяется на id до AutoMigrate
+	if err := migrateOrderItemKey(db); err != nil {
+		log.Fatal("Ошибка миграции order_items:", err)
+	}
+
+	// Досоздаем новые таблицы и колонки
+	err = db.AutoMigrate(
+		&models.Client{},
+		&models.Category{},
+		&models.Tag{},
+		&models.SmartDevice{},
+		&models.DeviceImage{},
+		&models.DeviceImageUpload{},
+		&models.SmartOrder{},
+		&models.OrderItem{},
+		&models.ClientAddress{},
+		&models.OrderStatusHistory{},
+		&models.OrderComment{},
+		&models.DeviceRevision{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+		&models.WebhookAttempt{},
+		&models.Notification{},
+		&models.NotificationPreference{},
+	)
+	if err != nil {
+		log.Fatal("Ошибка миграции БД:", err)
+	}
+
+	// Начальные категории: устройства распределяются по словам в названии, один раз
+	if err := catalog.SeedCategories(db); err != nil {
+		log.Fatal("Ошибка миграции категорий:", err)
+	}
+
+	// Галерея: существующие namespace_url становятся основными изображениями
+	if err := migrateDeviceImages(db); err != nil {
+		log.Fatal("Ошибка миграции изображений:", err)
+	}
+
+	// Ссылки на изображения ведут через API: bucket закрыт, прямые адреса MinIO не работают
+	if err := migrateImageURLs(db, storage.ImageURLPrefix()); err != nil {
+		log.Fatal("Ошибка миграции ссылок на изображения:", err)
+	}
+
+	// Исходные ревизии для устройств, созданных до появления истории изменений
+	if err := catalog.BackfillRevisions(db); err != nil {
+		log.Fatal("Ошибка миграции истории устройств:", err)
+	}
+
+	// Колонка и индекс полнотекстового поиска по каталогу
+	if err := migrateDeviceSearch(db); err != nil {
+		log.Fatal("Ошибка миграции поиска:", err)
+	}
+
+	// Один клиент Redis (REDIS_ADDR, REDIS_PASSWORD, REDIS_DB) на события, блокировки и ключи идемпотентности
+	redisClient := redis.NewClient(session.RedisOptionsFromEnv())
+	if err := redisClient.Ping(context.Background()).Err(); err != nil {
+		log.Printf("⚠️ Redis connection failed: %v", err)
+	}
+
+	// События для SSE: рассылка между экземплярами через Redis pub/sub
+	eventBroker := events.NewBroker(redisClient)
+	go eventBroker.Start(context.Background())
+
 	// Инициализация HTML handlers с передачей DB
-	handlers.Init(db)
+	handlers.Init(db, eventBroker)
 
 	// Инициализация middleware
 	authMiddleware := middleware.NewAuthMiddleware(db)
 
+	// Ключи идемпотентности для повторяемых POST/PUT запросов
+	idempotencyTTL := durationFromEnv("IDEMPOTENCY_TTL", 24*time.Hour)
+	idempotencyMiddleware := middleware.NewIdempotencyMiddleware(authMiddleware, idempotency.NewStore(redisClient, idempotencyTTL))
+	idempotent := idempotencyMiddleware.Wrap
+	// Маршруты с файлами: тело читается ради отпечатка, поэтому предел - как у самого маршрута
+	idempotentImport := idempotencyMiddleware.WrapLimit(apiHandlers.MaxImportSize)
+	idempotentImage := idempotencyMiddleware.WrapLimit(apiHandlers.MaxImageFormSize)
+
+	// Офлайн-геокодер адресов установки
+	geocoder := address.NewTableGeocoder()
+
+	// Правила совместимости протоколов при формировании заявки
+	compatibilityEngine := compatibility.NewEngine(compatibility.DefaultRules()...)
+
+	// Хранилище изображений (STORAGE_BACKEND=minio|local): один экземпляр на все приложение,
+	// bucket или каталог создаются при запуске
+	imageStore, err := storage.New(context.Background(), storage.ConfigFromEnv())
+	if err != nil {
+		log.Fatal("Ошибка хранилища изображений (для разработки без MinIO: STORAGE_BACKEND=local):", err)
+	}
+
+	// Исходящие webhooks: доставки пишутся в БД вместе с изменением,
+	// отправка и повторы с экспоненциальной задержкой - отдельной задачей.
+	// Блокировка только разводит запуски: доставки забираются в БД, даже если пачка идет дольше ее срока.
+	webhookDispatcher := webhooks.NewDispatcher(db, 8,
+		durationFromEnv("WEBHOOK_RETRY_BASE", 30*time.Second),
+		durationFromEnv("WEBHOOK_RETRY_MAX", 6*time.Hour))
+	webhookScheduler := maintenance.NewScheduler(
+		maintenance.NewRedisLock(redisClient, "webhooks:lock", time.Minute),
+		durationFromEnv("WEBHOOK_INTERVAL", 10*time.Second),
+		maintenance.Job{Name: "webhook-delivery", Run: webhookDispatcher.DeliverDue})
+	go webhookScheduler.Start(context.Background())
+
 	// Инициализация API handlers
-	smartDeviceAPI := apiHandlers.NewSmartDeviceAPIHandler(db)
-	smartOrderAPI := apiHandlers.NewSmartOrderAPIHandler(db)
-	orderItemAPI := apiHandlers.NewOrderItemAPIHandler(db)
+	smartDeviceAPI := apiHandlers.NewSmartDeviceAPIHandler(db, imageStore)
+	smartOrderAPI := apiHandlers.NewSmartOrderAPIHandler(db, geocoder, compatibilityEngine, eventBroker)
+	orderItemAPI := apiHandlers.NewOrderItemAPIHandler(db, eventBroker)
 	clientAPI := apiHandlers.NewClientAPIHandler(db)
+	clientAddressAPI := apiHandlers.NewClientAddressAPIHandler(db, geocoder)
+	statsAPI := apiHandlers.NewStatsAPIHandler(db)
+	webhookAPI := apiHandlers.NewWebhookAPIHandler(db, webhookDispatcher)
+	eventsAPI := apiHandlers.NewEventsAPIHandler(db, eventBroker)
+	notificationAPI := apiHandlers.NewNotificationAPIHandler(db)
+	categoryAPI := apiHandlers.NewCategoryAPIHandler(db)
+	tagAPI := apiHandlers.NewTagAPIHandler(db)
+
+	// Фоновое обслуживание: автоудаление заброшенных черновиков и неподтвержденных загрузок изображений.
+	// Блокировка в Redis - при нескольких экземплярах задачу выполняет один.
+	// Черновики удаляются через переходы заявок - с историей и событиями SSE.
+	draftCleaner := maintenance.NewDraftCleaner(db, notifications.NewDraftNotifier(db), smartOrderAPI,
+		durationFromEnv("DRAFT_TTL", 30*24*time.Hour),
+		durationFromEnv("DRAFT_WARNING_BEFORE", 3*24*time.Hour))
+	scheduler := maintenance.NewScheduler(
+		maintenance.NewRedisLock(redisClient, "maintenance:lock", 10*time.Minute),
+		durationFromEnv("MAINTENANCE_INTERVAL", time.Hour),
+		draftCleaner.Job(),
+		maintenance.NewUploadCleaner(db, imageStore).Job())
+	go scheduler.Start(context.Background())
 
 	// Статические файлы
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
@@ -70,7 +204,76 @@ func main() {
 		case http.MethodGet:
 			smartDeviceAPI.GetSmartDevices(w, r)
 		case http.MethodPost:
-			authMiddleware.RequireModerator(smartDeviceAPI.CreateSmartDevice)(w, r)
+			authMiddleware.RequireModerator(idempotent(smartDeviceAPI.CreateSmartDevice))(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// API маршруты - категории и метки (чтение публичное, изменение - модератор)
+	http.HandleFunc("/api/categories", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			categoryAPI.GetCategories(w, r)
+		case http.MethodPost:
+			authMiddleware.RequireModerator(idempotent(categoryAPI.CreateCategory))(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	http.HandleFunc("/api/categories/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			categoryAPI.GetCategory(w, r)
+		case http.MethodPut:
+			authMiddleware.RequireModerator(idempotent(categoryAPI.UpdateCategory))(w, r)
+		case http.MethodDelete:
+			authMiddleware.RequireModerator(categoryAPI.DeleteCategory)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	http.HandleFunc("/api/tags", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			tagAPI.GetTags(w, r)
+		case http.MethodPost:
+			authMiddleware.RequireModerator(idempotent(tagAPI.CreateTag))(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	http.HandleFunc("/api/tags/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			authMiddleware.RequireModerator(idempotent(tagAPI.UpdateTag))(w, r)
+		case http.MethodDelete:
+			authMiddleware.RequireModerator(tagAPI.DeleteTag)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	http.HandleFunc("/api/smart-devices/import", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			authMiddleware.RequireModerator(idempotentImport(smartDeviceAPI.ImportSmartDevices))(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	http.HandleFunc("/api/smart-devices/export", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			authMiddleware.RequireModerator(smartDeviceAPI.ExportSmartDevices)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Изображения из закрытого bucket: через сервер или редирект на подписанную ссылку
+	http.HandleFunc("/api/images/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			smartDeviceAPI.ServeImage(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
@@ -81,10 +284,64 @@ func main() {
 		path := r.URL.Path
 
 		switch {
+		case strings.HasSuffix(path, "/revisions"):
+			if r.Method == http.MethodGet {
+				authMiddleware.RequireModerator(smartDeviceAPI.GetDeviceRevisions)(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case strings.HasSuffix(path, "/revisions/diff"):
+			if r.Method == http.MethodGet {
+				authMiddleware.RequireModerator(smartDeviceAPI.GetDeviceRevisionDiff)(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case strings.Contains(path, "/revisions/") && strings.HasSuffix(path, "/revert"):
+			if r.Method == http.MethodPost {
+				authMiddleware.RequireModerator(idempotent(smartDeviceAPI.RevertDeviceRevision))(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case strings.HasSuffix(path, "/images"):
+			switch r.Method {
+			case http.MethodGet:
+				smartDeviceAPI.GetDeviceImages(w, r)
+			case http.MethodPost:
+				authMiddleware.RequireModerator(idempotentImage(smartDeviceAPI.AddDeviceImage))(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case strings.HasSuffix(path, "/images/order"):
+			if r.Method == http.MethodPut {
+				authMiddleware.RequireModerator(idempotent(smartDeviceAPI.ReorderDeviceImages))(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case strings.HasSuffix(path, "/images/uploads"):
+			if r.Method == http.MethodPost {
+				authMiddleware.RequireModerator(idempotent(smartDeviceAPI.CreateImageUpload))(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case strings.Contains(path, "/images/uploads/") && strings.HasSuffix(path, "/confirm"):
+			if r.Method == http.MethodPost {
+				authMiddleware.RequireModerator(idempotent(smartDeviceAPI.ConfirmImageUpload))(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case strings.Contains(path, "/images/"):
+			switch r.Method {
+			case http.MethodPut:
+				authMiddleware.RequireModerator(idempotent(smartDeviceAPI.UpdateDeviceImage))(w, r)
+			case http.MethodDelete:
+				authMiddleware.RequireModerator(smartDeviceAPI.DeleteGalleryImage)(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
 		case strings.Contains(path, "/image"):
 			switch r.Method {
 			case http.MethodPost:
-				authMiddleware.RequireModerator(smartDeviceAPI.UploadDeviceImage)(w, r)
+				authMiddleware.RequireModerator(idempotentImage(smartDeviceAPI.UploadDeviceImage))(w, r)
 			case http.MethodDelete:
 				authMiddleware.RequireModerator(smartDeviceAPI.DeleteDeviceImage)(w, r)
 			default:
@@ -96,7 +353,7 @@ func main() {
 			case http.MethodGet:
 				smartDeviceAPI.GetSmartDevice(w, r)
 			case http.MethodPut:
-				authMiddleware.RequireModerator(smartDeviceAPI.UpdateSmartDevice)(w, r)
+				authMiddleware.RequireModerator(idempotent(smartDeviceAPI.UpdateSmartDevice))(w, r)
 			case http.MethodDelete:
 				authMiddleware.RequireModerator(smartDeviceAPI.DeleteSmartDevice)(w, r)
 			default:
@@ -108,21 +365,62 @@ func main() {
 	// API маршруты - Smart Orders
 	http.HandleFunc("/api/smart-orders/cart", authMiddleware.RequireAuth(smartOrderAPI.GetCart))
 	http.HandleFunc("/api/smart-orders", authMiddleware.RequireAuth(smartOrderAPI.GetSmartOrders))
+	http.HandleFunc("/api/smart-orders/export", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			authMiddleware.RequireAuth(smartOrderAPI.ExportSmartOrders)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	http.HandleFunc("/api/smart-orders/bulk", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			authMiddleware.RequireModerator(idempotent(smartOrderAPI.BulkSmartOrders))(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
 
 	// Обработка всех /api/smart-orders/... маршрутов
 	http.HandleFunc("/api/smart-orders/", func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
 
 		switch {
+		case strings.HasSuffix(path, "/document.pdf"):
+			if r.Method == http.MethodGet {
+				authMiddleware.RequireAuth(smartOrderAPI.GetSmartOrderDocument)(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case strings.HasSuffix(path, "/history"):
+			if r.Method == http.MethodGet {
+				authMiddleware.RequireAuth(smartOrderAPI.GetSmartOrderHistory)(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case strings.HasSuffix(path, "/comments"):
+			switch r.Method {
+			case http.MethodGet:
+				authMiddleware.RequireAuth(smartOrderAPI.GetSmartOrderComments)(w, r)
+			case http.MethodPost:
+				authMiddleware.RequireAuth(idempotent(smartOrderAPI.AddSmartOrderComment))(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
 		case strings.Contains(path, "/complete"):
 			if r.Method == http.MethodPut {
-				authMiddleware.RequireModerator(smartOrderAPI.CompleteSmartOrder)(w, r)
+				authMiddleware.RequireModerator(idempotent(smartOrderAPI.CompleteSmartOrder))(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case strings.Contains(path, "/reject"):
+			if r.Method == http.MethodPut {
+				authMiddleware.RequireModerator(idempotent(smartOrderAPI.RejectSmartOrder))(w, r)
 			} else {
 				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			}
 		case strings.Contains(path, "/form"):
 			if r.Method == http.MethodPut {
-				authMiddleware.RequireAuth(smartOrderAPI.FormSmartOrder)(w, r)
+				authMiddleware.RequireAuth(idempotent(smartOrderAPI.FormSmartOrder))(w, r)
 			} else {
 				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			}
@@ -132,7 +430,7 @@ func main() {
 			case http.MethodGet:
 				authMiddleware.RequireAuth(smartOrderAPI.GetSmartOrder)(w, r)
 			case http.MethodPut:
-				authMiddleware.RequireAuth(smartOrderAPI.UpdateSmartOrder)(w, r)
+				authMiddleware.RequireAuth(idempotent(smartOrderAPI.UpdateSmartOrder))(w, r)
 			case http.MethodDelete:
 				authMiddleware.RequireAuth(smartOrderAPI.DeleteSmartOrder)(w, r)
 			default:
@@ -143,9 +441,26 @@ func main() {
 
 	// API маршруты - Order Items
 	http.HandleFunc("/api/order-items/", func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+
+		// Строки заявки: /api/order-items/lines/{lineId}[/split]
+		if strings.HasPrefix(path, "/api/order-items/lines/") {
+			switch {
+			case strings.HasSuffix(path, "/split") && r.Method == http.MethodPost:
+				authMiddleware.RequireAuth(idempotent(orderItemAPI.SplitOrderLine))(w, r)
+			case r.Method == http.MethodPut:
+				authMiddleware.RequireAuth(idempotent(orderItemAPI.UpdateOrderLine))(w, r)
+			case r.Method == http.MethodDelete:
+				authMiddleware.RequireAuth(orderItemAPI.DeleteOrderLine)(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
 		switch r.Method {
 		case http.MethodPut:
-			authMiddleware.RequireAuth(orderItemAPI.UpdateOrderItem)(w, r)
+			authMiddleware.RequireAuth(idempotent(orderItemAPI.UpdateOrderItem))(w, r)
 		case http.MethodDelete:
 			authMiddleware.RequireAuth(orderItemAPI.DeleteOrderItem)(w, r)
 		default:
@@ -157,16 +472,149 @@ func main() {
 	http.HandleFunc("/api/clients/login", clientAPI.Login)
 	http.HandleFunc("/api/clients/logout", clientAPI.Logout)
 	http.HandleFunc("/api/clients/register", clientAPI.CreateClient)
-	http.HandleFunc("/api/clients/update", authMiddleware.RequireAuth(clientAPI.UpdateClient))
+	http.HandleFunc("/api/clients/update", authMiddleware.RequireAuth(idempotent(clientAPI.UpdateClient)))
+
+	// API маршруты - адресная книга клиента
+	http.HandleFunc("/api/clients/addresses", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			authMiddleware.RequireAuth(clientAddressAPI.GetAddresses)(w, r)
+		case http.MethodPost:
+			authMiddleware.RequireAuth(idempotent(clientAddressAPI.CreateAddress))(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	http.HandleFunc("/api/clients/addresses/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			authMiddleware.RequireAuth(idempotent(clientAddressAPI.UpdateAddress))(w, r)
+		case http.MethodDelete:
+			authMiddleware.RequireAuth(clientAddressAPI.DeleteAddress)(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
 	http.HandleFunc("/api/clients/", authMiddleware.RequireModerator(clientAPI.GetClient))
 	http.HandleFunc("/api/clients", authMiddleware.RequireModerator(clientAPI.GetClients))
 
+	// API маршруты - аналитика для модераторов
+	http.HandleFunc("/api/stats/orders", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			authMiddleware.RequireModerator(statsAPI.GetOrdersByStatus)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	http.HandleFunc("/api/stats/processing-time", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			authMiddleware.RequireModerator(statsAPI.GetProcessingTime)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	http.HandleFunc("/api/stats/traffic", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			authMiddleware.RequireModerator(statsAPI.GetTrafficStats)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	http.HandleFunc("/api/stats/top-devices", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			authMiddleware.RequireModerator(statsAPI.GetTopDevices)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	http.HandleFunc("/api/stats/moderators", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			authMiddleware.RequireModerator(statsAPI.GetModeratorThroughput)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// API маршруты - поток событий (SSE)
+	http.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			authMiddleware.RequireAuth(eventsAPI.StreamEvents)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// API маршруты - уведомления пользователя
+	http.HandleFunc("/api/notifications", authMiddleware.RequireAuth(notificationAPI.GetNotifications))
+	http.HandleFunc("/api/notifications/", func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		switch {
+		case path == "/api/notifications/unread-count" && r.Method == http.MethodGet:
+			authMiddleware.RequireAuth(notificationAPI.GetUnreadCount)(w, r)
+		case path == "/api/notifications/read-all" && r.Method == http.MethodPost:
+			authMiddleware.RequireAuth(idempotent(notificationAPI.MarkAllRead))(w, r)
+		case path == "/api/notifications/preferences" && r.Method == http.MethodGet:
+			authMiddleware.RequireAuth(notificationAPI.GetPreferences)(w, r)
+		case path == "/api/notifications/preferences" && r.Method == http.MethodPut:
+			authMiddleware.RequireAuth(notificationAPI.UpdatePreferences)(w, r)
+		case strings.HasSuffix(path, "/read") && r.Method == http.MethodPost:
+			authMiddleware.RequireAuth(idempotent(notificationAPI.MarkRead))(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// API маршруты - подписки на webhooks (модератор)
+	http.HandleFunc("/api/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			authMiddleware.RequireModerator(webhookAPI.GetSubscriptions)(w, r)
+		case http.MethodPost:
+			authMiddleware.RequireModerator(idempotent(webhookAPI.CreateSubscription))(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	http.HandleFunc("/api/webhooks/", func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		switch {
+		case strings.HasPrefix(path, "/api/webhooks/deliveries/"):
+			switch {
+			case strings.HasSuffix(path, "/replay") && r.Method == http.MethodPost:
+				authMiddleware.RequireModerator(idempotent(webhookAPI.ReplayDelivery))(w, r)
+			case !strings.HasSuffix(path, "/replay") && r.Method == http.MethodGet:
+				authMiddleware.RequireModerator(webhookAPI.GetDelivery)(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case strings.HasSuffix(path, "/deliveries"):
+			if r.Method == http.MethodGet {
+				authMiddleware.RequireModerator(webhookAPI.GetDeliveries)(w, r)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		default:
+			switch r.Method {
+			case http.MethodGet:
+				authMiddleware.RequireModerator(webhookAPI.GetSubscription)(w, r)
+			case http.MethodPut:
+				authMiddleware.RequireModerator(idempotent(webhookAPI.UpdateSubscription))(w, r)
+			case http.MethodDelete:
+				authMiddleware.RequireModerator(webhookAPI.DeleteSubscription)(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		}
+	})
+
 	log.Println("🚀 Сервер запущен на http://localhost:8080")
 	log.Println("📱 HTML интерфейс доступен")
 	log.Println("🔐 Auth system initialized")
 	log.Println("🍪 Session storage: Redis")
 	log.Println("👥 User roles: client/moderator")
 	log.Println("🔮 Redis Lua scripts enabled")
+	log.Printf("🔁 Idempotency-Key window: %s", idempotencyTTL)
 
 	log.Println("🔐 Auth API:")
 	log.Println("   POST   /api/auth/login              - аутентификация")
@@ -177,37 +625,175 @@ func main() {
 	log.Println("   GET    /api/auth/session-stats      - статистика сессий через Lua (модератор)")
 
 	log.Println("📦 Smart Devices API:")
-	log.Println("   GET    /api/smart-devices           - список устройств")
+	log.Println("   GET    /api/smart-devices           - список устройств (limit/cursor/sort)")
 	log.Println("   GET    /api/smart-devices/{id}      - устройство по ID")
 	log.Println("   POST   /api/smart-devices           - создать устройство (модератор)")
 	log.Println("   PUT    /api/smart-devices/{id}      - обновить устройство (модератор)")
 	log.Println("   DELETE /api/smart-devices/{id}      - удалить устройство (модератор)")
-	log.Println("   POST   /api/smart-devices/{id}/image - загрузить картинку (модератор)")
-	log.Println("   DELETE /api/smart-devices/{id}/image - удалить картинку (модератор)")
+	log.Println("   POST   /api/smart-devices/{id}/image - загрузить основную картинку (модератор)")
+	log.Println("   DELETE /api/smart-devices/{id}/image - удалить основную картинку (модератор)")
+	log.Println("   GET    /api/smart-devices/{id}/images - галерея устройства")
+	log.Println("   POST   /api/smart-devices/{id}/images - добавить изображение (модератор)")
+	log.Println("   PUT    /api/smart-devices/{id}/images/order - порядок галереи (модератор)")
+	log.Println("   PUT    /api/smart-devices/{id}/images/{imageId} - подпись/основное (модератор)")
+	log.Println("   DELETE /api/smart-devices/{id}/images/{imageId} - удалить изображение (модератор)")
+	log.Println("   POST   /api/smart-devices/{id}/images/uploads - ссылка для загрузки в MinIO (модератор)")
+	log.Println("   POST   /api/smart-devices/{id}/images/uploads/{uploadId}/confirm - подтвердить загрузку (модератор)")
+	log.Println("   GET    /api/images/{name}           - файл изображения (прокси или редирект)")
+	log.Println("   POST   /api/smart-devices/import    - импорт csv/json по модели, dry_run (модератор)")
+	log.Println("   GET    /api/smart-devices/export    - выгрузка каталога csv/json (модератор)")
+	log.Println("   GET    /api/smart-devices/{id}/revisions - история изменений (модератор)")
+	log.Println("   GET    /api/smart-devices/{id}/revisions/diff - отличия ревизий from/to (модератор)")
+	log.Println("   POST   /api/smart-devices/{id}/revisions/{rev}/revert - откат к ревизии (модератор)")
+
+	log.Println("🗂️ Categories & Tags API:")
+	log.Println("   GET    /api/categories              - дерево категорий")
+	log.Println("   GET    /api/categories/{id}         - категория с подкатегориями")
+	log.Println("   POST   /api/categories              - создать категорию (модератор)")
+	log.Println("   PUT    /api/categories/{id}         - изменить/перенести категорию (модератор)")
+	log.Println("   DELETE /api/categories/{id}         - удалить пустую категорию (модератор)")
+	log.Println("   GET    /api/tags                    - метки с количеством устройств")
+	log.Println("   POST   /api/tags                    - создать метку (модератор)")
+	log.Println("   PUT    /api/tags/{id}               - переименовать метку (модератор)")
+	log.Println("   DELETE /api/tags/{id}               - удалить метку (модератор)")
 
 	log.Println("📋 Smart Orders API:")
 	log.Println("   GET    /api/smart-orders/cart       - корзина (требует auth)")
-	log.Println("   GET    /api/smart-orders            - список заявок (требует auth)")
+	log.Println("   GET    /api/smart-orders            - список заявок (limit/cursor/sort, требует auth)")
 	log.Println("   GET    /api/smart-orders/{id}       - заявка по ID (требует auth)")
+	log.Println("   GET    /api/smart-orders/export     - выгрузка заявок csv/xlsx (требует auth)")
+	log.Println("   GET    /api/smart-orders/{id}/document.pdf - наряд на установку (требует auth)")
+	log.Println("   GET    /api/smart-orders/{id}/history - история статусов (требует auth)")
+	log.Println("   GET    /api/smart-orders/{id}/comments - комментарии к заявке (требует auth)")
+	log.Println("   POST   /api/smart-orders/{id}/comments - добавить комментарий (требует auth)")
 	log.Println("   PUT    /api/smart-orders/{id}       - обновить заявку (требует auth)")
 	log.Println("   PUT    /api/smart-orders/{id}/form  - сформировать заявку (требует auth)")
 	log.Println("   PUT    /api/smart-orders/{id}/complete - завершить заявку (модератор)")
+	log.Println("   PUT    /api/smart-orders/{id}/reject - отклонить заявку (модератор)")
+	log.Println("   POST   /api/smart-orders/bulk       - массовое завершение/отклонение (модератор)")
 	log.Println("   DELETE /api/smart-orders/{id}       - удалить заявку (требует auth)")
 
 	log.Println("🛒 Order Items API:")
 	log.Println("   PUT    /api/order-items/{deviceId}  - изменить количество (требует auth)")
 	log.Println("   DELETE /api/order-items/{deviceId}  - удалить из заявки (требует auth)")
+	log.Println("   PUT    /api/order-items/lines/{id}  - изменить строку: помещение, примечание, настройки (черновик)")
+	log.Println("   POST   /api/order-items/lines/{id}/split - разбить строку по помещениям (черновик)")
+	log.Println("   DELETE /api/order-items/lines/{id}  - удалить строку (черновик)")
 
 	log.Println("👥 Clients API:")
-	log.Println("   GET    /api/clients                 - список клиентов (модератор)")
+	log.Println("   GET    /api/clients                 - список клиентов (limit/cursor/sort, модератор)")
 	log.Println("   GET    /api/clients/{id}            - клиент по ID (модератор)")
 	log.Println("   POST   /api/clients/register        - регистрация")
 	log.Println("   PUT    /api/clients/update          - обновить данные (требует auth)")
 	log.Println("   POST   /api/clients/login           - аутентификация")
 	log.Println("   POST   /api/clients/logout          - деавторизация")
 
-	log.Println("🎯 Всего методов: 28")
+	log.Println("🏠 Client Addresses API:")
+	log.Println("   GET    /api/clients/addresses       - адресная книга (требует auth)")
+	log.Println("   POST   /api/clients/addresses       - добавить адрес (требует auth)")
+	log.Println("   PUT    /api/clients/addresses/{id}  - изменить адрес (требует auth)")
+	log.Println("   DELETE /api/clients/addresses/{id}  - удалить адрес (требует auth)")
+
+	log.Println("📊 Stats API (модератор, фильтры date_from/date_to):")
+	log.Println("   GET    /api/stats/orders            - заявки по статусам (period=day|week|month)")
+	log.Println("   GET    /api/stats/processing-time   - среднее время обработки")
+	log.Println("   GET    /api/stats/traffic           - суммарный и средний трафик")
+	log.Println("   GET    /api/stats/top-devices       - популярные устройства")
+	log.Println("   GET    /api/stats/moderators        - производительность модераторов")
+	log.Println("📡 Events API:")
+	log.Println("   GET    /api/events                  - поток SSE: статусы заявок, корзина, новые заявки (модератор)")
+	log.Println("🔔 Notifications API (требует auth):")
+	log.Println("   GET    /api/notifications           - входящие (unread, type, limit/cursor)")
+	log.Println("   GET    /api/notifications/unread-count - количество непрочитанных")
+	log.Println("   POST   /api/notifications/{id}/read - отметить прочитанным")
+	log.Println("   POST   /api/notifications/read-all  - отметить все прочитанными")
+	log.Println("   GET    /api/notifications/preferences - включенные типы уведомлений")
+	log.Println("   PUT    /api/notifications/preferences - отключить/включить типы")
+	log.Println("🔗 Webhooks API (модератор):")
+	log.Println("   GET    /api/webhooks                - список подписок")
+	log.Println("   POST   /api/webhooks                - создать подписку (url, events, secret)")
+	log.Println("   GET    /api/webhooks/{id}           - подписка по ID")
+	log.Println("   PUT    /api/webhooks/{id}           - изменить подписку")
+	log.Println("   DELETE /api/webhooks/{id}           - удалить подписку")
+	log.Println("   GET    /api/webhooks/{id}/deliveries - журнал доставок (status, event)")
+	log.Println("   GET    /api/webhooks/deliveries/{id} - доставка с попытками")
+	log.Println("   POST   /api/webhooks/deliveries/{id}/replay - повторная отправка")
+
+	log.Println("🎯 Всего методов: 82")
 
 	// ⚠️ ЭТА СТРОЧКА ОБЯЗАТЕЛЬНА! - запускает HTTP сервер
 	http.ListenAndServe(":8080", nil)
 }
+
+// migrateOrderItemKey переводит order_items с ключа (order_id, device_id) на суррогатный id,
+// чтобы одно устройство можно было разбить на несколько строк с разными помещениями
+func migrateOrderItemKey(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.OrderItem{}) || migrator.HasColumn(&models.OrderItem{}, "id") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE order_items DROP CONSTRAINT IF EXISTS order_items_pkey").Error; err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE order_items ADD COLUMN id BIGSERIAL PRIMARY KEY").Error
+	})
+}
+
+// migrateDeviceSearch добавляет сгенерированную колонку search_vector и GIN-индекс.
+// Колонки нет в модели: Postgres сам пересчитывает ее при любом изменении устройства.
+func migrateDeviceSearch(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("ALTER TABLE smart_devices ADD COLUMN IF NOT EXISTS search_vector tsvector " +
+			"GENERATED ALWAYS AS (" + search.VectorSQL + ") STORED").Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec("CREATE INDEX IF NOT EXISTS idx_smart_devices_search ON smart_devices USING GIN (search_vector)").Error
+	})
+}
+
+// migrateDeviceImages переносит namespace_url устройств без галереи в device_images.
+// Файлы из bucket image получают имя объекта, внешние ссылки остаются только URL.
+func migrateDeviceImages(db *gorm.DB) error {
+	return db.Exec(`INSERT INTO device_images (device_id, object_name, url, alt_text, sort_order, is_primary, created_at)
+		SELECT d.id,
+			CASE WHEN d.namespace_url LIKE 'http://localhost:9000/image/%' THEN substring(d.namespace_url FROM '[^/]+$') ELSE '' END,
+			d.namespace_url, d.name, 0, true, now()
+		FROM smart_devices d
+		WHERE d.namespace_url <> ''
+			AND NOT EXISTS (SELECT 1 FROM device_images i WHERE i.device_id = d.id)`).Error
+}
+
+// migrateImageURLs переводит ссылки на файлы bucket на адрес prefix+имя объекта
+// и синхронизирует namespace_url устройств с основным изображением
+func migrateImageURLs(db *gorm.DB, prefix string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		columns := [][2]string{{"url", "object_name"}, {"medium_url", "medium_object"}, {"thumbnail_url", "thumbnail_object"}}
+		for _, column := range columns {
+			err := tx.Exec(fmt.Sprintf("UPDATE device_images SET %[1]s = ? || %[2]s WHERE %[2]s <> '' AND %[1]s <> ? || %[2]s",
+				column[0], column[1]), prefix, prefix).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Exec(`UPDATE smart_devices d SET namespace_url = i.url, version = d.version + 1
+			FROM device_images i
+			WHERE i.device_id = d.id AND i.is_primary AND d.namespace_url <> i.url`).Error
+	})
+}
+
+// durationFromEnv читает длительность из переменной окружения (например "24h")
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("⚠️ Invalid %s=%q, using %s", name, value, fallback)
+		return fallback
+	}
+	return d
+}
@@ -1,6 +1,6 @@
 import React, { useState, useEffect, useRef } from 'react';
 import { Container, Row, Col, Form, Spinner, Alert } from 'react-bootstrap';
-import type { SmartDevice } from '../types';
+import type { SmartDevice, Page } from '../types';
 import DeviceList from '../components/Devices/DeviceList';
 
 const DevicesPage: React.FC = () => {
@@ -19,7 +19,7 @@ const DevicesPage: React.FC = () => {
       setLoading(true);
       setError(null);
       
-      const queryParams = new URLSearchParams();
+      const queryParams = new URLSearchParams({ limit: '100' });
       if (search && search.trim() !== '') {
         queryParams.append('search', search.trim());
       }
@@ -29,8 +29,8 @@ const DevicesPage: React.FC = () => {
       
       if (!response.ok) throw new Error('Failed to load devices');
       
-      const devicesData = await response.json();
-      setDevices(devicesData);
+      const page: Page<SmartDevice> = await response.json();
+      setDevices(page.items);
     } catch (err) {
       setError(err instanceof Error ? err.message : 'Failed to load devices');
       // Mock данные для демонстрации
@@ -61,6 +61,7 @@ const DevicesPage: React.FC = () => {
         id: 1,
         name: 'Умная лампочка',
         model: 'Яндекс, E27',
+        vendor: 'Яндекс',
         avg_data_rate: 8,
         data_per_hour: 0.5,
         namespace_url: '',
@@ -68,12 +69,23 @@ const DevicesPage: React.FC = () => {
         description_all: 'Умная Яндекс лампочка позволяет дистанционно управлять освещением',
         protocol: 'Wi-Fi',
         is_active: true,
+        stock_quantity: 0,
+        reserved_quantity: 0,
+        available_quantity: 0,
+        in_stock: false,
+        category: null,
+        tags: [],
+        specs: {},
+        images: [],
+        thumbnail_url: '',
+        medium_url: '',
         created_at: new Date().toISOString()
       },
       {
         id: 2,
         name: 'Умная розетка', 
         model: 'YNDX-00340',
+        vendor: 'Яндекс',
         avg_data_rate: 2,
         data_per_hour: 0.1,
         namespace_url: '',
@@ -81,12 +93,23 @@ const DevicesPage: React.FC = () => {
         description_all: 'Умная розетка для дистанционного управления электроприборами',
         protocol: 'Wi-Fi',
         is_active: true,
+        stock_quantity: 0,
+        reserved_quantity: 0,
+        available_quantity: 0,
+        in_stock: false,
+        category: null,
+        tags: [],
+        specs: {},
+        images: [],
+        thumbnail_url: '',
+        medium_url: '',
         created_at: new Date().toISOString()
       },
       {
         id: 3,
         name: 'Датчик движения',
         model: 'Aqara Motion Sensor P1',
+        vendor: 'Aqara',
         avg_data_rate: 5,
         data_per_hour: 0.3,
         namespace_url: '',
@@ -94,12 +117,23 @@ const DevicesPage: React.FC = () => {
         description_all: 'Беспроводной датчик движения для автоматизации освещения',
         protocol: 'Zigbee',
         is_active: true,
+        stock_quantity: 0,
+        reserved_quantity: 0,
+        available_quantity: 0,
+        in_stock: false,
+        category: null,
+        tags: [],
+        specs: {},
+        images: [],
+        thumbnail_url: '',
+        medium_url: '',
         created_at: new Date().toISOString()
       },
       {
         id: 4,
         name: 'Умный выключатель',
         model: 'Яндекс, 2 клавиши',
+        vendor: 'Яндекс',
         avg_data_rate: 3,
         data_per_hour: 0.2,
         namespace_url: '',
@@ -107,6 +141,16 @@ const DevicesPage: React.FC = () => {
         description_all: 'Беспроводной выключатель для управления умным освещением',
         protocol: 'Bluetooth',
         is_active: true,
+        stock_quantity: 0,
+        reserved_quantity: 0,
+        available_quantity: 0,
+        in_stock: false,
+        category: null,
+        tags: [],
+        specs: {},
+        images: [],
+        thumbnail_url: '',
+        medium_url: '',
         created_at: new Date().toISOString()
       }
     ];
@@ -1,7 +1,21 @@
-import type { SmartDevice, SmartOrder, Client, DeviceFilter } from '../types';
+import type { SmartDevice, SmartOrder, Client, DeviceFilter, Page } from '../types';
 
 const API_BASE_URL = '/api'; // Прокси через Vite
 
+// Списки API отдаются страницами (не больше 100 записей) - проходим по next_cursor до конца
+async function fetchAllPages<T>(path: string, params: URLSearchParams = new URLSearchParams()): Promise<T[]> {
+  params.set('limit', '100');
+  const items: T[] = [];
+  for (;;) {
+    const response = await fetch(`${API_BASE_URL}${path}?${params.toString()}`);
+    if (!response.ok) throw new Error(`Failed to fetch ${path}`);
+    const page: Page<T> = await response.json();
+    items.push(...page.items);
+    if (!page.next_cursor) return items;
+    params.set('cursor', page.next_cursor);
+  }
+}
+
 export const api = {
   // ===== DEVICES =====
   async getDevices(filters?: DeviceFilter): Promise<SmartDevice[]> {
@@ -9,12 +23,8 @@ export const api = {
     if (filters?.search) queryParams.append('search', filters.search);
     if (filters?.protocol) queryParams.append('protocol', filters.protocol);
 
-    const url = `${API_BASE_URL}/smart-devices${queryParams.toString() ? `?${queryParams.toString()}` : ''}`;
-    
     try {
-      const response = await fetch(url);
-      if (!response.ok) throw new Error('Failed to fetch devices');
-      return response.json();
+      return await fetchAllPages<SmartDevice>('/smart-devices', queryParams);
     } catch (error) {
       console.error('API error, using mock data:', error);
       // Mock данные для демонстрации
@@ -23,6 +33,7 @@ export const api = {
           id: 1,
           name: 'Умная лампочка',
           model: 'Яндекс, E27',
+          vendor: 'Яндекс',
           avg_data_rate: 8,
           data_per_hour: 0.5,
           namespace_url: '',
@@ -30,12 +41,23 @@ export const api = {
           description_all: 'Умная Яндекс лампочка позволяет дистанционно управлять освещением',
           protocol: 'Wi-Fi',
           is_active: true,
+          stock_quantity: 0,
+          reserved_quantity: 0,
+          available_quantity: 0,
+          in_stock: false,
+          category: null,
+          tags: [],
+          specs: {},
+          images: [],
+          thumbnail_url: '',
+          medium_url: '',
           created_at: new Date().toISOString()
         },
         {
           id: 2,
           name: 'Умная розетка',
           model: 'YNDX-00340',
+          vendor: 'Яндекс',
           avg_data_rate: 2,
           data_per_hour: 0.1,
           namespace_url: '',
@@ -43,6 +65,16 @@ export const api = {
           description_all: 'Умная розетка для дистанционного управления электроприборами',
           protocol: 'Wi-Fi',
           is_active: true,
+          stock_quantity: 0,
+          reserved_quantity: 0,
+          available_quantity: 0,
+          in_stock: false,
+          category: null,
+          tags: [],
+          specs: {},
+          images: [],
+          thumbnail_url: '',
+          medium_url: '',
           created_at: new Date().toISOString()
         }
       ];
@@ -61,6 +93,7 @@ export const api = {
         id,
         name: 'Mock Device',
         model: 'Mock Model',
+        vendor: 'Mock',
         avg_data_rate: 10,
         data_per_hour: 1,
         namespace_url: '',
@@ -68,6 +101,16 @@ export const api = {
         description_all: 'Mock full description',
         protocol: 'Wi-Fi',
         is_active: true,
+        stock_quantity: 0,
+        reserved_quantity: 0,
+        available_quantity: 0,
+        in_stock: false,
+        category: null,
+        tags: [],
+        specs: {},
+        images: [],
+        thumbnail_url: '',
+        medium_url: '',
         created_at: new Date().toISOString()
       };
     }
@@ -76,9 +119,7 @@ export const api = {
   // ===== ORDERS =====
   async getOrders(): Promise<SmartOrder[]> {
     try {
-      const response = await fetch(`${API_BASE_URL}/smart-orders`);
-      if (!response.ok) throw new Error('Failed to fetch orders');
-      return response.json();
+      return await fetchAllPages<SmartOrder>('/smart-orders');
     } catch (error) {
       console.error('API error:', error);
       return [];
@@ -88,9 +129,7 @@ export const api = {
   // ===== CLIENTS =====
   async getClients(): Promise<Client[]> {
     try {
-      const response = await fetch(`${API_BASE_URL}/clients`);
-      if (!response.ok) throw new Error('Failed to fetch clients');
-      return response.json();
+      return await fetchAllPages<Client>('/clients');
     } catch (error) {
       console.error('API error:', error);
       return [];
@@ -2,6 +2,7 @@ export interface SmartDevice {
   id: number;
   name: string;
   model: string;
+  vendor: string;
   avg_data_rate: number;
   data_per_hour: number;
   namespace_url: string;
@@ -10,6 +11,36 @@ export interface SmartDevice {
   protocol: string;
   is_active: boolean;
   created_at: string;
+  stock_quantity: number;
+  reserved_quantity: number;
+  available_quantity: number;
+  in_stock: boolean;
+  category: CategoryRef | null;
+  tags: string[];
+  specs: Record<string, string | number | boolean>;
+  images: DeviceImage[];
+  thumbnail_url: string;
+  medium_url: string;
+}
+
+export interface DeviceImage {
+  id: number;
+  url: string;
+  alt_text: string;
+  sort_order: number;
+  is_primary: boolean;
+  created_at: string;
+  thumbnail_url: string;
+  medium_url: string;
+  content_type?: string;
+  width: number;
+  height: number;
+}
+
+export interface CategoryRef {
+  id: number;
+  slug: string;
+  name: string;
 }
 
 export interface SmartOrder {
@@ -45,4 +76,35 @@ export interface Client {
 export interface DeviceFilter {
   search?: string;
   protocol?: string;
-}
\ No newline at end of file
+}
+
+// Фасеты каталога: счетчики для панели фильтров
+export interface FacetValue {
+  value: string;
+  count: number;
+}
+
+export interface RangeFacet {
+  min: number | null;
+  max: number | null;
+  buckets: { from: number; to: number | null; count: number }[];
+}
+
+export interface DeviceFacets {
+  protocol: FacetValue[];
+  vendor: FacetValue[];
+  avg_data_rate: RangeFacet;
+  data_per_hour: RangeFacet;
+}
+
+// Постраничный ответ списков API
+export interface Page<T> {
+  items: T[];
+  next_cursor: string | null;
+  total: number;
+}
+
+// Страница каталога с фасетами по всей выборке
+export interface CatalogPage extends Page<SmartDevice> {
+  facets: DeviceFacets;
+}